@@ -1,5 +1,12 @@
 package action
 
+import (
+	"fmt"
+	"time"
+
+	"github.com/fako1024/brew/db"
+)
+
 // Category denotes a category of action performed on the coffee machine
 type Category = string
 
@@ -45,6 +52,7 @@ const (
 	DescaleFull = "descale_full"
 )
 
+// categories denotes the built-in types and their categories
 var categories = map[Type]Category{
 	NewCoffeePack:              Generic,
 	BackFlush:                  Maintenance,
@@ -56,12 +64,47 @@ var categories = map[Type]Category{
 
 // Categories returns a list of all types and their categories
 func Categories() map[Type]Category {
-	return categories
+	definitionsMu.RLock()
+	defer definitionsMu.RUnlock()
+
+	types := make(map[Type]Category, len(definitions))
+	for t, def := range definitions {
+		types[t] = def.Category
+	}
+
+	return types
 }
 
 // Categorize checks and returns if a type is valid (and its category)
 func Categorize(t Type) (category Category, isValid bool) {
-	category, isValid = categories[t]
+	def, isValid := Lookup(t)
+
+	return def.Category, isValid
+}
 
-	return
+// NewDataPoint generates a database data point recording an action of the given type,
+// including any additional fields
+func NewDataPoint(t Type, ts time.Time, fields map[string]interface{}) (db.DataPoint, error) {
+
+	def, isValid := Lookup(t)
+	if !isValid {
+		return db.DataPoint{}, fmt.Errorf("invalid action type: %s", t)
+	}
+
+	data := map[string]interface{}{
+		"type":     def.Label,
+		"category": label(def.Category),
+	}
+	for k, v := range fields {
+		data[k] = v
+	}
+
+	return db.DataPoint{
+		TimeStamp: ts,
+		Data:      data,
+		Tags: map[string]string{
+			"action_type":     t,
+			"action_category": def.Category,
+		},
+	}, nil
 }
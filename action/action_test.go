@@ -24,3 +24,43 @@ func TestCategories(t *testing.T) {
 		}
 	}
 }
+
+func TestRegister(t *testing.T) {
+	defer func() {
+		definitions = builtinDefinitions()
+	}()
+
+	if err := Register(
+		Definition{Type: "water_filter_change", Category: Maintenance, Params: []string{"product"}},
+		Definition{Type: "gasket_replacement", Category: "repair", Label: "Gasket Replacement"},
+	); err != nil {
+		t.Fatalf("Failed to register action types: %s", err)
+	}
+
+	if category, isValid := Categorize("gasket_replacement"); !isValid || category != "repair" {
+		t.Fatalf("Unexpected category for custom type: %s (valid: %v)", category, isValid)
+	}
+	if def, _ := Lookup("water_filter_change"); def.Label != "Water Filter Change" {
+		t.Fatalf("Unexpected derived label: %s", def.Label)
+	}
+	if _, isValid := Categorize(BackFlush); !isValid {
+		t.Fatalf("Built-in type no longer valid after registering custom types")
+	}
+	if len(Definitions()) != len(categories)+2 {
+		t.Fatalf("Unexpected number of definitions: %d", len(Definitions()))
+	}
+
+	if err := Validate("water_filter_change", nil); err == nil {
+		t.Fatalf("Expected error for missing required parameter")
+	}
+	if err := Validate("water_filter_change", map[string]string{"product": "Brita Purity C300"}); err != nil {
+		t.Fatalf("Unexpected error for valid parameters: %s", err)
+	}
+
+	if err := Register(Definition{Type: "invalid"}, Definition{Category: Generic}); err == nil {
+		t.Fatalf("Expected error for invalid definitions")
+	}
+	if _, isValid := Categorize("invalid"); isValid {
+		t.Fatalf("Unexpected valid type after failed registration")
+	}
+}
@@ -0,0 +1,147 @@
+package action
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Definition denotes the definition of a type of action
+type Definition struct {
+	Type     Type          // Type of the action
+	Category Category      // Category of the action
+	Label    string        // Human readable label (derived from the type if empty)
+	Interval time.Duration // Interval after which the action should be repeated (0: not recurring)
+	Params   []string      // Parameters required when recording the action (e.g. descaler product)
+}
+
+var (
+	definitions   = builtinDefinitions()
+	definitionsMu sync.RWMutex
+)
+
+// builtinDefinitions returns the definitions of all built-in types
+func builtinDefinitions() map[Type]Definition {
+	defs := make(map[Type]Definition, len(categories))
+	for t, category := range categories {
+		defs[t] = Definition{
+			Type:     t,
+			Category: category,
+			Label:    label(t),
+		}
+	}
+
+	return defs
+}
+
+// Register adds (or overrides) definitions of action types
+func Register(defs ...Definition) error {
+
+	var errs []error
+	for i, def := range defs {
+		if err := def.validate(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if def.Label == "" {
+			defs[i].Label = label(def.Type)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	definitionsMu.Lock()
+	defer definitionsMu.Unlock()
+
+	for _, def := range defs {
+		definitions[def.Type] = def
+	}
+
+	return nil
+}
+
+// Lookup returns the definition of a type (and if it is valid)
+func Lookup(t Type) (def Definition, isValid bool) {
+	definitionsMu.RLock()
+	defer definitionsMu.RUnlock()
+
+	def, isValid = definitions[t]
+
+	return
+}
+
+// Definitions returns the definitions of all types (ordered by category and type)
+func Definitions() []Definition {
+	definitionsMu.RLock()
+	defer definitionsMu.RUnlock()
+
+	defs := make([]Definition, 0, len(definitions))
+	for _, def := range definitions {
+		defs = append(defs, def)
+	}
+	sort.Slice(defs, func(i, j int) bool {
+		if defs[i].Category != defs[j].Category {
+			return defs[i].Category < defs[j].Category
+		}
+		return defs[i].Type < defs[j].Type
+	})
+
+	return defs
+}
+
+// Validate checks if a type is valid and all its required parameters are provided
+func Validate(t Type, params map[string]string) error {
+
+	def, isValid := Lookup(t)
+	if !isValid {
+		return fmt.Errorf("invalid action type: %s", t)
+	}
+
+	var missing []string
+	for _, param := range def.Params {
+		if params[param] == "" {
+			missing = append(missing, param)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required parameter(s) for action type %s: %s", t, strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+func (d Definition) validate() error {
+	if d.Type == "" {
+		return errors.New("no action type specified")
+	}
+	if d.Category == "" {
+		return fmt.Errorf("action type %s: no category specified", d.Type)
+	}
+	if d.Interval < 0 {
+		return fmt.Errorf("action type %s: negative interval", d.Type)
+	}
+	for _, param := range d.Params {
+		if param == "" {
+			return fmt.Errorf("action type %s: empty parameter name", d.Type)
+		}
+	}
+
+	return nil
+}
+
+// label generates a human readable label from a type / category (e.g. "back_flush" -> "Back Flush")
+func label(s string) string {
+	words := strings.Fields(strings.ReplaceAll(s, "_", " "))
+	for i, word := range words {
+		r, size := utf8.DecodeRuneInString(word)
+		words[i] = string(unicode.ToUpper(r)) + word[size:]
+	}
+
+	return strings.Join(words, " ")
+}
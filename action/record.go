@@ -0,0 +1,232 @@
+package action
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fako1024/brew/db"
+)
+
+// Measurement denotes the measurement holding all recorded actions
+const Measurement = "actions"
+
+const paramPrefix = "param_"
+
+// ErrNotFound denotes that a requested action record does not exist
+var ErrNotFound = errors.New("action not found")
+
+// Record denotes an action performed on the coffee machine
+type Record struct {
+	Type      Type              `json:"type"`
+	Category  Category          `json:"category"`
+	TimeStamp time.Time         `json:"time"`
+	Notes     string            `json:"notes,omitempty"`
+	Params    map[string]string `json:"params,omitempty"`
+}
+
+// ID returns the identifier of the record (derived from its type and time stamp, which
+// uniquely identify an action)
+func (r Record) ID() string {
+	return r.Type + "@" + strconv.FormatInt(r.TimeStamp.UnixMilli(), 10)
+}
+
+// parseID extracts the type and time stamp from a record identifier
+func parseID(id string) (Type, time.Time, error) {
+	sep := strings.LastIndex(id, "@")
+	if sep <= 0 {
+		return "", time.Time{}, fmt.Errorf("invalid action ID: %s", id)
+	}
+	ms, err := strconv.ParseInt(id[sep+1:], 10, 64)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid action ID: %s", id)
+	}
+
+	return id[:sep], time.UnixMilli(ms), nil
+}
+
+// Filter denotes criteria to select action records
+type Filter struct {
+	Category Category  // Category of the actions (all if empty)
+	Type     Type      // Type of the actions (all if empty)
+	Start    time.Time // Earliest time of the actions (inclusive, unbounded if zero)
+	End      time.Time // Latest time of the actions (exclusive, unbounded if zero)
+}
+
+// Store provides access to action records stored in a database
+type Store struct {
+	db     db.DB
+	dbName string
+}
+
+// NewStore instantiates a new action store backed by the provided database
+func NewStore(db db.DB, dbName string) *Store {
+	return &Store{
+		db:     db,
+		dbName: dbName,
+	}
+}
+
+// Add records a new action
+func (s *Store) Add(r Record) (Record, error) {
+
+	dataPoint, err := r.dataPoint()
+	if err != nil {
+		return r, err
+	}
+	r.Category = dataPoint.Tags["action_category"]
+
+	if err := s.db.EmitDataPoints(s.dbName, Measurement, db.DataPoints{dataPoint}); err != nil {
+		return r, fmt.Errorf("failed to add action: %w", err)
+	}
+
+	return r, nil
+}
+
+// List returns all action records matching the filter (ordered by time)
+func (s *Store) List(filter Filter) ([]Record, error) {
+
+	tags := make(map[string]string)
+	if filter.Category != "" {
+		tags["action_category"] = filter.Category
+	}
+	if filter.Type != "" {
+		tags["action_type"] = filter.Type
+	}
+
+	dataPoints, err := s.db.FetchDataPoints(s.dbName, Measurement, db.Filter{
+		Tags:  tags,
+		Start: filter.Start,
+		End:   filter.End,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list actions: %w", err)
+	}
+
+	records := make([]Record, 0, len(dataPoints))
+	for _, dataPoint := range dataPoints {
+		records = append(records, recordFromDataPoint(dataPoint))
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].TimeStamp.Before(records[j].TimeStamp)
+	})
+
+	return records, nil
+}
+
+// Get returns the action record with the given ID
+func (s *Store) Get(id string) (Record, error) {
+
+	t, ts, err := parseID(id)
+	if err != nil {
+		return Record{}, err
+	}
+
+	records, err := s.List(Filter{
+		Type:  t,
+		Start: ts,
+		End:   ts.Add(time.Millisecond),
+	})
+	if err != nil {
+		return Record{}, err
+	}
+	if len(records) == 0 {
+		return Record{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+
+	return records[0], nil
+}
+
+// Update replaces the action record with the given ID (e.g. correcting its time stamp or
+// attaching notes), returning the updated record
+func (s *Store) Update(id string, r Record) (Record, error) {
+
+	existing, err := s.Get(id)
+	if err != nil {
+		return r, err
+	}
+	dataPoint, err := r.dataPoint()
+	if err != nil {
+		return r, err
+	}
+	r.Category = dataPoint.Tags["action_category"]
+
+	if err := s.Delete(id); err != nil {
+		return r, err
+	}
+	if err := s.db.EmitDataPoints(s.dbName, Measurement, db.DataPoints{dataPoint}); err != nil {
+
+		// Attempt to restore the original record
+		if _, restoreErr := s.Add(existing); restoreErr != nil {
+			return r, fmt.Errorf("failed to update action: %w (failed to restore original: %s)", err, restoreErr)
+		}
+		return r, fmt.Errorf("failed to update action: %w", err)
+	}
+
+	return r, nil
+}
+
+// Delete removes the action record with the given ID
+func (s *Store) Delete(id string) error {
+
+	t, ts, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.DeleteDataPoints(s.dbName, Measurement, db.Filter{
+		Tags:  map[string]string{"action_type": t},
+		Start: ts,
+		End:   ts.Add(time.Millisecond),
+	}); err != nil {
+		return fmt.Errorf("failed to delete action: %w", err)
+	}
+
+	return nil
+}
+
+// dataPoint generates the database data point for the record
+func (r Record) dataPoint() (db.DataPoint, error) {
+
+	if err := Validate(r.Type, r.Params); err != nil {
+		return db.DataPoint{}, err
+	}
+	if r.TimeStamp.IsZero() {
+		return db.DataPoint{}, errors.New("no time stamp specified")
+	}
+
+	fields := make(map[string]interface{}, len(r.Params)+1)
+	if r.Notes != "" {
+		fields["notes"] = r.Notes
+	}
+	for k, v := range r.Params {
+		fields[paramPrefix+k] = v
+	}
+
+	return NewDataPoint(r.Type, r.TimeStamp, fields)
+}
+
+// recordFromDataPoint parses a record from a database data point
+func recordFromDataPoint(dataPoint db.DataPoint) Record {
+	r := Record{
+		Type:      dataPoint.Tags["action_type"],
+		Category:  dataPoint.Tags["action_category"],
+		TimeStamp: dataPoint.TimeStamp,
+	}
+	for k, v := range dataPoint.Data {
+		switch {
+		case k == "notes":
+			r.Notes = fmt.Sprint(v)
+		case strings.HasPrefix(k, paramPrefix):
+			if r.Params == nil {
+				r.Params = make(map[string]string)
+			}
+			r.Params[strings.TrimPrefix(k, paramPrefix)] = fmt.Sprint(v)
+		}
+	}
+
+	return r
+}
@@ -0,0 +1,86 @@
+package action
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fako1024/brew/db/memory"
+)
+
+func TestStore(t *testing.T) {
+	defer func() {
+		definitions = builtinDefinitions()
+	}()
+	if err := Register(Definition{Type: "descale_boiler", Category: Maintenance, Params: []string{"product"}}); err != nil {
+		t.Fatalf("Failed to register action type: %s", err)
+	}
+
+	store := NewStore(memory.New(), "brews")
+	ts := time.Date(2020, 9, 23, 11, 0, 0, 0, time.UTC)
+
+	if _, err := store.Add(Record{Type: "descale_boiler", TimeStamp: ts}); err == nil {
+		t.Fatalf("Expected error for missing required parameter")
+	}
+	for i, r := range []Record{
+		{Type: BackFlush, TimeStamp: ts},
+		{Type: "descale_boiler", TimeStamp: ts.Add(time.Hour), Params: map[string]string{"product": "Puly Caff"}},
+		{Type: NewCoffeePack, TimeStamp: ts.Add(2 * time.Hour), Notes: "House Blend"},
+	} {
+		added, err := store.Add(r)
+		if err != nil {
+			t.Fatalf("Failed to add record %d: %s", i, err)
+		}
+		if added.Category == "" {
+			t.Fatalf("Missing category for added record %d", i)
+		}
+	}
+
+	records, err := store.List(Filter{Category: Maintenance})
+	if err != nil {
+		t.Fatalf("Failed to list records: %s", err)
+	}
+	if len(records) != 2 || records[0].Type != BackFlush || records[1].Params["product"] != "Puly Caff" {
+		t.Fatalf("Unexpected maintenance records: %#v", records)
+	}
+	if records, err = store.List(Filter{Start: ts.Add(time.Hour)}); err != nil || len(records) != 2 {
+		t.Fatalf("Unexpected number of records in time range: %d (error: %v)", len(records), err)
+	}
+
+	// Correct the time stamp of the back flush and attach notes
+	r, err := store.Get(BackFlush + "@" + "1600858800000")
+	if err != nil {
+		t.Fatalf("Failed to get record: %s", err)
+	}
+	id := r.ID()
+	r.TimeStamp, r.Notes = ts.Add(-24*time.Hour), "Corrected"
+	if r, err = store.Update(id, r); err != nil {
+		t.Fatalf("Failed to update record: %s", err)
+	}
+	if _, err := store.Get(id); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Unexpected error for outdated ID: %v", err)
+	}
+	if updated, err := store.Get(r.ID()); err != nil || updated.Notes != "Corrected" {
+		t.Fatalf("Unexpected updated record: %#v (error: %v)", updated, err)
+	}
+
+	if err := store.Delete(r.ID()); err != nil {
+		t.Fatalf("Failed to delete record: %s", err)
+	}
+	if records, err = store.List(Filter{}); err != nil || len(records) != 2 {
+		t.Fatalf("Unexpected number of records after deletion: %d (error: %v)", len(records), err)
+	}
+}
+
+func TestLabel(t *testing.T) {
+	for input, expected := range map[string]string{
+		"back_flush":         "Back Flush",
+		"descale_brew_group": "Descale Brew Group",
+		"maintenance":        "Maintenance",
+		"":                   "",
+	} {
+		if label := label(input); label != expected {
+			t.Fatalf("Unexpected label for %q, want %q, have %q", input, expected, label)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/fako1024/brew"
+	"github.com/fako1024/brew/action"
+	"github.com/fako1024/brew/config"
+	"github.com/fako1024/brew/db"
+	"github.com/fako1024/brew/grind"
+	"github.com/fako1024/brew/inventory"
+	"github.com/fako1024/brew/maintenance"
+	"github.com/fako1024/brew/scanner"
+	"github.com/fako1024/brew/stats"
+	"github.com/fako1024/btscale/pkg/scale"
+)
+
+// API denotes the brew control API, allowing to manipulate running scanners
+type API struct {
+	endpoint string
+	cfg      *config.Config
+	scanners map[string]*scanner.Scanner
+	mux      *http.ServeMux
+
+	db        db.DB
+	inventory *inventory.Inventory
+
+	maintenanceTasks  []maintenance.Task
+	maintenanceSource maintenance.Source
+
+	logger scale.Logger
+}
+
+// ScaleSetup denotes the setup currently used by a scale
+type ScaleSetup struct {
+	Scale    string                 `json:"scale"`
+	Name     string                 `json:"name"`
+	Metadata map[string]interface{} `json:"metadata"`
+
+	BeansWeightSingle float64 `json:"beans_weight_single"`
+	BeansWeightDouble float64 `json:"beans_weight_double"`
+	GrindSetting      float64 `json:"grind_setting"`
+}
+
+// InventoryStatus denotes the state of the bean inventory
+type InventoryStatus struct {
+	Active   *inventory.Pack  `json:"active,omitempty"`
+	Warnings []string         `json:"warnings"`
+	Packs    []inventory.Pack `json:"packs"`
+}
+
+// SetupRequest denotes a request to switch the setup of one or all scales
+type SetupRequest struct {
+	Name string `json:"name"`
+}
+
+// PumpRequest denotes a request to signal the start of the pump on one or all scales
+type PumpRequest struct {
+	TimeStamp time.Time `json:"timestamp,omitempty"` // Start of the pump (default: now)
+}
+
+// PumpStatus denotes the start of the pump signaled on a scale
+type PumpStatus struct {
+	Scale      string    `json:"scale"`
+	TimeStamp  time.Time `json:"timestamp"`
+	PumpOffset float64   `json:"pump_offset"` // (Learned) time from the start of the pump to the first drop (in seconds, 0: unknown)
+}
+
+// New instantiates a new control API listening on the provided endpoint
+func New(endpoint string, cfg *config.Config, options ...func(*API)) *API {
+	a := &API{
+		endpoint: endpoint,
+		cfg:      cfg,
+		scanners: make(map[string]*scanner.Scanner),
+		mux:      http.NewServeMux(),
+		logger:   &scale.NullLogger{},
+	}
+
+	// Execute functional options (if any)
+	for _, option := range options {
+		option(a)
+	}
+
+	a.mux.HandleFunc("/setups", a.handleSetups)
+	a.mux.HandleFunc("/setup", a.handleSetup)
+	a.mux.HandleFunc("/inventory", a.handleInventory)
+	a.mux.HandleFunc("/maintenance", a.handleMaintenance)
+	a.mux.HandleFunc("/grind", a.handleGrind)
+	a.mux.HandleFunc("/pump", a.handlePump)
+
+	return a
+}
+
+// WithScanner registers a scanner (identified by the device ID of its scale)
+func WithScanner(deviceID string, s *scanner.Scanner) func(*API) {
+	return func(a *API) {
+		a.scanners[deviceID] = s
+	}
+}
+
+// WithDB sets a database to record actions (e.g. opening a new pack of beans) in
+func WithDB(db db.DB) func(*API) {
+	return func(a *API) {
+		a.db = db
+	}
+}
+
+// WithInventory sets the bean inventory
+func WithInventory(inv *inventory.Inventory) func(*API) {
+	return func(a *API) {
+		a.inventory = inv
+	}
+}
+
+// WithMaintenance sets the maintenance schedule and the source of recorded actions / brews
+func WithMaintenance(tasks []maintenance.Task, src maintenance.Source) func(*API) {
+	return func(a *API) {
+		a.maintenanceTasks = tasks
+		a.maintenanceSource = src
+	}
+}
+
+// WithLogger sets a logger
+func WithLogger(logger scale.Logger) func(*API) {
+	return func(a *API) {
+		a.logger = logger
+	}
+}
+
+// Run starts serving the API (blocking)
+func (a *API) Run() error {
+	a.logger.Infof("starting control API on %s", a.endpoint)
+	return http.ListenAndServe(a.endpoint, a.mux)
+}
+
+// ServeHTTP fulfills the http.Handler interface
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mux.ServeHTTP(w, r)
+}
+
+func (a *API) handleSetups(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, a.cfg.Setups)
+}
+
+func (a *API) handleSetup(w http.ResponseWriter, r *http.Request) {
+
+	deviceIDs, err := a.selectScales(r.URL.Query().Get("scale"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req SetupRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("failed to parse request: %w", err))
+			return
+		}
+		if req.Name == "" {
+			writeError(w, http.StatusBadRequest, errors.New("no setup name specified"))
+			return
+		}
+		if _, exists := a.cfg.Setups[req.Name]; !exists {
+			writeError(w, http.StatusNotFound, fmt.Errorf("unknown setup: %s", req.Name))
+			return
+		}
+
+		for _, deviceID := range deviceIDs {
+			setup, err := a.cfg.ScannerSetup(req.Name, a.cfg.ScaleProfile(deviceID))
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			a.scanners[deviceID].SetSetup(setup)
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	setups := make([]ScaleSetup, 0, len(deviceIDs))
+	for _, deviceID := range deviceIDs {
+		setup := a.scanners[deviceID].Setup()
+		setups = append(setups, ScaleSetup{
+			Scale:             deviceID,
+			Name:              setup.Metadata.Setup,
+			Metadata:          setup.Metadata.Fields(),
+			BeansWeightSingle: setup.BeansWeightSingle,
+			BeansWeightDouble: setup.BeansWeightDouble,
+			GrindSetting:      setup.GrindSetting,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, setups)
+}
+
+func (a *API) handleInventory(w http.ResponseWriter, r *http.Request) {
+
+	if a.inventory == nil {
+		writeError(w, http.StatusNotFound, errors.New("bean inventory not enabled"))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var pack inventory.Pack
+		if err := json.NewDecoder(r.Body).Decode(&pack); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("failed to parse request: %w", err))
+			return
+		}
+		pack, err := a.inventory.Register(pack)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		a.logger.Infof("registered new coffee pack `%s` (%.1f)", pack.Name, pack.Weight)
+
+		// Record opening the pack as action
+		if a.db != nil {
+			if _, err := action.NewStore(a.db, "brews").Add(action.Record{
+				Type:      action.NewCoffeePack,
+				TimeStamp: pack.Opened,
+				Params:    pack.Params(),
+			}); err != nil {
+				writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to record action: %w", err))
+				return
+			}
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	status := InventoryStatus{
+		Warnings: a.inventory.Warnings(time.Now()),
+		Packs:    a.inventory.Packs(),
+	}
+	if active, err := a.inventory.Active(); err == nil {
+		status.Active = &active
+	}
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (a *API) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	if a.maintenanceSource == nil {
+		writeError(w, http.StatusNotFound, errors.New("maintenance schedule not enabled"))
+		return
+	}
+
+	statuses, err := maintenance.Check(a.maintenanceTasks, a.maintenanceSource, time.Now())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func (a *API) handleGrind(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	if a.db == nil {
+		writeError(w, http.StatusNotFound, errors.New("no database available"))
+		return
+	}
+
+	shotType := brew.DoubleShot
+	if t := r.URL.Query().Get("shot_type"); t != "" {
+		if shotType = brew.ShotTypeFromString(t); shotType == brew.UnknownShot {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid shot type: %s", t))
+			return
+		}
+	}
+	target, err := a.cfg.GrindTarget(shotType)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	history, err := stats.Load(a.db, "brews", time.Time{}, time.Time{})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Default to the active pack of beans (or the pack of the most recent brew)
+	pack := r.URL.Query().Get("pack")
+	if pack == "" && a.inventory != nil {
+		if active, err := a.inventory.Active(); err == nil {
+			pack = active.ID
+		}
+	}
+	if pack == "" {
+		if pack, err = grind.LatestPack(history, shotType.String()); err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+	}
+
+	recommendation, err := grind.Recommend(history, pack, shotType.String(), target, a.cfg.Grind.Options()...)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, grind.ErrNoBrews) {
+			status = http.StatusNotFound
+		}
+		writeError(w, status, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, recommendation)
+}
+
+func (a *API) handlePump(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	deviceIDs, err := a.selectScales(r.URL.Query().Get("scale"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	// An empty body denotes the pump being started right now
+	var req PumpRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("failed to parse request: %w", err))
+		return
+	}
+	if req.TimeStamp.IsZero() {
+		req.TimeStamp = time.Now()
+	}
+
+	statuses := make([]PumpStatus, 0, len(deviceIDs))
+	for _, deviceID := range deviceIDs {
+		a.scanners[deviceID].PumpStarted(req.TimeStamp, brew.PumpStartAPI)
+		statuses = append(statuses, PumpStatus{
+			Scale:      deviceID,
+			TimeStamp:  req.TimeStamp,
+			PumpOffset: a.scanners[deviceID].PumpOffset().Seconds(),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// selectScales returns the device IDs of the requested scale (or all scales if none was specified)
+func (a *API) selectScales(deviceID string) ([]string, error) {
+	if deviceID != "" {
+		if _, exists := a.scanners[deviceID]; !exists {
+			return nil, fmt.Errorf("unknown scale: %s", deviceID)
+		}
+		return []string{deviceID}, nil
+	}
+
+	deviceIDs := make([]string, 0, len(a.scanners))
+	for id := range a.scanners {
+		deviceIDs = append(deviceIDs, id)
+	}
+	sort.Strings(deviceIDs)
+
+	return deviceIDs, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/fako1024/brew/grind"
+	"github.com/fako1024/brew/inventory"
+)
+
+// Client denotes a client for the brew control API
+type Client struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewClient instantiates a new client for the control API running on the provided
+// endpoint (e.g. ":8098" or "http://pi.local:8098")
+func NewClient(endpoint string) *Client {
+	if strings.HasPrefix(endpoint, ":") {
+		endpoint = "localhost" + endpoint
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+
+	return &Client{
+		baseURL: strings.TrimSuffix(endpoint, "/"),
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Setups returns the setups currently used by all scales (or a specific one)
+func (c *Client) Setups(deviceID string) ([]ScaleSetup, error) {
+	var setups []ScaleSetup
+	err := c.do(http.MethodGet, "/setup", deviceID, nil, &setups)
+	return setups, err
+}
+
+// SetSetup switches the setup of all scales (or a specific one)
+func (c *Client) SetSetup(name, deviceID string) ([]ScaleSetup, error) {
+	var setups []ScaleSetup
+	err := c.do(http.MethodPut, "/setup", deviceID, SetupRequest{Name: name}, &setups)
+	return setups, err
+}
+
+// Inventory returns the state of the bean inventory
+func (c *Client) Inventory() (InventoryStatus, error) {
+	var status InventoryStatus
+	err := c.do(http.MethodGet, "/inventory", "", nil, &status)
+	return status, err
+}
+
+// RegisterPack registers a new pack of beans, which becomes the active pack
+func (c *Client) RegisterPack(pack inventory.Pack) (InventoryStatus, error) {
+	var status InventoryStatus
+	err := c.do(http.MethodPost, "/inventory", "", pack, &status)
+	return status, err
+}
+
+// Grind returns a grind recommendation for a pack of beans and shot type (defaulting to the
+// active pack and double shots if empty)
+func (c *Client) Grind(pack, shotType string) (grind.Recommendation, error) {
+	query := url.Values{}
+	if pack != "" {
+		query.Set("pack", pack)
+	}
+	if shotType != "" {
+		query.Set("shot_type", shotType)
+	}
+
+	var recommendation grind.Recommendation
+	err := c.do(http.MethodGet, "/grind?"+query.Encode(), "", nil, &recommendation)
+	return recommendation, err
+}
+
+// PumpStarted signals the start of the pump on all scales (or a specific one)
+func (c *Client) PumpStarted(deviceID string) ([]PumpStatus, error) {
+	var statuses []PumpStatus
+	err := c.do(http.MethodPost, "/pump", deviceID, nil, &statuses)
+	return statuses, err
+}
+
+func (c *Client) do(method, path, deviceID string, req, res interface{}) error {
+
+	u := c.baseURL + path
+	if deviceID != "" {
+		u += "?scale=" + url.QueryEscape(deviceID)
+	}
+
+	var body bytes.Buffer
+	if req != nil {
+		if err := json.NewEncoder(&body).Encode(req); err != nil {
+			return err
+		}
+	}
+
+	httpReq, err := http.NewRequest(method, u, &body)
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr map[string]string
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err == nil && apiErr["error"] != "" {
+			return errors.New(apiErr["error"])
+		}
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(res)
+}
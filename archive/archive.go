@@ -0,0 +1,305 @@
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fako1024/brew/action"
+	"github.com/fako1024/brew/db"
+	"github.com/fako1024/brew/store"
+)
+
+// SchemaVersion denotes the version of the archive format written by this package
+const SchemaVersion = 1
+
+const (
+	headerRecord = "header"
+	brewRecord   = "brew"
+	actionRecord = "action"
+
+	maxLineLength = 64 * 1024 * 1024
+)
+
+// Filter denotes criteria to select the brews and actions of an archive
+type Filter struct {
+	Start     time.Time `json:"start"`                // Earliest start of brews / time of actions (inclusive, unbounded if zero)
+	End       time.Time `json:"end"`                  // Latest start of brews / time of actions (exclusive, unbounded if zero)
+	ShotTypes []string  `json:"shot_types,omitempty"` // Shot types of brews to select (all if empty)
+}
+
+// Header denotes the (first) record of an archive describing its contents
+type Header struct {
+	SchemaVersion int       `json:"schema_version"`
+	Created       time.Time `json:"created"`
+	DB            string    `json:"db"`
+	Filter        Filter    `json:"filter"`
+}
+
+// Brew denotes a brew as stored in the database (summary, curve and annotations)
+type Brew struct {
+	ID          string        `json:"id"`
+	Summary     db.DataPoint  `json:"summary"`
+	Curve       db.DataPoints `json:"curve"`
+	Annotations db.DataPoints `json:"annotations,omitempty"`
+}
+
+// Record denotes a single record (line) of an archive
+type Record struct {
+	Type   string        `json:"type"`
+	Header *Header       `json:"header,omitempty"`
+	Brew   *Brew         `json:"brew,omitempty"`
+	Action *db.DataPoint `json:"action,omitempty"`
+}
+
+// RecordFromEntry converts a brew to an archive record (as it would be stored in the database)
+func RecordFromEntry(e store.Entry) Record {
+	return Record{
+		Type: brewRecord,
+		Brew: &Brew{
+			ID:          e.ID,
+			Summary:     e.Summary(),
+			Curve:       e.Curve(),
+			Annotations: e.AnnotationDataPoints(e.Annotations...),
+		},
+	}
+}
+
+// Stats denotes the number of brews / actions written to an archive
+type Stats struct {
+	Brews   int
+	Actions int
+}
+
+// Writer writes records to an archive in JSON-lines format
+type Writer struct {
+	enc *json.Encoder
+}
+
+// NewWriter instantiates a new archive writer, writing the header immediately
+func NewWriter(w io.Writer, header Header) (*Writer, error) {
+	header.SchemaVersion = SchemaVersion
+	if header.Created.IsZero() {
+		header.Created = time.Now()
+	}
+
+	aw := &Writer{
+		enc: json.NewEncoder(w),
+	}
+
+	return aw, aw.enc.Encode(Record{Type: headerRecord, Header: &header})
+}
+
+// WriteBrew writes a brew to the archive
+func (w *Writer) WriteBrew(b Brew) error {
+	return w.enc.Encode(Record{Type: brewRecord, Brew: &b})
+}
+
+// WriteAction writes an action to the archive
+func (w *Writer) WriteAction(dataPoint db.DataPoint) error {
+	return w.enc.Encode(Record{Type: actionRecord, Action: &dataPoint})
+}
+
+// Export writes all brews and actions matching the filter to an archive
+func Export(d db.DB, dbName string, filter Filter, w io.Writer) (Stats, error) {
+
+	var stats Stats
+	aw, err := NewWriter(w, Header{DB: dbName, Filter: filter})
+	if err != nil {
+		return stats, err
+	}
+
+	summaries, err := d.FetchDataPoints(dbName, store.SummaryMeasurement, db.Filter{Start: filter.Start, End: filter.End})
+	if err != nil {
+		return stats, fmt.Errorf("failed to retrieve brew summaries: %w", err)
+	}
+	for _, summary := range summaries {
+		if !filter.matchesShotType(summary.Tags["shot_type"]) {
+			continue
+		}
+
+		b := Brew{
+			ID:      summary.Tags["id"],
+			Summary: summary,
+		}
+		byID := db.Filter{Tags: map[string]string{"id": b.ID}}
+		if b.Curve, err = d.FetchDataPoints(dbName, store.CurveMeasurement, byID); err != nil {
+			return stats, fmt.Errorf("failed to retrieve data points of brew %s: %w", b.ID, err)
+		}
+		if b.Annotations, err = d.FetchDataPoints(dbName, store.AnnotationsMeasurement, byID); err != nil {
+			return stats, fmt.Errorf("failed to retrieve annotations of brew %s: %w", b.ID, err)
+		}
+		if err := aw.WriteBrew(b); err != nil {
+			return stats, fmt.Errorf("failed to write brew %s: %w", b.ID, err)
+		}
+		stats.Brews++
+	}
+
+	actions, err := d.FetchDataPoints(dbName, action.Measurement, db.Filter{Start: filter.Start, End: filter.End})
+	if err != nil {
+		return stats, fmt.Errorf("failed to retrieve actions: %w", err)
+	}
+	for _, dataPoint := range actions {
+		if err := aw.WriteAction(dataPoint); err != nil {
+			return stats, fmt.Errorf("failed to write action: %w", err)
+		}
+		stats.Actions++
+	}
+
+	return stats, nil
+}
+
+// Reader reads records from an archive
+type Reader struct {
+	scanner *bufio.Scanner
+	header  Header
+	line    int
+}
+
+// NewReader instantiates a new archive reader, reading and validating the header
+func NewReader(r io.Reader) (*Reader, error) {
+
+	ar := &Reader{
+		scanner: bufio.NewScanner(r),
+	}
+	ar.scanner.Buffer(nil, maxLineLength)
+
+	record, err := ar.Next()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("empty archive")
+		}
+		return nil, err
+	}
+	if record.Type != headerRecord || record.Header == nil {
+		return nil, errors.New("missing archive header")
+	}
+	if record.Header.SchemaVersion < 1 || record.Header.SchemaVersion > SchemaVersion {
+		return nil, fmt.Errorf("unsupported archive schema version %d (supported: 1 - %d)", record.Header.SchemaVersion, SchemaVersion)
+	}
+	ar.header = *record.Header
+
+	return ar, nil
+}
+
+// Header returns the header of the archive
+func (r *Reader) Header() Header {
+	return r.header
+}
+
+// Line returns the line number of the last record read
+func (r *Reader) Line() int {
+	return r.line
+}
+
+// Next reads the next record of the archive (returning io.EOF once all records have been read)
+func (r *Reader) Next() (Record, error) {
+
+	for r.scanner.Scan() {
+		r.line++
+		if len(strings.TrimSpace(r.scanner.Text())) == 0 {
+			continue
+		}
+
+		var record Record
+		if err := json.Unmarshal(r.scanner.Bytes(), &record); err != nil {
+			return record, fmt.Errorf("line %d: %w", r.line, err)
+		}
+		return record, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return Record{}, err
+	}
+
+	return Record{}, io.EOF
+}
+
+// WriteFile atomically writes a file (via a temporary file in the same directory, replacing
+// any existing file only once writing succeeded), compressing it if its name ends in .gz
+func WriteFile(path string, write func(w io.Writer) error) error {
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := f.Chmod(0660); err != nil {
+		f.Close()
+		return err
+	}
+
+	bw := bufio.NewWriter(f)
+	var w io.Writer = bw
+	var gz *gzip.Writer
+	if strings.HasSuffix(path, ".gz") {
+		gz = gzip.NewWriter(bw)
+		w = gz
+	}
+
+	err = write(w)
+	if err == nil && gz != nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// Open opens an archive file for reading (decompressing it if its name ends in .gz)
+func Open(path string) (io.ReadCloser, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return f, nil
+	}
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &gzipFile{Reader: gz, f: f}, nil
+}
+
+type gzipFile struct {
+	*gzip.Reader
+	f *os.File
+}
+
+func (g *gzipFile) Close() error {
+	return errors.Join(g.Reader.Close(), g.f.Close())
+}
+
+func (f Filter) matchesShotType(shotType string) bool {
+	if len(f.ShotTypes) == 0 {
+		return true
+	}
+	for _, t := range f.ShotTypes {
+		if t == shotType {
+			return true
+		}
+	}
+	return false
+}
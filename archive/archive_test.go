@@ -0,0 +1,131 @@
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fako1024/brew"
+	"github.com/fako1024/brew/action"
+	"github.com/fako1024/brew/db"
+	"github.com/fako1024/brew/db/memory"
+	"github.com/fako1024/brew/store"
+	"github.com/fako1024/btscale/pkg/scale"
+)
+
+func testDB(t *testing.T, start time.Time) *memory.DB {
+	d := memory.New()
+	s := store.New(d, "brews")
+	for i, shotType := range []brew.ShotType{brew.SingleShot, brew.DoubleShot} {
+		ts := start.Add(time.Duration(i) * time.Hour)
+		if err := s.Save(store.Entry{
+			Brew: &brew.Brew{
+				ID:       shotType.String(),
+				Start:    ts,
+				End:      ts.Add(time.Second),
+				ShotType: shotType,
+				DataPoints: scale.DataPoints{
+					{TimeStamp: ts, Weight: 0., Unit: "g"},
+					{TimeStamp: ts.Add(time.Second), Weight: 30., Unit: "g"},
+				},
+				Annotations: []brew.Annotation{{TimeStamp: ts, Event: brew.TareEvent}},
+			},
+			Fields: map[string]interface{}{"battery_level": int64(80)},
+		}); err != nil {
+			t.Fatalf("Failed to save brew: %s", err)
+		}
+	}
+	if _, err := action.NewStore(d, "brews").Add(action.Record{Type: action.BackFlush, TimeStamp: start}); err != nil {
+		t.Fatalf("Failed to add action: %s", err)
+	}
+
+	return d
+}
+
+func TestExport(t *testing.T) {
+
+	start := time.Date(2020, 9, 23, 11, 0, 0, 0, time.UTC)
+	d := testDB(t, start)
+
+	buf := new(bytes.Buffer)
+	stats, err := Export(d, "brews", Filter{ShotTypes: []string{"double"}}, buf)
+	if err != nil {
+		t.Fatalf("Failed to export archive: %s", err)
+	}
+	if stats.Brews != 1 || stats.Actions != 1 {
+		t.Fatalf("Unexpected export stats: %#v", stats)
+	}
+
+	r, err := NewReader(buf)
+	if err != nil {
+		t.Fatalf("Failed to read archive: %s", err)
+	}
+	if r.Header().SchemaVersion != SchemaVersion || r.Header().Filter.ShotTypes[0] != "double" {
+		t.Fatalf("Unexpected header: %#v", r.Header())
+	}
+
+	expected, _ := d.FetchDataPoints("brews", store.SummaryMeasurement, db.Filter{Tags: map[string]string{"id": "double"}})
+	var records []Record
+	for {
+		record, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read record: %s", err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 2 || records[0].Brew == nil || records[1].Action == nil {
+		t.Fatalf("Unexpected records: %#v", records)
+	}
+	if b := records[0].Brew; !reflect.DeepEqual(b.Summary.Data, expected[0].Data) || len(b.Curve) != 2 || len(b.Annotations) != 1 {
+		t.Fatalf("Unexpected brew record: %#v", b)
+	}
+
+	// Archives of unknown schema versions are rejected
+	if _, err := NewReader(strings.NewReader(`{"type":"header","header":{"schema_version":99}}`)); err == nil {
+		t.Fatalf("Expected error for unsupported schema version")
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+
+	for _, name := range []string{"export.jsonl", "export.jsonl.gz"} {
+		path := filepath.Join(t.TempDir(), name)
+		for _, content := range []string{"long content\nlong content\n", "short\n"} {
+			if err := WriteFile(path, func(w io.Writer) error {
+				_, err := io.WriteString(w, content)
+				return err
+			}); err != nil {
+				t.Fatalf("Failed to write file: %s", err)
+			}
+		}
+
+		// A failed write retains the previous file
+		if err := WriteFile(path, func(w io.Writer) error {
+			return errors.New("failed")
+		}); err == nil {
+			t.Fatalf("Expected error for failed write")
+		}
+
+		f, err := Open(path)
+		if err != nil {
+			t.Fatalf("Failed to open file: %s", err)
+		}
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil || string(data) != "short\n" {
+			t.Fatalf("Unexpected file content: %q (error: %v)", data, err)
+		}
+		if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+			t.Fatalf("Unexpected number of files: %d", len(entries))
+		}
+	}
+}
@@ -0,0 +1,544 @@
+package archive
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fako1024/brew"
+	"github.com/fako1024/brew/db"
+	"github.com/fako1024/brew/store"
+	"github.com/google/uuid"
+)
+
+const (
+
+	// UnixMillis denotes a time layout representing timestamps as milliseconds since the epoch
+	UnixMillis = "unix_ms"
+
+	// UnixSeconds denotes a time layout representing timestamps as seconds since the epoch
+	UnixSeconds = "unix"
+
+	// Duration denotes a virtual column holding the duration of a brew (in seconds, used to
+	// determine its end if no end time stamp is available)
+	Duration = "duration"
+)
+
+// csvColumns denotes the columns of the native CSV format (in order)
+var csvColumns = []string{
+	"id", "shot_type", "start", "end", "end_weight", "unit", "beans_weight", "grind_setting", "battery_level",
+	"pack", "setup", "beans", "roaster", "roast_date", "grinder", "grinder_setting", "basket", "water_temperature", "recipe",
+}
+
+// weightFields denotes all summary fields representing a weight
+var weightFields = map[string]struct{}{
+	"end_weight": {}, "raw_end_weight": {}, "baseline_weight": {}, "beans_weight": {},
+}
+
+// timeFields denotes all summary fields representing a time stamp
+var timeFields = map[string]struct{}{
+	"start": {}, "end": {},
+}
+
+// tagColumns denotes all columns stored as tags (instead of fields)
+var tagColumns = map[string]struct{}{
+	"id": {}, "shot_type": {}, "pack": {}, "station": {}, "group_head": {},
+}
+
+// fallbackTimeLayouts denotes the layouts attempted to parse time stamps if no layout is given
+var fallbackTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"02/01/2006 15:04:05",
+	"02.01.2006 15:04:05",
+}
+
+// Mapping denotes the mapping of CSV columns to brew summary fields
+type Mapping struct {
+	Columns    map[string]string // CSV column header per summary field (identity if empty)
+	Positional []string          // Summary field per CSV column for files without header (empty entries are ignored)
+	TimeLayout string            // Layout of time stamps (Go layout, UnixMillis or UnixSeconds, detected if empty)
+	Location   *time.Location    // Time zone of time stamps without zone information (required for such time stamps)
+	WeightUnit string            // Unit of all weights (g if empty)
+}
+
+// Mappings returns the built-in column mappings (native format, legacy headerless format
+// and third-party apps)
+func Mappings() map[string]Mapping {
+	return map[string]Mapping{
+		"native": {},
+		"legacy": {
+			Positional: []string{"id", "shot_type", "start", "end", "end_weight", "unit", "battery_level", "beans_weight", "grind_setting", ""},
+			TimeLayout: UnixMillis,
+		},
+		"acaia": {
+			Columns: map[string]string{
+				"start":        "Date",
+				"end_weight":   "Weight",
+				Duration:       "Duration",
+				"beans_weight": "Dose",
+				"beans":        "Bean",
+				"recipe":       "Recipe",
+			},
+		},
+		"beanconqueror": {
+			Columns: map[string]string{
+				"start":             "Creation date",
+				"beans":             "Bean",
+				"roaster":           "Roaster",
+				"grinder":           "Mill",
+				"grinder_setting":   "Grind size",
+				"beans_weight":      "Grind weight",
+				"end_weight":        "Brew beverage quantity",
+				Duration:            "Brew time",
+				"water_temperature": "Brew temperature",
+				"recipe":            "Preparation",
+			},
+		},
+	}
+}
+
+// CSVOptions denotes the options for writing brew summaries as CSV
+type CSVOptions struct {
+	Location   *time.Location // Time zone of all time stamps (local time if nil)
+	WeightUnit string         // Unit of all weights (g if empty)
+}
+
+// WriteCSV writes the summaries of all brews matching the filter as CSV (including a header),
+// returning the number of written brews
+func WriteCSV(d db.DB, dbName string, filter Filter, opts CSVOptions, w io.Writer) (int, error) {
+
+	unit, err := brew.UnitFromString(opts.WeightUnit)
+	if err != nil {
+		return 0, err
+	}
+	loc := opts.Location
+	if loc == nil {
+		loc = time.Local
+	}
+
+	summaries, err := d.FetchDataPoints(dbName, store.SummaryMeasurement, db.Filter{Start: filter.Start, End: filter.End})
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve brew summaries: %w", err)
+	}
+
+	// Determine all columns (additional fields / tags are appended in alphabetical order)
+	columns := append([]string{}, csvColumns...)
+	known := make(map[string]struct{}, len(columns))
+	for _, column := range columns {
+		known[column] = struct{}{}
+	}
+	var additional []string
+	for _, summary := range summaries {
+		for _, values := range []map[string]string{summary.Tags, stringKeys(summary.Data)} {
+			for k := range values {
+				if _, exists := known[k]; !exists && k != "schema_version" {
+					known[k] = struct{}{}
+					additional = append(additional, k)
+				}
+			}
+		}
+	}
+	sort.Strings(additional)
+	columns = append(columns, additional...)
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return 0, err
+	}
+
+	var n int
+	for _, summary := range summaries {
+		if !filter.matchesShotType(summary.Tags["shot_type"]) {
+			continue
+		}
+
+		// Weights measured by the scale are stored in the unit it reported (unless normalized)
+		measuredUnit, err := storedUnit(summary)
+		if err != nil {
+			return n, fmt.Errorf("brew %s: %w", summary.Tags["id"], err)
+		}
+
+		row := make([]string, len(columns))
+		for i, column := range columns {
+			if v, isTag := summary.Tags[column]; isTag {
+				row[i] = v
+				continue
+			}
+			v, exists := summary.Data[column]
+			if !exists {
+				continue
+			}
+			if column == "end_weight" {
+				v, _ = store.Yield(summary)
+			}
+			_, isWeight := weightFields[column]
+			_, isTime := timeFields[column]
+			switch {
+			case column == "unit":
+				row[i] = unit.String()
+			case isWeight:
+				if f, ok := toFloat(v); ok {
+					from := measuredUnit
+					if column == "beans_weight" {
+						from = brew.CanonicalUnit
+					}
+					row[i] = strconv.FormatFloat(from.Convert(f, unit), 'f', -1, 64)
+				}
+			case isTime:
+				if ms, ok := toFloat(v); ok {
+					row[i] = time.UnixMilli(int64(ms)).In(loc).Format(time.RFC3339)
+				}
+			default:
+				row[i] = formatValue(v)
+			}
+		}
+		if err := cw.Write(row); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	cw.Flush()
+
+	return n, cw.Error()
+}
+
+// CSVReadOptions denotes the options for reading brew summaries from CSV
+type CSVReadOptions struct {
+	Mapping Mapping
+
+	// Expected yields of single / double shots, used to classify brews without shot type
+	ExpectedSingleShotWeight float64
+	ExpectedDoubleShotWeight float64
+}
+
+// ReadCSV reads brew summaries from CSV (using the provided column mapping), returning the
+// valid brews as archive records and a problem for each invalid row
+func ReadCSV(r io.Reader, opts CSVReadOptions) ([]Record, []Problem, error) {
+
+	m := opts.Mapping
+	factor, err := weightFactor(m.WeightUnit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	// Determine the summary field of each column
+	var fields []string
+	if len(m.Positional) > 0 {
+		fields = m.Positional
+	} else {
+		header, err := cr.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, nil, errors.New("empty CSV file")
+			}
+			return nil, nil, fmt.Errorf("failed to read CSV header: %w", err)
+		}
+		if fields, err = m.fields(header); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var (
+		records  []Record
+		problems []Problem
+		line     = 1
+	)
+	if len(m.Positional) > 0 {
+		line = 0
+	}
+	for {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		line++
+		if err != nil {
+			problems = append(problems, Problem{Line: line, Err: err})
+			continue
+		}
+		if len(row) != len(fields) {
+			problems = append(problems, Problem{Line: line, Err: fmt.Errorf("unexpected number of columns, want %d, have %d", len(fields), len(row))})
+			continue
+		}
+
+		b, err := m.parseRow(fields, row, factor, opts)
+		if err == nil {
+			_, err = validate(Record{Type: brewRecord, Brew: b})
+		}
+		if err != nil {
+			id := ""
+			if b != nil {
+				id = b.ID
+			}
+			problems = append(problems, Problem{Line: line, ID: id, Err: err})
+			continue
+		}
+		records = append(records, Record{Type: brewRecord, Brew: b})
+	}
+
+	return records, problems, nil
+}
+
+// fields determines the summary field of each column of a CSV header
+func (m Mapping) fields(header []string) ([]string, error) {
+
+	fields := make([]string, len(header))
+	if len(m.Columns) == 0 {
+		for i, column := range header {
+			fields[i] = strings.TrimSpace(column)
+		}
+		for _, required := range []string{"start", "end_weight"} {
+			if !contains(fields, required) {
+				return nil, fmt.Errorf("missing column %q in CSV header (headerless files require a positional mapping, e.g. legacy)", required)
+			}
+		}
+		return fields, nil
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		columns[strings.TrimSpace(column)] = i
+	}
+	for field, column := range m.Columns {
+		i, exists := columns[column]
+		if !exists {
+			if field == "start" || field == "end_weight" {
+				return nil, fmt.Errorf("missing column %q (mapped to %s) in CSV header", column, field)
+			}
+			continue
+		}
+		fields[i] = field
+	}
+
+	return fields, nil
+}
+
+// parseRow parses a single CSV row into a brew (summary only)
+func (m Mapping) parseRow(fields []string, row []string, factor float64, opts CSVReadOptions) (*Brew, error) {
+
+	// A unit column takes precedence over the unit of the mapping
+	for i, field := range fields {
+		if unit := strings.TrimSpace(row[i]); field == "unit" && unit != "" {
+			var err error
+			if factor, err = weightFactor(unit); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	tags := make(map[string]string)
+	data := make(map[string]interface{})
+	var duration float64
+	for i, field := range fields {
+		value := strings.TrimSpace(row[i])
+		if field == "" || value == "" {
+			continue
+		}
+
+		_, isTag := tagColumns[field]
+		_, isWeight := weightFields[field]
+		_, isTime := timeFields[field]
+		switch {
+		case isTag:
+			tags[field] = value
+		case isTime:
+			ts, err := m.parseTime(value)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", field, err)
+			}
+			data[field] = ts.UnixMilli()
+		case isWeight:
+			f, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: invalid weight %q", field, value)
+			}
+			data[field] = f * factor
+		case field == Duration:
+			d, err := parseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", field, err)
+			}
+			duration = d
+		case field == "unit":
+			continue
+		case brew.IsMetadataField(field) && field != "water_temperature":
+			data[field] = value
+		default:
+			if f, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64); err == nil {
+				data[field] = f
+			} else {
+				data[field] = value
+			}
+		}
+	}
+
+	start, hasStart := data["start"].(int64)
+	if !hasStart {
+		return nil, errors.New("missing start")
+	}
+	if _, hasEnd := data["end"]; !hasEnd && duration > 0 {
+		data["end"] = start + int64(math.Round(duration*1000))
+	}
+	if _, hasWeight := data["end_weight"]; !hasWeight {
+		return nil, errors.New("missing yield (end_weight)")
+	}
+
+	// All weights are stored in the canonical unit, the end weight denoting the net yield
+	data["unit"] = brew.CanonicalUnit.String()
+	data["schema_version"] = int64(store.SummaryVersion)
+
+	// Brews without ID are identified by their start
+	if tags["id"] == "" {
+		tags["id"] = BrewID(time.UnixMilli(start))
+	}
+	if tags["shot_type"] == "" {
+		yield, _ := toFloat(data["end_weight"])
+		tags["shot_type"] = brew.Classify(yield, opts.ExpectedSingleShotWeight, opts.ExpectedDoubleShotWeight).String()
+	} else if shotType := brew.ShotTypeFromString(tags["shot_type"]); shotType != brew.UnknownShot {
+		tags["shot_type"] = shotType.String()
+	}
+
+	return &Brew{
+		ID: tags["id"],
+		Summary: db.DataPoint{
+			TimeStamp: time.UnixMilli(start),
+			Tags:      tags,
+			Data:      data,
+		},
+	}, nil
+}
+
+// BrewID returns a deterministic ID for a brew imported without ID, derived from its start
+// (allowing to identify the brew when repeating an import)
+func BrewID(start time.Time) string {
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte("brew:"+strconv.FormatInt(start.UnixMilli(), 10))).String()
+}
+
+// parseTime parses a time stamp, requiring explicit time zone information (either as part of
+// the time stamp or via the mapping)
+func (m Mapping) parseTime(value string) (time.Time, error) {
+
+	switch m.TimeLayout {
+	case UnixMillis, UnixSeconds:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time stamp %q", value)
+		}
+		if m.TimeLayout == UnixSeconds {
+			return time.Unix(n, 0), nil
+		}
+		return time.UnixMilli(n), nil
+	}
+
+	layouts := fallbackTimeLayouts
+	if m.TimeLayout != "" {
+		layouts = []string{m.TimeLayout}
+	}
+	for _, layout := range layouts {
+		ts, err := time.Parse(layout, value)
+		if err != nil {
+			continue
+		}
+
+		// Time stamps without zone information are ambiguous unless a time zone is provided
+		if !strings.Contains(layout, "Z07") && !strings.Contains(layout, "MST") && !strings.Contains(layout, "-07") {
+			if m.Location == nil {
+				return time.Time{}, fmt.Errorf("time stamp %q lacks time zone information, specify a time zone", value)
+			}
+			return time.ParseInLocation(layout, value, m.Location)
+		}
+		return ts, nil
+	}
+
+	return time.Time{}, fmt.Errorf("failed to parse time stamp %q", value)
+}
+
+// parseDuration parses a duration either in seconds, as Go duration or as mm:ss
+func parseDuration(value string) (float64, error) {
+	if f, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64); err == nil {
+		return f, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return d.Seconds(), nil
+	}
+	if minutes, seconds, found := strings.Cut(value, ":"); found {
+		m, errM := strconv.Atoi(minutes)
+		s, errS := strconv.ParseFloat(seconds, 64)
+		if errM == nil && errS == nil {
+			return float64(m)*60 + s, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid duration %q", value)
+}
+
+// storedUnit returns the unit of the weights measured by the scale as stored in a summary
+func storedUnit(summary db.DataPoint) (brew.Unit, error) {
+	unit, exists := summary.Data["unit"]
+	if !exists || unit == nil {
+		return brew.CanonicalUnit, nil
+	}
+	return brew.UnitFromString(fmt.Sprint(unit))
+}
+
+// weightFactor returns the conversion factor of a weight unit to the canonical unit
+func weightFactor(unit string) (float64, error) {
+	u, err := brew.UnitFromString(unit)
+	if err != nil {
+		return 0, err
+	}
+	return u.ToCanonical(1.), nil
+}
+
+func formatValue(v interface{}) string {
+	if f, isFloat := v.(float64); isFloat {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case int64:
+		return float64(t), true
+	case int:
+		return float64(t), true
+	case json.Number:
+		f, err := t.Float64()
+		return f, err == nil
+	}
+	return 0., false
+}
+
+func stringKeys(m map[string]interface{}) map[string]string {
+	keys := make(map[string]string, len(m))
+	for k := range m {
+		keys[k] = ""
+	}
+	return keys
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
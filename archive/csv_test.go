@@ -0,0 +1,146 @@
+package archive
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fako1024/brew/db"
+	"github.com/fako1024/brew/db/memory"
+	"github.com/fako1024/brew/store"
+)
+
+func TestCSVRoundTrip(t *testing.T) {
+
+	start := time.Date(2020, 9, 23, 11, 0, 0, 0, time.UTC)
+	d := testDB(t, start)
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("Time zone data not available: %s", err)
+	}
+
+	buf := new(bytes.Buffer)
+	n, err := WriteCSV(d, "brews", Filter{}, CSVOptions{Location: berlin, WeightUnit: "oz"}, buf)
+	if err != nil {
+		t.Fatalf("Failed to write CSV: %s", err)
+	}
+	if n != 2 {
+		t.Fatalf("Unexpected number of brews written: %d", n)
+	}
+	if !strings.HasPrefix(buf.String(), strings.Join(csvColumns, ",")+",") || !strings.Contains(buf.String(), "2020-09-23T13:00:00+02:00") {
+		t.Fatalf("Unexpected CSV:\n%s", buf.String())
+	}
+
+	// Reading the CSV back (with reordered columns) restores the summaries
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	for i, line := range lines {
+		columns := strings.Split(line, ",")
+		columns[0], columns[4] = columns[4], columns[0]
+		lines[i] = strings.Join(columns, ",")
+	}
+	records, problems, err := ReadCSV(strings.NewReader(strings.Join(lines, "\n")), CSVReadOptions{})
+	if err != nil || len(problems) > 0 {
+		t.Fatalf("Failed to read CSV: %v / %v", err, problems)
+	}
+	expected, _ := d.FetchDataPoints("brews", store.SummaryMeasurement, db.Filter{})
+	if len(records) != len(expected) {
+		t.Fatalf("Unexpected number of records: %d", len(records))
+	}
+	for i, record := range records {
+		summary := record.Brew.Summary
+		if !summary.TimeStamp.Equal(expected[i].TimeStamp) || !reflect.DeepEqual(summary.Tags, expected[i].Tags) {
+			t.Fatalf("Unexpected summary:\nwant %v\nhave %v", expected[i], summary)
+		}
+		for k, v := range expected[i].Data {
+			have, _ := toFloat(summary.Data[k])
+			if want, isNumeric := toFloat(v); isNumeric && math.Abs(have-want) > 1e-9 {
+				t.Fatalf("Unexpected field %s: want %v, have %v", k, want, have)
+			}
+		}
+	}
+
+	// The import is idempotent
+	report, err := Import(memory.New(), "brews", records, SkipExisting, nil, false)
+	if err != nil || report.Created != 2 {
+		t.Fatalf("Unexpected import result: %#v (error: %v)", report, err)
+	}
+}
+
+func TestCSVMapping(t *testing.T) {
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("Time zone data not available: %s", err)
+	}
+
+	data := `Creation date,Bean,Grind weight,Brew beverage quantity,Brew time,Notes
+2023-03-01 08:30:00,House Blend,18.5,36.2,28,sweet
+2023-03-01 09:00:00,House Blend,9,18,,
+invalid,House Blend,9,18,25,
+`
+	mapping := Mappings()["beanconqueror"]
+
+	// Time stamps without zone information are rejected unless a time zone is provided
+	_, problems, err := ReadCSV(strings.NewReader(data), CSVReadOptions{Mapping: mapping})
+	if err != nil || len(problems) != 3 {
+		t.Fatalf("Expected problems for ambiguous time stamps, have %v (error: %v)", problems, err)
+	}
+
+	mapping.Location = berlin
+	records, problems, err := ReadCSV(strings.NewReader(data), CSVReadOptions{
+		Mapping:                  mapping,
+		ExpectedSingleShotWeight: 20.,
+		ExpectedDoubleShotWeight: 40.,
+	})
+	if err != nil {
+		t.Fatalf("Failed to read CSV: %s", err)
+	}
+	if len(problems) != 1 || problems[0].Line != 4 {
+		t.Fatalf("Unexpected problems: %v", problems)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Unexpected number of records: %d", len(records))
+	}
+
+	b := records[0].Brew
+	ts := time.Date(2023, 3, 1, 8, 30, 0, 0, berlin)
+	if !b.Summary.TimeStamp.Equal(ts) || b.Summary.Data["end"] != ts.Add(28*time.Second).UnixMilli() {
+		t.Fatalf("Unexpected start / end: %v / %v", b.Summary.TimeStamp, b.Summary.Data["end"])
+	}
+	if b.Summary.Tags["shot_type"] != "double" || records[1].Brew.Summary.Tags["shot_type"] != "single" {
+		t.Fatalf("Unexpected classification: %v / %v", b.Summary.Tags, records[1].Brew.Summary.Tags)
+	}
+	if b.Summary.Data["beans"] != "House Blend" || b.Summary.Data["beans_weight"] != 18.5 {
+		t.Fatalf("Unexpected summary fields: %v", b.Summary.Data)
+	}
+	if _, exists := b.Summary.Data["Notes"]; exists {
+		t.Fatalf("Unexpected unmapped column in summary: %v", b.Summary.Data)
+	}
+
+	// Brews without ID are identified by their start
+	again, _, _ := ReadCSV(strings.NewReader(data), CSVReadOptions{Mapping: mapping})
+	if again[0].Brew.ID != b.ID || again[1].Brew.ID == b.ID {
+		t.Fatalf("Unexpected brew IDs: %s / %s", again[0].Brew.ID, again[1].Brew.ID)
+	}
+
+	// Weights are converted to grams
+	mapping.WeightUnit = "oz"
+	records, _, _ = ReadCSV(strings.NewReader(data), CSVReadOptions{Mapping: mapping})
+	if yield := records[0].Brew.Summary.Data["end_weight"].(float64); math.Abs(yield-36.2*28.349523125) > 1e-9 {
+		t.Fatalf("Unexpected converted yield: %v", yield)
+	}
+
+	// Headerless legacy files are read positionally
+	records, problems, err = ReadCSV(strings.NewReader("84e1ffa1-07fa-4d25-9af7-0a50debe1921,double,1603958992000,1603959019000,55.66,g,0.57,16.0,0.208695652,1603958992245000000\n"),
+		CSVReadOptions{Mapping: Mappings()["legacy"]})
+	if err != nil || len(problems) > 0 || len(records) != 1 {
+		t.Fatalf("Failed to read legacy CSV: %v / %v", err, problems)
+	}
+	if summary := records[0].Brew.Summary; summary.Tags["id"] != "84e1ffa1-07fa-4d25-9af7-0a50debe1921" || summary.Data["end"] != int64(1603959019000) || summary.Data["grind_setting"] != 0.208695652 {
+		t.Fatalf("Unexpected legacy summary: %v", summary)
+	}
+}
@@ -0,0 +1,252 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/fako1024/brew"
+	"github.com/fako1024/brew/action"
+	"github.com/fako1024/brew/db"
+	"github.com/fako1024/brew/db/backup"
+	"github.com/fako1024/brew/store"
+)
+
+// Existing denotes how brews / actions already present in the database are treated on import
+type Existing string
+
+const (
+
+	// SkipExisting retains brews / actions already present in the database
+	SkipExisting Existing = "skip"
+
+	// UpdateExisting replaces brews / actions already present in the database
+	UpdateExisting Existing = "update"
+)
+
+// Problem denotes an invalid record of an archive
+type Problem struct {
+	Line int    // Line of the record in the archive
+	ID   string // ID of the brew / action (if available)
+	Err  error
+}
+
+func (p Problem) Error() string {
+	if p.ID == "" {
+		return fmt.Sprintf("line %d: %s", p.Line, p.Err)
+	}
+	return fmt.Sprintf("line %d (%s): %s", p.Line, p.ID, p.Err)
+}
+
+// Report denotes the outcome of an import
+type Report struct {
+	Created int // Number of brews / actions not present in the database yet
+	Updated int // Number of brews / actions replaced in the database
+	Skipped int // Number of brews / actions already present in the database and retained
+}
+
+// Read reads and validates all records of an archive, returning the valid records and a
+// problem for each invalid one
+func Read(r io.Reader) ([]Record, []Problem, error) {
+
+	ar, err := NewReader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		records  []Record
+		problems []Problem
+		brewIDs  = make(map[string]int)
+	)
+	for {
+		record, err := ar.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			problems = append(problems, Problem{Line: ar.Line(), Err: err})
+			continue
+		}
+
+		id, err := validate(record)
+		if err == nil && record.Type == brewRecord {
+			if line, exists := brewIDs[id]; exists {
+				err = fmt.Errorf("duplicate brew (see line %d)", line)
+			}
+			brewIDs[id] = ar.Line()
+		}
+		if err != nil {
+			problems = append(problems, Problem{Line: ar.Line(), ID: id, Err: err})
+			continue
+		}
+		records = append(records, record)
+	}
+
+	return records, problems, nil
+}
+
+// Import stores the brews and actions of an archive in the database as a single modification
+// (backed up if a journal is provided). Brews / actions already present in the database are
+// either skipped or updated. If dryRun is set, the database is not altered
+func Import(d db.DB, dbName string, records []Record, existing Existing, journal *backup.Journal, dryRun bool) (Report, error) {
+
+	var report Report
+	if existing != SkipExisting && existing != UpdateExisting {
+		return report, fmt.Errorf("invalid treatment of existing records: %s", existing)
+	}
+
+	changes := map[string]*backup.Change{
+		store.SummaryMeasurement:     {Measurement: store.SummaryMeasurement},
+		store.CurveMeasurement:       {Measurement: store.CurveMeasurement},
+		store.AnnotationsMeasurement: {Measurement: store.AnnotationsMeasurement},
+		action.Measurement:           {Measurement: action.Measurement},
+	}
+
+	for _, record := range records {
+		switch record.Type {
+		case brewRecord:
+			b := record.Brew
+			byID := db.Filter{Tags: map[string]string{"id": b.ID}}
+			summaries, err := d.FetchDataPoints(dbName, store.SummaryMeasurement, byID)
+			if err != nil {
+				return report, fmt.Errorf("failed to check for existing brew %s: %w", b.ID, err)
+			}
+			if len(summaries) > 0 {
+				if existing == SkipExisting {
+					report.Skipped++
+					continue
+				}
+
+				// Replace all data points of the existing brew
+				changes[store.SummaryMeasurement].Before = append(changes[store.SummaryMeasurement].Before, summaries...)
+				for _, measurement := range []string{store.CurveMeasurement, store.AnnotationsMeasurement} {
+					dataPoints, err := d.FetchDataPoints(dbName, measurement, byID)
+					if err != nil {
+						return report, fmt.Errorf("failed to retrieve existing brew %s: %w", b.ID, err)
+					}
+					changes[measurement].Before = append(changes[measurement].Before, dataPoints...)
+				}
+				report.Updated++
+			} else {
+				report.Created++
+			}
+
+			changes[store.SummaryMeasurement].After = append(changes[store.SummaryMeasurement].After, b.Summary)
+			changes[store.CurveMeasurement].After = append(changes[store.CurveMeasurement].After, b.Curve...)
+			changes[store.AnnotationsMeasurement].After = append(changes[store.AnnotationsMeasurement].After, b.Annotations...)
+
+		case actionRecord:
+			a := *record.Action
+			dataPoints, err := d.FetchDataPoints(dbName, action.Measurement, db.Filter{
+				Tags:  map[string]string{"action_type": a.Tags["action_type"]},
+				Start: a.TimeStamp,
+				End:   a.TimeStamp.Add(1),
+			})
+			if err != nil {
+				return report, fmt.Errorf("failed to check for existing action: %w", err)
+			}
+			if len(dataPoints) > 0 {
+				if existing == SkipExisting {
+					report.Skipped++
+					continue
+				}
+				changes[action.Measurement].Before = append(changes[action.Measurement].Before, dataPoints...)
+				report.Updated++
+			} else {
+				report.Created++
+			}
+			changes[action.Measurement].After = append(changes[action.Measurement].After, a)
+		}
+	}
+
+	if dryRun || report.Created+report.Updated == 0 {
+		return report, nil
+	}
+
+	m := backup.Modification{
+		Description: fmt.Sprintf("import %d new and %d updated brew(s) / action(s)", report.Created, report.Updated),
+		DB:          dbName,
+	}
+	for _, measurement := range []string{store.SummaryMeasurement, store.CurveMeasurement, store.AnnotationsMeasurement, action.Measurement} {
+		if c := changes[measurement]; len(c.Before)+len(c.After) > 0 {
+			m.Changes = append(m.Changes, *c)
+		}
+	}
+
+	return report, journal.Apply(d, m)
+}
+
+// validate checks a record for consistency, returning the ID of the brew / action
+func validate(record Record) (string, error) {
+
+	switch record.Type {
+	case brewRecord:
+		if record.Brew == nil {
+			return "", errors.New("missing brew")
+		}
+		b := record.Brew
+		if b.ID == "" {
+			return "", errors.New("missing brew ID")
+		}
+		if b.Summary.TimeStamp.IsZero() {
+			return b.ID, errors.New("missing time stamp of summary")
+		}
+		if b.Summary.Tags["id"] != b.ID {
+			return b.ID, fmt.Errorf("summary has mismatching ID %q", b.Summary.Tags["id"])
+		}
+		if shotType := b.Summary.Tags["shot_type"]; brew.ShotTypeFromString(shotType) == brew.UnknownShot {
+			return b.ID, fmt.Errorf("invalid shot type %q", shotType)
+		}
+
+		// Brews without data points are accepted (e.g. summaries imported from CSV)
+		for i, dataPoint := range b.Curve {
+			if err := validateDataPoint(b.ID, dataPoint); err != nil {
+				return b.ID, fmt.Errorf("data point %d: %w", i, err)
+			}
+			if _, exists := dataPoint.Data["weight"]; !exists {
+				return b.ID, fmt.Errorf("data point %d: missing weight", i)
+			}
+		}
+		for i, dataPoint := range b.Annotations {
+			if err := validateDataPoint(b.ID, dataPoint); err != nil {
+				return b.ID, fmt.Errorf("annotation %d: %w", i, err)
+			}
+			if event := dataPoint.Tags["event"]; brew.EventTypeFromString(event) == brew.UnknownEvent {
+				return b.ID, fmt.Errorf("annotation %d: invalid event %q", i, event)
+			}
+		}
+
+	case actionRecord:
+		if record.Action == nil {
+			return "", errors.New("missing action")
+		}
+		a := record.Action
+		id := fmt.Sprintf("%s@%d", a.Tags["action_type"], a.TimeStamp.UnixMilli())
+		if a.TimeStamp.IsZero() {
+			return id, errors.New("missing time stamp of action")
+		}
+		if strings.TrimSpace(a.Tags["action_type"]) == "" {
+			return id, errors.New("missing action type")
+		}
+		return id, nil
+
+	case headerRecord:
+		return "", errors.New("unexpected header")
+	default:
+		return "", fmt.Errorf("unknown record type %q", record.Type)
+	}
+
+	return record.Brew.ID, nil
+}
+
+func validateDataPoint(id string, dataPoint db.DataPoint) error {
+	if dataPoint.TimeStamp.IsZero() {
+		return errors.New("missing time stamp")
+	}
+	if dataPoint.Tags["id"] != id {
+		return fmt.Errorf("mismatching ID %q", dataPoint.Tags["id"])
+	}
+	return nil
+}
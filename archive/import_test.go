@@ -0,0 +1,76 @@
+package archive
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fako1024/brew/action"
+	"github.com/fako1024/brew/db"
+	"github.com/fako1024/brew/db/memory"
+	"github.com/fako1024/brew/store"
+)
+
+func TestImport(t *testing.T) {
+
+	start := time.Date(2020, 9, 23, 11, 0, 0, 0, time.UTC)
+	source := testDB(t, start)
+
+	buf := new(bytes.Buffer)
+	if _, err := Export(source, "brews", Filter{}, buf); err != nil {
+		t.Fatalf("Failed to export archive: %s", err)
+	}
+	data := buf.String()
+
+	records, problems, err := Read(strings.NewReader(data))
+	if err != nil || len(problems) > 0 || len(records) != 3 {
+		t.Fatalf("Unexpected result of reading archive: %d records, problems: %v (error: %v)", len(records), problems, err)
+	}
+
+	// A dry run does not alter the database
+	target := memory.New()
+	report, err := Import(target, "brews", records, SkipExisting, nil, true)
+	if err != nil || report.Created != 3 {
+		t.Fatalf("Unexpected dry run report: %#v (error: %v)", report, err)
+	}
+	if dataPoints, _ := target.FetchDataPoints("brews", store.SummaryMeasurement, db.Filter{}); len(dataPoints) != 0 {
+		t.Fatalf("Unexpected data points after dry run: %d", len(dataPoints))
+	}
+
+	// The import round-trips all data points
+	if report, err = Import(target, "brews", records, SkipExisting, nil, false); err != nil || report.Created != 3 {
+		t.Fatalf("Unexpected import report: %#v (error: %v)", report, err)
+	}
+	for _, measurement := range []string{store.SummaryMeasurement, store.CurveMeasurement, store.AnnotationsMeasurement, action.Measurement} {
+		expected, _ := source.FetchDataPoints("brews", measurement, db.Filter{})
+		actual, _ := target.FetchDataPoints("brews", measurement, db.Filter{})
+		if !reflect.DeepEqual(expected, actual) {
+			t.Fatalf("Unexpected data points in measurement %s after import:\nwant %v\nhave %v", measurement, expected, actual)
+		}
+	}
+
+	// Existing brews / actions are skipped or updated
+	if report, err = Import(target, "brews", records, SkipExisting, nil, false); err != nil || report.Skipped != 3 {
+		t.Fatalf("Unexpected import report: %#v (error: %v)", report, err)
+	}
+	records[0].Brew.Summary.Data["beans_weight"] = 18.
+	if report, err = Import(target, "brews", records, UpdateExisting, nil, false); err != nil || report.Updated != 3 {
+		t.Fatalf("Unexpected import report: %#v (error: %v)", report, err)
+	}
+	if summaries, _ := target.FetchDataPoints("brews", store.SummaryMeasurement, db.Filter{Tags: map[string]string{"id": records[0].Brew.ID}}); len(summaries) != 1 || summaries[0].Data["beans_weight"] != 18. {
+		t.Fatalf("Unexpected summary after update: %v", summaries)
+	}
+
+	// Invalid records are reported individually
+	lines := strings.Split(strings.TrimSpace(data), "\n")
+	lines[1] = strings.Replace(lines[1], `"shot_type":"single"`, `"shot_type":"triple"`, 1)
+	lines = append(lines, `{"type":"unknown"}`, `{invalid`)
+	if _, problems, err = Read(strings.NewReader(strings.Join(lines, "\n"))); err != nil || len(problems) != 3 {
+		t.Fatalf("Unexpected problems: %v (error: %v)", problems, err)
+	}
+	if problems[0].Line != 2 || problems[0].ID != "single" || problems[2].Line != 6 {
+		t.Fatalf("Unexpected problems: %v", problems)
+	}
+}
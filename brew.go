@@ -1 +1,54 @@
 package brew
+
+import (
+	"time"
+
+	"github.com/fako1024/btscale/pkg/scale"
+)
+
+// NetDataPoints returns the data points of the brew relative to its baseline weight, compensating
+// for any tare performed during the brew
+func (b *Brew) NetDataPoints() scale.DataPoints {
+
+	netDataPoints := make(scale.DataPoints, 0, len(b.DataPoints))
+	baseline, annotationIdx := b.Baseline, 0
+	for _, dataPoint := range b.DataPoints {
+
+		// Each tare shifts the baseline by the weight removed from the display
+		for ; annotationIdx < len(b.Annotations) && !b.Annotations[annotationIdx].TimeStamp.After(dataPoint.TimeStamp); annotationIdx++ {
+			if b.Annotations[annotationIdx].Event == TareEvent && !b.Annotations[annotationIdx].TimeStamp.Before(b.Start) {
+				baseline += b.Annotations[annotationIdx].Change
+			}
+		}
+
+		dataPoint.Weight -= baseline
+		netDataPoints = append(netDataPoints, dataPoint)
+	}
+
+	return netDataPoints
+}
+
+// Yield returns the net weight of the brew at its end, compensating for any baseline weight
+// (e.g. an untared cup) and tare performed during the brew
+func (b *Brew) Yield() float64 {
+	netDataPoints := b.NetDataPoints()
+	if len(netDataPoints) == 0 {
+		return 0.
+	}
+
+	return netDataPoints[len(netDataPoints)-1].Weight
+}
+
+// FlowTime returns the duration of the flow, i.e. from the first drop to the end of the brew
+func (b *Brew) FlowTime() time.Duration {
+	return b.End.Sub(b.Start)
+}
+
+// PumpTime returns the duration from the start of the pump to the end of the brew (as measured
+// by a barista), equal to the flow time if the start of the pump is unknown
+func (b *Brew) PumpTime() time.Duration {
+	if b.PumpStart.IsZero() {
+		return b.FlowTime()
+	}
+	return b.End.Sub(b.PumpStart)
+}
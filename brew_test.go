@@ -0,0 +1,83 @@
+package brew
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/fako1024/btscale/pkg/scale"
+)
+
+func TestNetDataPoints(t *testing.T) {
+
+	start := time.Date(2020, 9, 23, 11, 0, 0, 0, time.UTC)
+	b := Brew{
+		Start:    start,
+		Baseline: 200.,
+		DataPoints: scale.DataPoints{
+			{TimeStamp: start, Weight: 200.},
+			{TimeStamp: start.Add(time.Second), Weight: 210.},
+			{TimeStamp: start.Add(2 * time.Second), Weight: 0.},
+			{TimeStamp: start.Add(3 * time.Second), Weight: 15.},
+		},
+		Annotations: []Annotation{
+			{TimeStamp: start.Add(-10 * time.Second), Event: TareEvent, Change: -50.},
+			{TimeStamp: start.Add(2 * time.Second), Event: TareEvent, Change: -210.},
+		},
+	}
+
+	expected := []float64{0., 10., 10., 25.}
+	netDataPoints := b.NetDataPoints()
+	if len(netDataPoints) != len(expected) {
+		t.Fatalf("Unexpected number of net data points, want %d, have %d", len(expected), len(netDataPoints))
+	}
+	for i, dataPoint := range netDataPoints {
+		if math.Abs(dataPoint.Weight-expected[i]) > 1e-9 {
+			t.Fatalf("Unexpected net weight at position %d, want %.2f, have %.2f", i, expected[i], dataPoint.Weight)
+		}
+	}
+
+	if b.DataPoints[1].Weight != 210. {
+		t.Fatalf("Unexpected modification of raw data points")
+	}
+
+	if yield := b.Yield(); yield != 25. {
+		t.Fatalf("Unexpected yield, want %.2f, have %.2f", 25., yield)
+	}
+	if yield := (&Brew{}).Yield(); yield != 0. {
+		t.Fatalf("Unexpected yield for empty brew, want %.2f, have %.2f", 0., yield)
+	}
+}
+
+func TestMetadataFields(t *testing.T) {
+
+	m := Metadata{
+		Setup:            "house",
+		Beans:            "House Blend",
+		Roaster:          "Local Roasters",
+		RoastDate:        time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC),
+		Grinder:          "Vario",
+		GrinderSetting:   "3B",
+		WaterTemperature: 93.5,
+	}
+
+	fields := m.Fields()
+	if _, exists := fields["basket"]; exists {
+		t.Fatalf("Unexpected field for empty basket")
+	}
+	if fields["roast_date"] != "2020-09-01" {
+		t.Fatalf("Unexpected roast date field: %v", fields["roast_date"])
+	}
+
+	parsed, err := MetadataFromFields(fields)
+	if err != nil {
+		t.Fatalf("Failed to parse metadata from fields: %s", err)
+	}
+	if parsed != m {
+		t.Fatalf("Unexpected metadata after round trip, want %#v, have %#v", m, parsed)
+	}
+
+	if _, err := MetadataFromFields(map[string]interface{}{"roast_date": "yesterday"}); err == nil {
+		t.Fatalf("Expected error for invalid roast date")
+	}
+}
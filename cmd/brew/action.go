@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fako1024/brew/action"
+	"github.com/fako1024/brew/config"
+)
+
+type actionParams struct {
+	actionType string
+	category   string
+	timestamp  string
+	notes      string
+	params     paramsFlag
+
+	since string
+	until string
+	json  bool
+}
+
+// paramsFlag denotes a repeatable flag of key=value parameters
+type paramsFlag map[string]string
+
+func (p *paramsFlag) String() string {
+	if p == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(*p))
+	for k, v := range *p {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (p *paramsFlag) Set(value string) error {
+	k, v, found := strings.Cut(value, "=")
+	if !found || k == "" {
+		return fmt.Errorf("invalid parameter %q, expected key=value", value)
+	}
+	if *p == nil {
+		*p = make(paramsFlag)
+	}
+	(*p)[k] = v
+	return nil
+}
+
+func actionCommand() *command {
+	var p actionParams
+	settings := [][]string{config.InfluxSettings, config.DebugSettings}
+	return &command{
+		name:     "action",
+		synopsis: "Record and manage actions (e.g. maintenance) performed on the coffee machine",
+		subcommands: []*command{
+			{
+				name:     "add",
+				synopsis: "Record an action",
+				settings: settings,
+				setFlags: func(fs *flag.FlagSet) {
+					fs.StringVar(&p.actionType, "type", "", "Type of performed action")
+					fs.StringVar(&p.timestamp, "time", time.Now().Format(timestampLayout), "Timestamp at which the action was performed")
+					fs.StringVar(&p.notes, "notes", "", "Notes on the action")
+					fs.Var(&p.params, "param", "Parameter of the action as key=value (repeatable)")
+				},
+				run: func(env *environment) error {
+					return addAction(env, p)
+				},
+			},
+			{
+				name:     "list",
+				synopsis: "List recorded actions",
+				settings: settings,
+				setFlags: func(fs *flag.FlagSet) {
+					fs.StringVar(&p.category, "category", "", "Only list actions of this category")
+					fs.StringVar(&p.actionType, "type", "", "Only list actions of this type")
+					fs.StringVar(&p.since, "since", "", "Only list actions performed at / after this time")
+					fs.StringVar(&p.until, "until", "", "Only list actions performed before this time")
+					fs.BoolVar(&p.json, "json", false, "Output as JSON")
+				},
+				run: func(env *environment) error {
+					return listActions(env, p)
+				},
+			},
+			{
+				name:     "edit",
+				args:     "<id>",
+				synopsis: "Correct a recorded action (only the specified fields are changed)",
+				settings: settings,
+				setFlags: func(fs *flag.FlagSet) {
+					fs.StringVar(&p.actionType, "type", "", "Type of performed action")
+					fs.StringVar(&p.timestamp, "time", "", "Timestamp at which the action was performed")
+					fs.StringVar(&p.notes, "notes", "", "Notes on the action")
+					fs.Var(&p.params, "param", "Parameter of the action as key=value (repeatable, empty value removes the parameter)")
+				},
+				run: func(env *environment) error {
+					return editAction(env, p)
+				},
+			},
+			{
+				name:     "delete",
+				args:     "<id>",
+				synopsis: "Delete a recorded action",
+				settings: settings,
+				run:      deleteAction,
+			},
+			{
+				name:     "types",
+				synopsis: "List all supported action types",
+				run:      listActionTypes,
+			},
+		},
+	}
+}
+
+func actionStore(env *environment) (*action.Store, error) {
+	influxDB, err := env.database()
+	if err != nil {
+		return nil, err
+	}
+	return action.NewStore(influxDB, "brews"), nil
+}
+
+func addAction(env *environment, p actionParams) error {
+
+	if p.actionType == "" {
+		return usageErrorf("no action type specified")
+	}
+
+	// Attempt to parse the action timestamp
+	ts, err := parseTime(p.timestamp)
+	if err != nil {
+		return usageErrorf("failed to parse time stamp for action: %s", err)
+	}
+
+	// Check if the action type is supported and all required parameters are provided
+	record := action.Record{
+		Type:      p.actionType,
+		TimeStamp: ts,
+		Notes:     p.notes,
+		Params:    p.params,
+	}
+	if err := action.Validate(record.Type, record.Params); err != nil {
+		return usageErrorf("%s (see `brew action types`)", err)
+	}
+
+	store, err := actionStore(env)
+	if err != nil {
+		return err
+	}
+	if record, err = store.Add(record); err != nil {
+		return err
+	}
+	fmt.Fprintln(env.stdout, record.ID())
+
+	return nil
+}
+
+func listActions(env *environment, p actionParams) error {
+
+	filter := action.Filter{
+		Category: p.category,
+		Type:     p.actionType,
+	}
+	var err error
+	if filter.Start, filter.End, err = parseTimeRange(p.since, p.until); err != nil {
+		return err
+	}
+
+	store, err := actionStore(env)
+	if err != nil {
+		return err
+	}
+	records, err := store.List(filter)
+	if err != nil {
+		return err
+	}
+
+	if p.json {
+		enc := json.NewEncoder(env.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	}
+
+	w := tabwriter.NewWriter(env.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTIME\tTYPE\tCATEGORY\tPARAMETERS\tNOTES\t")
+	for _, r := range records {
+		params := paramsFlag(r.Params)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t\n", r.ID(), r.TimeStamp.Format(timestampLayout), r.Type, r.Category, params.String(), r.Notes)
+	}
+
+	return w.Flush()
+}
+
+func editAction(env *environment, p actionParams) error {
+
+	if len(env.args) != 1 {
+		return usageErrorf("expected exactly one action ID")
+	}
+
+	store, err := actionStore(env)
+	if err != nil {
+		return err
+	}
+	record, err := store.Get(env.args[0])
+	if err != nil {
+		return err
+	}
+
+	if p.actionType != "" {
+		record.Type = p.actionType
+	}
+	if p.timestamp != "" {
+		if record.TimeStamp, err = parseTime(p.timestamp); err != nil {
+			return usageErrorf("failed to parse time stamp for action: %s", err)
+		}
+	}
+	if p.notes != "" {
+		record.Notes = p.notes
+	}
+	for k, v := range p.params {
+		if record.Params == nil {
+			record.Params = make(map[string]string)
+		}
+		if v == "" {
+			delete(record.Params, k)
+			continue
+		}
+		record.Params[k] = v
+	}
+	if err := action.Validate(record.Type, record.Params); err != nil {
+		return usageErrorf("%s (see `brew action types`)", err)
+	}
+
+	if record, err = store.Update(env.args[0], record); err != nil {
+		return err
+	}
+	fmt.Fprintln(env.stdout, record.ID())
+
+	return nil
+}
+
+func deleteAction(env *environment) error {
+
+	if len(env.args) != 1 {
+		return usageErrorf("expected exactly one action ID")
+	}
+
+	store, err := actionStore(env)
+	if err != nil {
+		return err
+	}
+	if _, err := store.Get(env.args[0]); err != nil {
+		return err
+	}
+
+	return store.Delete(env.args[0])
+}
+
+func listActionTypes(env *environment) error {
+
+	w := tabwriter.NewWriter(env.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TYPE\tCATEGORY\tLABEL\tINTERVAL\tPARAMETERS\t")
+	for _, def := range action.Definitions() {
+		interval := "-"
+		if def.Interval > 0 {
+			interval = fmt.Sprintf("%dd", int(def.Interval.Hours()/24))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t\n", def.Type, def.Category, def.Label, interval, strings.Join(def.Params, ", "))
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fako1024/brew/action"
+)
+
+func TestActionTime(t *testing.T) {
+
+	// Timestamps on the command line denote local time (like the default of -time)
+	local := time.Local
+	time.Local = time.FixedZone("test", 2*60*60)
+	t.Cleanup(func() {
+		time.Local = local
+	})
+
+	d := testDB(t)
+	for _, c := range []struct {
+		args     []string
+		exitCode int
+		listed   bool // Action listed in the output
+	}{
+		{[]string{"action", "add", "-type", action.BackFlush, "-time", "2020-09-23T11:00:00"}, exitOK, false},
+		{[]string{"action", "add", "-type", action.BackFlush, "-time", "soon"}, exitUsage, false},
+		{[]string{"action", "list", "-since", "2020-09-23T11:00:01"}, exitOK, false},
+		{[]string{"action", "list", "-since", "2020-09-23T11:00:00", "-until", "2020-09-23T11:00:01"}, exitOK, true},
+		{[]string{"action", "list", "-until", "later"}, exitUsage, false},
+	} {
+		exitCode, out := runCLI(d, c.args...)
+		if exitCode != c.exitCode || strings.Contains(out, "2020-09-23T11:00:00") != c.listed {
+			t.Fatalf("Unexpected result of %v: exit code %d (want %d), output: %s", c.args, exitCode, c.exitCode, out)
+		}
+	}
+
+	records, err := action.NewStore(d, "brews").List(action.Filter{})
+	if err != nil || len(records) != 1 {
+		t.Fatalf("Unexpected actions: %v (error: %v)", records, err)
+	}
+	if want := time.Date(2020, 9, 23, 9, 0, 0, 0, time.UTC); !records[0].TimeStamp.Equal(want) {
+		t.Fatalf("Unexpected time of action: %v (want %v)", records[0].TimeStamp, want)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/fako1024/brew/config"
+)
+
+func completionCommand() *command {
+	return &command{
+		name:     "completion",
+		args:     "<bash|zsh|fish>",
+		synopsis: "Generate a shell completion script",
+		run: func(env *environment) error {
+			if len(env.args) != 1 {
+				return usageErrorf("expected exactly one shell (bash, zsh or fish)")
+			}
+			return writeCompletion(env.stdout, env.args[0])
+		},
+	}
+}
+
+// completionEntry denotes the completion candidates for a single command path
+type completionEntry struct {
+	path  []string // Command path (without the root command)
+	words []string // Subcommands or flags
+}
+
+// completionEntries walks the command tree and collects all subcommands / flags
+func completionEntries(cmds []*command, parents []string) (entries []completionEntry) {
+
+	var names []string
+	for _, c := range cmds {
+		names = append(names, c.name)
+	}
+	entries = append(entries, completionEntry{path: parents, words: append(names, "help")})
+
+	for _, c := range cmds {
+		path := append(append([]string{}, parents...), c.name)
+		if len(c.subcommands) > 0 {
+			entries = append(entries, completionEntries(c.subcommands, path)...)
+			continue
+		}
+
+		fs := c.flagSet(c.name, io.Discard)
+		config.NewLoader(fs, c.settings...)
+		var flags []string
+		fs.VisitAll(func(f *flag.Flag) {
+			flags = append(flags, "-"+f.Name)
+		})
+		sort.Strings(flags)
+		entries = append(entries, completionEntry{path: path, words: flags})
+	}
+
+	return
+}
+
+func writeCompletion(w io.Writer, shell string) error {
+
+	entries := completionEntries(commands(), nil)
+
+	switch shell {
+	case "bash", "zsh":
+		if shell == "zsh" {
+			fmt.Fprintln(w, "autoload -U +X bashcompinit && bashcompinit")
+		}
+		fmt.Fprintln(w, "_brew_completion() {")
+		fmt.Fprintln(w, "    local cur path word")
+		fmt.Fprintln(w, "    cur=\"${COMP_WORDS[COMP_CWORD]}\"")
+		fmt.Fprintln(w, "    path=\"\"")
+		fmt.Fprintln(w, "    for word in \"${COMP_WORDS[@]:1:COMP_CWORD-1}\"; do")
+		fmt.Fprintln(w, "        case \"$word\" in -*) break ;; esac")
+		fmt.Fprintln(w, "        path=\"${path:+$path }$word\"")
+		fmt.Fprintln(w, "    done")
+		fmt.Fprintln(w, "    case \"$path\" in")
+		for _, e := range entries {
+			fmt.Fprintf(w, "        %q) COMPREPLY=($(compgen -W %q -- \"$cur\")) ;;\n", strings.Join(e.path, " "), strings.Join(e.words, " "))
+		}
+		fmt.Fprintln(w, "        *) COMPREPLY=($(compgen -f -- \"$cur\")) ;;")
+		fmt.Fprintln(w, "    esac")
+		fmt.Fprintln(w, "}")
+		fmt.Fprintln(w, "complete -F _brew_completion brew")
+	case "fish":
+		for _, e := range entries {
+			condition := "__fish_use_subcommand"
+			if len(e.path) > 0 {
+				condition = fmt.Sprintf("__fish_seen_subcommand_from %s", e.path[len(e.path)-1])
+			}
+			for _, word := range e.words {
+				if strings.HasPrefix(word, "-") {
+					fmt.Fprintf(w, "complete -c brew -n '%s' -o %s\n", condition, strings.TrimPrefix(word, "-"))
+				} else {
+					fmt.Fprintf(w, "complete -c brew -f -n '%s' -a %s\n", condition, word)
+				}
+			}
+		}
+	default:
+		return usageErrorf("unsupported shell: %s (supported: bash, zsh, fish)", shell)
+	}
+
+	return nil
+}
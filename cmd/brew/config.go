@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/fako1024/brew/config"
+)
+
+func configCommand() *command {
+	return &command{
+		name:     "config",
+		synopsis: "Inspect the configuration",
+		subcommands: []*command{
+			{
+				name:     "validate",
+				synopsis: "Validate the configuration, reporting all errors at once",
+				settings: [][]string{config.InfluxSettings, config.ProfileSettings, config.ScaleSettings, config.DebugSettings},
+
+				deferLoadErrors: true,
+				run:             validateConfig,
+			},
+		},
+	}
+}
+
+// validateConfig validates the configuration, including any errors encountered while loading it
+func validateConfig(env *environment) error {
+	if err := errors.Join(env.loadErr, env.cfg.Validate()); err != nil {
+		return configError(err)
+	}
+
+	fmt.Fprintf(env.stdout, "configuration is valid (%d scale(s))\n", len(env.cfg.Scales))
+	return nil
+}
+
+// configError generates an error denoting an invalid configuration
+func configError(err error) error {
+	return fmt.Errorf("%w:\n%s", errConfig, err)
+}
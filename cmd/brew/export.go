@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/fako1024/brew"
+	"github.com/fako1024/brew/archive"
+	"github.com/fako1024/brew/config"
+	"github.com/fako1024/brew/shotfile"
+)
+
+type exportParams struct {
+	csvFile     string
+	archiveFile string
+	since       string
+	until       string
+	shotTypes   string
+	unit        string
+	timeZone    string
+	shotsPath   string
+	format      string
+	id          string
+}
+
+func exportCommand() *command {
+	var p exportParams
+	return &command{
+		name:     "export",
+		synopsis: "Export brews (summaries, data points and actions) to an archive, brew summaries to a CSV file or shots to Beanconqueror / visualizer.coffee",
+		settings: [][]string{config.InfluxSettings, config.DebugSettings},
+		setFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(&p.archiveFile, "archive", "", "Path to archive file (JSON lines, compressed if ending in .gz)")
+			fs.StringVar(&p.csvFile, "csv", "", "Path to CSV file (summaries only)")
+			fs.StringVar(&p.since, "since", "", "Only export brews / actions at / after this time")
+			fs.StringVar(&p.until, "until", "", "Only export brews / actions before this time")
+			fs.StringVar(&p.shotTypes, "shotType", "", "Only export brews of these shot types (comma separated)")
+			fs.StringVar(&p.unit, "unit", "g", "Unit of weights in CSV file (g or oz)")
+			fs.StringVar(&p.timeZone, "timezone", "Local", "Time zone of time stamps in CSV file (e.g. UTC or Europe/Berlin)")
+			fs.StringVar(&p.shotsPath, "shots", "", "Path to shot file (or existing directory to write one file per brew to)")
+			fs.StringVar(&p.format, "format", string(shotfile.Visualizer), "Format of shot files (beanconqueror, visualizer or brew)")
+			fs.StringVar(&p.id, "id", "", "Only export the brew with this ID (shot files only)")
+		},
+		run: func(env *environment) error {
+			if countSet(p.archiveFile, p.csvFile, p.shotsPath) > 1 {
+				return usageErrorf("only one of an archive, a CSV file or a shot file can be specified")
+			}
+			switch {
+			case p.archiveFile != "":
+				return exportArchive(env, p)
+			case p.csvFile != "":
+				return exportCSV(env, p)
+			case p.shotsPath != "":
+				return exportShots(env, p)
+			}
+			return usageErrorf("no archive, CSV file or shot file specified")
+		},
+	}
+}
+
+func exportArchive(env *environment, p exportParams) error {
+
+	filter, err := p.filter()
+	if err != nil {
+		return err
+	}
+
+	influxDB, err := env.database()
+	if err != nil {
+		return err
+	}
+
+	var stats archive.Stats
+	if err := archive.WriteFile(p.archiveFile, func(w io.Writer) error {
+		stats, err = archive.Export(influxDB, "brews", filter, w)
+		return err
+	}); err != nil {
+		return fmt.Errorf("failed to export archive: %w", err)
+	}
+	env.logger.Infof("exported %d brew(s) and %d action(s) to %s", stats.Brews, stats.Actions, p.archiveFile)
+
+	return nil
+}
+
+func exportCSV(env *environment, p exportParams) error {
+
+	filter, err := p.filter()
+	if err != nil {
+		return err
+	}
+	opts := archive.CSVOptions{
+		WeightUnit: p.unit,
+	}
+	if opts.Location, err = time.LoadLocation(p.timeZone); err != nil {
+		return usageErrorf("invalid time zone %s: %s", p.timeZone, err)
+	}
+
+	influxDB, err := env.database()
+	if err != nil {
+		return err
+	}
+
+	// Write the file (replacing any existing file only once all records have been written)
+	var n int
+	if err := archive.WriteFile(p.csvFile, func(w io.Writer) error {
+		n, err = archive.WriteCSV(influxDB, "brews", filter, opts, w)
+		return err
+	}); err != nil {
+		return fmt.Errorf("failed to export CSV file: %w", err)
+	}
+	env.logger.Infof("exported %d brew summaries to %s", n, p.csvFile)
+
+	return nil
+}
+
+// filter returns the archive filter corresponding to the export parameters
+func (p exportParams) filter() (archive.Filter, error) {
+
+	var filter archive.Filter
+	var err error
+	if filter.Start, filter.End, err = parseTimeRange(p.since, p.until); err != nil {
+		return filter, err
+	}
+	if p.shotTypes != "" {
+		for _, t := range strings.Split(p.shotTypes, ",") {
+			shotType := brew.ShotTypeFromString(strings.TrimSpace(t))
+			if shotType == brew.UnknownShot {
+				return filter, usageErrorf("invalid shot type: %s", t)
+			}
+			filter.ShotTypes = append(filter.ShotTypes, shotType.String())
+		}
+	}
+
+	return filter, nil
+}
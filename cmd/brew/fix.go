@@ -0,0 +1,509 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fako1024/brew"
+	"github.com/fako1024/brew/config"
+	"github.com/fako1024/brew/store"
+)
+
+type fixParams struct {
+	id           string
+	with         string
+	shotType     string
+	beansWeight  float64
+	grindSetting string
+	fields       paramsFlag
+
+	setup    string
+	metadata brew.Metadata
+	roast    string
+
+	at         string
+	start      string
+	end        string
+	reclassify bool
+	dryRun     bool
+}
+
+func fixCommand() *command {
+	var p fixParams
+	settings := [][]string{config.InfluxSettings, config.DebugSettings}
+	commonFlags := func(fs *flag.FlagSet) {
+		fs.StringVar(&p.id, "id", "", "Brew ID to perform change on")
+		fs.BoolVar(&p.dryRun, "dryRun", false, "Only preview the change without altering the database")
+	}
+	reclassifyFlag := func(fs *flag.FlagSet) {
+		fs.BoolVar(&p.reclassify, "reclassify", false, "Reclassify the shot type of the resulting brew(s) based on their yield")
+	}
+
+	return &command{
+		name:     "fix",
+		synopsis: "Correct existing brews",
+		subcommands: []*command{
+			{
+				name:     "set",
+				synopsis: "Change the shot type and / or summary fields of a brew",
+				settings: settings,
+				setFlags: func(fs *flag.FlagSet) {
+					commonFlags(fs)
+					fs.StringVar(&p.shotType, "shotType", "", "Shot type to set")
+					fs.Float64Var(&p.beansWeight, "beansWeight", 0., "Beans weight to set")
+					fs.StringVar(&p.grindSetting, "grindSetting", "", "Grind setting to set, in the notation of the grinder (e.g. 3B) or relative (e.g. 25%, without grinder 0.0 - 1.0)")
+					fs.Var(&p.fields, "field", "Summary field to set as key=value (repeatable, empty value removes the field)")
+
+					fs.StringVar(&p.setup, "setup", "", "Apply the metadata of a configured setup (individual metadata flags take precedence)")
+					fs.StringVar(&p.metadata.Beans, "beans", "", "Beans to set")
+					fs.StringVar(&p.metadata.Roaster, "roaster", "", "Roaster to set")
+					fs.StringVar(&p.roast, "roastDate", "", "Roast date to set (format: "+brew.RoastDateLayout+")")
+					fs.StringVar(&p.metadata.Grinder, "grinder", "", "Grinder to set")
+					fs.StringVar(&p.metadata.GrinderSetting, "grinderSetting", "", "Absolute grinder setting to set (e.g. 3B)")
+					fs.StringVar(&p.metadata.Basket, "basket", "", "Basket to set")
+					fs.Float64Var(&p.metadata.WaterTemperature, "waterTemperature", 0., "Water temperature to set")
+					fs.StringVar(&p.metadata.Recipe, "recipe", "", "Recipe to set")
+				},
+				run: func(env *environment) error {
+					return setBrewFields(env, p)
+				},
+			},
+			{
+				name:     "delete",
+				synopsis: "Delete a brew (summary, data points and annotations)",
+				settings: settings,
+				setFlags: commonFlags,
+				run: func(env *environment) error {
+					return deleteBrew(env, p)
+				},
+			},
+			{
+				name:     "split",
+				synopsis: "Split a brew that erroneously contains two shots",
+				settings: settings,
+				setFlags: func(fs *flag.FlagSet) {
+					commonFlags(fs)
+					reclassifyFlag(fs)
+					fs.StringVar(&p.at, "at", "", "Time of the split (offset from the start of the brew, e.g. 25s, or timestamp)")
+				},
+				run: func(env *environment) error {
+					return splitBrew(env, p)
+				},
+			},
+			{
+				name:     "merge",
+				synopsis: "Merge two brews that erroneously were tracked separately",
+				settings: settings,
+				setFlags: func(fs *flag.FlagSet) {
+					commonFlags(fs)
+					reclassifyFlag(fs)
+					fs.StringVar(&p.with, "with", "", "Brew ID to merge with")
+				},
+				run: func(env *environment) error {
+					return mergeBrews(env, p)
+				},
+			},
+			{
+				name:     "trim",
+				synopsis: "Remove data points from the start and / or end of a brew",
+				settings: settings,
+				setFlags: func(fs *flag.FlagSet) {
+					commonFlags(fs)
+					reclassifyFlag(fs)
+					fs.StringVar(&p.start, "start", "", "New start of the brew (offset from the start of the brew, e.g. 2s, or timestamp)")
+					fs.StringVar(&p.end, "end", "", "New end of the brew (offset from the start of the brew, e.g. 30s, or timestamp)")
+				},
+				run: func(env *environment) error {
+					return trimBrew(env, p)
+				},
+			},
+		},
+	}
+}
+
+func setBrewFields(env *environment, p fixParams) error {
+
+	// Collect all fields to set (metadata / setup first, explicit fields take precedence)
+	fields, err := metadataFields(env.cfg, p)
+	if err != nil {
+		return err
+	}
+	values := make(map[string]string, len(fields)+len(p.fields)+3)
+	for k, v := range fields {
+		values[k] = fmt.Sprint(v)
+	}
+	if p.shotType != "" {
+		values["shot_type"] = p.shotType
+	}
+	if p.beansWeight > 0. {
+		values["beans_weight"] = fmt.Sprint(p.beansWeight)
+	}
+	if len(values) == 0 && len(p.fields) == 0 && p.grindSetting == "" {
+		return usageErrorf("nothing to change, specify a shot type and / or fields to set")
+	}
+
+	s, original, err := loadBrew(env, p.id)
+	if err != nil {
+		return err
+	}
+	if err := grindSettingFields(env.cfg, p.grindSetting, values, original); err != nil {
+		return usageErrorf("%s", err)
+	}
+	for k, v := range p.fields {
+		values[k] = v
+	}
+
+	corrected := cloneEntry(original)
+	for _, k := range sortedKeys(values) {
+		if err := corrected.SetField(k, values[k]); err != nil {
+			return usageErrorf("%s", err)
+		}
+	}
+
+	return applyFix(env, s, p.dryRun, []store.Entry{original}, []store.Entry{corrected})
+}
+
+func deleteBrew(env *environment, p fixParams) error {
+
+	s, original, err := loadBrew(env, p.id)
+	if err != nil {
+		return err
+	}
+
+	return applyFix(env, s, p.dryRun, []store.Entry{original}, nil)
+}
+
+func splitBrew(env *environment, p fixParams) error {
+
+	if p.at == "" {
+		return usageErrorf("no split time specified")
+	}
+	s, original, err := loadBrew(env, p.id)
+	if err != nil {
+		return err
+	}
+	at, err := parseBrewTime(original.Brew, p.at)
+	if err != nil {
+		return err
+	}
+
+	first, second, err := original.Split(at)
+	if err != nil {
+		return usageErrorf("%s", err)
+	}
+	// The score of the original brew does not apply to either part
+	first.Score, second.Score = nil, nil
+	replacements := []store.Entry{
+		cloneEntry(store.Entry{Brew: first, Tags: original.Tags, Fields: original.Fields}),
+		cloneEntry(store.Entry{Brew: second, Tags: original.Tags, Fields: original.Fields}),
+	}
+	if p.reclassify {
+		reclassify(env.cfg, replacements...)
+	}
+
+	return applyFix(env, s, p.dryRun, []store.Entry{original}, replacements)
+}
+
+func mergeBrews(env *environment, p fixParams) error {
+
+	if p.with == "" {
+		return usageErrorf("no brew ID to merge with specified")
+	}
+	s, a, err := loadBrew(env, p.id)
+	if err != nil {
+		return err
+	}
+	_, b, err := loadBrew(env, p.with)
+	if err != nil {
+		return err
+	}
+
+	merged, err := brew.Merge(a.Brew, b.Brew)
+	if err != nil {
+		return usageErrorf("%s", err)
+	}
+
+	// The merged brew retains the tags / fields of the earlier brew
+	replacement := store.Entry{Brew: merged, Tags: a.Tags, Fields: a.Fields}
+	if merged.ID == b.ID {
+		replacement.Tags, replacement.Fields = b.Tags, b.Fields
+	}
+	if p.reclassify {
+		reclassify(env.cfg, replacement)
+	}
+
+	return applyFix(env, s, p.dryRun, []store.Entry{a, b}, []store.Entry{replacement})
+}
+
+func trimBrew(env *environment, p fixParams) error {
+
+	if p.start == "" && p.end == "" {
+		return usageErrorf("no start and / or end specified")
+	}
+	s, original, err := loadBrew(env, p.id)
+	if err != nil {
+		return err
+	}
+
+	var start, end time.Time
+	if p.start != "" {
+		if start, err = parseBrewTime(original.Brew, p.start); err != nil {
+			return err
+		}
+	}
+	if p.end != "" {
+		if end, err = parseBrewTime(original.Brew, p.end); err != nil {
+			return err
+		}
+	}
+
+	trimmed := cloneEntry(original)
+	if err := trimmed.Trim(start, end); err != nil {
+		return usageErrorf("%s", err)
+	}
+
+	// Annotations outside of the trimmed brew no longer apply
+	var annotations []brew.Annotation
+	for _, annotation := range trimmed.Annotations {
+		if !annotation.TimeStamp.Before(trimmed.Start) && !annotation.TimeStamp.After(trimmed.End) {
+			annotations = append(annotations, annotation)
+		}
+	}
+	trimmed.Annotations = annotations
+	if p.reclassify {
+		reclassify(env.cfg, trimmed)
+	}
+
+	return applyFix(env, s, p.dryRun, []store.Entry{original}, []store.Entry{trimmed})
+}
+
+// loadBrew retrieves a stored brew
+func loadBrew(env *environment, id string) (*store.Store, store.Entry, error) {
+	if id == "" {
+		return nil, store.Entry{}, usageErrorf("no brew ID specified")
+	}
+
+	s, err := brewStore(env)
+	if err != nil {
+		return nil, store.Entry{}, err
+	}
+	e, err := s.Load(id)
+
+	return s, e, err
+}
+
+// brewStore returns the store of brews to correct (backing up all replaced brews to the
+// journal and compressing the corrected ones as configured)
+func brewStore(env *environment) (*store.Store, error) {
+
+	influxDB, err := env.database()
+	if err != nil {
+		return nil, err
+	}
+	compression, err := env.cfg.Influx.CurveCompression()
+	if err != nil {
+		return nil, configError(err)
+	}
+
+	return store.New(influxDB, "brews", store.WithJournal(env.journal()), store.WithCompression(compression)), nil
+}
+
+// applyFix replaces the original brews by the corrected ones (or only previews the change)
+func applyFix(env *environment, s *store.Store, dryRun bool, originals, replacements []store.Entry) error {
+
+	if err := printFix(env, originals, replacements); err != nil {
+		return err
+	}
+	if dryRun {
+		fmt.Fprintln(env.stdout, "dry run, no changes applied")
+		return nil
+	}
+
+	if err := s.Replace(originals, replacements); err != nil {
+		return fmt.Errorf("failed to apply correction: %w", err)
+	}
+	env.logger.Infof("successfully corrected %d brew(s), resulting in %d brew(s)", len(originals), len(replacements))
+
+	return nil
+}
+
+// printFix prints all fields of the original and corrected brews side by side (matched by ID)
+func printFix(env *environment, originals, replacements []store.Entry) error {
+
+	ids, before, after := []string{}, make(map[string]map[string]string), make(map[string]map[string]string)
+	for _, e := range originals {
+		ids = append(ids, e.ID)
+		before[e.ID] = e.Flatten()
+	}
+	for _, e := range replacements {
+		if _, exists := before[e.ID]; !exists {
+			ids = append(ids, e.ID)
+		}
+		after[e.ID] = e.Flatten()
+	}
+
+	w := tabwriter.NewWriter(env.stdout, 0, 4, 2, ' ', 0)
+	for _, id := range ids {
+		switch {
+		case before[id] == nil:
+			fmt.Fprintf(w, "brew %s (new)\t\t\t\n", id)
+		case after[id] == nil:
+			fmt.Fprintf(w, "brew %s (deleted)\t\t\t\n", id)
+		default:
+			fmt.Fprintf(w, "brew %s\t\t\t\n", id)
+		}
+		fmt.Fprintln(w, "FIELD\tBEFORE\tAFTER\t")
+
+		keys := make(map[string]string)
+		for k := range before[id] {
+			keys[k] = ""
+		}
+		for k := range after[id] {
+			keys[k] = ""
+		}
+		for _, k := range sortedKeys(keys) {
+			old, updated := valueOrDash(before[id], k), valueOrDash(after[id], k)
+			marker := ""
+			if old != updated {
+				marker = " *"
+			}
+			fmt.Fprintf(w, "%s%s\t%s\t%s\t\n", k, marker, old, updated)
+		}
+		fmt.Fprintln(w, "\t\t\t")
+	}
+
+	return w.Flush()
+}
+
+// parseBrewTime parses a point in time within a brew, either as offset from its start or as
+// absolute (local) timestamp
+func parseBrewTime(b *brew.Brew, value string) (time.Time, error) {
+	if offset, err := time.ParseDuration(value); err == nil {
+		return b.Start.Add(offset), nil
+	}
+	ts, err := parseTime(value)
+	if err != nil {
+		return time.Time{}, usageErrorf("failed to parse time %q, expected offset (e.g. 25s) or timestamp", value)
+	}
+
+	return ts, nil
+}
+
+// reclassify determines the shot type of the provided brews based on their yield
+func reclassify(cfg *config.Config, entries ...store.Entry) {
+	for _, e := range entries {
+		e.ShotType = brew.Classify(e.Yield(), cfg.Defaults.ExpectedSingleShotWeight, cfg.Defaults.ExpectedDoubleShotWeight)
+	}
+}
+
+// cloneEntry creates a copy of a brew entry that can be altered independently
+func cloneEntry(e store.Entry) store.Entry {
+	b := *e.Brew
+	b.DataPoints = append(b.DataPoints[:0:0], e.DataPoints...)
+	b.Annotations = append(b.Annotations[:0:0], e.Annotations...)
+
+	cloned := store.Entry{
+		Brew:   &b,
+		Tags:   make(map[string]string, len(e.Tags)),
+		Fields: make(map[string]interface{}, len(e.Fields)),
+	}
+	for k, v := range e.Tags {
+		cloned.Tags[k] = v
+	}
+	for k, v := range e.Fields {
+		cloned.Fields[k] = v
+	}
+
+	return cloned
+}
+
+// metadataFields returns the metadata fields to set, combining a configured setup (if
+// requested) and the individual metadata flags
+func metadataFields(cfg *config.Config, p fixParams) (map[string]interface{}, error) {
+
+	var metadata brew.Metadata
+	if p.setup != "" {
+		setup, exists := cfg.Setups[p.setup]
+		if !exists {
+			return nil, usageErrorf("unknown setup: %s", p.setup)
+		}
+		var err error
+		if metadata, err = setup.Metadata(p.setup); err != nil {
+			return nil, configError(err)
+		}
+	}
+
+	if p.roast != "" {
+		roastDate, err := time.Parse(brew.RoastDateLayout, p.roast)
+		if err != nil {
+			return nil, usageErrorf("failed to parse roast date: %s", err)
+		}
+		p.metadata.RoastDate = roastDate
+	}
+
+	fields := metadata.Fields()
+	for k, v := range p.metadata.Fields() {
+		fields[k] = v
+	}
+
+	return fields, nil
+}
+
+// grindSettingFields sets the relative grind setting and the native setting of the grinder (the
+// one set, the brew was made with or the default grinder) from each other
+func grindSettingFields(cfg *config.Config, setting string, values map[string]string, e store.Entry) error {
+
+	grinderName := values["grinder"]
+	if grinderName == "" {
+		grinderName = e.Metadata.Grinder
+	}
+	if grinderName == "" {
+		grinderName = cfg.Defaults.Grinder
+	}
+	profile, err := cfg.GrinderProfile(grinderName)
+	isKnown := grinderName != "" && err == nil
+
+	if setting != "" {
+		relative, err := cfg.ParseGrindSetting(setting, grinderName)
+		if err != nil {
+			return err
+		}
+		values["grind_setting"] = fmt.Sprint(relative)
+		if _, exists := values["grinder_setting"]; !exists && isKnown {
+			if values["grinder_setting"], err = profile.Format(relative); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if native, exists := values["grinder_setting"]; exists && isKnown {
+		relative, err := profile.Normalize(native)
+		if err != nil {
+			return err
+		}
+		values["grind_setting"] = fmt.Sprint(relative)
+	}
+
+	return nil
+}
+
+func valueOrDash(values map[string]string, key string) string {
+	if v, exists := values[key]; exists && strings.TrimSpace(v) != "" {
+		return v
+	}
+	return "-"
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
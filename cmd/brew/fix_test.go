@@ -0,0 +1,129 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fako1024/brew"
+	"github.com/fako1024/brew/config"
+	"github.com/fako1024/brew/store"
+)
+
+func TestFix(t *testing.T) {
+
+	for _, c := range []struct {
+		name     string
+		args     []string
+		exitCode int
+		brews    int    // Number of stored brews afterwards
+		shotType string // Shot type of brew "test" afterwards (if retained)
+	}{
+		{"no subcommand", []string{"fix"}, exitUsage, 1, "single"},
+		{"unknown subcommand", []string{"fix", "unknown"}, exitUsage, 1, "single"},
+		{"unknown flag", []string{"fix", "set", "-unknown"}, exitUsage, 1, "single"},
+		{"no ID", []string{"fix", "set", "-shotType", "double"}, exitUsage, 1, "single"},
+		{"nothing to change", []string{"fix", "set", "-id", "test"}, exitUsage, 1, "single"},
+		{"invalid shot type", []string{"fix", "set", "-id", "test", "-shotType", "triple"}, exitUsage, 1, "single"},
+		{"derived field", []string{"fix", "set", "-id", "test", "-field", "end_weight=42"}, exitUsage, 1, "single"},
+		{"invalid grind setting", []string{"fix", "set", "-id", "test", "-grindSetting", "3B"}, exitUsage, 1, "single"},
+		{"unknown brew", []string{"fix", "set", "-id", "missing", "-shotType", "double"}, exitFailure, 1, "single"},
+		{"invalid configuration", []string{"fix", "set", "-id", "test", "-shotType", "double", "-influxCompression", "zip"}, exitConfig, 1, "single"},
+		{"dry run", []string{"fix", "set", "-id", "test", "-shotType", "double", "-dryRun"}, exitOK, 1, "single"},
+		{"set", []string{"fix", "set", "-id", "test", "-shotType", "double", "-grindSetting", "25%"}, exitOK, 1, "double"},
+		{"no split time", []string{"fix", "split", "-id", "test"}, exitUsage, 1, "single"},
+		{"split outside brew", []string{"fix", "split", "-id", "test", "-at", "1h"}, exitUsage, 1, "single"},
+		{"invalid split time", []string{"fix", "split", "-id", "test", "-at", "soon"}, exitUsage, 1, "single"},
+		{"split", []string{"fix", "split", "-id", "test", "-at", "15s"}, exitOK, 2, "single"},
+		{"no trim", []string{"fix", "trim", "-id", "test"}, exitUsage, 1, "single"},
+		{"delete", []string{"fix", "delete", "-id", "test"}, exitOK, 0, ""},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			d := testDB(t)
+			if exitCode, out := runCLI(d, c.args...); exitCode != c.exitCode {
+				t.Fatalf("Unexpected exit code for %v: %d (want %d), output: %s", c.args, exitCode, c.exitCode, out)
+			}
+
+			s := store.New(d, "brews")
+			ids, err := s.IDs(time.Time{}, time.Time{})
+			if err != nil || len(ids) != c.brews {
+				t.Fatalf("Unexpected brews after %v: %v (error: %v)", c.args, ids, err)
+			}
+			if c.shotType == "" {
+				return
+			}
+			e, err := s.Load("test")
+			if err != nil || e.ShotType.String() != c.shotType {
+				t.Fatalf("Unexpected brew after %v: %v (error: %v)", c.args, e.Brew, err)
+			}
+		})
+	}
+
+	// Without database, the InfluxDB endpoint is required
+	testDB(t)
+	t.Setenv(config.EnvPrefix+"INFLUX_ENDPOINT", "")
+	if exitCode, _ := runCLI(nil, "fix", "set", "-id", "test", "-shotType", "double"); exitCode != exitConfig {
+		t.Fatalf("Unexpected exit code without InfluxDB endpoint: %d", exitCode)
+	}
+}
+
+func TestFixCurve(t *testing.T) {
+
+	// Steps are executed in order on the same database
+	d := testDB(t)
+	s := store.New(d, "brews")
+	original, err := s.Load("test")
+	if err != nil {
+		t.Fatalf("Failed to load test brew: %s", err)
+	}
+	original.Score = &brew.Score{Reference: "espresso", Score: 90.}
+	original.Fields = map[string]interface{}{"battery_level": 0.8}
+	if err := s.Save(original); err != nil {
+		t.Fatalf("Failed to save test brew: %s", err)
+	}
+
+	for _, c := range []struct {
+		args       []string
+		brews      int           // Number of stored brews afterwards
+		start, end time.Duration // Start / end of brew "test" afterwards (offset from the original start)
+	}{
+		{[]string{"fix", "trim", "-id", "test", "-start", "2s", "-end", "28s"}, 1, 2 * time.Second, 28 * time.Second},
+		{[]string{"fix", "split", "-id", "test", "-at", "15s"}, 2, 2 * time.Second, 16 * time.Second},
+		{[]string{"fix", "merge", "-id", "test", "-with"}, 1, 2 * time.Second, 28 * time.Second},
+	} {
+		ids, err := s.IDs(time.Time{}, time.Time{})
+		if err != nil {
+			t.Fatalf("Failed to retrieve brews: %s", err)
+		}
+
+		// Merge with the brew split off before
+		args := c.args
+		if args[len(args)-1] == "-with" {
+			args = append(args, ids[len(ids)-1])
+		}
+		if exitCode, out := runCLI(d, args...); exitCode != exitOK {
+			t.Fatalf("Unexpected exit code for %v: %d, output: %s", args, exitCode, out)
+		}
+
+		if ids, err = s.IDs(time.Time{}, time.Time{}); err != nil || len(ids) != c.brews {
+			t.Fatalf("Unexpected brews after %v: %v (error: %v)", args, ids, err)
+		}
+		for _, id := range ids {
+			e, err := s.Load(id)
+			if err != nil {
+				t.Fatalf("Failed to load brew %s after %v: %s", id, args, err)
+			}
+			if e.Fields["battery_level"] != 0.8 {
+				t.Fatalf("Unexpected fields of brew %s after %v: %v", id, args, e.Fields)
+			}
+			if c.args[1] == "split" && e.Score != nil {
+				t.Fatalf("Unexpected score of brew %s after %v: %v", id, args, e.Score)
+			}
+			if id != "test" {
+				continue
+			}
+			if !e.Start.Equal(original.Start.Add(c.start)) || !e.End.Equal(original.Start.Add(c.end)) {
+				t.Fatalf("Unexpected brew after %v: %v - %v", args, e.Start, e.End)
+			}
+		}
+	}
+}
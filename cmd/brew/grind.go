@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/fako1024/brew"
+	"github.com/fako1024/brew/config"
+	"github.com/fako1024/brew/grind"
+	"github.com/fako1024/brew/stats"
+)
+
+type grindParams struct {
+	pack     string
+	shotType string
+	json     bool
+}
+
+func grindCommand() *command {
+	var p grindParams
+	return &command{
+		name:     "grind",
+		synopsis: "Recommend a grind adjustment based on recent brews",
+		settings: [][]string{config.InfluxSettings, config.ProfileSettings, config.DebugSettings},
+		setFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(&p.pack, "pack", "", "ID of the pack of beans (default: pack of the most recent brew)")
+			fs.StringVar(&p.shotType, "shotType", brew.DoubleShot.String(), "Shot type (single or double)")
+			fs.BoolVar(&p.json, "json", false, "Output as JSON")
+		},
+		run: func(env *environment) error {
+			return recommendGrind(env, p)
+		},
+	}
+}
+
+func recommendGrind(env *environment, p grindParams) error {
+
+	shotType := brew.ShotTypeFromString(p.shotType)
+	if shotType == brew.UnknownShot {
+		return usageErrorf("invalid shot type: %s", p.shotType)
+	}
+	target, err := env.cfg.GrindTarget(shotType)
+	if err != nil {
+		return configError(err)
+	}
+
+	influxDB, err := env.database()
+	if err != nil {
+		return err
+	}
+	history, err := stats.Load(influxDB, "brews", time.Time{}, time.Time{})
+	if err != nil {
+		return err
+	}
+
+	pack := p.pack
+	if pack == "" {
+		if pack, err = grind.LatestPack(history, shotType.String()); err != nil {
+			return err
+		}
+	}
+	r, err := grind.Recommend(history, pack, shotType.String(), target, env.cfg.Grind.Options()...)
+	if err != nil {
+		return err
+	}
+
+	if p.json {
+		enc := json.NewEncoder(env.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	}
+
+	fmt.Fprintf(env.stdout, "Pack %s (%s shots, last %d brews)\n", r.Pack, r.ShotType, r.Brews)
+	fmt.Fprintf(env.stdout, "  brew time: %6.2fs (target: %.2fs)\n", r.BrewTime, r.TargetBrewTime)
+	fmt.Fprintf(env.stdout, "  yield:     %6.2f  (target: %.2f)\n", r.Yield, r.TargetYield)
+	fmt.Fprintf(env.stdout, "  flow:      %6.2f/s (target: %.2f/s)\n", r.Flow, r.TargetFlow)
+	fmt.Fprintf(env.stdout, "  sensitivity: %.1fs per unit grind setting (%s)\n", r.Sensitivity.Value, r.Sensitivity.Source)
+	if r.Direction == grind.Keep {
+		fmt.Fprintf(env.stdout, "Keep the grind setting at %.3f (time error: %+.2fs)\n", r.CurrentSetting, r.TimeError)
+		return nil
+	}
+	fmt.Fprintf(env.stdout, "Grind %s: %.3f -> %.3f (%+.3f, time error: %+.2fs)\n", r.Direction, r.CurrentSetting, r.RecommendedSetting, r.Adjustment, r.TimeError)
+
+	return nil
+}
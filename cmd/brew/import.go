@@ -0,0 +1,143 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/fako1024/brew/archive"
+	"github.com/fako1024/brew/config"
+	"github.com/fako1024/brew/shotfile"
+)
+
+type importParams struct {
+	csvFile     string
+	archiveFile string
+	existing    string
+	dryRun      bool
+	mapping     string
+	timeZone    string
+	unit        string
+	shotsPath   string
+	format      string
+}
+
+func importCommand() *command {
+	var p importParams
+	return &command{
+		name:     "import",
+		synopsis: "Import brews (summaries, data points and actions) from an archive, brew summaries from a CSV file or shots from Beanconqueror / visualizer.coffee",
+		settings: [][]string{config.InfluxSettings, config.ProfileSettings, config.DebugSettings},
+		setFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(&p.archiveFile, "archive", "", "Path to archive file (as written by `brew export -archive`)")
+			fs.StringVar(&p.csvFile, "csv", "", "Path to CSV file (summaries only)")
+			fs.StringVar(&p.existing, "existing", string(archive.SkipExisting), "Treatment of brews / actions already present in the database (skip or update)")
+			fs.BoolVar(&p.dryRun, "dryRun", false, "Only validate the archive / CSV file and report the changes without altering the database")
+			fs.StringVar(&p.mapping, "mapping", "native", "Column mapping of CSV file (native, legacy, acaia, beanconqueror or user-defined)")
+			fs.StringVar(&p.timeZone, "timezone", "", "Time zone of CSV time stamps without zone information (overrides the mapping)")
+			fs.StringVar(&p.unit, "unit", "", "Unit of weights in CSV file (g or oz, overrides the mapping)")
+			fs.StringVar(&p.shotsPath, "shots", "", "Path to shot file (or directory containing shot files)")
+			fs.StringVar(&p.format, "format", string(shotfile.Visualizer), "Format of shot files (beanconqueror, visualizer or brew)")
+		},
+		run: func(env *environment) error {
+			if countSet(p.archiveFile, p.csvFile, p.shotsPath) > 1 {
+				return usageErrorf("only one of an archive, a CSV file or a shot file can be specified")
+			}
+			switch {
+			case p.archiveFile != "":
+				return importArchive(env, p)
+			case p.csvFile != "":
+				return importCSV(env, p)
+			case p.shotsPath != "":
+				return importShots(env, p)
+			}
+			return usageErrorf("no archive, CSV file or shot file specified")
+		},
+	}
+}
+
+func importArchive(env *environment, p importParams) error {
+
+	f, err := archive.Open(p.archiveFile)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	// Validate all records up front, refusing to import anything if any of them is invalid
+	records, problems, err := archive.Read(f)
+	if err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	return importRecords(env, p, "archive", records, problems)
+}
+
+func importCSV(env *environment, p importParams) error {
+
+	mapping, err := env.cfg.CSVMapping(p.mapping)
+	if err != nil {
+		return usageErrorf("%s", err)
+	}
+	if p.timeZone != "" {
+		if mapping.Location, err = time.LoadLocation(p.timeZone); err != nil {
+			return usageErrorf("invalid time zone %s: %s", p.timeZone, err)
+		}
+	}
+	if p.unit != "" {
+		mapping.WeightUnit = p.unit
+	}
+
+	f, err := os.Open(p.csvFile)
+	if err != nil {
+		return fmt.Errorf("failed to open CSV file: %w", err)
+	}
+	defer f.Close()
+
+	// Brews without shot type are classified based on the default profile
+	records, problems, err := archive.ReadCSV(f, archive.CSVReadOptions{
+		Mapping:                  mapping,
+		ExpectedSingleShotWeight: env.cfg.Defaults.ExpectedSingleShotWeight,
+		ExpectedDoubleShotWeight: env.cfg.Defaults.ExpectedDoubleShotWeight,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read CSV file: %w", err)
+	}
+
+	return importRecords(env, p, "CSV file", records, problems)
+}
+
+// importRecords stores validated records in the database, refusing to import anything if any
+// record is invalid
+func importRecords(env *environment, p importParams, source string, records []archive.Record, problems []archive.Problem) error {
+
+	existing := archive.Existing(p.existing)
+	if existing != archive.SkipExisting && existing != archive.UpdateExisting {
+		return usageErrorf("invalid treatment of existing brews / actions: %s (expected skip or update)", p.existing)
+	}
+
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Fprintln(env.stdout, problem)
+		}
+		return fmt.Errorf("%s contains %d invalid record(s), nothing imported", source, len(problems))
+	}
+
+	influxDB, err := env.database()
+	if err != nil {
+		return err
+	}
+	report, err := archive.Import(influxDB, "brews", records, existing, env.journal(), p.dryRun)
+	if err != nil {
+		return fmt.Errorf("failed to import %s: %w", source, err)
+	}
+
+	prefix := "imported"
+	if p.dryRun {
+		prefix = "dry run, would have imported"
+	}
+	fmt.Fprintf(env.stdout, "%s %d record(s): %d new, %d updated, %d skipped (already existing)\n", prefix, report.Created+report.Updated, report.Created, report.Updated, report.Skipped)
+
+	return nil
+}
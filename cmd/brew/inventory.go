@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fako1024/brew"
+	"github.com/fako1024/brew/api"
+	"github.com/fako1024/brew/config"
+	"github.com/fako1024/brew/inventory"
+)
+
+type inventoryParams struct {
+	pack      inventory.Pack
+	roastDate string
+}
+
+func inventoryCommand() *command {
+	var p inventoryParams
+	return &command{
+		name:     "inventory",
+		synopsis: "Manage the coffee bean inventory of the running daemon",
+		subcommands: []*command{
+			{
+				name:     "status",
+				synopsis: "Show the active pack of beans and all registered packs",
+				settings: [][]string{config.ControlAPISettings, config.DebugSettings},
+				run: func(env *environment) error {
+					return showInventory(env, nil)
+				},
+			},
+			{
+				name:     "add",
+				synopsis: "Register a new pack of beans (recorded as new_coffee_pack action)",
+				settings: [][]string{config.ControlAPISettings, config.DebugSettings},
+				setFlags: func(fs *flag.FlagSet) {
+					fs.StringVar(&p.pack.Name, "name", "", "Name of the beans")
+					fs.StringVar(&p.pack.Roaster, "roaster", "", "Roaster of the beans")
+					fs.StringVar(&p.roastDate, "roastDate", "", "Roast date of the beans (format: "+brew.RoastDateLayout+")")
+					fs.Float64Var(&p.pack.Weight, "weight", 0., "Weight of the beans in the pack")
+				},
+				run: func(env *environment) error {
+					if p.pack.Name == "" {
+						return usageErrorf("no pack name specified")
+					}
+					if p.pack.Weight <= 0. {
+						return usageErrorf("no valid pack weight specified")
+					}
+					if p.roastDate != "" {
+						roastDate, err := time.Parse(brew.RoastDateLayout, p.roastDate)
+						if err != nil {
+							return usageErrorf("failed to parse roast date: %s", err)
+						}
+						p.pack.RoastDate = roastDate
+					}
+					return showInventory(env, &p.pack)
+				},
+			},
+		},
+	}
+}
+
+// showInventory shows the state of the bean inventory, registering a new pack first (if provided)
+func showInventory(env *environment, pack *inventory.Pack) error {
+
+	if env.cfg.ControlAPI == "" {
+		return fmt.Errorf("%w: no control API endpoint specified", errConfig)
+	}
+	client := api.NewClient(env.cfg.ControlAPI)
+
+	var (
+		status api.InventoryStatus
+		err    error
+	)
+	if pack != nil {
+		status, err = client.RegisterPack(*pack)
+	} else {
+		status, err = client.Inventory()
+	}
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(env.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tROASTER\tROAST DATE\tOPENED\tREMAINING\tBREWS\t")
+	for i := len(status.Packs) - 1; i >= 0; i-- {
+		p := status.Packs[i]
+		roastDate := ""
+		if !p.RoastDate.IsZero() {
+			roastDate = p.RoastDate.Format(brew.RoastDateLayout)
+		}
+		if status.Active != nil && p.ID == status.Active.ID {
+			p.Name += " (active)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%.1f / %.1f\t%d\t\n", p.Name, p.Roaster, roastDate, p.Opened.Format(timestampLayout), p.Remaining, p.Weight, p.NBrews)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for _, warning := range status.Warnings {
+		fmt.Fprintf(env.stdout, "WARNING: %s\n", warning)
+	}
+
+	return nil
+}
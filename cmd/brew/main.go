@@ -1,110 +1,275 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
+	"io"
 	"os"
-	"os/signal"
-	"syscall"
+	"strings"
 	"time"
 
+	"github.com/fako1024/brew/action"
+	"github.com/fako1024/brew/config"
+	"github.com/fako1024/brew/db"
+	"github.com/fako1024/brew/db/backup"
 	"github.com/fako1024/brew/db/influx"
-	"github.com/fako1024/brew/scanner"
-	"github.com/fako1024/btscale/pkg/api"
-	"github.com/fako1024/btscale/pkg/felicita"
 	"github.com/fako1024/btscale/pkg/scale"
-	"github.com/fako1024/gatt"
 )
 
-type config struct {
-	apiEndpoint string
+const (
+	timestampLayout = "2006-01-02T15:04:05"
 
-	influxEndpoint string
-	influxUser     string
-	influxPassword string
+	exitOK      = 0 // Command completed successfully
+	exitFailure = 1 // Command failed
+	exitUsage   = 2 // Invalid usage (unknown command, invalid flags / arguments)
+	exitConfig  = 3 // Invalid configuration
+)
+
+var (
+	errUsage  = errors.New("invalid usage")
+	errConfig = errors.New("invalid configuration")
+)
+
+// command denotes a (sub-)command of the brew CLI
+type command struct {
+	name     string     // Name of the command
+	args     string     // Synopsis of positional arguments (if any)
+	synopsis string     // One-line description of the command
+	settings [][]string // Shared configuration settings exposed as flags
+
+	deferLoadErrors bool // Pass configuration load errors to the command instead of failing
+
+	setFlags    func(fs *flag.FlagSet)       // Registers command specific flags (optional)
+	run         func(env *environment) error // Executes the command
+	subcommands []*command                   // Subcommands (if any, replaces run)
+}
+
+// environment denotes the execution environment of a command
+type environment struct {
+	cfg     *config.Config
+	loadErr error // Errors encountered while loading the configuration (if deferred)
+	logger  scale.Logger
+	args    []string
+
+	stdout io.Writer
+	db     db.DB // Database to operate on instead of the InfluxDB (e.g. in tests)
+}
+
+// database returns the database to operate on (the InfluxDB based on the configuration,
+// unless provided by the environment)
+func (e *environment) database() (db.DB, error) {
+	if e.db != nil {
+		return e.db, nil
+	}
+	influxDB, err := e.influxDB()
+	if err != nil {
+		return nil, err
+	}
+
+	return influxDB, nil
+}
+
+// influxDB returns an InfluxDB instance based on the configuration
+func (e *environment) influxDB() (*influx.DB, error) {
+	if e.cfg.Influx.Endpoint == "" {
+		return nil, fmt.Errorf("%w: no InfluxDB endpoint specified", errConfig)
+	}
+
+	return influx.New(
+		e.cfg.Influx.Endpoint,
+		e.cfg.Influx.User,
+		e.cfg.Influx.Password,
+		influx.WithJournal(e.journal()),
+	), nil
+}
 
-	beansWeightSingle float64
-	beansWeightDouble float64
-	grindSetting      float64
+// journal returns the journal backing up modified data points (nil if disabled)
+func (e *environment) journal() *backup.Journal {
+	if e.cfg.Influx.BackupDir == "" {
+		return nil
+	}
+	return backup.New(e.cfg.Influx.BackupDir, e.cfg.Influx.JournalOptions()...)
+}
 
-	debug bool
+func commands() []*command {
+	return []*command{
+		runCommand(),
+		fixCommand(),
+		undoCommand(),
+		importCommand(),
+		exportCommand(),
+		actionCommand(),
+		setupCommand(),
+		pumpCommand(),
+		inventoryCommand(),
+		maintenanceCommand(),
+		replayCommand(),
+		redetectCommand(),
+		statsCommand(),
+		grindCommand(),
+		configCommand(),
+		completionCommand(),
+	}
 }
 
 func main() {
+	os.Exit(execute(os.Args[1:], os.Stdout, os.Stderr))
+}
 
-	var cfg config
+// execute runs the command selected by the provided arguments and returns its exit code
+func execute(args []string, stdout, stderr io.Writer) int {
+	return executeIn(environment{stdout: stdout}, args, stderr)
+}
 
-	flag.StringVar(&cfg.apiEndpoint, "api", ":8099", "Endpoint for scale API")
+// executeIn runs the command selected by the provided arguments in a base environment (e.g.
+// providing the database) and returns its exit code
+func executeIn(base environment, args []string, stderr io.Writer) int {
 
-	flag.StringVar(&cfg.influxEndpoint, "influxEndpoint", "", "Endpoint for InfluxDB emissions")
-	flag.StringVar(&cfg.influxUser, "influxUser", "root", "User for InfluxDB emissions")
-	flag.StringVar(&cfg.influxPassword, "influxPassword", "root", "Password for InfluxDB emissions")
+	root := &command{
+		name:        "brew",
+		synopsis:    "Track and analyze coffee brews using a remote scale",
+		subcommands: commands(),
+	}
 
-	flag.Float64Var(&cfg.beansWeightSingle, "beansWeightSingle", scanner.DefaultSingleShotBeansWeight, "Weight of beans / grounds used for a single shot")
-	flag.Float64Var(&cfg.beansWeightDouble, "beansWeightDouble", scanner.DefaultDoubleShotBeansWeight, "Weight of beans / grounds used for a double shot")
-	flag.Float64Var(&cfg.grindSetting, "grindSetting", scanner.DefaultGrindSetting, "Relative grinder setting (0.0: Fine -> 1.0: Coarse)")
+	return root.execute(nil, args, base, stderr)
+}
 
-	flag.BoolVar(&cfg.debug, "debug", false, "Enable debugging mode (more verbose logging)")
+func (c *command) execute(parents []string, args []string, base environment, stderr io.Writer) int {
 
-	flag.Parse()
-	logger := scale.NewDefaultLogger(cfg.debug)
+	path := strings.Join(append(parents, c.name), " ")
+
+	// Dispatch to the selected subcommand, if any
+	if len(c.subcommands) > 0 {
+		if len(args) == 0 {
+			c.printUsage(path, stderr, nil)
+			return exitUsage
+		}
+		switch args[0] {
+		case "help", "-h", "-help", "--help":
+			if len(args) > 1 {
+				if sub := c.lookup(args[1]); sub != nil {
+					return sub.execute(append(parents, c.name), append(args[2:], "-help"), base, stderr)
+				}
+			}
+			c.printUsage(path, base.stdout, nil)
+			return exitOK
+		}
 
-	if cfg.influxEndpoint == "" {
-		logger.Fatalf("no InfluxDB endpoint specified")
+		sub := c.lookup(args[0])
+		if sub == nil {
+			fmt.Fprintf(stderr, "unknown command %q for %s\n\n", args[0], path)
+			c.printUsage(path, stderr, nil)
+			return exitUsage
+		}
+
+		return sub.execute(append(parents, c.name), args[1:], base, stderr)
 	}
 
-	btDevice, err := gatt.NewDevice([]gatt.Option{
-		gatt.LnxMaxConnections(2),
-		gatt.LnxDeviceID(-1, true),
-		gatt.LnxMsgTimeout(10 * time.Second),
-	}...)
-	if err != nil {
-		logger.Fatalf("failed to initialize bluetooth system device: %s", err)
+	fs := c.flagSet(path, stderr)
+	loader := config.NewLoader(fs, c.settings...)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
 	}
 
-	s, err := felicita.New(felicita.WithDevice(btDevice), felicita.WithDeviceID("C8:FD:19:8E:3E:3C"), felicita.WithLogger(logger))
-	if err != nil {
-		logger.Fatalf("failed to initialize Felicita scale: %s", err)
+	// Load the configuration and register any user-defined action types
+	cfg, err := loader.Load()
+	if err == nil {
+		err = action.Register(cfg.ActionDefinitions()...)
+	}
+	logger := scale.NewDefaultLogger(cfg.Debug)
+	if err != nil && !c.deferLoadErrors {
+		logger.Errorf("failed to load configuration: %s", err)
+		return exitConfig
 	}
-	sStateChan := make(chan scale.ConnectionStatus)
-	s.SetStateChangeChannel(sStateChan)
-	go func() {
-		for st := range sStateChan {
-			logger.Infof("scale state change: %v", st)
+
+	env := base
+	env.cfg, env.loadErr, env.logger, env.args = cfg, err, logger, fs.Args()
+	if err := c.run(&env); err != nil {
+		logger.Errorf("%s: %s", path, err)
+		switch {
+		case errors.Is(err, errUsage):
+			return exitUsage
+		case errors.Is(err, errConfig):
+			return exitConfig
+		default:
+			return exitFailure
 		}
-	}()
+	}
 
-	if cfg.apiEndpoint != "" {
-		api.New(s, cfg.apiEndpoint)
+	return exitOK
+}
+
+func (c *command) lookup(name string) *command {
+	for _, sub := range c.subcommands {
+		if sub.name == name {
+			return sub
+		}
+	}
+	return nil
+}
+
+func (c *command) flagSet(path string, output io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(path, flag.ContinueOnError)
+	fs.SetOutput(output)
+	if c.setFlags != nil {
+		c.setFlags(fs)
+	}
+	fs.Usage = func() {
+		c.printUsage(path, fs.Output(), fs)
 	}
 
-	sigChan := make(chan os.Signal, 3)
-	signal.Notify(sigChan, syscall.SIGTERM)
-	signal.Notify(sigChan, os.Interrupt)
-	go func() {
-		<-sigChan
-		logger.Infof("got signal, terminating connection to scale / meater")
-		if err := s.Close(); err != nil {
-			logger.Errorf("failed to close scale: %s", err)
+	return fs
+}
+
+func (c *command) printUsage(path string, w io.Writer, fs *flag.FlagSet) {
+	fmt.Fprintf(w, "%s\n\n", c.synopsis)
+
+	if len(c.subcommands) > 0 {
+		fmt.Fprintf(w, "Usage:\n  %s <command> [flags]\n\nCommands:\n", path)
+		for _, sub := range c.subcommands {
+			fmt.Fprintf(w, "  %-12s %s\n", sub.name, sub.synopsis)
+		}
+		fmt.Fprintf(w, "\nUse \"%s help <command>\" for more information about a command.\n", path)
+		return
+	}
+
+	fmt.Fprintf(w, "Usage:\n  %s\n\nFlags:\n", strings.TrimSpace(path+" [flags] "+c.args))
+	if fs != nil {
+		fs.PrintDefaults()
+	}
+}
+
+// usageErrorf generates an error denoting invalid usage of a command
+func usageErrorf(format string, a ...interface{}) error {
+	return fmt.Errorf("%w: %s", errUsage, fmt.Sprintf(format, a...))
+}
+
+// parseTime parses a timestamp provided on the command line (as local time)
+func parseTime(value string) (time.Time, error) {
+	return time.ParseInLocation(timestampLayout, value, time.Local)
+}
+
+// parseTimeRange parses the bounds of a time range provided on the command line (an empty
+// value denoting no limit)
+func parseTimeRange(since, until string) (start, end time.Time, err error) {
+	for _, bound := range []struct {
+		value string
+		dest  *time.Time
+	}{
+		{since, &start},
+		{until, &end},
+	} {
+		if bound.value == "" {
+			continue
 		}
-		if err := btDevice.Close(); err != nil {
-			logger.Errorf("failed to stop bluetooth device: %s", err)
+		if *bound.dest, err = parseTime(bound.value); err != nil {
+			return time.Time{}, time.Time{}, usageErrorf("failed to parse time stamp: %s", err)
 		}
-		os.Exit(0)
-	}()
-
-	influxDB := influx.New(
-		cfg.influxEndpoint,
-		cfg.influxUser,
-		cfg.influxPassword,
-	)
-	scan := scanner.New(s, influxDB,
-		scanner.WithSingleShotBeansWeight(cfg.beansWeightSingle),
-		scanner.WithDoubleShotBeansWeight(cfg.beansWeightDouble),
-		scanner.WithGrindSetting(cfg.grindSetting),
-		scanner.WithLogger(logger),
-	)
-
-	if err := scan.Run(); err != nil {
-		logger.Fatalf("failed to scan for data: %s", err)
 	}
+
+	return start, end, nil
 }
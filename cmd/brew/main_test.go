@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/fako1024/brew"
+	"github.com/fako1024/brew/config"
+	"github.com/fako1024/brew/db"
+	"github.com/fako1024/brew/db/memory"
+	"github.com/fako1024/brew/store"
+	"github.com/fako1024/btscale/pkg/scale"
+)
+
+// testDB prepares the environment variables of the CLI (backing up modifications to a
+// temporary directory) and returns an in-memory database holding a single brew "test"
+func testDB(t *testing.T) *memory.DB {
+	t.Setenv(config.EnvConfigFile, "")
+	t.Setenv(config.EnvPrefix+"INFLUX_ENDPOINT", "http://localhost:8086")
+	t.Setenv(config.EnvPrefix+"INFLUX_BACKUP_DIR", t.TempDir())
+
+	start := time.Date(2020, 9, 23, 11, 0, 0, 0, time.Local)
+	b := &brew.Brew{
+		ID:       "test",
+		Start:    start,
+		End:      start.Add(30 * time.Second),
+		ShotType: brew.SingleShot,
+	}
+	for i := 0; i <= 30; i++ {
+		b.DataPoints = append(b.DataPoints, scale.DataPoint{TimeStamp: start.Add(time.Duration(i) * time.Second), Weight: float64(i), Unit: "g"})
+	}
+
+	d := memory.New()
+	if err := store.New(d, "brews").Save(store.Entry{Brew: b}); err != nil {
+		t.Fatalf("Failed to save test brew: %s", err)
+	}
+
+	return d
+}
+
+// runCLI executes the CLI with the provided arguments, operating on the database (if any),
+// and returns the exit code and output
+func runCLI(d db.DB, args ...string) (int, string) {
+	var stdout bytes.Buffer
+	return executeIn(environment{stdout: &stdout, db: d}, args, io.Discard), stdout.String()
+}
+
+func TestExecute(t *testing.T) {
+
+	testDB(t)
+	for _, c := range []struct {
+		args     []string
+		exitCode int
+	}{
+		{nil, exitUsage},
+		{[]string{"unknown"}, exitUsage},
+		{[]string{"help"}, exitOK},
+		{[]string{"help", "fix"}, exitOK},
+		{[]string{"undo", "-help"}, exitOK},
+		{[]string{"undo", "-unknown"}, exitUsage},
+		{[]string{"undo", "-n", "x"}, exitUsage},
+		{[]string{"undo", "-config", "/nonexistent/config.yaml"}, exitConfig},
+	} {
+		if exitCode, _ := runCLI(nil, c.args...); exitCode != c.exitCode {
+			t.Fatalf("Unexpected exit code for %v: %d (want %d)", c.args, exitCode, c.exitCode)
+		}
+	}
+}
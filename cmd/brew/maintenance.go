@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fako1024/brew/config"
+	"github.com/fako1024/brew/maintenance"
+)
+
+type maintenanceParams struct {
+	json bool
+}
+
+func maintenanceCommand() *command {
+	var p maintenanceParams
+	return &command{
+		name:     "maintenance",
+		synopsis: "Track the maintenance schedule of the coffee machine",
+		subcommands: []*command{
+			{
+				name:     "status",
+				synopsis: "Show when each maintenance task is due",
+				settings: [][]string{config.InfluxSettings, config.DebugSettings},
+				setFlags: func(fs *flag.FlagSet) {
+					fs.BoolVar(&p.json, "json", false, "Output as JSON")
+				},
+				run: func(env *environment) error {
+					return maintenanceStatus(env, p)
+				},
+			},
+		},
+	}
+}
+
+func maintenanceStatus(env *environment, p maintenanceParams) error {
+
+	influxDB, err := env.influxDB()
+	if err != nil {
+		return err
+	}
+
+	statuses, err := maintenance.Check(env.cfg.Maintenance.Schedule(), maintenance.NewInfluxSource(influxDB, "brews"), time.Now())
+	if err != nil {
+		return err
+	}
+
+	if p.json {
+		enc := json.NewEncoder(env.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(statuses)
+	}
+
+	w := tabwriter.NewWriter(env.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TASK\tLAST PERFORMED\tSHOTS SINCE\tSHOTS LEFT\tDUE AT\tSTATUS\t")
+	for _, status := range statuses {
+		last, shotsLeft, dueAt, state := "never", "-", "-", "ok"
+		if !status.Last.IsZero() {
+			last = status.Last.Format(timestampLayout)
+		}
+		if status.Task.Shots > 0 {
+			shotsLeft = fmt.Sprint(status.ShotsLeft)
+		}
+		if !status.DueAt.IsZero() {
+			dueAt = status.DueAt.Format(timestampLayout)
+		}
+		if status.Due {
+			state = "DUE"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t\n", status.Type, last, status.Shots, shotsLeft, dueAt, state)
+	}
+
+	return w.Flush()
+}
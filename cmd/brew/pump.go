@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/fako1024/brew/api"
+	"github.com/fako1024/brew/config"
+)
+
+type pumpParams struct {
+	deviceID string
+}
+
+func pumpCommand() *command {
+	var p pumpParams
+	return &command{
+		name:     "pump",
+		synopsis: "Signal the start of the pump to the running daemon (starting the shot timer of the next brew)",
+		settings: [][]string{config.ControlAPISettings, config.DebugSettings},
+		setFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(&p.deviceID, "scale", "", "Device ID of the scale (default: all scales)")
+		},
+		run: func(env *environment) error {
+			if env.cfg.ControlAPI == "" {
+				return fmt.Errorf("%w: no control API endpoint specified", errConfig)
+			}
+
+			statuses, err := api.NewClient(env.cfg.ControlAPI).PumpStarted(p.deviceID)
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(env.stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "SCALE\tPUMP START\tPUMP OFFSET\t")
+			for _, s := range statuses {
+				offset := "unknown"
+				if s.PumpOffset > 0. {
+					offset = fmt.Sprintf("%.1fs", s.PumpOffset)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t\n", s.Scale, s.TimeStamp.Format("15:04:05.000"), offset)
+			}
+
+			return w.Flush()
+		},
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/fako1024/brew"
+	"github.com/fako1024/brew/config"
+	"github.com/fako1024/brew/scanner"
+	"github.com/fako1024/brew/store"
+)
+
+type redetectParams struct {
+	id    string
+	since string
+	until string
+	apply bool
+}
+
+// redetection denotes the outcome of re-running the detection on a stored brew
+type redetection struct {
+	stored   store.Entry
+	detected *brew.Brew
+	status   string
+}
+
+func redetectCommand() *command {
+	var p redetectParams
+	return &command{
+		name:     "redetect",
+		synopsis: "Re-run brew detection / classification on stored brews with the current configuration",
+		settings: [][]string{config.InfluxSettings, config.ProfileSettings, config.DebugSettings},
+		setFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(&p.id, "id", "", "Only process the brew with this ID")
+			fs.StringVar(&p.since, "since", "", "Only process brews started at / after this time")
+			fs.StringVar(&p.until, "until", "", "Only process brews started before this time")
+			fs.BoolVar(&p.apply, "apply", false, "Apply the corrections (otherwise only the changes are shown)")
+		},
+		run: func(env *environment) error {
+			return redetect(env, p)
+		},
+	}
+}
+
+func redetect(env *environment, p redetectParams) error {
+
+	since, until, err := parseTimeRange(p.since, p.until)
+	if err != nil {
+		return err
+	}
+
+	s, err := brewStore(env)
+	if err != nil {
+		return err
+	}
+
+	ids := []string{p.id}
+	if p.id == "" {
+		if ids, err = s.IDs(since, until); err != nil {
+			return err
+		}
+	}
+
+	var results []redetection
+	for _, id := range ids {
+		e, err := s.Load(id)
+		if err != nil {
+			return err
+		}
+		result, err := redetectBrew(env.cfg, e)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+	}
+
+	w := tabwriter.NewWriter(env.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTART\tEND\tSHOT TYPE\tYIELD\tRATIO\tSTATUS\t")
+	var nChanged int
+	for _, r := range results {
+		if r.detected == nil {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%.2f\t%s\t%s\t\n", r.stored.ID, r.stored.Start.Format(timestampLayout), r.stored.End.Format(timestampLayout), r.stored.ShotType, r.stored.Yield(), ratio(r.stored.Brew), r.status)
+			continue
+		}
+		if r.status == "changed" {
+			nChanged++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t\n", r.stored.ID,
+			change(r.stored.Start.Format(timestampLayout), r.detected.Start.Format(timestampLayout)),
+			change(r.stored.End.Format(timestampLayout), r.detected.End.Format(timestampLayout)),
+			change(r.stored.ShotType.String(), r.detected.ShotType.String()),
+			change(fmt.Sprintf("%.2f", r.stored.Yield()), fmt.Sprintf("%.2f", r.detected.Yield())),
+			change(ratio(r.stored.Brew), ratio(r.detected)),
+			r.status)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if !p.apply {
+		env.logger.Infof("%d of %d brew(s) would change, use -apply to correct them", nChanged, len(results))
+		return nil
+	}
+
+	var originals, replacements []store.Entry
+	for _, r := range results {
+		if r.status == "changed" {
+			originals, replacements = append(originals, r.stored), append(replacements, redetectedEntry(r))
+		}
+	}
+	if len(originals) > 0 {
+		if err := s.Replace(originals, replacements); err != nil {
+			return fmt.Errorf("failed to apply correction: %w", err)
+		}
+	}
+	env.logger.Infof("corrected %d of %d brew(s)", nChanged, len(results))
+
+	return nil
+}
+
+// redetectBrew replays a stored brew using the scanner settings of the scale it was tracked on
+func redetectBrew(cfg *config.Config, e store.Entry) (redetection, error) {
+
+	options, err := cfg.ScannerOptions(cfg.ScaleByTags(e.Tags))
+	if err != nil {
+		return redetection{}, configError(err)
+	}
+	detected, err := scanner.Redetect(e.Brew, options...)
+	if err != nil {
+		return redetection{}, err
+	}
+
+	result := redetection{stored: e}
+	switch len(detected) {
+	case 0:
+		result.status = "no brew detected"
+	case 1:
+		result.detected = detected[0]
+
+		// The corrected brew retains the beans weight of the stored one
+		result.detected.BeansWeight = e.BeansWeight
+		result.status = "unchanged"
+		if result.detected.ShotType != e.ShotType ||
+			result.detected.Start.Unix() != e.Start.Unix() || result.detected.End.Unix() != e.End.Unix() ||
+			fmt.Sprintf("%.2f", result.detected.Yield()) != fmt.Sprintf("%.2f", e.Yield()) {
+			result.status = "changed"
+		}
+	default:
+		result.status = fmt.Sprintf("%d brews detected (see `brew fix split`)", len(detected))
+	}
+
+	return result, nil
+}
+
+// redetectedEntry generates the corrected entry of a stored brew from the result of the
+// detection (retaining its metadata, setup and start of the pump)
+func redetectedEntry(r redetection) store.Entry {
+
+	corrected := cloneEntry(r.stored)
+	b := r.detected
+	corrected.Start, corrected.End, corrected.ShotType = b.Start, b.End, b.ShotType
+	corrected.Baseline, corrected.Score = b.Baseline, b.Score
+	corrected.DataPoints = append(corrected.DataPoints[:0], b.DataPoints...)
+	corrected.Annotations = append(corrected.Annotations[:0], b.Annotations...)
+
+	return corrected
+}
+
+// ratio returns the brew ratio (yield / beans weight) of a brew
+func ratio(b *brew.Brew) string {
+	if b.BeansWeight <= 0. {
+		return "-"
+	}
+	return fmt.Sprintf("1:%.2f", b.Yield()/b.BeansWeight)
+}
+
+func change(before, after string) string {
+	if before == after {
+		return before
+	}
+	return before + " -> " + after
+}
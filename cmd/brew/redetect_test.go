@@ -0,0 +1,57 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fako1024/brew"
+	"github.com/fako1024/brew/store"
+	"github.com/fako1024/btscale/pkg/scale"
+)
+
+func TestRedetect(t *testing.T) {
+
+	// A brew stored including static data points long after the flow stopped
+	d := testDB(t)
+	start := time.Date(2020, 9, 23, 12, 0, 0, 0, time.Local)
+	b := &brew.Brew{
+		ID:       "tail",
+		Start:    start,
+		End:      start.Add(40 * time.Second),
+		ShotType: brew.DoubleShot,
+	}
+	for i := 0; i <= 40; i++ {
+		b.DataPoints = append(b.DataPoints, scale.DataPoint{TimeStamp: start.Add(time.Duration(i) * time.Second), Weight: math.Min(float64(i), 30.), Unit: "g"})
+	}
+	s := store.New(d, "brews")
+	if err := s.Save(store.Entry{Brew: b}); err != nil {
+		t.Fatalf("Failed to save test brew: %s", err)
+	}
+
+	// Steps are executed in order on the same database
+	for _, c := range []struct {
+		args     []string
+		changed  bool          // Brew reported as changed
+		end      time.Duration // End of the stored brew afterwards (offset from its start)
+		shotType brew.ShotType // Shot type of the stored brew afterwards
+	}{
+		{[]string{"redetect", "-id", "tail"}, true, 40 * time.Second, brew.DoubleShot},
+		{[]string{"redetect", "-id", "tail", "-apply"}, true, 34 * time.Second, brew.SingleShot},
+		{[]string{"redetect", "-id", "tail"}, false, 34 * time.Second, brew.SingleShot},
+	} {
+		exitCode, out := runCLI(d, c.args...)
+		if exitCode != exitOK || strings.Contains(out, " changed") != c.changed || strings.Contains(out, "unchanged") == c.changed {
+			t.Fatalf("Unexpected result of %v: exit code %d, output: %s", c.args, exitCode, out)
+		}
+
+		e, err := s.Load("tail")
+		if err != nil {
+			t.Fatalf("Failed to load brew after %v: %s", c.args, err)
+		}
+		if !e.Start.Equal(start) || !e.End.Equal(start.Add(c.end)) || e.ShotType != c.shotType || e.Yield() != 30. {
+			t.Fatalf("Unexpected brew after %v: %s, %v - %v, yield %.2f", c.args, e.ShotType, e.Start, e.End, e.Yield())
+		}
+	}
+}
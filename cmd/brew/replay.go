@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fako1024/brew"
+	"github.com/fako1024/brew/config"
+	"github.com/fako1024/brew/db/influx"
+	"github.com/fako1024/brew/scanner"
+	"github.com/fako1024/btscale/pkg/mock"
+	"github.com/fako1024/btscale/pkg/scale"
+)
+
+type replayParams struct {
+	file string
+	emit bool
+	json bool
+}
+
+func replayCommand() *command {
+	var p replayParams
+	return &command{
+		name:     "replay",
+		synopsis: "Replay recorded scale data points or brews (JSON) through the brew scanner",
+		settings: [][]string{config.InfluxSettings, config.ProfileSettings, config.DebugSettings},
+		setFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(&p.file, "file", "-", "Path to JSON file containing the recorded data points or brews (- for stdin)")
+			fs.BoolVar(&p.emit, "emit", false, "Store detected brews in InfluxDB")
+			fs.BoolVar(&p.json, "json", false, "Output the detected brews as JSON")
+		},
+		run: func(env *environment) error {
+			return replay(env, p)
+		},
+	}
+}
+
+func replay(env *environment, p replayParams) error {
+
+	var (
+		r   io.Reader = os.Stdin
+		err error
+	)
+	if p.file != "-" {
+		f, err := os.Open(p.file)
+		if err != nil {
+			return fmt.Errorf("failed to open data points file: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read data points: %w", err)
+	}
+	dataPoints, err := parseReplayData(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse data points: %w", err)
+	}
+
+	var influxDB *influx.DB
+	if p.emit {
+		if influxDB, err = env.influxDB(); err != nil {
+			return err
+		}
+	}
+
+	s, err := mock.New()
+	if err != nil {
+		return fmt.Errorf("failed to initialize mock scale: %w", err)
+	}
+
+	w := tabwriter.NewWriter(env.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTART\tDURATION\tYIELD\tSHOT TYPE\tEVENTS")
+	var brews []*brew.Brew
+	options, err := env.cfg.ScannerOptions(config.Scale{})
+	if err != nil {
+		return configError(err)
+	}
+
+	scan := scanner.New(s, influxDB, append(options,
+		scanner.WithLogger(env.logger),
+		scanner.WithFinishHandler(func(b *brew.Brew) {
+			brews = append(brews, b)
+			if p.json {
+				return
+			}
+			var events []string
+			for _, annotation := range b.Annotations {
+				events = append(events, annotation.Event.String())
+			}
+			fmt.Fprintf(w, "%s\t%s\t%v\t%.2f\t%s\t%v\n", b.ID, b.Start.Format(timestampLayout), b.End.Sub(b.Start).Round(10*time.Millisecond), b.Yield(), b.ShotType, events)
+		}),
+	)...)
+
+	for _, dataPoint := range dataPoints {
+		scan.Process(dataPoint)
+	}
+	env.logger.Infof("replayed %d data points, detected %d brew(s)", len(dataPoints), len(brews))
+
+	if p.json {
+		enc := json.NewEncoder(env.stdout)
+		enc.SetIndent("", "  ")
+		if brews == nil {
+			brews = []*brew.Brew{}
+		}
+		return enc.Encode(brews)
+	}
+
+	return w.Flush()
+}
+
+// parseReplayData parses recorded scale data points or brews (a single brew or a list of
+// brews in their JSON representation, replaying the data points of all of them)
+func parseReplayData(data []byte) (scale.DataPoints, error) {
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		trimmed = append(append([]byte{'['}, trimmed...), ']')
+	}
+
+	var raw []map[string]json.RawMessage
+	if err := json.Unmarshal(trimmed, &raw); err != nil {
+		return nil, err
+	}
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	if _, isBrew := raw[0]["version"]; !isBrew {
+		var dataPoints scale.DataPoints
+		return dataPoints, json.Unmarshal(trimmed, &dataPoints)
+	}
+
+	var brews []brew.Brew
+	if err := json.Unmarshal(trimmed, &brews); err != nil {
+		return nil, err
+	}
+	sort.Slice(brews, func(i, j int) bool {
+		return brews[i].Start.Before(brews[j].Start)
+	})
+	var dataPoints scale.DataPoints
+	for _, b := range brews {
+		dataPoints = append(dataPoints, b.DataPoints...)
+	}
+
+	return dataPoints, nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fako1024/brew"
+	"github.com/fako1024/brew/api"
+	"github.com/fako1024/brew/config"
+	"github.com/fako1024/brew/inventory"
+	"github.com/fako1024/brew/maintenance"
+	"github.com/fako1024/brew/scanner"
+	"github.com/fako1024/brew/store"
+	scaleapi "github.com/fako1024/btscale/pkg/api"
+	"github.com/fako1024/btscale/pkg/felicita"
+	"github.com/fako1024/btscale/pkg/scale"
+	"github.com/fako1024/gatt"
+)
+
+func runCommand() *command {
+	return &command{
+		name:     "run",
+		synopsis: "Run the brew daemon, tracking brews on all configured scales",
+		settings: [][]string{config.InfluxSettings, config.ProfileSettings, config.ScaleSettings, config.InventorySettings, config.ControlAPISettings, config.DebugSettings},
+		run:      runDaemon,
+	}
+}
+
+func runDaemon(env *environment) error {
+
+	cfg, logger := env.cfg, env.logger
+	if err := cfg.Validate(); err != nil {
+		return configError(err)
+	}
+
+	btDevice, err := gatt.NewDevice([]gatt.Option{
+		gatt.LnxMaxConnections(len(cfg.Scales) + 1),
+		gatt.LnxDeviceID(-1, true),
+		gatt.LnxMsgTimeout(10 * time.Second),
+	}...)
+	if err != nil {
+		logger.Fatalf("failed to initialize bluetooth system device: %s", err)
+	}
+
+	influxDB, err := env.influxDB()
+	if err != nil {
+		return err
+	}
+
+	// Initialize the bean inventory (if enabled), shared among all scales
+	var inv *inventory.Inventory
+	if cfg.Inventory.StateFile != "" {
+		if inv, err = inventory.New(cfg.Inventory.Options()...); err != nil {
+			return err
+		}
+		for _, warning := range inv.Warnings(time.Now()) {
+			logger.Warnf("%s", warning)
+		}
+	}
+
+	// Check for due maintenance tasks
+	var (
+		maintenanceSource = maintenance.NewInfluxSource(influxDB, "brews")
+		startupBuzz       int
+	)
+	if statuses, err := maintenance.Check(cfg.Maintenance.Schedule(), maintenanceSource, time.Now()); err != nil {
+		logger.Warnf("failed to check maintenance status: %s", err)
+	} else {
+		for _, status := range statuses {
+			if status.Due {
+				logger.Warnf("maintenance due: %s", status.Type)
+			}
+		}
+		if cfg.Maintenance.Buzz {
+			startupBuzz = maintenance.Buzz(statuses)
+		}
+	}
+
+	// Determine the reference curves to score brews against
+	references, err := cfg.BrewReferences(func(id string) (*brew.Brew, error) {
+		e, err := store.New(influxDB, "brews").Load(id)
+		return e.Brew, err
+	})
+	if err != nil {
+		return configError(err)
+	}
+
+	var (
+		scales   []*felicita.Felicita
+		scanners []*scanner.Scanner
+	)
+	for _, scaleCfg := range cfg.Scales {
+		s, err := felicita.New(felicita.WithDevice(btDevice), felicita.WithDeviceID(scaleCfg.DeviceID), felicita.WithLogger(logger))
+		if err != nil {
+			logger.Fatalf("failed to initialize Felicita scale %s: %s", scaleCfg.DeviceID, err)
+		}
+		sStateChan := make(chan scale.ConnectionStatus)
+		s.SetStateChangeChannel(sStateChan)
+		go func(deviceID string) {
+			for st := range sStateChan {
+				logger.Infof("scale %s state change: %v", deviceID, st)
+			}
+		}(scaleCfg.DeviceID)
+
+		if scaleCfg.APIEndpoint != "" {
+			scaleapi.New(s, scaleCfg.APIEndpoint)
+		}
+
+		options, err := cfg.ScannerOptions(scaleCfg)
+		if err != nil {
+			return configError(err)
+		}
+		if inv != nil {
+			options = append(options, scanner.WithInventory(inv))
+		}
+		if len(references) > 0 {
+			options = append(options, scanner.WithReferences(references))
+		}
+		if startupBuzz > 0 {
+			options = append(options, scanner.WithStartupBuzz(startupBuzz))
+		}
+
+		scales = append(scales, s)
+		scanners = append(scanners, scanner.New(s, influxDB, append(options, scanner.WithLogger(logger))...))
+	}
+
+	// Start the control API (if enabled)
+	if cfg.ControlAPI != "" {
+		apiOptions := []func(*api.API){api.WithDB(influxDB), api.WithInventory(inv),
+			api.WithMaintenance(cfg.Maintenance.Schedule(), maintenanceSource), api.WithLogger(logger)}
+		for i, scan := range scanners {
+			apiOptions = append(apiOptions, api.WithScanner(cfg.Scales[i].DeviceID, scan))
+		}
+		go func() {
+			if err := api.New(cfg.ControlAPI, cfg, apiOptions...).Run(); err != nil {
+				logger.Fatalf("failed to run control API: %s", err)
+			}
+		}()
+	}
+
+	sigChan := make(chan os.Signal, 3)
+	signal.Notify(sigChan, syscall.SIGTERM)
+	signal.Notify(sigChan, os.Interrupt)
+	go func() {
+		<-sigChan
+		logger.Infof("got signal, terminating connection to scale(s)")
+		for _, s := range scales {
+			if err := s.Close(); err != nil {
+				logger.Errorf("failed to close scale: %s", err)
+			}
+		}
+		if err := btDevice.Close(); err != nil {
+			logger.Errorf("failed to stop bluetooth device: %s", err)
+		}
+		os.Exit(exitOK)
+	}()
+
+	// Run all scanners concurrently
+	var wg sync.WaitGroup
+	for i, scan := range scanners {
+		wg.Add(1)
+		go func(deviceID string, scan *scanner.Scanner) {
+			defer wg.Done()
+			if err := scan.Run(); err != nil {
+				logger.Fatalf("failed to scan for data on scale %s: %s", deviceID, err)
+			}
+		}(cfg.Scales[i].DeviceID, scan)
+	}
+	wg.Wait()
+
+	return nil
+}
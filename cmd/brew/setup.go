@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/fako1024/brew/api"
+	"github.com/fako1024/brew/config"
+)
+
+type setupParams struct {
+	deviceID string
+}
+
+func setupCommand() *command {
+	var p setupParams
+	scaleFlag := func(fs *flag.FlagSet) {
+		fs.StringVar(&p.deviceID, "scale", "", "Device ID of the scale (default: all scales)")
+	}
+	return &command{
+		name:     "setup",
+		synopsis: "Manage the setups (beans, grinder, recipe, ...) used for brewing",
+		subcommands: []*command{
+			{
+				name:     "list",
+				synopsis: "List all configured setups",
+				run:      listSetups,
+			},
+			{
+				name:     "show",
+				synopsis: "Show the setup currently used by the running daemon",
+				settings: [][]string{config.ControlAPISettings, config.DebugSettings},
+				setFlags: scaleFlag,
+				run: func(env *environment) error {
+					return showSetup(env, p, "")
+				},
+			},
+			{
+				name:     "use",
+				args:     "<name>",
+				synopsis: "Switch the setup used by the running daemon",
+				settings: [][]string{config.ControlAPISettings, config.DebugSettings},
+				setFlags: scaleFlag,
+				run: func(env *environment) error {
+					if len(env.args) != 1 {
+						return usageErrorf("expected exactly one setup name")
+					}
+					return showSetup(env, p, env.args[0])
+				},
+			},
+		},
+	}
+}
+
+func listSetups(env *environment) error {
+
+	names := make([]string, 0, len(env.cfg.Setups))
+	for name := range env.cfg.Setups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(env.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tBEANS\tROASTER\tROAST DATE\tGRINDER\tSETTING\tRECIPE\t")
+	for _, name := range names {
+		s := env.cfg.Setups[name]
+		if name == env.cfg.CurrentSetup {
+			name += " (current)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t\n", name, s.Beans, s.Roaster, s.RoastDate, s.Grinder, s.GrinderSetting, s.Recipe)
+	}
+
+	return w.Flush()
+}
+
+// showSetup shows the setup(s) currently used by the running daemon, switching to the
+// named setup first (if provided)
+func showSetup(env *environment, p setupParams, name string) error {
+
+	if env.cfg.ControlAPI == "" {
+		return fmt.Errorf("%w: no control API endpoint specified", errConfig)
+	}
+	client := api.NewClient(env.cfg.ControlAPI)
+
+	var (
+		setups []api.ScaleSetup
+		err    error
+	)
+	if name != "" {
+		setups, err = client.SetSetup(name, p.deviceID)
+	} else {
+		setups, err = client.Setups(p.deviceID)
+	}
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(env.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SCALE\tSETUP\tBEANS (SINGLE / DOUBLE)\tGRIND SETTING\t")
+	for _, s := range setups {
+		fmt.Fprintf(w, "%s\t%s\t%.1f / %.1f\t%.3f\t\n", s.Scale, s.Name, s.BeansWeightSingle, s.BeansWeightDouble, s.GrindSetting)
+	}
+
+	return w.Flush()
+}
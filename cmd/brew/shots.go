@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/fako1024/brew"
+	"github.com/fako1024/brew/archive"
+	"github.com/fako1024/brew/shotfile"
+	"github.com/fako1024/brew/store"
+)
+
+// exportShots writes brews to a shot file (or one shot file per brew if the path denotes an
+// existing directory)
+func exportShots(env *environment, p exportParams) error {
+
+	format, err := shotfile.FormatFromString(p.format)
+	if err != nil {
+		return usageErrorf("%s", err)
+	}
+	filter, err := p.filter()
+	if err != nil {
+		return err
+	}
+
+	influxDB, err := env.database()
+	if err != nil {
+		return err
+	}
+	s := store.New(influxDB, "brews")
+
+	ids := []string{p.id}
+	if p.id == "" {
+		if ids, err = s.IDs(filter.Start, filter.End); err != nil {
+			return err
+		}
+	}
+
+	var brews []*brew.Brew
+	for _, id := range ids {
+		e, err := s.Load(id)
+		if err != nil {
+			return err
+		}
+		if len(filter.ShotTypes) > 0 && !contains(filter.ShotTypes, e.ShotType.String()) {
+			continue
+		}
+
+		// Brews without data points (e.g. imported from CSV) cannot be represented as shots
+		if len(e.DataPoints) == 0 {
+			env.logger.Warnf("skipping brew %s without data points", id)
+			continue
+		}
+		brews = append(brews, e.Brew)
+	}
+	if len(brews) == 0 {
+		return errors.New("no brews to export")
+	}
+
+	files := map[string][]*brew.Brew{p.shotsPath: brews}
+	if info, err := os.Stat(p.shotsPath); err == nil && info.IsDir() {
+		files = make(map[string][]*brew.Brew, len(brews))
+		for _, b := range brews {
+			files[filepath.Join(p.shotsPath, b.ID+".json")] = []*brew.Brew{b}
+		}
+	}
+
+	for path, brews := range files {
+		data, err := format.Marshal(brews...)
+		if err != nil {
+			return err
+		}
+		if err := archive.WriteFile(path, func(w io.Writer) error {
+			_, err := w.Write(data)
+			return err
+		}); err != nil {
+			return fmt.Errorf("failed to write shot file: %w", err)
+		}
+	}
+	env.logger.Infof("exported %d brew(s) as %s shot(s) to %s", len(brews), format, p.shotsPath)
+
+	return nil
+}
+
+// importShots reads brews from a shot file (or all shot files of a directory) and stores them
+// in the database
+func importShots(env *environment, p importParams) error {
+
+	format, err := shotfile.FormatFromString(p.format)
+	if err != nil {
+		return usageErrorf("%s", err)
+	}
+
+	paths := []string{p.shotsPath}
+	if info, err := os.Stat(p.shotsPath); err != nil {
+		return fmt.Errorf("failed to open shot file: %w", err)
+	} else if info.IsDir() {
+		if paths, err = filepath.Glob(filepath.Join(p.shotsPath, "*.json")); err != nil {
+			return err
+		}
+		sort.Strings(paths)
+	}
+
+	compression, err := env.cfg.Influx.CurveCompression()
+	if err != nil {
+		return configError(err)
+	}
+
+	// Each invalid file is reported as a problem (the line denoting the index of the file)
+	var (
+		records  []archive.Record
+		problems []archive.Problem
+	)
+	for i, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read shot file: %w", err)
+		}
+		brews, err := format.Unmarshal(data, shotfile.Options{
+			ExpectedSingleShotWeight: env.cfg.Defaults.ExpectedSingleShotWeight,
+			ExpectedDoubleShotWeight: env.cfg.Defaults.ExpectedDoubleShotWeight,
+		})
+		if err != nil {
+			problems = append(problems, archive.Problem{Line: i + 1, ID: filepath.Base(path), Err: err})
+			continue
+		}
+		records = append(records, shotfile.CompressedRecords(compression, brews...)...)
+	}
+
+	return importRecords(env, p, "shot file", records, problems)
+}
+
+// countSet returns the number of non-empty values
+func countSet(values ...string) (n int) {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			n++
+		}
+	}
+	return
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"time"
+
+	"github.com/fako1024/brew"
+	"github.com/fako1024/brew/config"
+	"github.com/fako1024/brew/stats"
+)
+
+type statsParams struct {
+	since            time.Duration
+	period           string
+	format           string
+	outlierThreshold float64
+	unit             string
+}
+
+func statsCommand() *command {
+	var p statsParams
+	return &command{
+		name:     "stats",
+		synopsis: "Show statistics and trends of stored brews",
+		settings: [][]string{config.InfluxSettings, config.DebugSettings},
+		setFlags: func(fs *flag.FlagSet) {
+			fs.DurationVar(&p.since, "since", 0, "Only consider brews within the given period (e.g. 720h, default: all)")
+			fs.StringVar(&p.period, "period", string(stats.All), "Split the report into periods (day, week, month or all)")
+			fs.StringVar(&p.format, "format", string(stats.Text), "Output format (text, json or markdown)")
+			fs.Float64Var(&p.outlierThreshold, "outlierThreshold", stats.DefaultOutlierThreshold, "Z-score above which a shot is considered an outlier")
+			fs.StringVar(&p.unit, "unit", brew.CanonicalUnit.String(), "Unit of all weights (g or oz)")
+		},
+		run: func(env *environment) error {
+			return showStats(env, p)
+		},
+	}
+}
+
+func showStats(env *environment, p statsParams) error {
+
+	period, err := stats.PeriodFromString(p.period)
+	if err != nil {
+		return usageErrorf("%s", err)
+	}
+	format := stats.Format(p.format)
+	if format != stats.Text && format != stats.JSON && format != stats.Markdown {
+		return usageErrorf("invalid output format: %s (expected text, json or markdown)", p.format)
+	}
+	if p.outlierThreshold <= 0. {
+		return usageErrorf("invalid outlier threshold: %.2f", p.outlierThreshold)
+	}
+	unit, err := brew.UnitFromString(p.unit)
+	if err != nil {
+		return usageErrorf("%s", err)
+	}
+
+	influxDB, err := env.database()
+	if err != nil {
+		return err
+	}
+
+	var start time.Time
+	if p.since > 0 {
+		start = time.Now().Add(-p.since)
+	}
+	shots, err := stats.Load(influxDB, "brews", start, time.Time{})
+	if err != nil {
+		return err
+	}
+
+	report := stats.Compute(shots, stats.WithPeriod(period), stats.WithOutlierThreshold(p.outlierThreshold), stats.WithUnit(unit))
+
+	return report.Write(env.stdout, format)
+}
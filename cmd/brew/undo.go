@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/fako1024/brew/config"
+)
+
+type undoParams struct {
+	n    int
+	list bool
+}
+
+func undoCommand() *command {
+	var p undoParams
+	return &command{
+		name:     "undo",
+		synopsis: "Revert the last modification(s) of stored data (e.g. corrections of brews)",
+		settings: [][]string{config.InfluxSettings, config.DebugSettings},
+		setFlags: func(fs *flag.FlagSet) {
+			fs.IntVar(&p.n, "n", 1, "Number of modifications to revert (most recent first)")
+			fs.BoolVar(&p.list, "list", false, "Only list the modifications that can be reverted")
+		},
+		run: func(env *environment) error {
+			return undo(env, p)
+		},
+	}
+}
+
+func undo(env *environment, p undoParams) error {
+
+	journal := env.journal()
+	if journal == nil {
+		return fmt.Errorf("%w: no backup directory specified", errConfig)
+	}
+
+	if p.list {
+		modifications, err := journal.List()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(env.stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tTIME\tDESCRIPTION\t")
+		for _, m := range modifications {
+			fmt.Fprintf(w, "%s\t%s\t%s\t\n", m.ID, m.TimeStamp.Local().Format(timestampLayout), m.Description)
+		}
+		return w.Flush()
+	}
+
+	if p.n < 1 {
+		return usageErrorf("invalid number of modifications to revert: %d", p.n)
+	}
+	influxDB, err := env.database()
+	if err != nil {
+		return err
+	}
+
+	reverted, err := journal.Undo(influxDB, p.n)
+	for _, m := range reverted {
+		fmt.Fprintf(env.stdout, "reverted %s: %s\n", m.ID, m.Description)
+	}
+
+	return err
+}
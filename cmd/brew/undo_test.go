@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fako1024/brew/store"
+)
+
+func TestUndo(t *testing.T) {
+
+	// Steps are executed in order on the same database / backup directory
+	d := testDB(t)
+	for _, c := range []struct {
+		args     []string
+		exitCode int
+		output   string // Expected substring of the output (if any)
+		shotType string // Shot type of brew "test" afterwards
+	}{
+		{[]string{"undo", "-list"}, exitOK, "DESCRIPTION", "single"},
+		{[]string{"undo"}, exitFailure, "", "single"},
+		{[]string{"fix", "set", "-id", "test", "-shotType", "double"}, exitOK, "", "double"},
+		{[]string{"undo", "-list"}, exitOK, "replace brew(s) test", "double"},
+		{[]string{"undo", "-n", "0"}, exitUsage, "", "double"},
+		{[]string{"undo", "-n", "2"}, exitFailure, "", "double"},
+		{[]string{"undo", "-influxBackupDir", ""}, exitConfig, "", "double"},
+		{[]string{"undo"}, exitOK, "reverted", "single"},
+		{[]string{"undo"}, exitFailure, "", "single"},
+	} {
+		exitCode, out := runCLI(d, c.args...)
+		if exitCode != c.exitCode || !strings.Contains(out, c.output) {
+			t.Fatalf("Unexpected result of %v: exit code %d (want %d), output: %s", c.args, exitCode, c.exitCode, out)
+		}
+		e, err := store.New(d, "brews").Load("test")
+		if err != nil || e.ShotType.String() != c.shotType {
+			t.Fatalf("Unexpected brew after %v: %v (error: %v)", c.args, e.Brew, err)
+		}
+	}
+}
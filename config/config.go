@@ -0,0 +1,795 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fako1024/brew"
+	"github.com/fako1024/brew/action"
+	"github.com/fako1024/brew/archive"
+	"github.com/fako1024/brew/curve"
+	"github.com/fako1024/brew/db/backup"
+	"github.com/fako1024/brew/grind"
+	"github.com/fako1024/brew/grinder"
+	"github.com/fako1024/brew/inventory"
+	"github.com/fako1024/brew/maintenance"
+	"github.com/fako1024/brew/scanner"
+)
+
+const (
+
+	// DefaultDeviceID denotes the device ID of the scale tracked if no scales are configured
+	DefaultDeviceID = "C8:FD:19:8E:3E:3C"
+
+	// DefaultAPIEndpoint denotes the scale API endpoint used if no scales are configured
+	DefaultAPIEndpoint = ":8099"
+)
+
+// Config denotes the configuration shared by all commands
+type Config struct {
+	Influx   Influx  `json:"influx" yaml:"influx" toml:"influx"`       // InfluxDB connection settings
+	Defaults Profile `json:"defaults" yaml:"defaults" toml:"defaults"` // Default profile for all scales
+	Scales   []Scale `json:"scales" yaml:"scales" toml:"scales"`       // Scales to track
+
+	Setups       map[string]Setup `json:"setups" yaml:"setups" toml:"setups"`                      // Available setups (beans, grinder, recipe, ...)
+	CurrentSetup string           `json:"current_setup" yaml:"current_setup" toml:"current_setup"` // Setup used on startup for all scales (unless overridden)
+
+	ActionTypes []ActionType `json:"action_types" yaml:"action_types" toml:"action_types"` // User-defined action types (in addition to the built-in ones)
+
+	Inventory   Inventory   `json:"inventory" yaml:"inventory" toml:"inventory"`       // Bean inventory settings
+	Maintenance Maintenance `json:"maintenance" yaml:"maintenance" toml:"maintenance"` // Maintenance schedule
+	ControlAPI  string      `json:"control_api" yaml:"control_api" toml:"control_api"` // Endpoint for the brew control API (disabled if empty)
+
+	References map[string]Reference `json:"references" yaml:"references" toml:"references"` // Reference curves per recipe to score brews against
+	Grind      Grind                `json:"grind" yaml:"grind" toml:"grind"`                // Settings of the grind recommendations
+
+	CSVMappings map[string]CSVMapping `json:"csv_mappings" yaml:"csv_mappings" toml:"csv_mappings"` // User-defined CSV column mappings (overriding a built-in mapping of the same name)
+
+	Grinders map[string]Grinder `json:"grinders" yaml:"grinders" toml:"grinders"` // User-defined grinder profiles (overriding a built-in profile of the same name)
+
+	Debug bool `json:"debug" yaml:"debug" toml:"debug"` // Enable debugging mode (more verbose logging)
+}
+
+// Influx denotes the settings for the InfluxDB connection
+type Influx struct {
+	Endpoint     string `json:"endpoint" yaml:"endpoint" toml:"endpoint"`
+	User         string `json:"user" yaml:"user" toml:"user"`
+	Password     string `json:"password" yaml:"password" toml:"password"`
+	PasswordFile string `json:"password_file" yaml:"password_file" toml:"password_file"` // File to read the password from (e.g. a Docker secret)
+	BackupDir    string `json:"backup_dir" yaml:"backup_dir" toml:"backup_dir"`          // Directory to back up data points to before modifying them (disabled if empty)
+
+	MaxBackups    int `json:"max_backups" yaml:"max_backups" toml:"max_backups"`             // Maximum number of backups retained (0: unlimited)
+	MaxBackupDays int `json:"max_backup_days" yaml:"max_backup_days" toml:"max_backup_days"` // Days after which backups are removed (0: unlimited)
+
+	Compression          string  `json:"compression" yaml:"compression" toml:"compression"`                               // Compression of brew curves prior to storage (none, lossless or simplify)
+	CompressionTolerance float64 `json:"compression_tolerance" yaml:"compression_tolerance" toml:"compression_tolerance"` // Maximum deviation of the weight of simplified curves
+}
+
+// Profile denotes the scanner settings of a scale / group head
+type Profile struct {
+	ExpectedSingleShotWeight float64  `json:"expected_single_shot_weight" yaml:"expected_single_shot_weight" toml:"expected_single_shot_weight"`
+	ExpectedDoubleShotWeight float64  `json:"expected_double_shot_weight" yaml:"expected_double_shot_weight" toml:"expected_double_shot_weight"`
+	BeansWeightSingle        float64  `json:"beans_weight_single" yaml:"beans_weight_single" toml:"beans_weight_single"`
+	BeansWeightDouble        float64  `json:"beans_weight_double" yaml:"beans_weight_double" toml:"beans_weight_double"`
+	GrindSetting             *float64 `json:"grind_setting" yaml:"grind_setting" toml:"grind_setting"`             // Relative grind setting (unset: taken from the default profile)
+	Grinder                  string   `json:"grinder" yaml:"grinder" toml:"grinder"`                               // Grinder in use (allowing grind settings in its native notation)
+	PumpOffset               *float64 `json:"pump_offset" yaml:"pump_offset" toml:"pump_offset"`                   // Time from the start of the pump to the first drop until learned (in seconds, unset / 0: unknown)
+	LearnPumpOffset          *bool    `json:"learn_pump_offset" yaml:"learn_pump_offset" toml:"learn_pump_offset"` // Learn the pump offset from brews with signaled start of the pump (in memory only, default: false)
+}
+
+// Scale denotes a single scale / group head to track. Any profile setting not specified
+// explicitly is taken from the default profile
+type Scale struct {
+	DeviceID    string `json:"device_id" yaml:"device_id" toml:"device_id"`
+	APIEndpoint string `json:"api_endpoint" yaml:"api_endpoint" toml:"api_endpoint"`
+
+	Station   string `json:"station" yaml:"station" toml:"station"`
+	GroupHead string `json:"group_head" yaml:"group_head" toml:"group_head"`
+	Setup     string `json:"setup" yaml:"setup" toml:"setup"` // Setup used on startup (overrides the current setup)
+
+	Profile `yaml:",inline"`
+}
+
+// Inventory denotes the settings of the bean inventory
+type Inventory struct {
+	StateFile     string  `json:"state_file" yaml:"state_file" toml:"state_file"`             // File to persist the inventory to (disabled if empty)
+	LowThreshold  float64 `json:"low_threshold" yaml:"low_threshold" toml:"low_threshold"`    // Remaining weight below which a pack is considered nearly empty
+	FreshnessDays int     `json:"freshness_days" yaml:"freshness_days" toml:"freshness_days"` // Days after roasting after which beans are considered past their best (0: disabled)
+}
+
+// ActionType denotes a user-defined action type (overriding a built-in type of the same name)
+type ActionType struct {
+	Type         string   `json:"type" yaml:"type" toml:"type"`
+	Category     string   `json:"category" yaml:"category" toml:"category"`
+	Label        string   `json:"label" yaml:"label" toml:"label"`                         // Human readable label (derived from the type if empty)
+	IntervalDays int      `json:"interval_days" yaml:"interval_days" toml:"interval_days"` // Number of days after which the action should be repeated (0: not recurring)
+	Params       []string `json:"params" yaml:"params" toml:"params"`                      // Parameters required when recording the action
+}
+
+// Maintenance denotes the maintenance schedule
+type Maintenance struct {
+	Tasks []MaintenanceTask `json:"tasks" yaml:"tasks" toml:"tasks"` // Maintenance tasks (replacing the default schedule if set)
+	Buzz  bool              `json:"buzz" yaml:"buzz" toml:"buzz"`    // Signal due maintenance on the scale(s) at startup
+}
+
+// MaintenanceTask denotes a recurring maintenance task
+type MaintenanceTask struct {
+	Type         string `json:"type" yaml:"type" toml:"type"`                            // Action type performing the maintenance
+	Shots        int    `json:"shots" yaml:"shots" toml:"shots"`                         // Number of shots after which the task is due (0: disabled)
+	IntervalDays int    `json:"interval_days" yaml:"interval_days" toml:"interval_days"` // Number of days after which the task is due (0: disabled)
+	Buzz         int    `json:"buzz" yaml:"buzz" toml:"buzz"`                            // Number of buzzes signaled on the scale if the task is due
+}
+
+// Reference denotes the reference curve of a recipe, either taken from a stored brew or
+// defined by its parameters (pre-infusion time, brew time and yield)
+type Reference struct {
+	BrewID          string  `json:"brew_id" yaml:"brew_id" toml:"brew_id"`                               // ID of the stored brew to use as reference
+	PreInfusionTime float64 `json:"pre_infusion_time" yaml:"pre_infusion_time" toml:"pre_infusion_time"` // Time without flow (in seconds)
+	BrewTime        float64 `json:"brew_time" yaml:"brew_time" toml:"brew_time"`                         // Total brew time (in seconds)
+	Yield           float64 `json:"yield" yaml:"yield" toml:"yield"`                                     // Yield at the end of the brew
+}
+
+// Grind denotes the settings of the grind recommendations (the target yield of each shot type
+// being its expected weight)
+type Grind struct {
+	TargetBrewTime float64 `json:"target_brew_time" yaml:"target_brew_time" toml:"target_brew_time"` // Target brew time of all shots (in seconds)
+	Tolerance      float64 `json:"tolerance" yaml:"tolerance" toml:"tolerance"`                      // Deviation from the target brew time tolerated without adjustment (in seconds)
+	Brews          int     `json:"brews" yaml:"brews" toml:"brews"`                                  // Number of recent brews considered
+	Sensitivity    float64 `json:"sensitivity" yaml:"sensitivity" toml:"sensitivity"`                // Brew time gained per unit of relative grind setting towards finer until learned (in seconds)
+	MaxAdjustment  float64 `json:"max_adjustment" yaml:"max_adjustment" toml:"max_adjustment"`       // Maximum adjustment of the relative grind setting recommended at once
+}
+
+// Grinder denotes a user-defined grinder profile (see grinder.Profile)
+type Grinder struct {
+	Notation   string  `json:"notation" yaml:"notation" toml:"notation"`          // macro_micro, dial or clicks
+	MacroSteps int     `json:"macro_steps" yaml:"macro_steps" toml:"macro_steps"` // Number of macro steps (numbered from 1)
+	MicroSteps int     `json:"micro_steps" yaml:"micro_steps" toml:"micro_steps"` // Number of micro steps per macro step (lettered from A)
+	Min        float64 `json:"min" yaml:"min" toml:"min"`                         // Finest setting of a dial
+	Max        float64 `json:"max" yaml:"max" toml:"max"`                         // Coarsest setting of a dial / maximum number of clicks
+	Step       float64 `json:"step" yaml:"step" toml:"step"`                      // Resolution of a dial (0: stepless)
+}
+
+// CSVMapping denotes a mapping of CSV columns to brew summary fields (see archive.Mapping)
+type CSVMapping struct {
+	Columns    map[string]string `json:"columns" yaml:"columns" toml:"columns"`             // CSV column header per summary field
+	Positional []string          `json:"positional" yaml:"positional" toml:"positional"`    // Summary field per CSV column for files without header
+	TimeLayout string            `json:"time_layout" yaml:"time_layout" toml:"time_layout"` // Go layout, unix_ms or unix (detected if empty)
+	TimeZone   string            `json:"time_zone" yaml:"time_zone" toml:"time_zone"`       // Time zone of time stamps without zone information (e.g. Europe/Berlin)
+	WeightUnit string            `json:"weight_unit" yaml:"weight_unit" toml:"weight_unit"` // Unit of all weights (g or oz)
+}
+
+// Setup denotes a setup used for brewing. Beans weights / grind setting not specified
+// explicitly are taken from the profile of the respective scale
+type Setup struct {
+	Beans            string  `json:"beans" yaml:"beans" toml:"beans"`
+	Roaster          string  `json:"roaster" yaml:"roaster" toml:"roaster"`
+	RoastDate        string  `json:"roast_date" yaml:"roast_date" toml:"roast_date"` // Format: YYYY-MM-DD
+	Grinder          string  `json:"grinder" yaml:"grinder" toml:"grinder"`
+	GrinderSetting   string  `json:"grinder_setting" yaml:"grinder_setting" toml:"grinder_setting"`
+	Basket           string  `json:"basket" yaml:"basket" toml:"basket"`
+	WaterTemperature float64 `json:"water_temperature" yaml:"water_temperature" toml:"water_temperature"`
+	Recipe           string  `json:"recipe" yaml:"recipe" toml:"recipe"`
+
+	BeansWeightSingle float64  `json:"beans_weight_single" yaml:"beans_weight_single" toml:"beans_weight_single"`
+	BeansWeightDouble float64  `json:"beans_weight_double" yaml:"beans_weight_double" toml:"beans_weight_double"`
+	GrindSetting      *float64 `json:"grind_setting" yaml:"grind_setting" toml:"grind_setting"` // Relative grind setting (unset: derived from the grinder setting / taken from the profile)
+}
+
+// Default returns the default configuration
+func Default() *Config {
+	grindSetting := scanner.DefaultGrindSetting
+	return &Config{
+		Influx: Influx{
+			User:       "root",
+			Password:   "root",
+			BackupDir:  defaultBackupDir(),
+			MaxBackups: backup.DefaultMaxBackups,
+
+			Compression:          curve.None.String(),
+			CompressionTolerance: curve.DefaultTolerance,
+		},
+		Defaults: Profile{
+			ExpectedSingleShotWeight: scanner.DefaultExpectedSingleShotWeight,
+			ExpectedDoubleShotWeight: scanner.DefaultExpectedDoubleShotWeight,
+			BeansWeightSingle:        scanner.DefaultSingleShotBeansWeight,
+			BeansWeightDouble:        scanner.DefaultDoubleShotBeansWeight,
+			GrindSetting:             &grindSetting,
+		},
+		Scales: []Scale{
+			{
+				DeviceID:    DefaultDeviceID,
+				APIEndpoint: DefaultAPIEndpoint,
+			},
+		},
+		Inventory: Inventory{
+			LowThreshold:  inventory.DefaultLowThreshold,
+			FreshnessDays: int(inventory.DefaultFreshnessWindow.Hours() / 24),
+		},
+		Grind: Grind{
+			TargetBrewTime: grind.DefaultTargetBrewTime.Seconds(),
+			Tolerance:      grind.DefaultTolerance.Seconds(),
+			Brews:          grind.DefaultBrews,
+			Sensitivity:    grind.DefaultSensitivity,
+			MaxAdjustment:  grind.DefaultMaxAdjustment,
+		},
+	}
+}
+
+// defaultBackupDir returns the default directory for backups of modified data points
+// (within the user's configuration directory, if available)
+func defaultBackupDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "brew", "backup")
+}
+
+// Tags returns the tags identifying the scale in all emitted data points
+func (s Scale) Tags() map[string]string {
+	tags := make(map[string]string)
+	if s.Station != "" {
+		tags["station"] = s.Station
+	}
+	if s.GroupHead != "" {
+		tags["group_head"] = s.GroupHead
+	}
+
+	return tags
+}
+
+// ScannerOptions returns the scanner options for a scale, using the default profile for
+// all profile settings not specified explicitly
+func (c *Config) ScannerOptions(s Scale) ([]func(*scanner.Scanner), error) {
+	profile := s.Profile.merge(c.Defaults)
+
+	setup, err := c.ScannerSetup(s.setupName(c.CurrentSetup), profile)
+	if err != nil {
+		return nil, err
+	}
+
+	options := []func(*scanner.Scanner){
+		scanner.WithSetup(setup),
+		scanner.WithTags(s.Tags()),
+	}
+	if profile.ExpectedSingleShotWeight > 0. {
+		options = append(options, scanner.WithExpectedSingleBrewShotWeight(profile.ExpectedSingleShotWeight))
+	}
+	if profile.ExpectedDoubleShotWeight > 0. {
+		options = append(options, scanner.WithExpectedDoubleBrewShotWeight(profile.ExpectedDoubleShotWeight))
+	}
+	if profile.PumpOffset != nil && *profile.PumpOffset > 0. {
+		options = append(options, scanner.WithPumpOffset(time.Duration(*profile.PumpOffset*float64(time.Second))))
+	}
+	if profile.LearnPumpOffset != nil && *profile.LearnPumpOffset {
+		options = append(options, scanner.WithPumpOffsetLearning())
+	}
+	compression, err := c.Influx.CurveCompression()
+	if err != nil {
+		return nil, err
+	}
+	if compression.Enabled() {
+		options = append(options, scanner.WithCompression(compression))
+	}
+
+	return options, nil
+}
+
+// ScannerSetup returns the named setup as applied to a scale with the given profile (an
+// empty name denoting no specific setup)
+func (c *Config) ScannerSetup(name string, profile Profile) (scanner.Setup, error) {
+
+	setup := scanner.Setup{
+		BeansWeightSingle: profile.BeansWeightSingle,
+		BeansWeightDouble: profile.BeansWeightDouble,
+	}
+	if profile.GrindSetting != nil {
+		setup.GrindSetting = *profile.GrindSetting
+	}
+	setup.Metadata.Grinder = profile.Grinder
+	if name == "" {
+		return setup, c.completeGrinderSetting(&setup)
+	}
+
+	s, exists := c.Setups[name]
+	if !exists {
+		return setup, fmt.Errorf("unknown setup: %s", name)
+	}
+
+	metadata, err := s.Metadata(name)
+	if err != nil {
+		return setup, err
+	}
+	setup.Metadata = metadata
+
+	if s.BeansWeightSingle > 0. {
+		setup.BeansWeightSingle = s.BeansWeightSingle
+	}
+	if s.BeansWeightDouble > 0. {
+		setup.BeansWeightDouble = s.BeansWeightDouble
+	}
+	if s.Grinder == "" {
+		setup.Metadata.Grinder = profile.Grinder
+	}
+
+	// Derive the relative grind setting from the native setting of the grinder (unless
+	// specified explicitly)
+	if s.GrindSetting != nil {
+		setup.GrindSetting = *s.GrindSetting
+	} else if s.GrinderSetting != "" {
+		if p, exists := c.grinderProfile(setup.Metadata.Grinder); exists {
+			relative, err := p.Normalize(s.GrinderSetting)
+			if err != nil {
+				return setup, fmt.Errorf("setup %s: %w", name, err)
+			}
+			setup.GrindSetting = relative
+		}
+	}
+
+	return setup, c.completeGrinderSetting(&setup)
+}
+
+// completeGrinderSetting sets the native grinder setting of a setup from its relative grind
+// setting, unless already specified (or the grinder is unknown)
+func (c *Config) completeGrinderSetting(setup *scanner.Setup) error {
+	if setup.Metadata.GrinderSetting != "" {
+		return nil
+	}
+	p, exists := c.grinderProfile(setup.Metadata.Grinder)
+	if !exists {
+		return nil
+	}
+
+	var err error
+	setup.Metadata.GrinderSetting, err = p.Format(setup.GrindSetting)
+	return err
+}
+
+// GrinderProfile returns the profile of the grinder with the given name (either user-defined
+// or built-in)
+func (c *Config) GrinderProfile(name string) (grinder.Profile, error) {
+	if g, exists := c.Grinders[name]; exists {
+		p := grinder.Profile{
+			Name:       name,
+			Notation:   grinder.Notation(g.Notation),
+			MacroSteps: g.MacroSteps,
+			MicroSteps: g.MicroSteps,
+			Min:        g.Min,
+			Max:        g.Max,
+			Step:       g.Step,
+		}
+		return p, p.Validate()
+	}
+	if p, exists := grinder.Lookup(name); exists {
+		return p, nil
+	}
+	return grinder.Profile{}, fmt.Errorf("unknown grinder %s (built-in: %s)", name, strings.Join(grinder.Names(), ", "))
+}
+
+// ParseGrindSetting parses a grind setting, either in the native notation of the grinder (if
+// known) or as relative setting marked by a percent suffix (see grinder.Parse)
+func (c *Config) ParseGrindSetting(setting, grinderName string) (float64, error) {
+	if p, exists := c.grinderProfile(grinderName); exists {
+		return grinder.Parse(setting, &p)
+	}
+	return grinder.Parse(setting, nil)
+}
+
+func (c *Config) grinderProfile(name string) (grinder.Profile, bool) {
+	if name == "" {
+		return grinder.Profile{}, false
+	}
+	p, err := c.GrinderProfile(name)
+	return p, err == nil
+}
+
+// ScaleProfile returns the profile of the scale with the given device ID (or the default
+// profile if no such scale is configured)
+func (c *Config) ScaleProfile(deviceID string) Profile {
+	for _, s := range c.Scales {
+		if s.DeviceID == deviceID {
+			return s.Profile.merge(c.Defaults)
+		}
+	}
+	return c.Defaults
+}
+
+// ScaleByTags returns the scale whose tags (station / group head) match the provided ones (or
+// an empty scale, i.e. the default profile, if no such scale is configured)
+func (c *Config) ScaleByTags(tags map[string]string) Scale {
+	for _, s := range c.Scales {
+		scaleTags := s.Tags()
+		if len(scaleTags) == 0 {
+			continue
+		}
+		matches := true
+		for k, v := range scaleTags {
+			if tags[k] != v {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return s
+		}
+	}
+	return Scale{}
+}
+
+// Metadata returns the brew metadata defined by the setup
+func (s Setup) Metadata(name string) (brew.Metadata, error) {
+
+	metadata := brew.Metadata{
+		Setup:            name,
+		Beans:            s.Beans,
+		Roaster:          s.Roaster,
+		Grinder:          s.Grinder,
+		GrinderSetting:   s.GrinderSetting,
+		Basket:           s.Basket,
+		WaterTemperature: s.WaterTemperature,
+		Recipe:           s.Recipe,
+	}
+
+	if s.RoastDate != "" {
+		var err error
+		if metadata.RoastDate, err = time.Parse(brew.RoastDateLayout, s.RoastDate); err != nil {
+			return metadata, fmt.Errorf("setup %s: invalid roast date: %w", name, err)
+		}
+	}
+
+	return metadata, nil
+}
+
+// Options returns the options for the bean inventory
+func (i Inventory) Options() []func(*inventory.Inventory) {
+	return []func(*inventory.Inventory){
+		inventory.WithStateFile(i.StateFile),
+		inventory.WithLowThreshold(i.LowThreshold),
+		inventory.WithFreshnessWindow(time.Duration(i.FreshnessDays) * 24 * time.Hour),
+	}
+}
+
+// JournalOptions returns the options for the journal of backups
+func (i Influx) JournalOptions() []func(*backup.Journal) {
+	return []func(*backup.Journal){
+		backup.WithMaxBackups(i.MaxBackups),
+		backup.WithMaxAge(time.Duration(i.MaxBackupDays) * 24 * time.Hour),
+	}
+}
+
+// CurveCompression returns the compression applied to brew curves prior to storage
+func (i Influx) CurveCompression() (curve.Compression, error) {
+	mode, err := curve.ModeFromString(i.Compression)
+	if err != nil {
+		return curve.Compression{}, err
+	}
+	compression := curve.Compression{Mode: mode, Tolerance: i.CompressionTolerance}
+
+	return compression, compression.Validate()
+}
+
+// Options returns the options for the grind recommendations
+func (g Grind) Options() []func(*grind.Settings) {
+	return []func(*grind.Settings){
+		grind.WithBrews(g.Brews),
+		grind.WithTolerance(time.Duration(g.Tolerance * float64(time.Second))),
+		grind.WithSensitivity(g.Sensitivity),
+		grind.WithMaxAdjustment(g.MaxAdjustment),
+	}
+}
+
+// GrindTarget returns the target of the grind recommendations for a shot type
+func (c *Config) GrindTarget(shotType brew.ShotType) (grind.Target, error) {
+	target := grind.Target{BrewTime: time.Duration(c.Grind.TargetBrewTime * float64(time.Second))}
+	switch shotType {
+	case brew.SingleShot:
+		target.Yield = c.Defaults.ExpectedSingleShotWeight
+	case brew.DoubleShot:
+		target.Yield = c.Defaults.ExpectedDoubleShotWeight
+	default:
+		return grind.Target{}, fmt.Errorf("no target yield for shot type %s", shotType)
+	}
+
+	return target, nil
+}
+
+// BrewReferences returns the reference curves of all recipes, loading the brews of references
+// taken from stored brews via the provided function
+func (c *Config) BrewReferences(load func(id string) (*brew.Brew, error)) (map[string]brew.Reference, error) {
+
+	references := make(map[string]brew.Reference, len(c.References))
+	for recipe, r := range c.References {
+		var (
+			ref brew.Reference
+			err error
+		)
+		if r.BrewID != "" {
+			b, loadErr := load(r.BrewID)
+			if loadErr != nil {
+				return nil, fmt.Errorf("references[%s]: failed to load brew %s: %w", recipe, r.BrewID, loadErr)
+			}
+			ref, err = brew.ReferenceFromBrew(b)
+		} else {
+			ref, err = brew.ParametricReference(recipe,
+				time.Duration(r.PreInfusionTime*float64(time.Second)), time.Duration(r.BrewTime*float64(time.Second)), r.Yield)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("references[%s]: %w", recipe, err)
+		}
+		references[recipe] = ref
+	}
+
+	return references, nil
+}
+
+// CSVMapping returns the CSV column mapping with the given name (either user-defined or built-in)
+func (c *Config) CSVMapping(name string) (archive.Mapping, error) {
+	m, exists := c.CSVMappings[name]
+	if !exists {
+		builtIn, exists := archive.Mappings()[name]
+		if !exists {
+			return archive.Mapping{}, fmt.Errorf("unknown CSV mapping %s", name)
+		}
+		return builtIn, nil
+	}
+
+	mapping := archive.Mapping{
+		Columns:    m.Columns,
+		Positional: m.Positional,
+		TimeLayout: m.TimeLayout,
+		WeightUnit: m.WeightUnit,
+	}
+	if m.TimeZone != "" {
+		loc, err := time.LoadLocation(m.TimeZone)
+		if err != nil {
+			return archive.Mapping{}, fmt.Errorf("csv_mappings[%s]: invalid time zone %s: %w", name, m.TimeZone, err)
+		}
+		mapping.Location = loc
+	}
+
+	return mapping, nil
+}
+
+// ActionDefinitions returns the definitions of all user-defined action types
+func (c *Config) ActionDefinitions() []action.Definition {
+	defs := make([]action.Definition, 0, len(c.ActionTypes))
+	for _, t := range c.ActionTypes {
+		defs = append(defs, action.Definition{
+			Type:     t.Type,
+			Category: t.Category,
+			Label:    t.Label,
+			Interval: time.Duration(t.IntervalDays) * 24 * time.Hour,
+			Params:   t.Params,
+		})
+	}
+
+	return defs
+}
+
+// Schedule returns the maintenance tasks (or the default schedule if none are configured),
+// including all registered recurring action types not covered by a task
+func (m Maintenance) Schedule() []maintenance.Task {
+	tasks := maintenance.DefaultTasks()
+	if len(m.Tasks) > 0 {
+		tasks = make([]maintenance.Task, 0, len(m.Tasks))
+		for _, t := range m.Tasks {
+			tasks = append(tasks, maintenance.Task{
+				Type:     t.Type,
+				Shots:    t.Shots,
+				Interval: time.Duration(t.IntervalDays) * 24 * time.Hour,
+				Buzz:     t.Buzz,
+			})
+		}
+	}
+
+	return maintenance.WithRecurringActions(tasks)
+}
+
+func (s Scale) setupName(currentSetup string) string {
+	if s.Setup != "" {
+		return s.Setup
+	}
+	return currentSetup
+}
+
+// Validate checks the configuration for consistency, reporting all errors at once
+func (c *Config) Validate() error {
+
+	var errs []error
+	if c.Influx.Endpoint == "" {
+		errs = append(errs, errors.New("influx: no endpoint specified"))
+	}
+	if _, err := c.Influx.CurveCompression(); err != nil {
+		errs = append(errs, fmt.Errorf("influx: %w", err))
+	}
+	if c.Influx.MaxBackups < 0 {
+		errs = append(errs, fmt.Errorf("influx: negative maximum number of backups %d", c.Influx.MaxBackups))
+	}
+	if c.Influx.MaxBackupDays < 0 {
+		errs = append(errs, fmt.Errorf("influx: negative maximum age of backups of %d days", c.Influx.MaxBackupDays))
+	}
+
+	errs = append(errs, c.Defaults.validate("defaults")...)
+
+	if len(c.Scales) == 0 {
+		errs = append(errs, errors.New("scales: no scales specified"))
+	}
+	deviceIDs, apiEndpoints := make(map[string]int), make(map[string]int)
+	for i, s := range c.Scales {
+		prefix := fmt.Sprintf("scales[%d]", i)
+		if s.DeviceID == "" {
+			errs = append(errs, fmt.Errorf("%s: no device ID specified", prefix))
+		} else if j, exists := deviceIDs[s.DeviceID]; exists {
+			errs = append(errs, fmt.Errorf("%s: duplicate device ID %s (already used by scales[%d])", prefix, s.DeviceID, j))
+		} else {
+			deviceIDs[s.DeviceID] = i
+		}
+		if s.APIEndpoint != "" {
+			if j, exists := apiEndpoints[s.APIEndpoint]; exists {
+				errs = append(errs, fmt.Errorf("%s: duplicate API endpoint %s (already used by scales[%d])", prefix, s.APIEndpoint, j))
+			} else {
+				apiEndpoints[s.APIEndpoint] = i
+			}
+		}
+		errs = append(errs, s.Profile.merge(c.Defaults).validate(prefix)...)
+		if name := s.setupName(c.CurrentSetup); name != "" {
+			if _, exists := c.Setups[name]; !exists {
+				errs = append(errs, fmt.Errorf("%s: unknown setup %s", prefix, name))
+			}
+		}
+	}
+
+	if c.Inventory.LowThreshold < 0. {
+		errs = append(errs, fmt.Errorf("inventory: negative low threshold %.1f", c.Inventory.LowThreshold))
+	}
+	if c.Inventory.FreshnessDays < 0 {
+		errs = append(errs, fmt.Errorf("inventory: negative freshness window of %d days", c.Inventory.FreshnessDays))
+	}
+
+	actionTypes := make(map[string]struct{})
+	for i, t := range c.ActionTypes {
+		prefix := fmt.Sprintf("action_types[%d]", i)
+		if t.Type == "" {
+			errs = append(errs, fmt.Errorf("%s: no type specified", prefix))
+		}
+		if t.Category == "" {
+			errs = append(errs, fmt.Errorf("%s: no category specified", prefix))
+		}
+		if t.IntervalDays < 0 {
+			errs = append(errs, fmt.Errorf("%s: negative interval", prefix))
+		}
+		if _, exists := actionTypes[t.Type]; exists {
+			errs = append(errs, fmt.Errorf("%s: duplicate type %s", prefix, t.Type))
+		}
+		actionTypes[t.Type] = struct{}{}
+	}
+
+	for i, t := range c.Maintenance.Tasks {
+		prefix := fmt.Sprintf("maintenance.tasks[%d]", i)
+		_, isUserDefined := actionTypes[t.Type]
+		if _, isValid := action.Categorize(t.Type); !isValid && !isUserDefined {
+			errs = append(errs, fmt.Errorf("%s: invalid action type %s", prefix, t.Type))
+		}
+		if t.Shots < 0 || t.IntervalDays < 0 || t.Buzz < 0 {
+			errs = append(errs, fmt.Errorf("%s: negative shots / interval / buzz", prefix))
+		}
+		if t.Shots == 0 && t.IntervalDays == 0 {
+			errs = append(errs, fmt.Errorf("%s: neither shots nor interval specified", prefix))
+		}
+	}
+
+	for name, s := range c.Setups {
+		prefix := fmt.Sprintf("setups[%s]", name)
+		if _, err := s.Metadata(name); err != nil {
+			errs = append(errs, err)
+		}
+		if p, exists := c.grinderProfile(s.Grinder); exists && s.GrinderSetting != "" {
+			if _, err := p.Normalize(s.GrinderSetting); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", prefix, err))
+			}
+		}
+		errs = append(errs, Profile{BeansWeightSingle: s.BeansWeightSingle, BeansWeightDouble: s.BeansWeightDouble, GrindSetting: s.GrindSetting}.validate(prefix)...)
+		if s.WaterTemperature < 0. || s.WaterTemperature > 100. {
+			errs = append(errs, fmt.Errorf("%s: water temperature %.1f out of range [0, 100]", prefix, s.WaterTemperature))
+		}
+	}
+
+	for recipe, r := range c.References {
+		prefix := fmt.Sprintf("references[%s]", recipe)
+		if r.BrewID != "" && (r.BrewTime != 0. || r.Yield != 0.) {
+			errs = append(errs, fmt.Errorf("%s: either a brew ID or brew time / yield can be specified", prefix))
+		} else if r.BrewID == "" {
+			if _, err := brew.ParametricReference(recipe, time.Duration(r.PreInfusionTime*float64(time.Second)), time.Duration(r.BrewTime*float64(time.Second)), r.Yield); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", prefix, err))
+			}
+		}
+	}
+
+	if c.Grind.TargetBrewTime <= 0. {
+		errs = append(errs, fmt.Errorf("grind: non-positive target brew time %.1f", c.Grind.TargetBrewTime))
+	}
+	if c.Grind.Tolerance < 0. || c.Grind.Sensitivity <= 0. || c.Grind.MaxAdjustment <= 0. || c.Grind.MaxAdjustment > 1. {
+		errs = append(errs, errors.New("grind: tolerance must not be negative, sensitivity must be positive and max adjustment within (0, 1]"))
+	}
+	if c.Grind.Brews < 1 {
+		errs = append(errs, fmt.Errorf("grind: invalid number of brews %d", c.Grind.Brews))
+	}
+
+	for name := range c.Grinders {
+		if _, err := c.GrinderProfile(name); err != nil {
+			errs = append(errs, fmt.Errorf("grinders[%s]: %w", name, err))
+		}
+	}
+	if c.Defaults.Grinder != "" {
+		if _, err := c.GrinderProfile(c.Defaults.Grinder); err != nil {
+			errs = append(errs, fmt.Errorf("defaults: %w", err))
+		}
+	}
+
+	for name, m := range c.CSVMappings {
+		if len(m.Columns) > 0 && len(m.Positional) > 0 {
+			errs = append(errs, fmt.Errorf("csv_mappings[%s]: either columns or positional fields can be specified", name))
+		}
+		if _, err := brew.UnitFromString(m.WeightUnit); err != nil {
+			errs = append(errs, fmt.Errorf("csv_mappings[%s]: %w", name, err))
+		}
+		if _, err := c.CSVMapping(name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (p Profile) merge(defaults Profile) Profile {
+	if p.ExpectedSingleShotWeight == 0. {
+		p.ExpectedSingleShotWeight = defaults.ExpectedSingleShotWeight
+	}
+	if p.ExpectedDoubleShotWeight == 0. {
+		p.ExpectedDoubleShotWeight = defaults.ExpectedDoubleShotWeight
+	}
+	if p.BeansWeightSingle == 0. {
+		p.BeansWeightSingle = defaults.BeansWeightSingle
+	}
+	if p.BeansWeightDouble == 0. {
+		p.BeansWeightDouble = defaults.BeansWeightDouble
+	}
+	if p.GrindSetting == nil {
+		p.GrindSetting = defaults.GrindSetting
+	}
+	if p.Grinder == "" {
+		p.Grinder = defaults.Grinder
+	}
+	if p.PumpOffset == nil {
+		p.PumpOffset = defaults.PumpOffset
+	}
+	if p.LearnPumpOffset == nil {
+		p.LearnPumpOffset = defaults.LearnPumpOffset
+	}
+
+	return p
+}
+
+func (p Profile) validate(prefix string) (errs []error) {
+	if p.ExpectedSingleShotWeight < 0. || p.ExpectedDoubleShotWeight < 0. {
+		errs = append(errs, fmt.Errorf("%s: expected shot weights must not be negative", prefix))
+	}
+	if p.ExpectedSingleShotWeight > 0. && p.ExpectedDoubleShotWeight > 0. && p.ExpectedSingleShotWeight >= p.ExpectedDoubleShotWeight {
+		errs = append(errs, fmt.Errorf("%s: expected single shot weight (%.2f) must be lower than expected double shot weight (%.2f)", prefix, p.ExpectedSingleShotWeight, p.ExpectedDoubleShotWeight))
+	}
+	if p.BeansWeightSingle < 0. || p.BeansWeightDouble < 0. {
+		errs = append(errs, fmt.Errorf("%s: beans weights must not be negative", prefix))
+	}
+	if p.GrindSetting != nil && !(*p.GrindSetting >= 0. && *p.GrindSetting <= 1.) {
+		errs = append(errs, fmt.Errorf("%s: grind setting %.3f out of range [0.0, 1.0]", prefix, *p.GrindSetting))
+	}
+	if p.PumpOffset != nil && (*p.PumpOffset < 0. || *p.PumpOffset > scanner.MaxPumpLead.Seconds()) {
+		errs = append(errs, fmt.Errorf("%s: pump offset %.1fs out of range [0, %.0fs]", prefix, *p.PumpOffset, scanner.MaxPumpLead.Seconds()))
+	}
+
+	return
+}
@@ -0,0 +1,401 @@
+package config
+
+import (
+	"flag"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fako1024/brew/maintenance"
+)
+
+const (
+	testYAML = `influx:
+  endpoint: http://localhost:8086
+  user: brew
+defaults:
+  grind_setting: 0.3
+scales:
+  - device_id: "AA:BB:CC:DD:EE:01"
+    station: bar
+    group_head: "1"
+  - device_id: "AA:BB:CC:DD:EE:02"
+    station: bar
+    group_head: "2"
+    beans_weight_double: 18.5
+`
+	testTOML = `[influx]
+endpoint = "http://localhost:8086"
+user = "brew"
+
+[defaults]
+grind_setting = 0.3
+
+[[scales]]
+device_id = "AA:BB:CC:DD:EE:01"
+station = "bar"
+group_head = "1"
+
+[[scales]]
+device_id = "AA:BB:CC:DD:EE:02"
+station = "bar"
+group_head = "2"
+beans_weight_double = 18.5
+`
+	testJSON = `{
+  "influx": {"endpoint": "http://localhost:8086", "user": "brew"},
+  "defaults": {"grind_setting": 0.3},
+  "scales": [
+    {"device_id": "AA:BB:CC:DD:EE:01", "station": "bar", "group_head": "1"},
+    {"device_id": "AA:BB:CC:DD:EE:02", "station": "bar", "group_head": "2", "beans_weight_double": 18.5}
+  ]
+}`
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write test file: %s", err)
+	}
+	return path
+}
+
+func load(t *testing.T, args ...string) (*Config, error) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	loader := NewLoader(fs, InfluxSettings, ProfileSettings, ScaleSettings, DebugSettings)
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("Failed to parse flags: %s", err)
+	}
+	return loader.Load()
+}
+
+func TestDefaults(t *testing.T) {
+	cfg, err := load(t)
+	if err != nil {
+		t.Fatalf("Failed to load default configuration: %s", err)
+	}
+	if len(cfg.Scales) != 1 || cfg.Scales[0].DeviceID != DefaultDeviceID || cfg.Scales[0].APIEndpoint != DefaultAPIEndpoint {
+		t.Fatalf("Unexpected default scales: %v", cfg.Scales)
+	}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "no endpoint specified") {
+		t.Fatalf("Unexpected validation result for missing endpoint: %v", err)
+	}
+}
+
+func TestLoadFileFormats(t *testing.T) {
+	for name, content := range map[string]string{
+		"config.yaml": testYAML,
+		"config.toml": testTOML,
+		"config.json": testJSON,
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := load(t, "-config", writeFile(t, name, content))
+			if err != nil {
+				t.Fatalf("Failed to load configuration: %s", err)
+			}
+			if err := cfg.Validate(); err != nil {
+				t.Fatalf("Unexpected invalid configuration: %s", err)
+			}
+
+			if cfg.Influx.Endpoint != "http://localhost:8086" || cfg.Influx.User != "brew" || cfg.Influx.Password != "root" {
+				t.Fatalf("Unexpected InfluxDB settings: %v", cfg.Influx)
+			}
+			if len(cfg.Scales) != 2 {
+				t.Fatalf("Unexpected number of scales, want 2, have %d", len(cfg.Scales))
+			}
+			if tags := cfg.Scales[1].Tags(); tags["station"] != "bar" || tags["group_head"] != "2" {
+				t.Fatalf("Unexpected tags: %v", tags)
+			}
+			if profile := cfg.Scales[1].Profile.merge(cfg.Defaults); profile.BeansWeightDouble != 18.5 || *profile.GrindSetting != 0.3 || profile.BeansWeightSingle != cfg.Defaults.BeansWeightSingle {
+				t.Fatalf("Unexpected merged profile: %v", profile)
+			}
+		})
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	configFile := writeFile(t, "config.yaml", testYAML)
+	passwordFile := writeFile(t, "password", "s3cr3t\n")
+
+	t.Setenv(EnvPrefix+"INFLUX_USER", "env-user")
+	t.Setenv(EnvPrefix+"INFLUX_PASSWORD_FILE", passwordFile)
+	t.Setenv(EnvPrefix+"GRIND_SETTING", "0.4")
+
+	cfg, err := load(t, "-config", configFile, "-grindSetting", "0.5", "-debug")
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %s", err)
+	}
+	if cfg.Influx.Endpoint != "http://localhost:8086" {
+		t.Fatalf("Unexpected endpoint from configuration file: %s", cfg.Influx.Endpoint)
+	}
+	if cfg.Influx.User != "env-user" {
+		t.Fatalf("Unexpected user from environment: %s", cfg.Influx.User)
+	}
+	if cfg.Influx.Password != "s3cr3t" {
+		t.Fatalf("Unexpected password from secret file: %s", cfg.Influx.Password)
+	}
+	if *cfg.Defaults.GrindSetting != 0.5 {
+		t.Fatalf("Unexpected grind setting from flag: %v", *cfg.Defaults.GrindSetting)
+	}
+	if !cfg.Debug {
+		t.Fatalf("Unexpected debug setting from flag")
+	}
+
+	// An explicit password flag takes precedence over the password file from the environment
+	if cfg, err = load(t, "-config", configFile, "-influxPassword", "flag-password"); err != nil {
+		t.Fatalf("Failed to load configuration: %s", err)
+	}
+	if cfg.Influx.Password != "flag-password" {
+		t.Fatalf("Unexpected password from flag: %s", cfg.Influx.Password)
+	}
+}
+
+func TestZeroProfileSettings(t *testing.T) {
+
+	// Explicit zero values of a scale take precedence over the default profile
+	configFile := writeFile(t, "config.yaml", strings.NewReplacer(
+		"  grind_setting: 0.3\n", "  grind_setting: 0.3\n  pump_offset: 4\n",
+		"    beans_weight_double: 18.5\n", "    beans_weight_double: 18.5\n    grind_setting: 0.0\n    pump_offset: 0\n",
+	).Replace(testYAML))
+	cfg, err := load(t, "-config", configFile)
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %s", err)
+	}
+	for i, expected := range []struct{ grindSetting, pumpOffset float64 }{{0.3, 4.}, {0., 0.}} {
+		profile := cfg.Scales[i].Profile.merge(cfg.Defaults)
+		if profile.GrindSetting == nil || *profile.GrindSetting != expected.grindSetting || profile.PumpOffset == nil || *profile.PumpOffset != expected.pumpOffset {
+			t.Fatalf("Unexpected profile of scale %d: %v / %v", i, profile.GrindSetting, profile.PumpOffset)
+		}
+	}
+}
+
+func TestPumpOffsetLearning(t *testing.T) {
+
+	// Learning is disabled unless enabled explicitly
+	cfg, err := load(t)
+	if err != nil {
+		t.Fatalf("Failed to load default configuration: %s", err)
+	}
+	if learn := cfg.Scales[0].Profile.merge(cfg.Defaults).LearnPumpOffset; learn != nil && *learn {
+		t.Fatalf("Unexpected learning of pump offset by default")
+	}
+
+	// A scale may disable learning enabled by default
+	configFile := writeFile(t, "config.yaml", strings.Replace(testYAML, "    beans_weight_double: 18.5\n", "    beans_weight_double: 18.5\n    learn_pump_offset: false\n", 1))
+	if cfg, err = load(t, "-config", configFile, "-learnPumpOffset"); err != nil {
+		t.Fatalf("Failed to load configuration: %s", err)
+	}
+	for i, expected := range []bool{true, false} {
+		if learn := cfg.Scales[i].Profile.merge(cfg.Defaults).LearnPumpOffset; learn == nil || *learn != expected {
+			t.Fatalf("Unexpected learning of pump offset for scale %d: %v", i, learn)
+		}
+	}
+}
+
+func TestReportAllErrors(t *testing.T) {
+	t.Setenv(EnvPrefix+"BEANS_WEIGHT_SINGLE", "a lot")
+	t.Setenv(EnvPrefix+"INFLUX_PASSWORD_FILE", filepath.Join(t.TempDir(), "missing"))
+
+	configFile := writeFile(t, "config.yaml", `defaults:
+  grind_setting: 1.5
+  expected_single_shot_weight: 70
+  expected_double_shot_weight: 60
+scales:
+  - device_id: "AA:BB:CC:DD:EE:01"
+  - device_id: "AA:BB:CC:DD:EE:01"
+  - station: bar
+`)
+
+	cfg, err := load(t, "-config", configFile, "-deviceID", "AA:BB:CC:DD:EE:03", "-influxCompression", "zip")
+	if err == nil {
+		t.Fatalf("Expected error loading invalid configuration")
+	}
+	for _, expected := range []string{EnvPrefix + "BEANS_WEIGHT_SINGLE", "password file", "-deviceID"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("Expected load error to mention %q, have: %s", expected, err)
+		}
+	}
+
+	err = cfg.Validate()
+	if err == nil {
+		t.Fatalf("Expected error validating invalid configuration")
+	}
+	for _, expected := range []string{"no endpoint specified", "out of range", "must be lower than", "duplicate device ID", "scales[2]: no device ID specified", "unsupported curve compression"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("Expected validation error to mention %q, have: %s", expected, err)
+		}
+	}
+}
+
+func TestUnknownFields(t *testing.T) {
+	for name, content := range map[string]string{
+		"config.yaml": "influx:\n  endpiont: http://localhost:8086\n",
+		"config.toml": "[influx]\nendpiont = \"http://localhost:8086\"\n",
+		"config.json": `{"influx": {"endpiont": "http://localhost:8086"}}`,
+		"config.ini":  "",
+	} {
+		if _, err := load(t, "-config", writeFile(t, name, content)); err == nil {
+			t.Fatalf("Expected error loading configuration file %s", name)
+		}
+	}
+}
+
+func TestSetups(t *testing.T) {
+	configFile := writeFile(t, "config.yaml", testYAML+`setups:
+  house:
+    beans: House Blend
+    roast_date: "2020-09-01"
+    grinder: Vario
+    grinder_setting: 3B
+    beans_weight_double: 19
+  guest:
+    beans: Guest Roast
+  finest:
+    grinder: Niche Zero
+    grind_setting: 0
+current_setup: house
+`)
+
+	cfg, err := load(t, "-config", configFile)
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %s", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Unexpected validation error: %s", err)
+	}
+
+	// The setup beans weight takes precedence over the profile of the scale
+	setup, err := cfg.ScannerSetup(cfg.CurrentSetup, cfg.ScaleProfile("AA:BB:CC:DD:EE:02"))
+	if err != nil {
+		t.Fatalf("Failed to get scanner setup: %s", err)
+	}
+	if setup.Metadata.Setup != "house" || setup.Metadata.GrinderSetting != "3B" || setup.Metadata.RoastDate.IsZero() {
+		t.Fatalf("Unexpected setup metadata: %#v", setup.Metadata)
+	}
+	if setup.BeansWeightDouble != 19. || setup.GrindSetting != 0.3 {
+		t.Fatalf("Unexpected setup weights / grind setting: %#v", setup)
+	}
+
+	// An explicit grind setting of zero (the finest setting) takes precedence over the profile
+	if setup, err = cfg.ScannerSetup("finest", cfg.ScaleProfile("AA:BB:CC:DD:EE:02")); err != nil {
+		t.Fatalf("Failed to get scanner setup: %s", err)
+	}
+	if setup.GrindSetting != 0. || setup.Metadata.GrinderSetting != "0" {
+		t.Fatalf("Unexpected grind setting of finest setup: %#v", setup)
+	}
+
+	cfg.Scales[0].Setup = "unknown"
+	cfg.Setups["guest"] = Setup{RoastDate: "01.09.2020"}
+	err = cfg.Validate()
+	if err == nil {
+		t.Fatalf("Expected validation errors for invalid setups")
+	}
+	for _, expected := range []string{"unknown setup unknown", "setup guest: invalid roast date"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("Missing error `%s` in: %s", expected, err)
+		}
+	}
+}
+
+func TestMaintenanceSchedule(t *testing.T) {
+	cfg := Default()
+	cfg.Influx.Endpoint = "http://localhost:8086"
+	if len(cfg.Maintenance.Schedule()) != len(maintenance.DefaultTasks()) {
+		t.Fatalf("Unexpected default maintenance schedule: %v", cfg.Maintenance.Schedule())
+	}
+
+	cfg.Maintenance.Tasks = []MaintenanceTask{
+		{Type: "back_flush", Shots: 40},
+		{Type: "descale_brew_group", IntervalDays: 60},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Unexpected validation error: %s", err)
+	}
+	tasks := cfg.Maintenance.Schedule()
+	if len(tasks) != 2 || tasks[0].Shots != 40 || tasks[1].Interval != 60*24*time.Hour {
+		t.Fatalf("Unexpected maintenance schedule: %v", tasks)
+	}
+
+	cfg.Maintenance.Tasks = append(cfg.Maintenance.Tasks, MaintenanceTask{Type: "polish_cups"}, MaintenanceTask{Type: "back_flush"})
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatalf("Expected validation errors for invalid maintenance tasks")
+	}
+	for _, expected := range []string{"maintenance.tasks[2]: invalid action type polish_cups", "maintenance.tasks[3]: neither shots nor interval specified"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("Missing error `%s` in: %s", expected, err)
+		}
+	}
+}
+
+func TestGrinders(t *testing.T) {
+
+	// Settings in the native notation of the grinder are converted to relative settings
+	cfg, err := load(t, "-grinder", "Mahlkönig Vario", "-grindSetting", "3B")
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %s", err)
+	}
+	if math.Abs(*cfg.Defaults.GrindSetting-48./230.) > 1e-9 {
+		t.Fatalf("Unexpected grind setting: %v", *cfg.Defaults.GrindSetting)
+	}
+	if _, err := load(t, "-grinder", "Mahlkönig Vario", "-grindSetting", "11A"); err == nil {
+		t.Fatalf("Expected error for invalid grind setting")
+	}
+
+	// Relative settings require a percent suffix if a grinder is selected
+	if cfg, err = load(t, "-grinder", "Niche Zero", "-grindSetting", "50%"); err != nil {
+		t.Fatalf("Failed to load configuration: %s", err)
+	}
+	if *cfg.Defaults.GrindSetting != 0.5 {
+		t.Fatalf("Unexpected relative grind setting: %v", *cfg.Defaults.GrindSetting)
+	}
+	if cfg, err = load(t, "-grinder", "Niche Zero", "-grindSetting", "0.5"); err != nil {
+		t.Fatalf("Failed to load configuration: %s", err)
+	}
+	if math.Abs(*cfg.Defaults.GrindSetting-0.01) > 1e-9 {
+		t.Fatalf("Unexpected native grind setting: %v", *cfg.Defaults.GrindSetting)
+	}
+
+	configFile := writeFile(t, "config.yaml", testYAML+`grinders:
+  Hand Grinder:
+    notation: clicks
+    max: 30
+setups:
+  niche:
+    grinder: Niche Zero
+    grinder_setting: "15"
+  hand:
+    grinder: Hand Grinder
+    grind_setting: 0.5
+`)
+	if cfg, err = load(t, "-config", configFile); err != nil {
+		t.Fatalf("Failed to load configuration: %s", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Unexpected validation error: %s", err)
+	}
+
+	// The relative grind setting is derived from the native setting (and vice versa)
+	setup, err := cfg.ScannerSetup("niche", cfg.Defaults)
+	if err != nil || math.Abs(setup.GrindSetting-0.3) > 1e-9 {
+		t.Fatalf("Unexpected setup: %#v (error: %v)", setup, err)
+	}
+	if setup, err = cfg.ScannerSetup("hand", cfg.Defaults); err != nil || setup.Metadata.GrinderSetting != "15" {
+		t.Fatalf("Unexpected setup: %#v (error: %v)", setup, err)
+	}
+
+	cfg.Grinders["Broken"] = Grinder{Notation: "dial", Min: 10, Max: 5}
+	cfg.Setups["niche"] = Setup{Grinder: "Niche Zero", GrinderSetting: "3B"}
+	err = cfg.Validate()
+	if err == nil {
+		t.Fatalf("Expected validation errors for invalid grinders")
+	}
+	for _, expected := range []string{"grinders[Broken]: invalid dial range", `setups[niche]: invalid setting "3B"`} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("Missing error `%s` in: %s", expected, err)
+		}
+	}
+}
@@ -0,0 +1,434 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+
+	// EnvPrefix denotes the prefix of all environment variables overriding configuration settings
+	EnvPrefix = "BREW_"
+
+	// EnvConfigFile denotes the environment variable specifying the configuration file to use
+	EnvConfigFile = EnvPrefix + "CONFIG"
+)
+
+// setting denotes a single configuration setting that can be overridden via the
+// environment and / or a command line flag
+type setting struct {
+	flag   string // Name of the command line flag
+	env    string // Name of the environment variable (without prefix)
+	usage  string // Usage description
+	isBool bool   // Setting is a boolean switch
+
+	get func(c *Config) string
+	set func(c *Config, value string) error
+}
+
+var (
+
+	// InfluxSettings denotes the settings for the InfluxDB connection
+	InfluxSettings = []string{"influxEndpoint", "influxUser", "influxPassword", "influxPasswordFile", "influxBackupDir", "influxCompression", "influxCompressionTolerance"}
+
+	// ProfileSettings denotes the settings for the default scanner profile
+	ProfileSettings = []string{"expectedSingleShotWeight", "expectedDoubleShotWeight", "beansWeightSingle", "beansWeightDouble", "grinder", "grindSetting", "pumpOffset", "learnPumpOffset"}
+
+	// ScaleSettings denotes the settings for a single scale (only valid if exactly one scale is configured)
+	ScaleSettings = []string{"deviceID", "api"}
+
+	// InventorySettings denotes the settings for the bean inventory
+	InventorySettings = []string{"inventoryStateFile"}
+
+	// ControlAPISettings denotes the settings for the brew control API
+	ControlAPISettings = []string{"controlAPI"}
+
+	// DebugSettings denotes the settings for debugging
+	DebugSettings = []string{"debug"}
+)
+
+var settings = []setting{
+	{
+		flag: "influxEndpoint", env: "INFLUX_ENDPOINT", usage: "Endpoint for InfluxDB emissions",
+		get: func(c *Config) string { return c.Influx.Endpoint },
+		set: func(c *Config, v string) error { c.Influx.Endpoint = v; return nil },
+	},
+	{
+		flag: "influxUser", env: "INFLUX_USER", usage: "User for InfluxDB emissions",
+		get: func(c *Config) string { return c.Influx.User },
+		set: func(c *Config, v string) error { c.Influx.User = v; return nil },
+	},
+	{
+		flag: "influxPassword", env: "INFLUX_PASSWORD", usage: "Password for InfluxDB emissions (prefer influxPasswordFile)",
+		get: func(c *Config) string { return c.Influx.Password },
+		set: func(c *Config, v string) error { c.Influx.Password = v; return nil },
+	},
+	{
+		flag: "influxPasswordFile", env: "INFLUX_PASSWORD_FILE", usage: "File containing the password for InfluxDB emissions",
+		get: func(c *Config) string { return c.Influx.PasswordFile },
+		set: func(c *Config, v string) error { c.Influx.PasswordFile = v; return nil },
+	},
+	{
+		flag: "influxBackupDir", env: "INFLUX_BACKUP_DIR", usage: "Directory to back up data points to before modifying them (disabled if empty)",
+		get: func(c *Config) string { return c.Influx.BackupDir },
+		set: func(c *Config, v string) error { c.Influx.BackupDir = v; return nil },
+	},
+	{
+		flag: "influxCompression", env: "INFLUX_COMPRESSION", usage: "Compression of brew curves prior to storage (none, lossless or simplify)",
+		get: func(c *Config) string { return c.Influx.Compression },
+		set: func(c *Config, v string) error { c.Influx.Compression = v; return nil },
+	},
+	{
+		flag: "influxCompressionTolerance", env: "INFLUX_COMPRESSION_TOLERANCE", usage: "Maximum deviation of the weight of simplified brew curves",
+		get: func(c *Config) string { return formatFloat(c.Influx.CompressionTolerance) },
+		set: func(c *Config, v string) error { return parseFloat(v, &c.Influx.CompressionTolerance) },
+	},
+	{
+		flag: "expectedSingleShotWeight", env: "EXPECTED_SINGLE_SHOT_WEIGHT", usage: "Expected yield of a single shot (used for classification)",
+		get: func(c *Config) string { return formatFloat(c.Defaults.ExpectedSingleShotWeight) },
+		set: func(c *Config, v string) error { return parseFloat(v, &c.Defaults.ExpectedSingleShotWeight) },
+	},
+	{
+		flag: "expectedDoubleShotWeight", env: "EXPECTED_DOUBLE_SHOT_WEIGHT", usage: "Expected yield of a double shot (used for classification)",
+		get: func(c *Config) string { return formatFloat(c.Defaults.ExpectedDoubleShotWeight) },
+		set: func(c *Config, v string) error { return parseFloat(v, &c.Defaults.ExpectedDoubleShotWeight) },
+	},
+	{
+		flag: "beansWeightSingle", env: "BEANS_WEIGHT_SINGLE", usage: "Weight of beans / grounds used for a single shot",
+		get: func(c *Config) string { return formatFloat(c.Defaults.BeansWeightSingle) },
+		set: func(c *Config, v string) error { return parseFloat(v, &c.Defaults.BeansWeightSingle) },
+	},
+	{
+		flag: "beansWeightDouble", env: "BEANS_WEIGHT_DOUBLE", usage: "Weight of beans / grounds used for a double shot",
+		get: func(c *Config) string { return formatFloat(c.Defaults.BeansWeightDouble) },
+		set: func(c *Config, v string) error { return parseFloat(v, &c.Defaults.BeansWeightDouble) },
+	},
+	{
+		flag: "grinder", env: "GRINDER", usage: "Grinder in use (allowing grind settings in its native notation, e.g. Mahlkönig Vario)",
+		get: func(c *Config) string { return c.Defaults.Grinder },
+		set: func(c *Config, v string) error { c.Defaults.Grinder = v; return nil },
+	},
+	{
+		flag: "grindSetting", env: "GRIND_SETTING", usage: "Grinder setting in the notation of the grinder (e.g. 3B) or relative (e.g. 25%, without grinder 0.0: Fine -> 1.0: Coarse)",
+		get: func(c *Config) string { return formatOptionalFloat(c.Defaults.GrindSetting) },
+		set: func(c *Config, v string) error {
+			relative, err := c.ParseGrindSetting(v, c.Defaults.Grinder)
+			if err != nil {
+				return err
+			}
+			c.Defaults.GrindSetting = &relative
+			return nil
+		},
+	},
+	{
+		flag: "pumpOffset", env: "PUMP_OFFSET", usage: "Time from the start of the pump to the first drop until learned (in seconds, 0: unknown)",
+		get: func(c *Config) string { return formatOptionalFloat(c.Defaults.PumpOffset) },
+		set: func(c *Config, v string) error { return parseOptionalFloat(v, &c.Defaults.PumpOffset) },
+	},
+	{
+		flag: "learnPumpOffset", env: "LEARN_PUMP_OFFSET", usage: "Learn the pump offset from brews with signaled start of the pump (in memory only)", isBool: true,
+		get: func(c *Config) string {
+			return strconv.FormatBool(c.Defaults.LearnPumpOffset != nil && *c.Defaults.LearnPumpOffset)
+		},
+		set: func(c *Config, v string) error {
+			learn, err := strconv.ParseBool(v)
+			if err != nil {
+				return err
+			}
+			c.Defaults.LearnPumpOffset = &learn
+			return nil
+		},
+	},
+	{
+		flag: "deviceID", env: "DEVICE_ID", usage: "Device ID of the scale (only if a single scale is configured)",
+		get: func(c *Config) string { return singleScale(c).DeviceID },
+		set: func(c *Config, v string) error {
+			s, err := mustSingleScale(c)
+			if err != nil {
+				return err
+			}
+			s.DeviceID = v
+			return nil
+		},
+	},
+	{
+		flag: "api", env: "API_ENDPOINT", usage: "Endpoint for scale API (only if a single scale is configured)",
+		get: func(c *Config) string { return singleScale(c).APIEndpoint },
+		set: func(c *Config, v string) error {
+			s, err := mustSingleScale(c)
+			if err != nil {
+				return err
+			}
+			s.APIEndpoint = v
+			return nil
+		},
+	},
+	{
+		flag: "inventoryStateFile", env: "INVENTORY_STATE_FILE", usage: "File to persist the bean inventory to (disabled if empty)",
+		get: func(c *Config) string { return c.Inventory.StateFile },
+		set: func(c *Config, v string) error { c.Inventory.StateFile = v; return nil },
+	},
+	{
+		flag: "controlAPI", env: "CONTROL_API", usage: "Endpoint for the brew control API (e.g. switching setups at runtime)",
+		get: func(c *Config) string { return c.ControlAPI },
+		set: func(c *Config, v string) error { c.ControlAPI = v; return nil },
+	},
+	{
+		flag: "debug", env: "DEBUG", usage: "Enable debugging mode (more verbose logging)", isBool: true,
+		get: func(c *Config) string { return strconv.FormatBool(c.Debug) },
+		set: func(c *Config, v string) (err error) { c.Debug, err = strconv.ParseBool(v); return },
+	},
+}
+
+// Loader loads the configuration from (in ascending order of precedence) the defaults, a
+// configuration file (YAML, TOML or JSON), the environment and command line flags
+type Loader struct {
+	fs         *flag.FlagSet
+	configFile string
+	flags      map[string]*flagValue
+}
+
+// NewLoader instantiates a new configuration loader, registering the -config flag and
+// the flags for the requested settings (e.g. InfluxSettings) with the provided flag set
+func NewLoader(fs *flag.FlagSet, settingNames ...[]string) *Loader {
+	l := &Loader{
+		fs:    fs,
+		flags: make(map[string]*flagValue),
+	}
+
+	fs.StringVar(&l.configFile, "config", os.Getenv(EnvConfigFile), "Path to configuration file (YAML, TOML or JSON) (env: "+EnvConfigFile+")")
+
+	defaults := Default()
+	for _, names := range settingNames {
+		for _, name := range names {
+			s, exists := lookupSetting(name)
+			if !exists {
+				panic(fmt.Sprintf("unknown configuration setting: %s", name))
+			}
+			if _, exists := l.flags[name]; exists {
+				continue
+			}
+
+			v := &flagValue{isBool: s.isBool, def: s.get(defaults)}
+			if s.isBool && v.def == "false" {
+				v.def = ""
+			}
+			l.flags[name] = v
+			fs.Var(v, s.flag, fmt.Sprintf("%s (env: %s%s)", s.usage, EnvPrefix, s.env))
+		}
+	}
+
+	return l
+}
+
+// ConfigFile returns the path of the configuration file (if any)
+func (l *Loader) ConfigFile() string {
+	return l.configFile
+}
+
+// Load loads the configuration (to be called after the flag set was parsed), reporting
+// all errors encountered at once (alongside the configuration loaded despite them)
+func (l *Loader) Load() (*Config, error) {
+
+	cfg := Default()
+	var errs []error
+
+	// Load the configuration file, if any
+	if l.configFile != "" {
+		prevPasswordFile := cfg.Influx.PasswordFile
+		if err := cfg.readFile(l.configFile); err != nil {
+			errs = append(errs, err)
+		} else if cfg.Influx.PasswordFile != prevPasswordFile {
+			errs = append(errs, cfg.readPasswordFile())
+		}
+	}
+
+	// Apply overrides from the environment and from all explicitly set flags
+	errs = append(errs, l.apply(cfg, "environment", func(s setting) (string, bool) {
+		return os.LookupEnv(EnvPrefix + s.env)
+	})...)
+	errs = append(errs, l.apply(cfg, "flag", func(s setting) (string, bool) {
+		if v, exists := l.flags[s.flag]; exists && v.isSet {
+			return v.value, true
+		}
+		return "", false
+	})...)
+
+	return cfg, errors.Join(errs...)
+}
+
+// apply applies all setting overrides from a single source (the password file being resolved
+// after the password, so it takes precedence within the same source)
+func (l *Loader) apply(cfg *Config, source string, lookup func(s setting) (string, bool)) (errs []error) {
+	var passwordFileSet bool
+	for _, s := range settings {
+		value, exists := lookup(s)
+		if !exists {
+			continue
+		}
+		if err := s.set(cfg, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %w", source, s.name(source), err))
+		}
+		passwordFileSet = passwordFileSet || s.flag == "influxPasswordFile"
+	}
+
+	if passwordFileSet {
+		errs = append(errs, cfg.readPasswordFile())
+	}
+
+	return
+}
+
+func (c *Config) readPasswordFile() error {
+	if c.Influx.PasswordFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(c.Influx.PasswordFile)
+	if err != nil {
+		return fmt.Errorf("influx: failed to read password file: %w", err)
+	}
+	c.Influx.Password = strings.TrimRight(string(data), "\r\n")
+
+	return nil
+}
+
+func (c *Config) readFile(path string) error {
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read configuration file: %w", err)
+	}
+
+	// Scales defined in the configuration file replace the default one (instead of being
+	// decoded on top of it)
+	defaultScales := c.Scales
+	c.Scales = nil
+	defer func() {
+		if c.Scales == nil {
+			c.Scales = defaultScales
+		}
+	}()
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to parse YAML configuration file %s: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), c)
+		if err != nil {
+			return fmt.Errorf("failed to parse TOML configuration file %s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("failed to parse TOML configuration file %s: unknown fields %v", path, undecoded)
+		}
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(c); err != nil {
+			return fmt.Errorf("failed to parse JSON configuration file %s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("unsupported configuration file format: %s", ext)
+	}
+
+	return nil
+}
+
+func (s setting) name(source string) string {
+	if source == "environment" {
+		return EnvPrefix + s.env
+	}
+	return "-" + s.flag
+}
+
+func lookupSetting(name string) (setting, bool) {
+	for _, s := range settings {
+		if s.flag == name {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+func singleScale(c *Config) Scale {
+	if len(c.Scales) != 1 {
+		return Scale{}
+	}
+	return c.Scales[0]
+}
+
+func mustSingleScale(c *Config) (*Scale, error) {
+	if len(c.Scales) != 1 {
+		return nil, fmt.Errorf("only supported if exactly one scale is configured (have %d)", len(c.Scales))
+	}
+	return &c.Scales[0], nil
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func parseFloat(v string, dest *float64) (err error) {
+	*dest, err = strconv.ParseFloat(v, 64)
+	return
+}
+
+// formatOptionalFloat formats a setting that may be unset (empty if unset)
+func formatOptionalFloat(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return formatFloat(*v)
+}
+
+// parseOptionalFloat parses a setting that may be unset, marking it as set
+func parseOptionalFloat(v string, dest **float64) error {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return err
+	}
+	*dest = &f
+	return nil
+}
+
+// flagValue denotes a command line flag whose value is only applied if set explicitly
+type flagValue struct {
+	value  string
+	def    string
+	isSet  bool
+	isBool bool
+}
+
+func (f *flagValue) String() string {
+	if f == nil {
+		return ""
+	}
+	if f.isSet {
+		return f.value
+	}
+	return f.def
+}
+
+func (f *flagValue) Set(value string) error {
+	f.value, f.isSet = value, true
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool {
+	return f.isBool
+}
@@ -0,0 +1,118 @@
+package brew
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/fako1024/btscale/pkg/scale"
+	"github.com/google/uuid"
+)
+
+// minDataPoints denotes the minimum number of data points a (corrected) brew must retain
+const minDataPoints = 2
+
+// Classify determines the shot type of a brew based on its (net) yield and the expected
+// yields of single / double shots
+func Classify(yield, expectedSingleShotWeight, expectedDoubleShotWeight float64) ShotType {
+	if math.Abs(expectedSingleShotWeight-yield) < math.Abs(expectedDoubleShotWeight-yield) {
+		return SingleShot
+	}
+	return DoubleShot
+}
+
+// Trim removes all data points before start and / or after end (a zero time denoting no
+// limit) and updates the start / end of the brew accordingly
+func (b *Brew) Trim(start, end time.Time) error {
+
+	var dataPoints scale.DataPoints
+	for _, dataPoint := range b.DataPoints {
+		if !start.IsZero() && dataPoint.TimeStamp.Before(start) {
+			continue
+		}
+		if !end.IsZero() && dataPoint.TimeStamp.After(end) {
+			continue
+		}
+		dataPoints = append(dataPoints, dataPoint)
+	}
+	if len(dataPoints) < minDataPoints {
+		return fmt.Errorf("trimmed brew would retain %d data point(s), need at least %d", len(dataPoints), minDataPoints)
+	}
+
+	b.DataPoints = dataPoints
+	b.Start, b.End = dataPoints[0].TimeStamp, dataPoints[len(dataPoints)-1].TimeStamp
+
+	return nil
+}
+
+// Split separates a brew that erroneously contains two shots at the given time, returning
+// both brews (the first one retaining the ID of the original brew)
+func (b *Brew) Split(at time.Time) (*Brew, *Brew, error) {
+
+	if !at.After(b.Start) || !at.Before(b.End) {
+		return nil, nil, fmt.Errorf("split time %v outside of brew (%v - %v)", at, b.Start, b.End)
+	}
+
+	first, second := *b, *b
+	first.DataPoints, second.DataPoints, first.Annotations, second.Annotations = nil, nil, nil, nil
+	for _, dataPoint := range b.DataPoints {
+		if dataPoint.TimeStamp.Before(at) {
+			first.DataPoints = append(first.DataPoints, dataPoint)
+		} else {
+			second.DataPoints = append(second.DataPoints, dataPoint)
+		}
+	}
+	if len(first.DataPoints) < minDataPoints || len(second.DataPoints) < minDataPoints {
+		return nil, nil, fmt.Errorf("split would result in brews with less than %d data points", minDataPoints)
+	}
+	for _, annotation := range b.Annotations {
+		if annotation.TimeStamp.Before(at) {
+			first.Annotations = append(first.Annotations, annotation)
+		} else {
+			second.Annotations = append(second.Annotations, annotation)
+		}
+	}
+
+	first.Start, first.End = first.DataPoints[0].TimeStamp, first.DataPoints[len(first.DataPoints)-1].TimeStamp
+
+	// The second brew starts from the weight on the scale at the time of the split
+	second.ID = uuid.New().String()
+	second.Start, second.End = second.DataPoints[0].TimeStamp, second.DataPoints[len(second.DataPoints)-1].TimeStamp
+	second.Baseline = second.DataPoints[0].Weight
+	second.PumpStart, second.PumpStartSource = time.Time{}, ""
+
+	return &first, &second, nil
+}
+
+// Merge combines two brews that erroneously were tracked separately (e.g. due to a glitch),
+// retaining the ID, baseline and metadata of the earlier one
+func Merge(a, b *Brew) (*Brew, error) {
+
+	if a == nil || b == nil {
+		return nil, errors.New("cannot merge nil brew")
+	}
+	if a.ID == b.ID {
+		return nil, fmt.Errorf("cannot merge brew %s with itself", a.ID)
+	}
+	if b.Start.Before(a.Start) {
+		a, b = b, a
+	}
+
+	merged := *a
+	merged.DataPoints = append(append(scale.DataPoints{}, a.DataPoints...), b.DataPoints...)
+	sort.SliceStable(merged.DataPoints, func(i, j int) bool {
+		return merged.DataPoints[i].TimeStamp.Before(merged.DataPoints[j].TimeStamp)
+	})
+	merged.Annotations = append(append([]Annotation{}, a.Annotations...), b.Annotations...)
+	sort.SliceStable(merged.Annotations, func(i, j int) bool {
+		return merged.Annotations[i].TimeStamp.Before(merged.Annotations[j].TimeStamp)
+	})
+
+	if len(merged.DataPoints) > 0 {
+		merged.Start, merged.End = merged.DataPoints[0].TimeStamp, merged.DataPoints[len(merged.DataPoints)-1].TimeStamp
+	}
+
+	return &merged, nil
+}
@@ -0,0 +1,81 @@
+package brew
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fako1024/btscale/pkg/scale"
+)
+
+func testBrew(start time.Time, weights ...float64) *Brew {
+	b := &Brew{ID: "test", Start: start}
+	for i, weight := range weights {
+		b.DataPoints = append(b.DataPoints, scale.DataPoint{TimeStamp: start.Add(time.Duration(i) * time.Second), Weight: weight, Unit: "g"})
+	}
+	b.End = b.DataPoints[len(b.DataPoints)-1].TimeStamp
+	return b
+}
+
+func TestClassify(t *testing.T) {
+	for yield, expected := range map[float64]ShotType{
+		20.: SingleShot,
+		40.: SingleShot,
+		50.: DoubleShot,
+		80.: DoubleShot,
+	} {
+		if shotType := Classify(yield, 30., 65.); shotType != expected {
+			t.Fatalf("Unexpected shot type for yield %.1f, want %s, have %s", yield, expected, shotType)
+		}
+	}
+}
+
+func TestTrim(t *testing.T) {
+	start := time.Date(2020, 9, 23, 11, 0, 0, 0, time.UTC)
+	b := testBrew(start, 0., 1., 5., 10., 15., 15.)
+
+	if err := b.Trim(start.Add(4*time.Second), start.Add(4*time.Second)); err == nil {
+		t.Fatalf("Expected error for trim retaining a single data point")
+	}
+	if err := b.Trim(start.Add(time.Second), start.Add(4*time.Second)); err != nil {
+		t.Fatalf("Failed to trim brew: %s", err)
+	}
+	if len(b.DataPoints) != 4 || !b.Start.Equal(start.Add(time.Second)) || !b.End.Equal(start.Add(4*time.Second)) {
+		t.Fatalf("Unexpected trimmed brew: %v - %v, %d data points", b.Start, b.End, len(b.DataPoints))
+	}
+}
+
+func TestSplitMerge(t *testing.T) {
+	start := time.Date(2020, 9, 23, 11, 0, 0, 0, time.UTC)
+	b := testBrew(start, 0., 10., 20., 30., 31., 40., 50., 60.)
+	b.Annotations = []Annotation{
+		{TimeStamp: start.Add(5 * time.Second), Event: TareEvent, Change: -1.},
+	}
+
+	if _, _, err := b.Split(start.Add(time.Second)); err == nil {
+		t.Fatalf("Expected error for split resulting in a single data point")
+	}
+	first, second, err := b.Split(start.Add(4 * time.Second))
+	if err != nil {
+		t.Fatalf("Failed to split brew: %s", err)
+	}
+	if first.ID != b.ID || second.ID == b.ID {
+		t.Fatalf("Unexpected IDs after split: %s / %s", first.ID, second.ID)
+	}
+	if len(first.DataPoints) != 4 || len(second.DataPoints) != 4 || len(second.Annotations) != 1 {
+		t.Fatalf("Unexpected split: %d / %d data points", len(first.DataPoints), len(second.DataPoints))
+	}
+	if first.Yield() != 30. || second.Yield() != 30. {
+		t.Fatalf("Unexpected yields after split: %.1f / %.1f", first.Yield(), second.Yield())
+	}
+
+	merged, err := Merge(second, first)
+	if err != nil {
+		t.Fatalf("Failed to merge brews: %s", err)
+	}
+	if merged.ID != b.ID || len(merged.DataPoints) != len(b.DataPoints) || !merged.Start.Equal(b.Start) || !merged.End.Equal(b.End) {
+		t.Fatalf("Unexpected merged brew: %#v", merged)
+	}
+	if _, err := Merge(first, first); err == nil {
+		t.Fatalf("Expected error merging a brew with itself")
+	}
+}
@@ -0,0 +1,232 @@
+// Package curve compresses the weight curves of brews for storage by dropping all data points
+// that can be reconstructed by linear interpolation between the retained ones (either exactly
+// or within an error bound) and reconstructs them for queries / exports
+package curve
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/fako1024/btscale/pkg/scale"
+)
+
+// Mode denotes the compression mode of the curves
+type Mode string
+
+const (
+
+	// None denotes that all data points are stored
+	None Mode = "none"
+
+	// Lossless denotes that only data points that are reconstructed exactly are dropped, i.e.
+	// data points lying on the line between the retained ones (e.g. plateaus of identical
+	// weights) whose time stamps are spaced evenly (at the millisecond precision of the
+	// database)
+	Lossless Mode = "lossless"
+
+	// Simplify denotes that the curve is simplified using the Ramer–Douglas–Peucker algorithm,
+	// retaining only the data points required to keep the deviation of the weight below the
+	// tolerance (the time stamps of dropped data points being spaced evenly on reconstruction)
+	Simplify Mode = "simplify"
+)
+
+// DefaultTolerance denotes the default maximum deviation of the weight of the simplified
+// curve (i.e. the resolution of the scale)
+const DefaultTolerance = 0.1
+
+// Modes denotes all supported compression modes
+var Modes = []Mode{None, Lossless, Simplify}
+
+// losslessTolerance denotes the deviation considered exact (absorbing rounding errors)
+const losslessTolerance = 1e-9
+
+// ModeFromString allows to generate a Mode from a string (an empty string denoting None)
+func ModeFromString(m string) (Mode, error) {
+	if m == "" {
+		return None, nil
+	}
+	for _, mode := range Modes {
+		if string(mode) == m {
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported curve compression %q (supported: %s, %s, %s)", m, None, Lossless, Simplify)
+}
+
+// String returns a string representation of the compression mode
+func (m Mode) String() string {
+	return string(m)
+}
+
+// Compression denotes the compression applied to curves prior to storage
+type Compression struct {
+	Mode      Mode
+	Tolerance float64 // Maximum deviation of the weight (Simplify only)
+}
+
+// Enabled returns if any data points are dropped
+func (c Compression) Enabled() bool {
+	return c.Mode == Lossless || c.Mode == Simplify
+}
+
+// Validate checks the compression for consistency
+func (c Compression) Validate() error {
+	if _, err := ModeFromString(string(c.Mode)); err != nil {
+		return err
+	}
+	if c.Mode == Simplify && c.Tolerance <= 0. {
+		return fmt.Errorf("invalid tolerance of curve simplification: %v (must be positive)", c.Tolerance)
+	}
+	return nil
+}
+
+// Select returns the indices of the data points to retain (in ascending order). The first
+// and last data point as well as the ones adjacent to a change of the unit are always retained
+func (c Compression) Select(dataPoints scale.DataPoints) []int {
+
+	if !c.Enabled() || len(dataPoints) < 3 {
+		indices := make([]int, len(dataPoints))
+		for i := range indices {
+			indices[i] = i
+		}
+		return indices
+	}
+
+	tolerance := losslessTolerance
+	if c.Mode == Simplify {
+		tolerance = math.Max(c.Tolerance, losslessTolerance)
+	}
+
+	retain := make([]bool, len(dataPoints))
+	first := 0
+	for i := 1; i <= len(dataPoints); i++ {
+		if i < len(dataPoints) && dataPoints[i].Unit == dataPoints[first].Unit {
+			continue
+		}
+		simplify(dataPoints, first, i-1, tolerance, c.Mode == Lossless, retain)
+		first = i
+	}
+
+	indices := make([]int, 0, len(dataPoints))
+	for i, keep := range retain {
+		if keep {
+			indices = append(indices, i)
+		}
+	}
+
+	return indices
+}
+
+// Compress returns the data points to retain
+func (c Compression) Compress(dataPoints scale.DataPoints) scale.DataPoints {
+
+	indices := c.Select(dataPoints)
+	compressed := make(scale.DataPoints, 0, len(indices))
+	for _, i := range indices {
+		compressed = append(compressed, dataPoints[i])
+	}
+
+	return compressed
+}
+
+// Dropped returns the number of data points dropped after each of the retained ones (as
+// returned by Select), as required to reconstruct the curve
+func Dropped(indices []int) []int {
+
+	dropped := make([]int, len(indices))
+	for i := 0; i < len(indices)-1; i++ {
+		dropped[i] = indices[i+1] - indices[i] - 1
+	}
+
+	return dropped
+}
+
+// Reconstruct restores the data points dropped after each of the retained ones (spaced evenly
+// up to the next retained data point at millisecond precision and interpolated linearly). A
+// missing number of dropped data points denotes that none have been dropped
+func Reconstruct(dataPoints scale.DataPoints, dropped []int) scale.DataPoints {
+
+	reconstructed := make(scale.DataPoints, 0, len(dataPoints))
+	for i, dataPoint := range dataPoints {
+		reconstructed = append(reconstructed, dataPoint)
+		if i >= len(dropped) || i == len(dataPoints)-1 {
+			continue
+		}
+		from, to := truncate(dataPoint), truncate(dataPoints[i+1])
+		for k := 1; k <= dropped[i]; k++ {
+			ts := spaced(from.TimeStamp, to.TimeStamp, k, dropped[i]+1)
+			reconstructed = append(reconstructed, scale.DataPoint{
+				TimeStamp: ts,
+				Unit:      dataPoint.Unit,
+				Weight:    interpolate(from, to, ts),
+			})
+		}
+	}
+
+	return reconstructed
+}
+
+// simplify marks the data points to retain between the first and last index (inclusive) such
+// that no dropped data point deviates from the interpolated weight by more than the tolerance.
+// If exact, data points are only dropped if their time stamps are reconstructed exactly as
+// well, i.e. if they are spaced evenly (at millisecond precision)
+func simplify(dataPoints scale.DataPoints, first, last int, tolerance float64, exact bool, retain []bool) {
+
+	at := func(i int) scale.DataPoint {
+		if exact {
+			return truncate(dataPoints[i])
+		}
+		return dataPoints[i]
+	}
+
+	retain[first], retain[last] = true, true
+	stack := [][2]int{{first, last}}
+	for len(stack) > 0 {
+		segment := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		from, to := at(segment[0]), at(segment[1])
+
+		maxDeviation, maxIdx, unevenIdx := 0., -1, -1
+		for i := segment[0] + 1; i < segment[1]; i++ {
+			dataPoint := at(i)
+			deviation := math.Abs(dataPoint.Weight - interpolate(from, to, dataPoint.TimeStamp))
+			if deviation > maxDeviation {
+				maxDeviation, maxIdx = deviation, i
+			}
+			if exact && unevenIdx < 0 && !dataPoint.TimeStamp.Equal(spaced(from.TimeStamp, to.TimeStamp, i-segment[0], segment[1]-segment[0])) {
+				unevenIdx = i
+			}
+		}
+		if maxIdx < 0 || maxDeviation <= tolerance {
+			if maxIdx = unevenIdx; maxIdx < 0 {
+				continue
+			}
+		}
+
+		retain[maxIdx] = true
+		stack = append(stack, [2]int{segment[0], maxIdx}, [2]int{maxIdx, segment[1]})
+	}
+}
+
+// spaced returns the time stamp of the k-th of n - 1 data points spaced evenly between two
+// time stamps (at millisecond precision)
+func spaced(from, to time.Time, k, n int) time.Time {
+	return from.Add(to.Sub(from) * time.Duration(k) / time.Duration(n)).Truncate(time.Millisecond)
+}
+
+// truncate returns a data point with its time stamp truncated to millisecond precision (the
+// precision of the database)
+func truncate(dataPoint scale.DataPoint) scale.DataPoint {
+	dataPoint.TimeStamp = dataPoint.TimeStamp.Truncate(time.Millisecond)
+	return dataPoint
+}
+
+// interpolate returns the weight at a given time on the line between two data points
+func interpolate(from, to scale.DataPoint, ts time.Time) float64 {
+	span := to.TimeStamp.Sub(from.TimeStamp)
+	if span <= 0 {
+		return from.Weight
+	}
+	return from.Weight + (to.Weight-from.Weight)*float64(ts.Sub(from.TimeStamp))/float64(span)
+}
@@ -0,0 +1,128 @@
+package curve
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/fako1024/btscale/pkg/scale"
+)
+
+// testCurve generates a typical curve: a plateau (pre-infusion), a (slightly noisy) ramp
+// and a plateau after the end of the brew
+func testCurve(start time.Time) scale.DataPoints {
+	var dataPoints scale.DataPoints
+	for i := 0; i < 300; i++ {
+		weight := 0.
+		switch {
+		case i >= 250:
+			weight = 36.
+		case i >= 50:
+			weight = float64(i-50)*0.18 + 0.05*math.Sin(float64(i))
+		}
+		dataPoints = append(dataPoints, scale.DataPoint{TimeStamp: start.Add(time.Duration(i) * 100 * time.Millisecond), Weight: weight, Unit: "g"})
+	}
+	return dataPoints
+}
+
+func TestCompression(t *testing.T) {
+
+	start := time.Date(2020, 9, 23, 11, 0, 0, 0, time.UTC)
+	dataPoints := testCurve(start)
+
+	for _, c := range []struct {
+		compression Compression
+		maxPoints   int
+		tolerance   float64
+	}{
+		{Compression{Mode: None}, 300, 0.},
+		{Compression{Mode: Lossless}, 210, 1e-9},
+		{Compression{Mode: Simplify, Tolerance: 0.1}, 10, 0.1},
+		{Compression{Mode: Simplify, Tolerance: 0.01}, 210, 0.01},
+	} {
+		t.Run(c.compression.Mode.String(), func(t *testing.T) {
+			if err := c.compression.Validate(); err != nil {
+				t.Fatalf("Unexpected invalid compression: %s", err)
+			}
+
+			indices := c.compression.Select(dataPoints)
+			compressed := c.compression.Compress(dataPoints)
+			if len(compressed) > c.maxPoints || !compressed[0].TimeStamp.Equal(start) || compressed[len(compressed)-1] != dataPoints[len(dataPoints)-1] {
+				t.Fatalf("Unexpected compressed curve (%d data points): %v", len(compressed), compressed)
+			}
+
+			reconstructed := Reconstruct(compressed, Dropped(indices))
+			if len(reconstructed) != len(dataPoints) {
+				t.Fatalf("Unexpected number of reconstructed data points: %d", len(reconstructed))
+			}
+			for i, dataPoint := range reconstructed {
+				if !dataPoint.TimeStamp.Equal(dataPoints[i].TimeStamp) || math.Abs(dataPoint.Weight-dataPoints[i].Weight) > c.tolerance {
+					t.Fatalf("Unexpected reconstructed data point %d: %v (want %v)", i, dataPoint, dataPoints[i])
+				}
+			}
+		})
+	}
+
+	// Data points adjacent to a change of the unit are retained
+	mixed := scale.DataPoints{
+		{TimeStamp: start, Weight: 1., Unit: "g"},
+		{TimeStamp: start.Add(time.Second), Weight: 1., Unit: "g"},
+		{TimeStamp: start.Add(2 * time.Second), Weight: 1., Unit: "oz"},
+		{TimeStamp: start.Add(3 * time.Second), Weight: 1., Unit: "oz"},
+		{TimeStamp: start.Add(4 * time.Second), Weight: 1., Unit: "oz"},
+	}
+	if indices := (Compression{Mode: Lossless}).Select(mixed); len(indices) != 4 || indices[1] != 1 || indices[2] != 2 {
+		t.Fatalf("Unexpected data points retained across change of unit: %v", indices)
+	}
+
+	if _, err := ModeFromString("zip"); err == nil {
+		t.Fatalf("Expected error for unsupported compression mode")
+	}
+	if err := (Compression{Mode: Simplify}).Validate(); err == nil {
+		t.Fatalf("Expected error for simplification without tolerance")
+	}
+}
+
+func TestLosslessJitter(t *testing.T) {
+
+	// Time stamps of the scale jitter around the sampling interval, except for the plateaus
+	start := time.Date(2020, 9, 23, 11, 0, 0, 0, time.UTC)
+	dataPoints := testCurve(start)
+	for i := range dataPoints {
+		if i >= 50 && i < 250 {
+			dataPoints[i].TimeStamp = dataPoints[i].TimeStamp.Add(time.Duration((i*7)%23-11)*time.Millisecond + 345*time.Microsecond)
+		}
+	}
+
+	indices := (Compression{Mode: Lossless}).Select(dataPoints)
+	compressed := (Compression{Mode: Lossless}).Compress(dataPoints)
+	if len(compressed) >= len(dataPoints) || len(compressed) < 200 {
+		t.Fatalf("Unexpected number of compressed data points: %d", len(compressed))
+	}
+
+	reconstructed := Reconstruct(compressed, Dropped(indices))
+	if len(reconstructed) != len(dataPoints) {
+		t.Fatalf("Unexpected number of reconstructed data points: %d", len(reconstructed))
+	}
+	for i, dataPoint := range reconstructed {
+		if dataPoint.TimeStamp.UnixMilli() != dataPoints[i].TimeStamp.UnixMilli() || math.Abs(dataPoint.Weight-dataPoints[i].Weight) > 1e-9 {
+			t.Fatalf("Unexpected reconstructed data point %d: %v (want %v)", i, dataPoint, dataPoints[i])
+		}
+	}
+
+	// A gap in the plateau is retained as well
+	gap := append(scale.DataPoints(nil), testCurve(start)[250:]...)
+	gap[20].TimeStamp = gap[20].TimeStamp.Add(3 * time.Second)
+	for i := 21; i < len(gap); i++ {
+		gap[i].TimeStamp = gap[20].TimeStamp.Add(time.Duration(i-20) * 100 * time.Millisecond)
+	}
+	reconstructed = Reconstruct((Compression{Mode: Lossless}).Compress(gap), Dropped((Compression{Mode: Lossless}).Select(gap)))
+	if len(reconstructed) != len(gap) {
+		t.Fatalf("Unexpected number of reconstructed data points across gap: %d", len(reconstructed))
+	}
+	for i, dataPoint := range reconstructed {
+		if !dataPoint.TimeStamp.Equal(gap[i].TimeStamp) {
+			t.Fatalf("Unexpected reconstructed data point %d across gap: %v (want %v)", i, dataPoint, gap[i])
+		}
+	}
+}
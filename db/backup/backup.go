@@ -0,0 +1,444 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fako1024/brew/db"
+)
+
+const (
+	idLayout = "20060102-150405.000000000"
+
+	fileSuffix   = ".json"
+	undoneSuffix = ".undone"
+)
+
+// Change denotes the replacement of data points of a single measurement
+type Change struct {
+	Measurement string
+	Before      db.DataPoints // Data points removed by the change
+	After       db.DataPoints // Data points stored by the change
+}
+
+// Modification denotes a set of changes applied to a database as a single transaction
+type Modification struct {
+	ID          string    `json:"id"`
+	TimeStamp   time.Time `json:"timestamp"`
+	Description string    `json:"description"`
+	DB          string    `json:"db"`
+	Changes     []Change  `json:"-"`
+}
+
+// DefaultMaxBackups denotes the default number of backups retained by a journal
+const DefaultMaxBackups = 100
+
+// Journal keeps a backup of all data points affected by modifications of the database,
+// allowing to undo them
+type Journal struct {
+	dir string
+
+	maxBackups int           // Maximum number of backups retained (0: unlimited)
+	maxAge     time.Duration // Maximum age of retained backups (0: unlimited)
+}
+
+// New instantiates a new journal, storing backups in the provided directory (which is
+// created on demand)
+func New(dir string, options ...func(*Journal)) *Journal {
+	j := &Journal{
+		dir:        dir,
+		maxBackups: DefaultMaxBackups,
+	}
+	for _, option := range options {
+		option(j)
+	}
+
+	return j
+}
+
+// WithMaxBackups sets the maximum number of backups retained (including undone ones), older
+// ones being removed whenever a modification is applied (0: unlimited)
+func WithMaxBackups(n int) func(*Journal) {
+	return func(j *Journal) {
+		j.maxBackups = n
+	}
+}
+
+// WithMaxAge sets the maximum age of retained backups (including undone ones), older ones
+// being removed whenever a modification is applied (0: unlimited)
+func WithMaxAge(age time.Duration) func(*Journal) {
+	return func(j *Journal) {
+		j.maxAge = age
+	}
+}
+
+// Apply performs a modification, replacing the data points before the change by the ones
+// after the change. Prior to altering the database, all affected data points are written
+// to a backup file. The result is verified and the original state is restored if any step
+// fails. Once applied, backups exceeding the retention limits are removed. A nil journal
+// applies the modification without backup file
+func (j *Journal) Apply(d db.DB, m Modification) error {
+
+	if m.TimeStamp.IsZero() {
+		m.TimeStamp = time.Now()
+	}
+	if m.ID == "" {
+		m.ID = m.TimeStamp.UTC().Format(idLayout)
+	}
+
+	var path string
+	if j != nil {
+		var err error
+		if path, err = j.write(m); err != nil {
+			return fmt.Errorf("failed to back up data points, database unchanged: %w", err)
+		}
+	}
+
+	err := replace(d, m.DB, m.Changes, false)
+	if err == nil {
+		if j == nil {
+			return nil
+		}
+		if err := j.prune(m.TimeStamp); err != nil {
+			return fmt.Errorf("modification applied, failed to remove expired backups: %w", err)
+		}
+		return nil
+	}
+
+	// Restore the original state
+	if restoreErr := replace(d, m.DB, m.Changes, true); restoreErr != nil {
+		if path != "" {
+			return fmt.Errorf("%w (failed to restore original data points: %s, backup retained in %s)", err, restoreErr, path)
+		}
+		return fmt.Errorf("%w (failed to restore original data points: %s)", err, restoreErr)
+	}
+	if path != "" {
+		if removeErr := os.Remove(path); removeErr != nil {
+			return fmt.Errorf("%w (original data points restored, failed to remove backup: %s)", err, removeErr)
+		}
+	}
+
+	return fmt.Errorf("%w (original data points restored)", err)
+}
+
+// List returns all modifications that can be undone (most recent first). Only the metadata
+// of each modification is read, i.e. no changes are returned
+func (j *Journal) List() ([]Modification, error) {
+
+	names, err := j.files(fileSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	modifications := make([]Modification, 0, len(names))
+	for _, name := range names {
+		m, err := j.readHeader(filepath.Join(j.dir, name))
+		if err != nil {
+			return nil, err
+		}
+		modifications = append(modifications, m)
+	}
+
+	return modifications, nil
+}
+
+// Undo reverts the last n modifications (most recent first), returning the modifications
+// that have been reverted
+func (j *Journal) Undo(d db.DB, n int) ([]Modification, error) {
+
+	modifications, err := j.List()
+	if err != nil {
+		return nil, err
+	}
+	if n > len(modifications) {
+		return nil, fmt.Errorf("cannot undo %d modification(s), only %d available", n, len(modifications))
+	}
+
+	for i := range modifications[:n] {
+		m, err := j.read(j.path(modifications[i].ID))
+		if err != nil {
+			return modifications[:i], err
+		}
+		modifications[i] = m
+		if err := replace(d, m.DB, m.Changes, true); err != nil {
+			return modifications[:i], fmt.Errorf("failed to undo modification %s: %w", m.ID, err)
+		}
+		path := j.path(m.ID)
+		if err := os.Rename(path, path+undoneSuffix); err != nil {
+			return modifications[:i+1], fmt.Errorf("failed to mark modification %s as undone: %w", m.ID, err)
+		}
+	}
+
+	return modifications[:n], nil
+}
+
+// replace removes the data points before each change and stores the ones after it (or vice
+// versa, if reverting the changes), verifying the result
+func replace(d db.DB, dbName string, changes []Change, revert bool) error {
+
+	for _, change := range changes {
+		remove, add := change.Before, change.After
+		if revert {
+			remove, add = add, remove
+		}
+
+		for _, filter := range filters(remove) {
+			if err := d.DeleteDataPoints(dbName, change.Measurement, filter); err != nil {
+				return fmt.Errorf("failed to remove data points from measurement %s: %w", change.Measurement, err)
+			}
+			remaining, err := d.FetchDataPoints(dbName, change.Measurement, filter)
+			if err != nil {
+				return fmt.Errorf("failed to verify removal of data points from measurement %s: %w", change.Measurement, err)
+			}
+			if len(remaining) > 0 {
+				return fmt.Errorf("failed to remove data points from measurement %s: %d data point(s) remaining", change.Measurement, len(remaining))
+			}
+		}
+
+		if len(add) == 0 {
+			continue
+		}
+		if err := d.EmitDataPoints(dbName, change.Measurement, add); err != nil {
+			return fmt.Errorf("failed to store data points in measurement %s: %w", change.Measurement, err)
+		}
+		if err := verify(d, dbName, change.Measurement, add); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// verify ensures that all provided data points are present in the database
+func verify(d db.DB, dbName, measurement string, expected db.DataPoints) error {
+
+	stored := make(map[string]db.DataPoint)
+	for _, filter := range filters(expected) {
+		dataPoints, err := d.FetchDataPoints(dbName, measurement, filter)
+		if err != nil {
+			return fmt.Errorf("failed to verify data points in measurement %s: %w", measurement, err)
+		}
+		for _, dataPoint := range dataPoints {
+			stored[key(dataPoint)] = dataPoint
+		}
+	}
+
+	for _, dataPoint := range expected {
+		actual, exists := stored[key(dataPoint)]
+		if !exists {
+			return fmt.Errorf("verification failed: data point at %v missing in measurement %s", dataPoint.TimeStamp, measurement)
+		}
+		for k, v := range dataPoint.Data {
+			if fmt.Sprint(actual.Data[k]) != fmt.Sprint(v) {
+				return fmt.Errorf("verification failed: unexpected value of field %s at %v in measurement %s, want %v, have %v", k, dataPoint.TimeStamp, measurement, v, actual.Data[k])
+			}
+		}
+	}
+
+	return nil
+}
+
+// filters generates filters selecting the provided data points (grouped by their tags and
+// limited to the time range they cover)
+func filters(dataPoints db.DataPoints) []db.Filter {
+
+	groups := make(map[string]*db.Filter)
+	var keys []string
+	for _, dataPoint := range dataPoints {
+		ts := dataPoint.TimeStamp.Truncate(time.Millisecond)
+		k := tagKey(dataPoint.Tags)
+		filter, exists := groups[k]
+		if !exists {
+			filter = &db.Filter{Tags: dataPoint.Tags, Start: ts, End: ts.Add(time.Millisecond)}
+			groups[k] = filter
+			keys = append(keys, k)
+			continue
+		}
+		if ts.Before(filter.Start) {
+			filter.Start = ts
+		}
+		if !ts.Before(filter.End) {
+			filter.End = ts.Add(time.Millisecond)
+		}
+	}
+
+	result := make([]db.Filter, 0, len(keys))
+	for _, k := range keys {
+		result = append(result, *groups[k])
+	}
+
+	return result
+}
+
+// key identifies a data point by its tags and (millisecond precision) time stamp
+func key(dataPoint db.DataPoint) string {
+	return fmt.Sprintf("%d|%s", dataPoint.TimeStamp.UnixMilli(), tagKey(dataPoint.Tags))
+}
+
+func tagKey(tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (j *Journal) path(id string) string {
+	return filepath.Join(j.dir, id+fileSuffix)
+}
+
+// files returns the names of all backup files with the given suffix (most recent first)
+func (j *Journal) files(suffix string) ([]string, error) {
+
+	entries, err := os.ReadDir(j.dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), suffix) {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+
+	return names, nil
+}
+
+// prune removes all backups (including undone ones) exceeding the maximum number of backups
+// or the maximum age
+func (j *Journal) prune(now time.Time) error {
+
+	if j.maxBackups <= 0 && j.maxAge <= 0 {
+		return nil
+	}
+
+	names, err := j.files(fileSuffix)
+	if err != nil {
+		return err
+	}
+	undone, err := j.files(fileSuffix + undoneSuffix)
+	if err != nil {
+		return err
+	}
+	names = append(names, undone...)
+	sort.Slice(names, func(i, k int) bool {
+		return strings.TrimSuffix(names[i], undoneSuffix) > strings.TrimSuffix(names[k], undoneSuffix)
+	})
+
+	var errs []error
+	for i, name := range names {
+		path := filepath.Join(j.dir, name)
+		if j.maxBackups <= 0 || i < j.maxBackups {
+			if j.maxAge <= 0 {
+				continue
+			}
+			m, err := j.readHeader(path)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if now.Sub(m.TimeStamp) <= j.maxAge {
+				continue
+			}
+		}
+		if err := os.Remove(path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// write stores a backup of the modification (atomically, via a temporary file). The file
+// starts with a single line holding the metadata of the modification, followed by the
+// changes (allowing to list modifications without reading the data points)
+func (j *Journal) write(m Modification) (string, error) {
+
+	header, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	body, err := json.MarshalIndent(encodeChanges(m.Changes), "", "  ")
+	if err != nil {
+		return "", err
+	}
+	data := append(append(header, '\n'), body...)
+	if err := os.MkdirAll(j.dir, 0700); err != nil {
+		return "", err
+	}
+
+	path := j.path(m.ID)
+	f, err := os.CreateTemp(j.dir, ".backup-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	return path, os.Rename(f.Name(), path)
+}
+
+// readHeader loads the metadata of a modification from its backup
+func (j *Journal) readHeader(path string) (Modification, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return Modification{}, err
+	}
+	defer f.Close()
+
+	var m Modification
+	if err := json.NewDecoder(f).Decode(&m); err != nil {
+		return Modification{}, fmt.Errorf("failed to parse backup %s: %w", path, err)
+	}
+
+	return m, nil
+}
+
+// read loads a backup of a modification (including its changes)
+func (j *Journal) read(path string) (Modification, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return Modification{}, err
+	}
+	defer f.Close()
+
+	var (
+		m       Modification
+		encoded changes
+	)
+	dec := json.NewDecoder(f)
+	if err := dec.Decode(&m); err != nil {
+		return Modification{}, fmt.Errorf("failed to parse backup %s: %w", path, err)
+	}
+	if err := dec.Decode(&encoded); err != nil {
+		return Modification{}, fmt.Errorf("failed to parse changes in backup %s: %w", path, err)
+	}
+	m.Changes = encoded.decode()
+
+	return m, nil
+}
@@ -0,0 +1,164 @@
+package backup
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fako1024/brew/db"
+	"github.com/fako1024/brew/db/memory"
+)
+
+// failingDB denotes a database failing to store data points of the given shot type
+type failingDB struct {
+	*memory.DB
+	shotTypes map[string]bool
+}
+
+func (f *failingDB) EmitDataPoints(dbName, measurement string, data db.DataPoints) error {
+	for _, dataPoint := range data {
+		if f.shotTypes[dataPoint.Tags["shot_type"]] {
+			return errors.New("emission failed")
+		}
+	}
+	return f.DB.EmitDataPoints(dbName, measurement, data)
+}
+
+func testDataPoints(ts time.Time, shotType string) db.DataPoints {
+	return db.DataPoints{
+		{TimeStamp: ts, Tags: map[string]string{"id": "a", "shot_type": shotType}, Data: map[string]interface{}{"weight": 1.5, "start": int64(1)}},
+		{TimeStamp: ts.Add(time.Second), Tags: map[string]string{"id": "a", "shot_type": shotType}, Data: map[string]interface{}{"weight": 2.5, "unit": "g"}},
+	}
+}
+
+func TestApplyUndo(t *testing.T) {
+
+	ts := time.Date(2020, 9, 23, 11, 0, 0, 0, time.UTC)
+	d := memory.New()
+	if err := d.EmitDataPoints("brews", "brew", testDataPoints(ts, "single")); err != nil {
+		t.Fatalf("Failed to emit data points: %s", err)
+	}
+
+	j := New(t.TempDir())
+	for i, shotType := range []string{"double", "single"} {
+		before, _ := d.FetchDataPoints("brews", "brew", db.Filter{})
+		if err := j.Apply(d, Modification{
+			ID:          string(rune('a' + i)),
+			Description: "change shot type",
+			DB:          "brews",
+			Changes:     []Change{{Measurement: "brew", Before: before, After: testDataPoints(ts, shotType)}},
+		}); err != nil {
+			t.Fatalf("Failed to apply modification: %s", err)
+		}
+	}
+
+	modifications, err := j.List()
+	if err != nil || len(modifications) != 2 || modifications[0].ID != "b" || modifications[0].Description != "change shot type" || len(modifications[0].Changes) != 0 {
+		t.Fatalf("Unexpected modifications: %#v (error: %v)", modifications, err)
+	}
+	m, err := j.read(j.path("b"))
+	if err != nil || len(m.Changes) != 1 {
+		t.Fatalf("Unexpected backup: %#v (error: %v)", m, err)
+	}
+	if v := m.Changes[0].Before[0].Data["start"]; v != int64(1) {
+		t.Fatalf("Unexpected type of restored field: %T", v)
+	}
+
+	if _, err := j.Undo(d, 3); err == nil {
+		t.Fatalf("Expected error when undoing more modifications than available")
+	}
+	undone, err := j.Undo(d, 1)
+	if err != nil || len(undone) != 1 {
+		t.Fatalf("Failed to undo modification: %v", err)
+	}
+	dataPoints, _ := d.FetchDataPoints("brews", "brew", db.Filter{})
+	if len(dataPoints) != 2 || dataPoints[0].Tags["shot_type"] != "double" {
+		t.Fatalf("Unexpected data points after undo: %#v", dataPoints)
+	}
+	if modifications, _ = j.List(); len(modifications) != 1 {
+		t.Fatalf("Unexpected number of remaining modifications: %d", len(modifications))
+	}
+}
+
+func TestApplyRestore(t *testing.T) {
+
+	ts := time.Date(2020, 9, 23, 11, 0, 0, 0, time.UTC)
+	d := &failingDB{DB: memory.New()}
+	if err := d.EmitDataPoints("brews", "brew", testDataPoints(ts, "single")); err != nil {
+		t.Fatalf("Failed to emit data points: %s", err)
+	}
+	before, _ := d.FetchDataPoints("brews", "brew", db.Filter{})
+	m := Modification{
+		DB:      "brews",
+		Changes: []Change{{Measurement: "brew", Before: before, After: testDataPoints(ts, "double")}},
+	}
+	j := New(t.TempDir())
+
+	// If only the replacement fails, the original data points are restored immediately
+	d.shotTypes = map[string]bool{"double": true}
+	m.ID = "a"
+	if err := j.Apply(d, m); err == nil {
+		t.Fatalf("Expected error for failing modification")
+	}
+	if dataPoints, _ := d.FetchDataPoints("brews", "brew", db.Filter{}); len(dataPoints) != 2 || dataPoints[0].Tags["shot_type"] != "single" {
+		t.Fatalf("Unexpected data points after restore: %#v", dataPoints)
+	}
+	if modifications, _ := j.List(); len(modifications) != 0 {
+		t.Fatalf("Unexpected backups after successful restore: %d", len(modifications))
+	}
+
+	// If the original data points cannot be restored either, the backup is retained
+	d.shotTypes = map[string]bool{"double": true, "single": true}
+	m.ID = "b"
+	if err := j.Apply(d, m); err == nil {
+		t.Fatalf("Expected error for failing modification")
+	}
+	if modifications, err := j.List(); err != nil || len(modifications) != 1 {
+		t.Fatalf("Expected backup to be retained, have %d (error: %v)", len(modifications), err)
+	}
+
+	// Once the database is available again, the modification can be undone
+	d.shotTypes = nil
+	if _, err := j.Undo(d, 1); err != nil {
+		t.Fatalf("Failed to undo modification: %s", err)
+	}
+	if dataPoints, _ := d.FetchDataPoints("brews", "brew", db.Filter{}); len(dataPoints) != 2 || dataPoints[0].Tags["shot_type"] != "single" {
+		t.Fatalf("Unexpected data points after undo: %#v", dataPoints)
+	}
+}
+
+func TestRetention(t *testing.T) {
+
+	ts := time.Date(2020, 9, 23, 11, 0, 0, 0, time.UTC)
+	d := memory.New()
+	j := New(t.TempDir(), WithMaxBackups(3), WithMaxAge(48*time.Hour))
+	for i := 0; i < 5; i++ {
+		before, _ := d.FetchDataPoints("brews", "brew", db.Filter{})
+		if err := j.Apply(d, Modification{
+			TimeStamp: ts.Add(time.Duration(i) * time.Hour),
+			DB:        "brews",
+			Changes:   []Change{{Measurement: "brew", Before: before, After: testDataPoints(ts, []string{"single", "double"}[i%2])}},
+		}); err != nil {
+			t.Fatalf("Failed to apply modification: %s", err)
+		}
+		if i == 3 {
+			if _, err := j.Undo(d, 1); err != nil {
+				t.Fatalf("Failed to undo modification: %s", err)
+			}
+		}
+	}
+
+	// Undone backups count towards the maximum number of backups
+	modifications, err := j.List()
+	if err != nil || len(modifications) != 2 || !modifications[0].TimeStamp.Equal(ts.Add(4*time.Hour)) || !modifications[1].TimeStamp.Equal(ts.Add(2*time.Hour)) {
+		t.Fatalf("Unexpected retained modifications: %#v (error: %v)", modifications, err)
+	}
+
+	// Backups exceeding the maximum age are removed
+	if err := j.Apply(d, Modification{TimeStamp: ts.Add(50 * time.Hour), DB: "brews"}); err != nil {
+		t.Fatalf("Failed to apply modification: %s", err)
+	}
+	if modifications, err = j.List(); err != nil || len(modifications) != 2 || !modifications[1].TimeStamp.Equal(ts.Add(4*time.Hour)) {
+		t.Fatalf("Unexpected retained modifications: %#v (error: %v)", modifications, err)
+	}
+}
@@ -0,0 +1,35 @@
+package backup
+
+import "github.com/fako1024/brew/db"
+
+type change struct {
+	Measurement string        `json:"measurement"`
+	Before      db.DataPoints `json:"before"`
+	After       db.DataPoints `json:"after"`
+}
+
+// changes denotes the serialized form of the changes of a modification (following its
+// metadata in a backup file)
+type changes struct {
+	Changes []change `json:"changes"`
+}
+
+func encodeChanges(c []Change) changes {
+	encoded := changes{
+		Changes: make([]change, 0, len(c)),
+	}
+	for _, ch := range c {
+		encoded.Changes = append(encoded.Changes, change(ch))
+	}
+
+	return encoded
+}
+
+func (c changes) decode() []Change {
+	decoded := make([]Change, 0, len(c.Changes))
+	for _, ch := range c.Changes {
+		decoded = append(decoded, Change(ch))
+	}
+
+	return decoded
+}
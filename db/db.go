@@ -14,12 +14,26 @@ type DataPoint struct {
 // DataPoints denotes a list of data points
 type DataPoints []DataPoint
 
+// Filter denotes criteria to select data points of a measurement
+type Filter struct {
+	Tags  map[string]string // Tags the data points must have (all of them)
+	Start time.Time         // Earliest time stamp of the data points (inclusive, unbounded if zero)
+	End   time.Time         // Latest time stamp of the data points (exclusive, unbounded if zero)
+}
+
 // DB is an generic DB interface, providing functionality to interact with a database
 type DB interface {
 
 	// EmitDataPoints creates data points and stores it in the underlying database
 	EmitDataPoints(db, measurement string, data DataPoints) error
 
-	// ModifyMeasurement allows to alter certain elements of a measurement
+	// FetchDataPoints retrieves all data points of a measurement matching the filter
+	FetchDataPoints(db, measurement string, filter Filter) (DataPoints, error)
+
+	// DeleteDataPoints removes all data points of a measurement matching the filter
+	DeleteDataPoints(db, measurement string, filter Filter) error
+
+	// ModifyMeasurement allows to alter certain elements of a measurement (if replaceTagName is
+	// empty, only the additional fields are altered / added)
 	ModifyMeasurement(db, measurement, selectTagName, selectTagValue, replaceTagName, replaceTagValue string, additionalData map[string]interface{}) error
 }
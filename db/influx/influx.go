@@ -7,23 +7,38 @@ import (
 	"time"
 
 	"github.com/fako1024/brew/db"
+	"github.com/fako1024/brew/db/backup"
 	client "github.com/influxdata/influxdb1-client/v2"
 )
 
 // DB is an InfluxDB interface, providing functionality to interact with the database
 type DB struct {
-	config *client.HTTPConfig
+	config  *client.HTTPConfig
+	journal *backup.Journal
 }
 
 // New creates a new InfluxDB instance
-func New(addr, username, password string) *DB {
-	return &DB{
+func New(addr, username, password string, options ...func(*DB)) *DB {
+	d := &DB{
 		config: &client.HTTPConfig{
 			Addr:     addr,
 			Username: username,
 			Password: password,
 		},
 	}
+
+	for _, opt := range options {
+		opt(d)
+	}
+
+	return d
+}
+
+// WithJournal sets a journal to back up all data points affected by modifications to
+func WithJournal(journal *backup.Journal) func(*DB) {
+	return func(d *DB) {
+		d.journal = journal
+	}
 }
 
 // EmitDataPoints creates data points and stores it in the underlying Influx database
@@ -88,7 +103,9 @@ func (d *DB) FetchMeasurementsTable(dbName, measurement string, field ...string)
 			for _, row := range ser.Values {
 				var rowFields []string
 				for _, column := range row {
-					if colStr, ok := column.(string); ok {
+					if column == nil {
+						rowFields = append(rowFields, "")
+					} else if colStr, ok := column.(string); ok {
 						rowFields = append(rowFields, colStr)
 					} else if colStringer, ok := column.(fmt.Stringer); ok {
 						rowFields = append(rowFields, colStringer.String())
@@ -104,138 +121,122 @@ func (d *DB) FetchMeasurementsTable(dbName, measurement string, field ...string)
 	return entries, nil
 }
 
-// ModifyMeasurement allows to alter certain elements of a measurement
+// ModifyMeasurement allows to alter certain elements of a measurement (if replaceTagName is
+// empty, only the additional fields are altered / added). All affected data points (across
+// any number of series) are backed up prior to the modification (if a journal is set) and
+// restored if the modification fails
 func (d *DB) ModifyMeasurement(dbName, measurement, selectTagName, selectTagValue, replaceTagName, replaceTagValue string, additionalData map[string]interface{}) error {
 
+	before, err := d.FetchDataPoints(dbName, measurement, db.Filter{
+		Tags: map[string]string{selectTagName: selectTagValue},
+	})
+	if err != nil {
+		return err
+	}
+	if len(before) == 0 {
+		return fmt.Errorf("No data points with %s = %s found in measurement %s", selectTagName, selectTagValue, measurement)
+	}
+
+	// Replace the tag (if requested) and set / add the additional fields
+	after := make(db.DataPoints, 0, len(before))
+	for _, dataPoint := range before {
+		modified := db.DataPoint{
+			TimeStamp: dataPoint.TimeStamp,
+			Tags:      make(map[string]string, len(dataPoint.Tags)),
+			Data:      make(map[string]interface{}, len(dataPoint.Data)+len(additionalData)),
+		}
+		for k, v := range dataPoint.Tags {
+			modified.Tags[k] = v
+		}
+		for k, v := range dataPoint.Data {
+			modified.Data[k] = v
+		}
+		if replaceTagName != "" {
+			modified.Tags[replaceTagName] = replaceTagValue
+		}
+		for k, v := range additionalData {
+			modified.Data[k] = v
+		}
+		after = append(after, modified)
+	}
+
+	return d.journal.Apply(d, backup.Modification{
+		Description: fmt.Sprintf("modify %s where %s = %s", measurement, selectTagName, selectTagValue),
+		DB:          dbName,
+		Changes: []backup.Change{
+			{Measurement: measurement, Before: before, After: after},
+		},
+	})
+}
+
+// LastTimestamp retrieves the timestamp of the most recent data point of a measurement with
+// the given tag (returning a zero timestamp if no such data point exists)
+func (d *DB) LastTimestamp(dbName, measurement, tagName, tagValue string) (time.Time, error) {
+
 	// Create a new InfluxDB client
 	c, err := client.NewHTTPClient(*d.config)
 	if err != nil {
-		return fmt.Errorf("Error creating InfluxDB Client for measurement %s on DB %s: %s", measurement, dbName, err)
+		return time.Time{}, fmt.Errorf("Error creating InfluxDB Client for measurement %s on DB %s: %s", measurement, dbName, err)
 	}
 	defer c.Close()
 
-	// Get the column types
-	q := client.NewQueryWithParameters("SHOW FIELD KEYS ON $d FROM $m", dbName, "ms", client.Params{
-		"d": client.Identifier(dbName),
-		"m": client.Identifier(measurement),
+	q := client.NewQueryWithParameters("SELECT * FROM $m WHERE $tag_name = $tag_value ORDER BY time DESC LIMIT 1", dbName, "ms", client.Params{
+		"m":         client.Identifier(measurement),
+		"tag_name":  client.Identifier(tagName),
+		"tag_value": client.StringValue(tagValue),
 	})
 	response, err := c.Query(q)
 	if err != nil || response.Error() != nil {
-		return fmt.Errorf("Failed to query measurement: %s", err)
+		return time.Time{}, fmt.Errorf("Failed to query measurement: %s, %s", err, response.Error())
 	}
-	columnTypes := make(map[string]string)
+
 	for _, result := range response.Results {
 		for _, ser := range result.Series {
 			for _, row := range ser.Values {
-				columnTypes[row[0].(string)] = row[1].(string)
+				tsParse, err := row[0].(json.Number).Int64()
+				if err != nil {
+					return time.Time{}, fmt.Errorf("Failed to convert timestamp: %s", err)
+				}
+				return time.Unix(0, tsParse*int64(time.Millisecond)), nil
 			}
 		}
 	}
 
-	// Get the requested measurement values
-	q = client.NewQueryWithParameters("SELECT * FROM $m WHERE $tag_name = $tag_value", dbName, "ms", client.Params{
-		"m":         client.Identifier(measurement),
-		"tag_name":  client.Identifier(selectTagName),
-		"tag_value": client.StringValue(selectTagValue),
-	})
-	response, err = c.Query(q)
-	if err != nil || response.Error() != nil {
-		return fmt.Errorf("Failed to query measurement: %s", err)
-	}
-	if len(response.Results) != 1 || len(response.Results[0].Series) != 1 {
-		return fmt.Errorf("Unexpected number of results / series returned, want exactly one")
+	return time.Time{}, nil
+}
+
+// Count retrieves the number of data points of a measurement (having the given field set)
+// since the provided time
+func (d *DB) Count(dbName, measurement, field string, since time.Time) (int, error) {
+
+	// Create a new InfluxDB client
+	c, err := client.NewHTTPClient(*d.config)
+	if err != nil {
+		return 0, fmt.Errorf("Error creating InfluxDB Client for measurement %s on DB %s: %s", measurement, dbName, err)
 	}
+	defer c.Close()
 
-	// Generate tags for updated data points
-	tags := map[string]string{
-		selectTagName:  selectTagValue,
-		replaceTagName: replaceTagValue,
+	q := client.NewQueryWithParameters("SELECT count($f) FROM $m WHERE time >= $since", dbName, "ms", client.Params{
+		"f":     client.Identifier(field),
+		"m":     client.Identifier(measurement),
+		"since": client.StringValue(since.UTC().Format(time.RFC3339Nano)),
+	})
+	response, err := c.Query(q)
+	if err != nil || response.Error() != nil {
+		return 0, fmt.Errorf("Failed to query measurement: %s, %s", err, response.Error())
 	}
 
-	// Process existing data points
-	var dataPoints db.DataPoints
 	for _, result := range response.Results {
 		for _, ser := range result.Series {
-
 			for _, row := range ser.Values {
-
-				var (
-					data = make(map[string]interface{})
-					ts   time.Time
-				)
-
-				// Process individual columns
-				for i, col := range ser.Columns {
-
-					// If the column is a tag, ignore it
-					if _, tagExists := tags[col]; tagExists {
-						continue
-					}
-
-					// If the column is the timestamp, parse and convert it
-					if col == "time" {
-						tsParse, err := row[i].(json.Number).Int64()
-						if err != nil {
-							return fmt.Errorf("Failed to convert timestamp: %s", err)
-						}
-						ts = time.Unix(0, tsParse*int64(time.Millisecond))
-						data[col] = ts
-					} else {
-
-						// Check if an additional field override was provided
-						if override, exists := additionalData[col]; exists {
-							data[col] = override
-							continue
-						}
-
-						// Check the column type and perform parsing
-						switch columnTypes[col] {
-						case "integer":
-							if intValue, err := row[i].(json.Number).Int64(); err == nil {
-								data[col] = intValue
-							} else {
-								return fmt.Errorf("Failed to parse integer value for column %s", col)
-							}
-						case "float":
-							if floatValue, err := row[i].(json.Number).Float64(); err == nil {
-								data[col] = floatValue
-							} else {
-								return fmt.Errorf("Failed to parse floating point value for column %s", col)
-							}
-						case "string":
-							data[col] = row[i].(string)
-						default:
-							return fmt.Errorf("Failed to find valid type assertion for column %s", col)
-						}
-					}
+				count, err := row[1].(json.Number).Int64()
+				if err != nil {
+					return 0, fmt.Errorf("Failed to parse count: %s", err)
 				}
-
-				// Append the new data point
-				dataPoints = append(dataPoints, db.DataPoint{
-					TimeStamp: ts,
-					Data:      data,
-					Tags:      tags,
-				})
-			}
-
-			// Cross check generated data points
-			if len(dataPoints) != len(ser.Values) {
-				return fmt.Errorf("Unexpected length of data points, want %d, have %d", len(ser.Values), len(dataPoints))
+				return int(count), nil
 			}
 		}
 	}
 
-	//Drop existing measurement with the provided tag from the DB
-	q = client.NewQueryWithParameters("DROP SERIES FROM $m WHERE $tag_name = $tag_value", dbName, "ms", client.Params{
-		"m":         client.Identifier(measurement),
-		"tag_name":  client.Identifier(selectTagName),
-		"tag_value": client.StringValue(selectTagValue),
-	})
-	response, err = c.Query(q)
-	if err != nil || response.Error() != nil {
-		return err
-	}
-
-	// Insert new data points for the same measuremet / tag combination
-	return d.EmitDataPoints(dbName, measurement, dataPoints)
+	return 0, nil
 }
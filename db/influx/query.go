@@ -0,0 +1,181 @@
+package influx
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fako1024/brew/db"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+// FetchDataPoints retrieves all data points of a measurement matching the filter
+func (d *DB) FetchDataPoints(dbName, measurement string, filter db.Filter) (db.DataPoints, error) {
+
+	// Create a new InfluxDB client
+	c, err := client.NewHTTPClient(*d.config)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating InfluxDB Client for measurement %s on DB %s: %s", measurement, dbName, err)
+	}
+	defer c.Close()
+
+	fieldTypes, tagKeys, err := schema(c, dbName, measurement)
+	if err != nil {
+		return nil, err
+	}
+
+	where, params := whereClause(filter)
+	params["m"] = client.Identifier(measurement)
+	response, err := c.Query(client.NewQueryWithParameters("SELECT * FROM $m"+where+" ORDER BY time ASC", dbName, "ms", params))
+	if err != nil || response.Error() != nil {
+		return nil, fmt.Errorf("Failed to query measurement: %s, %s", err, response.Error())
+	}
+
+	var dataPoints db.DataPoints
+	for _, result := range response.Results {
+		for _, ser := range result.Series {
+			for _, row := range ser.Values {
+				dataPoint := db.DataPoint{
+					Data: make(map[string]interface{}),
+					Tags: make(map[string]string),
+				}
+				for i, col := range ser.Columns {
+					if row[i] == nil {
+						continue
+					}
+					if col == "time" {
+						tsParse, err := row[i].(json.Number).Int64()
+						if err != nil {
+							return nil, fmt.Errorf("Failed to convert timestamp: %s", err)
+						}
+						dataPoint.TimeStamp = time.Unix(0, tsParse*int64(time.Millisecond))
+						continue
+					}
+					if _, isTag := tagKeys[col]; isTag {
+						dataPoint.Tags[col] = fmt.Sprint(row[i])
+						continue
+					}
+					value, err := parseValue(fieldTypes[col], row[i])
+					if err != nil {
+						return nil, fmt.Errorf("Failed to parse value for column %s: %s", col, err)
+					}
+					dataPoint.Data[col] = value
+				}
+				dataPoints = append(dataPoints, dataPoint)
+			}
+		}
+	}
+
+	return dataPoints, nil
+}
+
+// DeleteDataPoints removes all data points of a measurement matching the filter
+func (d *DB) DeleteDataPoints(dbName, measurement string, filter db.Filter) error {
+
+	// Create a new InfluxDB client
+	c, err := client.NewHTTPClient(*d.config)
+	if err != nil {
+		return fmt.Errorf("Error creating InfluxDB Client for measurement %s on DB %s: %s", measurement, dbName, err)
+	}
+	defer c.Close()
+
+	where, params := whereClause(filter)
+	params["m"] = client.Identifier(measurement)
+	response, err := c.Query(client.NewQueryWithParameters("DELETE FROM $m"+where, dbName, "ms", params))
+	if err != nil || response.Error() != nil {
+		return fmt.Errorf("Failed to delete from measurement: %s, %s", err, response.Error())
+	}
+
+	return nil
+}
+
+// schema retrieves the field types and tag keys of a measurement
+func schema(c client.Client, dbName, measurement string) (map[string]string, map[string]struct{}, error) {
+
+	fieldTypes := make(map[string]string)
+	tagKeys := make(map[string]struct{})
+	for _, query := range []string{"SHOW FIELD KEYS ON $d FROM $m", "SHOW TAG KEYS ON $d FROM $m"} {
+		response, err := c.Query(client.NewQueryWithParameters(query, dbName, "ms", client.Params{
+			"d": client.Identifier(dbName),
+			"m": client.Identifier(measurement),
+		}))
+		if err != nil || response.Error() != nil {
+			return nil, nil, fmt.Errorf("Failed to query measurement schema: %s, %s", err, response.Error())
+		}
+		for _, result := range response.Results {
+			for _, ser := range result.Series {
+				for _, row := range ser.Values {
+					if len(row) > 1 {
+						fieldTypes[row[0].(string)] = row[1].(string)
+					} else {
+						tagKeys[row[0].(string)] = struct{}{}
+					}
+				}
+			}
+		}
+	}
+
+	return fieldTypes, tagKeys, nil
+}
+
+// whereClause generates a (parameterized) WHERE clause for a filter
+func whereClause(filter db.Filter) (string, client.Params) {
+
+	var (
+		conditions []string
+		params     = make(client.Params)
+	)
+
+	// Ensure a stable order of conditions
+	tagNames := make([]string, 0, len(filter.Tags))
+	for name := range filter.Tags {
+		tagNames = append(tagNames, name)
+	}
+	sort.Strings(tagNames)
+	for i, name := range tagNames {
+		conditions = append(conditions, fmt.Sprintf("$tag_name%d = $tag_value%d", i, i))
+		params[fmt.Sprintf("tag_name%d", i)] = client.Identifier(name)
+		params[fmt.Sprintf("tag_value%d", i)] = client.StringValue(filter.Tags[name])
+	}
+
+	if !filter.Start.IsZero() {
+		conditions = append(conditions, "time >= $start")
+		params["start"] = client.StringValue(filter.Start.UTC().Format(time.RFC3339Nano))
+	}
+	if !filter.End.IsZero() {
+		conditions = append(conditions, "time < $end")
+		params["end"] = client.StringValue(filter.End.UTC().Format(time.RFC3339Nano))
+	}
+
+	if len(conditions) == 0 {
+		return "", params
+	}
+
+	return " WHERE " + strings.Join(conditions, " AND "), params
+}
+
+// parseValue converts a raw field value according to its type
+func parseValue(fieldType string, value interface{}) (interface{}, error) {
+	switch fieldType {
+	case "integer":
+		if number, ok := value.(json.Number); ok {
+			return number.Int64()
+		}
+	case "float":
+		if number, ok := value.(json.Number); ok {
+			return number.Float64()
+		}
+	case "boolean":
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	case "string":
+		if str, ok := value.(string); ok {
+			return str, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unexpected value %v for type %s", value, fieldType)
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// dataPoint denotes the serialized form of a data point, retaining the type of each field
+// (the database does not allow to change the type of an existing field)
+type dataPoint struct {
+	TimeStamp time.Time         `json:"timestamp"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Fields    map[string]field  `json:"fields"`
+}
+
+type field struct {
+	Int    *int64   `json:"int,omitempty"`
+	Float  *float64 `json:"float,omitempty"`
+	String *string  `json:"string,omitempty"`
+	Bool   *bool    `json:"bool,omitempty"`
+}
+
+// MarshalJSON serializes a data point, retaining the type of each field
+func (d DataPoint) MarshalJSON() ([]byte, error) {
+
+	fields := make(map[string]field, len(d.Data))
+	for k, v := range d.Data {
+		var f field
+		switch t := v.(type) {
+		case int64:
+			f.Int = &t
+		case int:
+			n := int64(t)
+			f.Int = &n
+		case float64:
+			f.Float = &t
+		case string:
+			f.String = &t
+		case bool:
+			f.Bool = &t
+		default:
+			return nil, fmt.Errorf("unsupported type %T of field %s", v, k)
+		}
+		fields[k] = f
+	}
+
+	return json.Marshal(dataPoint{
+		TimeStamp: d.TimeStamp,
+		Tags:      d.Tags,
+		Fields:    fields,
+	})
+}
+
+// UnmarshalJSON deserializes a data point
+func (d *DataPoint) UnmarshalJSON(data []byte) error {
+
+	var encoded dataPoint
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+
+	d.TimeStamp, d.Tags = encoded.TimeStamp, encoded.Tags
+	if d.Tags == nil {
+		d.Tags = make(map[string]string)
+	}
+	d.Data = make(map[string]interface{}, len(encoded.Fields))
+	for k, f := range encoded.Fields {
+		switch {
+		case f.Int != nil:
+			d.Data[k] = *f.Int
+		case f.Float != nil:
+			d.Data[k] = *f.Float
+		case f.String != nil:
+			d.Data[k] = *f.String
+		case f.Bool != nil:
+			d.Data[k] = *f.Bool
+		default:
+			return fmt.Errorf("missing value of field %s", k)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package memory
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/fako1024/brew/db"
+)
+
+// DB is an in-memory database, providing functionality to interact with the database
+// (e.g. for testing or dry runs)
+type DB struct {
+	measurements map[string]db.DataPoints
+	mu           sync.RWMutex
+}
+
+// New creates a new (empty) in-memory database
+func New() *DB {
+	return &DB{
+		measurements: make(map[string]db.DataPoints),
+	}
+}
+
+// EmitDataPoints stores data points (replacing any existing data point with the same tags
+// and time stamp, merging their fields)
+func (d *DB) EmitDataPoints(dbName, measurement string, data db.DataPoints) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := dbName + "/" + measurement
+	for _, dataPoint := range data {
+		dataPoint = clone(dataPoint)
+
+		replaced := false
+		for i, existing := range d.measurements[key] {
+			if existing.TimeStamp.Equal(dataPoint.TimeStamp) && equalTags(existing.Tags, dataPoint.Tags) {
+				for k, v := range dataPoint.Data {
+					d.measurements[key][i].Data[k] = v
+				}
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			d.measurements[key] = append(d.measurements[key], dataPoint)
+		}
+	}
+	sort.SliceStable(d.measurements[key], func(i, j int) bool {
+		return d.measurements[key][i].TimeStamp.Before(d.measurements[key][j].TimeStamp)
+	})
+
+	return nil
+}
+
+// FetchDataPoints retrieves all data points of a measurement matching the filter
+func (d *DB) FetchDataPoints(dbName, measurement string, filter db.Filter) (db.DataPoints, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var dataPoints db.DataPoints
+	for _, dataPoint := range d.measurements[dbName+"/"+measurement] {
+		if matches(dataPoint, filter) {
+			dataPoints = append(dataPoints, clone(dataPoint))
+		}
+	}
+
+	return dataPoints, nil
+}
+
+// DeleteDataPoints removes all data points of a measurement matching the filter
+func (d *DB) DeleteDataPoints(dbName, measurement string, filter db.Filter) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := dbName + "/" + measurement
+	var retained db.DataPoints
+	for _, dataPoint := range d.measurements[key] {
+		if !matches(dataPoint, filter) {
+			retained = append(retained, dataPoint)
+		}
+	}
+	d.measurements[key] = retained
+
+	return nil
+}
+
+// ModifyMeasurement allows to alter certain elements of a measurement (if replaceTagName is
+// empty, only the additional fields are altered / added)
+func (d *DB) ModifyMeasurement(dbName, measurement, selectTagName, selectTagValue, replaceTagName, replaceTagValue string, additionalData map[string]interface{}) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var nModified int
+	for _, dataPoint := range d.measurements[dbName+"/"+measurement] {
+		if dataPoint.Tags[selectTagName] != selectTagValue {
+			continue
+		}
+		if replaceTagName != "" {
+			dataPoint.Tags[replaceTagName] = replaceTagValue
+		}
+		for k, v := range additionalData {
+			dataPoint.Data[k] = v
+		}
+		nModified++
+	}
+	if nModified == 0 {
+		return fmt.Errorf("no data points with %s = %s found", selectTagName, selectTagValue)
+	}
+
+	return nil
+}
+
+func matches(dataPoint db.DataPoint, filter db.Filter) bool {
+	for k, v := range filter.Tags {
+		if dataPoint.Tags[k] != v {
+			return false
+		}
+	}
+	if !filter.Start.IsZero() && dataPoint.TimeStamp.Before(filter.Start) {
+		return false
+	}
+	if !filter.End.IsZero() && !dataPoint.TimeStamp.Before(filter.End) {
+		return false
+	}
+
+	return true
+}
+
+func equalTags(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func clone(dataPoint db.DataPoint) db.DataPoint {
+	cloned := db.DataPoint{
+		TimeStamp: dataPoint.TimeStamp,
+		Data:      make(map[string]interface{}, len(dataPoint.Data)),
+		Tags:      make(map[string]string, len(dataPoint.Tags)),
+	}
+	for k, v := range dataPoint.Data {
+		cloned.Data[k] = v
+	}
+	for k, v := range dataPoint.Tags {
+		cloned.Tags[k] = v
+	}
+
+	return cloned
+}
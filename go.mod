@@ -3,11 +3,13 @@ module github.com/fako1024/brew
 go 1.20
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/fako1024/btscale v1.0.4
 	github.com/fako1024/gatt v1.0.4
 	github.com/google/uuid v1.6.0
 	github.com/influxdata/influxdb1-client v0.0.0-20220302092344-a9ab5670611c
 	github.com/json-iterator/go v1.1.12
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
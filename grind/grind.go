@@ -0,0 +1,247 @@
+// Package grind provides grind adjustment recommendations based on recent brews
+package grind
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/fako1024/brew/stats"
+)
+
+const (
+
+	// DefaultTargetBrewTime denotes the default target brew time of all shots
+	DefaultTargetBrewTime = 28 * time.Second
+
+	// DefaultTolerance denotes the default deviation of the brew time tolerated without adjusting the grind
+	DefaultTolerance = 2 * time.Second
+
+	// DefaultBrews denotes the default number of recent brews considered
+	DefaultBrews = 5
+
+	// DefaultSensitivity denotes the brew time (in seconds) gained per unit of relative grind
+	// setting towards finer, used until the sensitivity of the beans has been learned (roughly
+	// 0.65s per step of a Mahlkönig Vario with 230 steps)
+	DefaultSensitivity = 150.
+
+	// DefaultMaxAdjustment denotes the default maximum adjustment of the relative grind setting
+	// recommended at once
+	DefaultMaxAdjustment = 0.05
+
+	// minCorrelation denotes the minimum (negative) correlation between grind setting and
+	// brew time for a learned sensitivity to be considered reliable
+	minCorrelation = 0.3
+)
+
+// ErrNoBrews denotes that no brews are available to base a recommendation on
+var ErrNoBrews = errors.New("no brews available")
+
+// Direction denotes the direction of a recommended grind adjustment
+type Direction string
+
+const (
+
+	// Finer denotes grinding finer (i.e. slowing down the shot)
+	Finer Direction = "finer"
+
+	// Coarser denotes grinding coarser (i.e. speeding up the shot)
+	Coarser Direction = "coarser"
+
+	// Keep denotes keeping the grind setting
+	Keep Direction = "keep"
+)
+
+// Target denotes the target brew time and yield of a shot type
+type Target struct {
+	BrewTime time.Duration
+	Yield    float64
+}
+
+// Flow returns the mean flow rate (g/s) of the target
+func (t Target) Flow() float64 {
+	return t.Yield / t.BrewTime.Seconds()
+}
+
+// Sensitivity denotes the brew time gained per unit of relative grind setting towards finer
+type Sensitivity struct {
+	Value   float64 `json:"value"`   // Seconds per unit of relative grind setting
+	Source  string  `json:"source"`  // Origin of the value (pack, beans or default)
+	Brews   int     `json:"brews"`   // Number of brews the value was learned from
+	Quality float64 `json:"quality"` // Absolute correlation between grind setting and brew time (0 if not learned)
+}
+
+// Recommendation denotes a recommended grind adjustment for a pack of beans and shot type
+type Recommendation struct {
+	Pack     string `json:"pack"`
+	Beans    string `json:"beans,omitempty"`
+	ShotType string `json:"shot_type"`
+	Brews    int    `json:"brews"` // Number of recent brews the recommendation is based on
+
+	BrewTime       float64 `json:"brew_time"` // Mean brew time of the recent brews (in seconds)
+	Yield          float64 `json:"yield"`     // Mean yield of the recent brews
+	Flow           float64 `json:"flow"`      // Mean flow rate of the recent brews (g/s)
+	TargetBrewTime float64 `json:"target_brew_time"`
+	TargetYield    float64 `json:"target_yield"`
+	TargetFlow     float64 `json:"target_flow"`
+
+	// Deviation of the brew time from the time it should have taken to reach the actual yield at
+	// the target flow rate (positive: too slow)
+	TimeError float64 `json:"time_error"`
+
+	Direction          Direction   `json:"direction"`
+	Adjustment         float64     `json:"adjustment"` // Change of the relative grind setting (negative: finer)
+	CurrentSetting     float64     `json:"current_setting"`
+	RecommendedSetting float64     `json:"recommended_setting"`
+	Sensitivity        Sensitivity `json:"sensitivity"`
+}
+
+// Settings denotes the settings of the recommendation engine
+type Settings struct {
+	Brews         int
+	Tolerance     time.Duration
+	Sensitivity   float64
+	MaxAdjustment float64
+}
+
+// WithBrews sets the number of recent brews considered
+func WithBrews(n int) func(*Settings) {
+	return func(s *Settings) {
+		s.Brews = n
+	}
+}
+
+// WithTolerance sets the deviation of the brew time tolerated without adjusting the grind
+func WithTolerance(tolerance time.Duration) func(*Settings) {
+	return func(s *Settings) {
+		s.Tolerance = tolerance
+	}
+}
+
+// WithSensitivity sets the sensitivity used until the sensitivity of the beans has been learned
+func WithSensitivity(sensitivity float64) func(*Settings) {
+	return func(s *Settings) {
+		s.Sensitivity = sensitivity
+	}
+}
+
+// WithMaxAdjustment sets the maximum adjustment of the relative grind setting recommended at once
+func WithMaxAdjustment(adjustment float64) func(*Settings) {
+	return func(s *Settings) {
+		s.MaxAdjustment = adjustment
+	}
+}
+
+// Recommend determines a grind adjustment for a pack of beans and shot type from the brew
+// history (learning the sensitivity of the beans from all brews of the pack / the same beans)
+func Recommend(history []stats.Shot, pack, shotType string, target Target, options ...func(*Settings)) (Recommendation, error) {
+
+	s := Settings{
+		Brews:         DefaultBrews,
+		Tolerance:     DefaultTolerance,
+		Sensitivity:   DefaultSensitivity,
+		MaxAdjustment: DefaultMaxAdjustment,
+	}
+	for _, option := range options {
+		option(&s)
+	}
+	if target.BrewTime <= 0 || target.Yield <= 0. {
+		return Recommendation{}, fmt.Errorf("invalid target (brew time: %v, yield: %.2f)", target.BrewTime, target.Yield)
+	}
+
+	var packShots []stats.Shot
+	for _, shot := range history {
+		if shot.Pack == pack && shot.ShotType == shotType && shot.Duration > 0 && shot.Yield > 0. {
+			packShots = append(packShots, shot)
+		}
+	}
+	if len(packShots) == 0 {
+		return Recommendation{}, fmt.Errorf("%w for pack %s (%s shots)", ErrNoBrews, pack, shotType)
+	}
+	recent := packShots
+	if len(recent) > s.Brews {
+		recent = recent[len(recent)-s.Brews:]
+	}
+
+	r := Recommendation{
+		Pack:           pack,
+		Beans:          recent[len(recent)-1].Beans,
+		ShotType:       shotType,
+		Brews:          len(recent),
+		TargetBrewTime: target.BrewTime.Seconds(),
+		TargetYield:    target.Yield,
+		TargetFlow:     round(target.Flow()),
+		CurrentSetting: recent[len(recent)-1].GrindSetting,
+	}
+	for _, shot := range recent {
+		r.BrewTime += shot.Duration.Seconds() / float64(len(recent))
+		r.Yield += shot.Yield / float64(len(recent))
+	}
+	r.Flow = round(r.Yield / r.BrewTime)
+	r.BrewTime, r.Yield = round(r.BrewTime), round(r.Yield)
+	r.TimeError = round(r.BrewTime - r.Yield/target.Flow())
+
+	r.Sensitivity = learnSensitivity(history, packShots, r.Beans, shotType, s.Sensitivity)
+
+	r.Direction, r.RecommendedSetting = Keep, r.CurrentSetting
+	if math.Abs(r.TimeError) <= s.Tolerance.Seconds() {
+		return r, nil
+	}
+
+	// A shot running too slow requires grinding coarser (and vice versa)
+	r.Adjustment = math.Max(-s.MaxAdjustment, math.Min(s.MaxAdjustment, r.TimeError/r.Sensitivity.Value))
+	r.RecommendedSetting = math.Max(0., math.Min(1., r.CurrentSetting+r.Adjustment))
+	r.Adjustment = round4(r.RecommendedSetting - r.CurrentSetting)
+	r.RecommendedSetting = round4(r.RecommendedSetting)
+	switch {
+	case r.Adjustment < 0.:
+		r.Direction = Finer
+	case r.Adjustment > 0.:
+		r.Direction = Coarser
+	}
+
+	return r, nil
+}
+
+// learnSensitivity determines the sensitivity of the brew time to the grind setting from the
+// brews of the pack or, if insufficient, all brews of the same beans
+func learnSensitivity(history, packShots []stats.Shot, beans, shotType string, fallback float64) Sensitivity {
+
+	if trend, ok := stats.FitGrindTrend(packShots); ok && trend.Slope < 0. && -trend.Correlation >= minCorrelation {
+		return Sensitivity{Value: -trend.Slope, Source: "pack", Brews: trend.Count, Quality: round(-trend.Correlation)}
+	}
+
+	if beans != "" {
+		var beansShots []stats.Shot
+		for _, shot := range history {
+			if shot.Beans == beans && shot.ShotType == shotType && shot.Duration > 0 {
+				beansShots = append(beansShots, shot)
+			}
+		}
+		if trend, ok := stats.FitGrindTrend(beansShots); ok && trend.Slope < 0. && -trend.Correlation >= minCorrelation {
+			return Sensitivity{Value: -trend.Slope, Source: "beans", Brews: trend.Count, Quality: round(-trend.Correlation)}
+		}
+	}
+
+	return Sensitivity{Value: fallback, Source: "default"}
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func round4(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
+
+// LatestPack returns the pack of beans the most recent brew of a shot type was made from
+// (assuming the history to be in chronological order)
+func LatestPack(history []stats.Shot, shotType string) (string, error) {
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].ShotType == shotType && history[i].Pack != "" {
+			return history[i].Pack, nil
+		}
+	}
+	return "", fmt.Errorf("%w (%s shots from a known pack)", ErrNoBrews, shotType)
+}
@@ -0,0 +1,89 @@
+package grind
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/fako1024/brew/stats"
+)
+
+func testHistory(pack, beans string, settings, durations []float64) []stats.Shot {
+	start := time.Date(2023, 3, 1, 8, 0, 0, 0, time.UTC)
+
+	var shots []stats.Shot
+	for i := range settings {
+		shots = append(shots, stats.Shot{
+			ID:           pack + string(rune('a'+i)),
+			ShotType:     "double",
+			Pack:         pack,
+			Beans:        beans,
+			Start:        start.Add(time.Duration(i) * time.Hour),
+			Duration:     time.Duration(durations[i] * float64(time.Second)),
+			Yield:        36.,
+			GrindSetting: settings[i],
+		})
+	}
+
+	return shots
+}
+
+func TestRecommend(t *testing.T) {
+
+	target := Target{BrewTime: 28 * time.Second, Yield: 36.}
+
+	// Shots running too fast with a learnable sensitivity (one second per 0.005 towards finer)
+	history := testHistory("p1", "House Blend", []float64{0.30, 0.29, 0.28, 0.27}, []float64{20, 22, 24, 26})
+	r, err := Recommend(history, "p1", "double", target)
+	if err != nil {
+		t.Fatalf("Failed to determine recommendation: %s", err)
+	}
+	if r.Sensitivity.Source != "pack" || math.Abs(r.Sensitivity.Value-200.) > 1e-6 {
+		t.Fatalf("Unexpected sensitivity: %#v", r.Sensitivity)
+	}
+	if r.Direction != Finer || r.Brews != 4 || r.BrewTime != 23. || r.CurrentSetting != 0.27 || r.TimeError != -5. {
+		t.Fatalf("Unexpected recommendation: %#v", r)
+	}
+	if math.Abs(r.Adjustment+0.025) > 1e-9 || math.Abs(r.RecommendedSetting-0.245) > 1e-9 {
+		t.Fatalf("Unexpected adjustment: %#v", r)
+	}
+
+	// A new pack of the same beans (without sufficient own history) uses the sensitivity of the beans
+	history = append(history, testHistory("p2", "House Blend", []float64{0.24}, []float64{32})...)
+	if r, err = Recommend(history, "p2", "double", target); err != nil {
+		t.Fatalf("Failed to determine recommendation: %s", err)
+	}
+	if r.Sensitivity.Source != "beans" || r.Direction != Coarser || math.Abs(r.Adjustment-0.02) > 1e-9 {
+		t.Fatalf("Unexpected recommendation for new pack: %#v", r)
+	}
+
+	// Unknown beans use the default sensitivity, limited to the maximum adjustment
+	history = testHistory("p3", "", []float64{0.5, 0.5}, []float64{5, 7})
+	if r, err = Recommend(history, "p3", "double", target); err != nil {
+		t.Fatalf("Failed to determine recommendation: %s", err)
+	}
+	if r.Sensitivity.Source != "default" || r.Direction != Finer || math.Abs(r.Adjustment+DefaultMaxAdjustment) > 1e-9 {
+		t.Fatalf("Unexpected recommendation for unknown beans: %#v", r)
+	}
+
+	// Deviations within the tolerance do not require an adjustment (judged by flow rate, i.e. a
+	// lower yield within a shorter time is fine)
+	history = testHistory("p4", "", []float64{0.4, 0.4}, []float64{25, 25})
+	for i := range history {
+		history[i].Yield = 32.
+	}
+	if r, err = Recommend(history, "p4", "double", target); err != nil {
+		t.Fatalf("Failed to determine recommendation: %s", err)
+	}
+	if r.Direction != Keep || r.Adjustment != 0. || r.RecommendedSetting != 0.4 {
+		t.Fatalf("Unexpected recommendation within tolerance: %#v", r)
+	}
+
+	if _, err = Recommend(history, "unknown", "double", target); !errors.Is(err, ErrNoBrews) {
+		t.Fatalf("Expected error for unknown pack, got %v", err)
+	}
+	if pack, err := LatestPack(history, "double"); err != nil || pack != "p4" {
+		t.Fatalf("Unexpected latest pack %s (error: %v)", pack, err)
+	}
+}
@@ -0,0 +1,233 @@
+// Package grinder provides grinder profiles, converting between the native setting notation
+// of a grinder (e.g. "3B" on a Mahlkönig Vario) and the relative grind setting (0.0: finest,
+// 1.0: coarsest) stored with each brew
+package grinder
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Notation denotes the notation of the settings of a grinder
+type Notation string
+
+const (
+
+	// MacroMicro denotes numbered macro steps, each subdivided into lettered micro steps
+	// (e.g. "3B" on a Mahlkönig Vario)
+	MacroMicro Notation = "macro_micro"
+
+	// Dial denotes a numbered dial, either stepped or stepless (e.g. "15.5" on a Niche Zero)
+	Dial Notation = "dial"
+
+	// Clicks denotes the number of clicks from the zero point, i.e. the finest setting
+	// (e.g. "24" or "24 clicks" on a Comandante C40)
+	Clicks Notation = "clicks"
+)
+
+// Profile denotes a grinder and the notation / range of its settings
+type Profile struct {
+	Name     string   `json:"name"`
+	Notation Notation `json:"notation"`
+
+	MacroSteps int `json:"macro_steps,omitempty"` // Number of macro steps (numbered from 1, MacroMicro only)
+	MicroSteps int `json:"micro_steps,omitempty"` // Number of micro steps per macro step (lettered from A, MacroMicro only)
+
+	Min  float64 `json:"min,omitempty"`  // Finest setting (Dial only)
+	Max  float64 `json:"max,omitempty"`  // Coarsest setting (Dial / Clicks)
+	Step float64 `json:"step,omitempty"` // Resolution of the dial (Dial only, 0: stepless)
+}
+
+// Built-in grinder profiles
+var (
+
+	// MahlkoenigVario denotes a Mahlkönig Vario (V2), ranging from 1A to 10W
+	MahlkoenigVario = Profile{Name: "Mahlkönig Vario", Notation: MacroMicro, MacroSteps: 10, MicroSteps: 23}
+
+	// BaratzaSette270 denotes a Baratza Sette 270, ranging from 1A to 30I
+	BaratzaSette270 = Profile{Name: "Baratza Sette 270", Notation: MacroMicro, MacroSteps: 30, MicroSteps: 9}
+
+	// NicheZero denotes a Niche Zero with its stepless dial ranging from 0 to 50
+	NicheZero = Profile{Name: "Niche Zero", Notation: Dial, Min: 0, Max: 50}
+
+	// ComandanteC40 denotes a Comandante C40 with up to 40 clicks from the zero point
+	ComandanteC40 = Profile{Name: "Comandante C40", Notation: Clicks, Max: 40}
+)
+
+// Profiles returns all built-in grinder profiles (by name)
+func Profiles() map[string]Profile {
+	profiles := make(map[string]Profile)
+	for _, p := range []Profile{MahlkoenigVario, BaratzaSette270, NicheZero, ComandanteC40} {
+		profiles[p.Name] = p
+	}
+	return profiles
+}
+
+// Lookup returns the built-in grinder profile with the given name (ignoring case)
+func Lookup(name string) (Profile, bool) {
+	for profileName, p := range Profiles() {
+		if strings.EqualFold(profileName, name) {
+			return p, true
+		}
+	}
+	return Profile{}, false
+}
+
+// Names returns the names of all built-in grinder profiles (in alphabetical order)
+func Names() []string {
+	names := make([]string, 0, len(Profiles()))
+	for name := range Profiles() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate checks the profile for consistency
+func (p Profile) Validate() error {
+	switch p.Notation {
+	case MacroMicro:
+		if p.MacroSteps < 1 || p.MicroSteps < 1 || p.MicroSteps > 26 {
+			return fmt.Errorf("invalid number of macro / micro steps (%d / %d)", p.MacroSteps, p.MicroSteps)
+		}
+	case Dial:
+		if p.Max <= p.Min {
+			return fmt.Errorf("invalid dial range [%v, %v]", p.Min, p.Max)
+		}
+		if p.Step < 0. || p.Step > p.Max-p.Min {
+			return fmt.Errorf("invalid dial step %v", p.Step)
+		}
+	case Clicks:
+		if p.Max < 1 || p.Max != math.Trunc(p.Max) {
+			return fmt.Errorf("invalid maximum number of clicks %v", p.Max)
+		}
+	default:
+		return fmt.Errorf("unknown notation %q (expected %s, %s or %s)", p.Notation, MacroMicro, Dial, Clicks)
+	}
+	return nil
+}
+
+// Normalize converts a setting in the native notation of the grinder (e.g. "3B") to the
+// relative grind setting (0.0: finest, 1.0: coarsest)
+func (p Profile) Normalize(setting string) (float64, error) {
+
+	if err := p.Validate(); err != nil {
+		return 0., fmt.Errorf("grinder %s: %w", p.Name, err)
+	}
+	setting = strings.TrimSpace(setting)
+
+	switch p.Notation {
+	case MacroMicro:
+		if len(setting) < 2 {
+			return 0., p.invalid(setting)
+		}
+		macro, err := strconv.Atoi(setting[:len(setting)-1])
+		micro := int(strings.ToUpper(setting[len(setting)-1:])[0]-'A') + 1
+		if err != nil || macro < 1 || macro > p.MacroSteps || micro < 1 || micro > p.MicroSteps {
+			return 0., p.invalid(setting)
+		}
+		return float64((macro-1)*p.MicroSteps+micro) / float64(p.MacroSteps*p.MicroSteps), nil
+
+	case Dial:
+		value, err := strconv.ParseFloat(setting, 64)
+		if err != nil || math.IsNaN(value) || value < p.Min || value > p.Max {
+			return 0., p.invalid(setting)
+		}
+		if p.Step > 0. && !isMultiple(value-p.Min, p.Step) {
+			return 0., fmt.Errorf("%w (not a multiple of %v)", p.invalid(setting), p.Step)
+		}
+		return (value - p.Min) / (p.Max - p.Min), nil
+
+	default:
+		clicks, err := strconv.Atoi(strings.TrimSpace(strings.TrimSuffix(strings.ToLower(setting), "clicks")))
+		if err != nil || clicks < 0 || float64(clicks) > p.Max {
+			return 0., p.invalid(setting)
+		}
+		return float64(clicks) / p.Max, nil
+	}
+}
+
+// MustNormalize converts a setting in the native notation of the grinder to the relative
+// grind setting, panicking if the setting is invalid (e.g. for defaults)
+func (p Profile) MustNormalize(setting string) float64 {
+	relative, err := p.Normalize(setting)
+	if err != nil {
+		panic(err)
+	}
+	return relative
+}
+
+// Format converts a relative grind setting (0.0: finest, 1.0: coarsest) to the native
+// notation of the grinder, rounding to the nearest available setting
+func (p Profile) Format(relative float64) (string, error) {
+
+	if err := p.Validate(); err != nil {
+		return "", fmt.Errorf("grinder %s: %w", p.Name, err)
+	}
+	if math.IsNaN(relative) || relative < 0. || relative > 1. {
+		return "", fmt.Errorf("relative grind setting %.3f out of range [0.0, 1.0]", relative)
+	}
+
+	switch p.Notation {
+	case MacroMicro:
+		n := int(math.Max(1., math.Round(relative*float64(p.MacroSteps*p.MicroSteps))))
+		return fmt.Sprintf("%d%c", (n-1)/p.MicroSteps+1, rune('A'+(n-1)%p.MicroSteps)), nil
+
+	case Dial:
+		value := p.Min + relative*(p.Max-p.Min)
+		if p.Step > 0. {
+			value = p.Min + math.Round((value-p.Min)/p.Step)*p.Step
+		} else {
+			value = math.Round(value*10) / 10
+		}
+		return strconv.FormatFloat(value, 'f', -1, 64), nil
+
+	default:
+		return strconv.Itoa(int(math.Round(relative * p.Max))), nil
+	}
+}
+
+// Parse converts a grind setting to the relative grind setting (0.0: finest, 1.0: coarsest).
+// Relative settings are marked by a percent suffix (e.g. 25%), anything else is interpreted in
+// the native notation of the grinder. Without grinder (nil), relative settings are accepted
+// without suffix as well (0.0 - 1.0)
+func Parse(setting string, p *Profile) (float64, error) {
+
+	setting = strings.TrimSpace(setting)
+	if percent, isRelative := strings.CutSuffix(setting, "%"); isRelative {
+		relative, err := strconv.ParseFloat(strings.TrimSpace(percent), 64)
+		if err != nil || math.IsNaN(relative) || relative < 0. || relative > 100. {
+			return 0., fmt.Errorf("invalid relative grind setting %q (expected a value in [0%%, 100%%])", setting)
+		}
+		return relative / 100., nil
+	}
+	if p != nil {
+		return p.Normalize(setting)
+	}
+
+	relative, err := strconv.ParseFloat(setting, 64)
+	if err != nil || math.IsNaN(relative) || relative < 0. || relative > 1. {
+		return 0., fmt.Errorf("invalid relative grind setting %q (expected a value in [0.0, 1.0] or [0%%, 100%%])", setting)
+	}
+
+	return relative, nil
+}
+
+func (p Profile) invalid(setting string) error {
+	switch p.Notation {
+	case MacroMicro:
+		return fmt.Errorf("invalid setting %q for grinder %s (expected 1A - %d%c)", setting, p.Name, p.MacroSteps, rune('A'+p.MicroSteps-1))
+	case Dial:
+		return fmt.Errorf("invalid setting %q for grinder %s (expected %v - %v)", setting, p.Name, p.Min, p.Max)
+	default:
+		return fmt.Errorf("invalid setting %q for grinder %s (expected 0 - %v clicks)", setting, p.Name, p.Max)
+	}
+}
+
+func isMultiple(value, step float64) bool {
+	n := value / step
+	return math.Abs(n-math.Round(n)) < 1e-6
+}
@@ -0,0 +1,96 @@
+package grinder
+
+import (
+	"math"
+	"testing"
+)
+
+func TestConversion(t *testing.T) {
+
+	for _, c := range []struct {
+		profile  Profile
+		setting  string
+		relative float64
+	}{
+		{MahlkoenigVario, "3B", 48. / 230.},
+		{MahlkoenigVario, "1A", 1. / 230.},
+		{MahlkoenigVario, "10W", 1.},
+		{BaratzaSette270, "5C", 39. / 270.},
+		{NicheZero, "15.5", 0.31},
+		{ComandanteC40, "24", 0.6},
+		{Profile{Name: "Dial", Notation: Dial, Min: 1, Max: 11, Step: 0.5}, "3.5", 0.25},
+	} {
+		relative, err := c.profile.Normalize(c.setting)
+		if err != nil {
+			t.Fatalf("Failed to normalize %s on %s: %s", c.setting, c.profile.Name, err)
+		}
+		if math.Abs(relative-c.relative) > 1e-9 {
+			t.Fatalf("Unexpected relative setting for %s on %s: %v (expected %v)", c.setting, c.profile.Name, relative, c.relative)
+		}
+		setting, err := c.profile.Format(relative)
+		if err != nil || setting != c.setting {
+			t.Fatalf("Unexpected setting for %v on %s: %s (error: %v)", relative, c.profile.Name, setting, err)
+		}
+	}
+
+	// Lower case micro steps and a click suffix are accepted
+	if relative, err := MahlkoenigVario.Normalize("3b"); err != nil || relative != 48./230. {
+		t.Fatalf("Unexpected relative setting: %v (error: %v)", relative, err)
+	}
+	if relative, err := ComandanteC40.Normalize("20 clicks"); err != nil || relative != 0.5 {
+		t.Fatalf("Unexpected relative setting: %v (error: %v)", relative, err)
+	}
+
+	for _, c := range []struct {
+		profile Profile
+		setting string
+	}{
+		{MahlkoenigVario, "11A"}, {MahlkoenigVario, "3X"}, {MahlkoenigVario, "B"},
+		{NicheZero, "51"}, {NicheZero, "NaN"}, {ComandanteC40, "12.5"},
+		{Profile{Name: "Dial", Notation: Dial, Min: 1, Max: 11, Step: 0.5}, "3.2"},
+		{Profile{Name: "Invalid", Notation: "unknown"}, "1"},
+	} {
+		if _, err := c.profile.Normalize(c.setting); err == nil {
+			t.Fatalf("Expected error for %s on %s", c.setting, c.profile.Name)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+
+	// Settings are interpreted in the native notation of the grinder unless marked as relative
+	for _, c := range []struct {
+		setting  string
+		profile  *Profile
+		expected float64
+		valid    bool
+	}{
+		{"3B", &MahlkoenigVario, 48. / 230., true},
+		{"25%", &MahlkoenigVario, 0.25, true},
+		{"0.25", &MahlkoenigVario, 0., false},
+		{"1", &ComandanteC40, 1. / 40., true},
+		{"50 %", &ComandanteC40, 0.5, true},
+		{"0.5", &ComandanteC40, 0., false},
+		{"0.5", &NicheZero, 0.01, true},
+		{"50%", &NicheZero, 0.5, true},
+		{"110%", &ComandanteC40, 0., false},
+		{"0.25", nil, 0.25, true},
+		{"25%", nil, 0.25, true},
+		{"3B", nil, 0., false},
+		{"1.5", nil, 0., false},
+		{"NaN", nil, 0., false},
+		{"NaN%", &NicheZero, 0., false},
+		{"NaN", &NicheZero, 0., false},
+	} {
+		relative, err := Parse(c.setting, c.profile)
+		if (err == nil) != c.valid || relative != c.expected {
+			t.Fatalf("Unexpected relative setting for %q: %v (error: %v)", c.setting, relative, err)
+		}
+	}
+	if _, err := NicheZero.Format(math.NaN()); err == nil {
+		t.Fatalf("Expected error for invalid relative setting")
+	}
+	if p, exists := Lookup("niche zero"); !exists || p.Name != NicheZero.Name {
+		t.Fatalf("Failed to look up grinder: %#v", p)
+	}
+}
@@ -0,0 +1,256 @@
+package inventory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fako1024/brew"
+	"github.com/google/uuid"
+)
+
+const (
+
+	// DefaultLowThreshold denotes the default remaining weight below which a pack is
+	// considered nearly empty
+	DefaultLowThreshold = 50.0
+
+	// DefaultFreshnessWindow denotes the default time after roasting after which the
+	// beans of a pack are considered past their best
+	DefaultFreshnessWindow = 6 * 7 * 24 * time.Hour
+)
+
+// ErrNoActivePack denotes that no pack of coffee has been registered yet
+var ErrNoActivePack = errors.New("no active coffee pack")
+
+// Pack denotes a pack of coffee beans
+type Pack struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Roaster   string    `json:"roaster,omitempty"`
+	RoastDate time.Time `json:"roast_date,omitempty"`
+	Opened    time.Time `json:"opened"`
+
+	Weight    float64 `json:"weight"`    // Initial weight of the beans in the pack
+	Remaining float64 `json:"remaining"` // Remaining weight of the beans in the pack
+	NBrews    int     `json:"n_brews"`   // Number of brews made from the pack
+}
+
+// Params returns the pack attributes as parameters of the action recording its opening
+func (p Pack) Params() map[string]string {
+	params := map[string]string{
+		"pack_id":   p.ID,
+		"pack_name": p.Name,
+		"weight":    strconv.FormatFloat(p.Weight, 'f', -1, 64),
+	}
+	if p.Roaster != "" {
+		params["roaster"] = p.Roaster
+	}
+	if !p.RoastDate.IsZero() {
+		params["roast_date"] = p.RoastDate.Format(brew.RoastDateLayout)
+	}
+
+	return params
+}
+
+// Apply fills all bean related metadata not already set from the pack
+func (p Pack) Apply(m *brew.Metadata) {
+	if m.Beans == "" {
+		m.Beans = p.Name
+	}
+	if m.Roaster == "" {
+		m.Roaster = p.Roaster
+	}
+	if m.RoastDate.IsZero() {
+		m.RoastDate = p.RoastDate
+	}
+}
+
+// Inventory keeps track of packs of coffee beans and their consumption
+type Inventory struct {
+	stateFile       string
+	lowThreshold    float64
+	freshnessWindow time.Duration
+
+	packs []Pack // All registered packs (the last one being the active one)
+	mu    sync.Mutex
+}
+
+// New instantiates a new inventory, restoring its state from the state file (if set)
+func New(options ...func(*Inventory)) (*Inventory, error) {
+	inv := &Inventory{
+		lowThreshold:    DefaultLowThreshold,
+		freshnessWindow: DefaultFreshnessWindow,
+	}
+
+	// Execute functional options (if any)
+	for _, option := range options {
+		option(inv)
+	}
+
+	if err := inv.load(); err != nil {
+		return nil, err
+	}
+
+	return inv, nil
+}
+
+// WithStateFile sets the file the inventory state is persisted to
+func WithStateFile(path string) func(*Inventory) {
+	return func(inv *Inventory) {
+		inv.stateFile = path
+	}
+}
+
+// WithLowThreshold sets the remaining weight below which a pack is considered nearly empty
+func WithLowThreshold(weight float64) func(*Inventory) {
+	return func(inv *Inventory) {
+		inv.lowThreshold = weight
+	}
+}
+
+// WithFreshnessWindow sets the time after roasting after which the beans are considered
+// past their best (zero disables the check)
+func WithFreshnessWindow(window time.Duration) func(*Inventory) {
+	return func(inv *Inventory) {
+		inv.freshnessWindow = window
+	}
+}
+
+// Register adds a new pack, which becomes the active pack from now on
+func (inv *Inventory) Register(p Pack) (Pack, error) {
+
+	if p.Name == "" {
+		return p, errors.New("no pack name specified")
+	}
+	if p.Weight <= 0. {
+		return p, fmt.Errorf("invalid pack weight: %.1f", p.Weight)
+	}
+	if p.ID == "" {
+		p.ID = uuid.New().String()
+	}
+	if p.Opened.IsZero() {
+		p.Opened = time.Now()
+	}
+	p.Remaining, p.NBrews = p.Weight, 0
+
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	inv.packs = append(inv.packs, p)
+
+	return p, inv.save()
+}
+
+// Active returns the currently active pack
+func (inv *Inventory) Active() (Pack, error) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	if len(inv.packs) == 0 {
+		return Pack{}, ErrNoActivePack
+	}
+
+	return inv.packs[len(inv.packs)-1], nil
+}
+
+// Packs returns all registered packs (in order of registration)
+func (inv *Inventory) Packs() []Pack {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	return append([]Pack(nil), inv.packs...)
+}
+
+// Consume deducts the dose of a brew from the active pack and returns the updated pack
+func (inv *Inventory) Consume(dose float64) (Pack, error) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	if len(inv.packs) == 0 {
+		return Pack{}, ErrNoActivePack
+	}
+
+	p := &inv.packs[len(inv.packs)-1]
+	p.Remaining -= dose
+	if p.Remaining < 0. {
+		p.Remaining = 0.
+	}
+	p.NBrews++
+
+	return *p, inv.save()
+}
+
+// Warnings returns all warnings regarding the active pack (e.g. nearly empty or past
+// its freshness window) at the given time
+func (inv *Inventory) Warnings(t time.Time) []string {
+	p, err := inv.Active()
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	var warnings []string
+	if p.Remaining <= inv.lowThreshold {
+		warnings = append(warnings, fmt.Sprintf("coffee pack `%s` is nearly empty (%.1f remaining)", p.Name, p.Remaining))
+	}
+	if inv.freshnessWindow > 0 && !p.RoastDate.IsZero() {
+		if age := t.Sub(p.RoastDate); age > inv.freshnessWindow {
+			warnings = append(warnings, fmt.Sprintf("coffee pack `%s` is past its freshness window (roasted %d days ago)", p.Name, int(age.Hours()/24)))
+		}
+	}
+
+	return warnings
+}
+
+// load restores the inventory state from the state file (if it exists)
+func (inv *Inventory) load() error {
+	if inv.stateFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(inv.stateFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to read inventory state: %w", err)
+	}
+	if err := json.Unmarshal(data, &inv.packs); err != nil {
+		return fmt.Errorf("failed to parse inventory state: %w", err)
+	}
+
+	return nil
+}
+
+// save persists the inventory state to the state file (if set), replacing it atomically
+func (inv *Inventory) save() error {
+	if inv.stateFile == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(inv.packs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(inv.stateFile), filepath.Base(inv.stateFile)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write inventory state: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to write inventory state: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to write inventory state: %w", err)
+	}
+
+	return os.Rename(tmpFile.Name(), inv.stateFile)
+}
@@ -0,0 +1,85 @@
+package inventory
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConsume(t *testing.T) {
+
+	stateFile := filepath.Join(t.TempDir(), "inventory.json")
+	inv, err := New(WithStateFile(stateFile), WithLowThreshold(20.))
+	if err != nil {
+		t.Fatalf("Failed to initialize inventory: %s", err)
+	}
+
+	if _, err := inv.Consume(16.); !errors.Is(err, ErrNoActivePack) {
+		t.Fatalf("Unexpected error for consumption without active pack: %v", err)
+	}
+	if _, err := inv.Register(Pack{Name: "House Blend"}); err == nil {
+		t.Fatalf("Expected error for pack without weight")
+	}
+
+	if _, err := inv.Register(Pack{Name: "House Blend", Weight: 250.}); err != nil {
+		t.Fatalf("Failed to register pack: %s", err)
+	}
+	for i := 0; i < 14; i++ {
+		if _, err := inv.Consume(16.); err != nil {
+			t.Fatalf("Failed to consume beans: %s", err)
+		}
+	}
+	if warnings := inv.Warnings(time.Now()); len(warnings) != 0 {
+		t.Fatalf("Unexpected warnings: %v", warnings)
+	}
+
+	p, err := inv.Consume(16.)
+	if err != nil {
+		t.Fatalf("Failed to consume beans: %s", err)
+	}
+	if p.Remaining != 10. || p.NBrews != 15 {
+		t.Fatalf("Unexpected pack state, want %.1f remaining after %d brews, have %.1f after %d", 10., 15, p.Remaining, p.NBrews)
+	}
+	if warnings := inv.Warnings(time.Now()); len(warnings) != 1 {
+		t.Fatalf("Unexpected number of warnings for nearly empty pack: %v", warnings)
+	}
+
+	// Consumption beyond the remaining weight empties the pack
+	if p, err = inv.Consume(16.); err != nil || p.Remaining != 0. {
+		t.Fatalf("Unexpected state of empty pack: %.1f remaining (error: %v)", p.Remaining, err)
+	}
+
+	// The state is restored from the state file
+	restored, err := New(WithStateFile(stateFile))
+	if err != nil {
+		t.Fatalf("Failed to restore inventory: %s", err)
+	}
+	active, err := restored.Active()
+	if err != nil {
+		t.Fatalf("Failed to get active pack: %s", err)
+	}
+	if active.ID != p.ID || active.NBrews != 16 {
+		t.Fatalf("Unexpected restored pack: %#v", active)
+	}
+}
+
+func TestFreshness(t *testing.T) {
+
+	inv, err := New(WithFreshnessWindow(14 * 24 * time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to initialize inventory: %s", err)
+	}
+
+	roastDate := time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := inv.Register(Pack{Name: "House Blend", RoastDate: roastDate, Weight: 1000.}); err != nil {
+		t.Fatalf("Failed to register pack: %s", err)
+	}
+
+	if warnings := inv.Warnings(roastDate.Add(10 * 24 * time.Hour)); len(warnings) != 0 {
+		t.Fatalf("Unexpected warnings for fresh pack: %v", warnings)
+	}
+	if warnings := inv.Warnings(roastDate.Add(20 * 24 * time.Hour)); len(warnings) != 1 {
+		t.Fatalf("Unexpected number of warnings for stale pack: %v", warnings)
+	}
+}
@@ -0,0 +1,203 @@
+package brew
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fako1024/btscale/pkg/scale"
+)
+
+// JSONVersion denotes the version of the JSON representation of a brew, to be increased
+// on any incompatible change
+//
+// Version 1:
+//
+//	{
+//	  "version": 1,
+//	  "id": "84e1ffa1-07fa-4d25-9af7-0a50debe1921",
+//	  "shot_type": "double",                      // single, double or unknown
+//	  "start": "2020-09-23T11:17:45.139Z",        // RFC 3339
+//	  "duration_ms": 28000,                       // End of the brew relative to its start
+//	  "unit": "g",                                // Unit of all weights
+//	  "baseline": 0,
+//	  "beans_weight": 16,
+//	  "grind_setting": 0.2087,
+//	  "pack": "...",                              // (optional)
+//	  "unit_changed": true,                       // (optional)
+//	  "pump_start_ms": -4500,                     // Start of the pump relative to the first drop (optional)
+//	  "pump_start_source": "api",                 // api, button or offset (optional)
+//	  "metadata": {"beans": "House Blend", ...},  // Summary fields of the metadata (optional)
+//	  "score": {"reference": "...", "score": 87.5, "curve_deviation": 1.2, "yield_error": -0.5, "time_error_ms": 1500},
+//	  "annotations": [{"offset_ms": -2000, "event": "cup_placed", "change": 5.2}],
+//	  "data_points": [[0, 0.1], [105, 0.3], ...]  // [offset_ms, weight] (raw, i.e. including the baseline)
+//	}
+//
+// All offsets are given in milliseconds relative to the start of the brew
+const JSONVersion = 1
+
+type jsonBrew struct {
+	Version     int                    `json:"version"`
+	ID          string                 `json:"id"`
+	ShotType    string                 `json:"shot_type"`
+	Start       time.Time              `json:"start"`
+	Duration    int64                  `json:"duration_ms"`
+	Unit        string                 `json:"unit"`
+	Baseline    float64                `json:"baseline"`
+	BeansWeight float64                `json:"beans_weight"`
+	Grind       float64                `json:"grind_setting"`
+	Pack        string                 `json:"pack,omitempty"`
+	UnitChanged bool                   `json:"unit_changed,omitempty"`
+	PumpStart   *int64                 `json:"pump_start_ms,omitempty"`
+	PumpSource  string                 `json:"pump_start_source,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	Score       *jsonScore             `json:"score,omitempty"`
+	Annotations []jsonAnnotation       `json:"annotations,omitempty"`
+	DataPoints  [][2]float64           `json:"data_points"`
+}
+
+type jsonScore struct {
+	Reference      string  `json:"reference"`
+	Score          float64 `json:"score"`
+	CurveDeviation float64 `json:"curve_deviation"`
+	YieldError     float64 `json:"yield_error"`
+	TimeError      int64   `json:"time_error_ms"`
+}
+
+type jsonAnnotation struct {
+	Offset int64   `json:"offset_ms"`
+	Event  string  `json:"event"`
+	Change float64 `json:"change"`
+}
+
+// MarshalJSON serializes a brew (see JSONVersion for the schema)
+func (b Brew) MarshalJSON() ([]byte, error) {
+
+	j := jsonBrew{
+		Version:     JSONVersion,
+		ID:          b.ID,
+		ShotType:    b.ShotType.String(),
+		Start:       b.Start,
+		Duration:    b.End.Sub(b.Start).Milliseconds(),
+		Unit:        CanonicalUnit.String(),
+		Baseline:    b.Baseline,
+		BeansWeight: b.BeansWeight,
+		Grind:       b.GrindSetting,
+		Pack:        b.Pack,
+		UnitChanged: b.UnitChanged,
+		Metadata:    b.Metadata.Fields(),
+		DataPoints:  make([][2]float64, 0, len(b.DataPoints)),
+	}
+	if len(j.Metadata) == 0 {
+		j.Metadata = nil
+	}
+	if !b.PumpStart.IsZero() {
+		offset := b.PumpStart.Sub(b.Start).Milliseconds()
+		j.PumpStart, j.PumpSource = &offset, b.PumpStartSource.String()
+	}
+	if b.Score != nil {
+		j.Score = &jsonScore{
+			Reference:      b.Score.Reference,
+			Score:          b.Score.Score,
+			CurveDeviation: b.Score.CurveDeviation,
+			YieldError:     b.Score.YieldError,
+			TimeError:      b.Score.TimeError.Milliseconds(),
+		}
+	}
+	for _, annotation := range b.Annotations {
+		j.Annotations = append(j.Annotations, jsonAnnotation{
+			Offset: annotation.TimeStamp.Sub(b.Start).Milliseconds(),
+			Event:  annotation.Event.String(),
+			Change: annotation.Change,
+		})
+	}
+
+	// All data points share a single unit (as normalized by the scanner)
+	if len(b.DataPoints) > 0 {
+		unit, err := UnitFromString(b.DataPoints[0].Unit)
+		if err != nil {
+			return nil, err
+		}
+		j.Unit = unit.String()
+	}
+	for _, dataPoint := range b.DataPoints {
+		if unit, err := UnitFromString(dataPoint.Unit); err != nil || unit.String() != j.Unit {
+			return nil, fmt.Errorf("brew %s: data points in mixed units (%s / %s)", b.ID, j.Unit, dataPoint.Unit)
+		}
+		j.DataPoints = append(j.DataPoints, [2]float64{float64(dataPoint.TimeStamp.Sub(b.Start).Milliseconds()), dataPoint.Weight})
+	}
+
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON deserializes a brew (see JSONVersion for the schema)
+func (b *Brew) UnmarshalJSON(data []byte) error {
+
+	var j jsonBrew
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	if j.Version == 0 {
+		return errors.New("missing version of brew JSON")
+	}
+	if j.Version != JSONVersion {
+		return fmt.Errorf("unsupported version of brew JSON: %d (supported: %d)", j.Version, JSONVersion)
+	}
+	unit, err := UnitFromString(j.Unit)
+	if err != nil {
+		return err
+	}
+	metadata, err := MetadataFromFields(j.Metadata)
+	if err != nil {
+		return err
+	}
+
+	*b = Brew{
+		ID:           j.ID,
+		ShotType:     ShotTypeFromString(j.ShotType),
+		Start:        j.Start,
+		End:          j.Start.Add(time.Duration(j.Duration) * time.Millisecond),
+		Baseline:     j.Baseline,
+		BeansWeight:  j.BeansWeight,
+		GrindSetting: j.Grind,
+		Pack:         j.Pack,
+		UnitChanged:  j.UnitChanged,
+		Metadata:     metadata,
+	}
+	if j.PumpStart != nil {
+		source, ok := PumpStartSourceFromString(j.PumpSource)
+		if !ok {
+			return fmt.Errorf("unsupported pump start source %q (supported: %s, %s, %s)", j.PumpSource, PumpStartAPI, PumpStartButton, PumpStartOffset)
+		}
+		b.PumpStart, b.PumpStartSource = j.Start.Add(time.Duration(*j.PumpStart)*time.Millisecond), source
+	}
+	if j.Score != nil {
+		b.Score = &Score{
+			Reference:      j.Score.Reference,
+			Score:          j.Score.Score,
+			CurveDeviation: j.Score.CurveDeviation,
+			YieldError:     j.Score.YieldError,
+			TimeError:      time.Duration(j.Score.TimeError) * time.Millisecond,
+		}
+	}
+	for _, annotation := range j.Annotations {
+		b.Annotations = append(b.Annotations, Annotation{
+			TimeStamp: j.Start.Add(time.Duration(annotation.Offset) * time.Millisecond),
+			Event:     EventTypeFromString(annotation.Event),
+			Change:    annotation.Change,
+		})
+	}
+	if len(j.DataPoints) > 0 {
+		b.DataPoints = make(scale.DataPoints, 0, len(j.DataPoints))
+	}
+	for _, dataPoint := range j.DataPoints {
+		b.DataPoints = append(b.DataPoints, scale.DataPoint{
+			TimeStamp: j.Start.Add(time.Duration(dataPoint[0]) * time.Millisecond),
+			Unit:      unit.String(),
+			Weight:    dataPoint[1],
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package brew
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fako1024/btscale/pkg/scale"
+)
+
+func TestJSON(t *testing.T) {
+
+	start := time.Date(2020, 9, 23, 11, 17, 45, 139000000, time.UTC)
+	original := &Brew{
+		ID:              "test",
+		Start:           start,
+		End:             start.Add(28 * time.Second),
+		ShotType:        DoubleShot,
+		Baseline:        120.5,
+		BeansWeight:     16.,
+		GrindSetting:    0.2,
+		Pack:            "p1",
+		PumpStart:       start.Add(-4500 * time.Millisecond),
+		PumpStartSource: PumpStartAPI,
+		Metadata:        Metadata{Beans: "House Blend", RoastDate: time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC), WaterTemperature: 93.},
+		Score:           &Score{Reference: "espresso", Score: 87.5, CurveDeviation: 1.2, YieldError: -0.5, TimeError: 1500 * time.Millisecond},
+		Annotations:     []Annotation{{TimeStamp: start.Add(-2 * time.Second), Event: CupPlacedEvent, Change: 120.5}},
+		DataPoints: scale.DataPoints{
+			{TimeStamp: start, Unit: "g", Weight: 120.5},
+			{TimeStamp: start.Add(105 * time.Millisecond), Unit: "g", Weight: 120.7},
+			{TimeStamp: start.Add(28 * time.Second), Unit: "g", Weight: 156.5},
+		},
+	}
+
+	data, err := json.Marshal(original)
+	if err != nil {
+		t.Fatalf("Failed to marshal brew: %s", err)
+	}
+	for _, expected := range []string{`"version":1`, `"shot_type":"double"`, `"duration_ms":28000`, `"data_points":[[0,120.5],[105,120.7],[28000,156.5]]`, `"offset_ms":-2000,"event":"cup_placed"`, `"pump_start_ms":-4500`} {
+		if !strings.Contains(string(data), expected) {
+			t.Fatalf("Missing `%s` in JSON: %s", expected, data)
+		}
+	}
+
+	var decoded Brew
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal brew: %s", err)
+	}
+	if !reflect.DeepEqual(&decoded, original) {
+		t.Fatalf("Unexpected brew after round trip:\nwant %#v\nhave %#v", original, &decoded)
+	}
+
+	// Brews are marshalled by value as well
+	if byValue, err := json.Marshal(*original); err != nil || string(byValue) != string(data) {
+		t.Fatalf("Unexpected JSON when marshalling by value: %s (error: %v)", byValue, err)
+	}
+
+	for input, expected := range map[string]string{
+		`{"id": "test"}`:               "missing version",
+		`{"version": 2, "id": "test"}`: "unsupported version",
+		`{"version": 1, "unit": "ml"}`: "unsupported weight unit",
+		`{"version": 1, "pump_start_ms": -4500, "pump_start_source": "guess"}`: "unsupported pump start source",
+	} {
+		if err := json.Unmarshal([]byte(input), &decoded); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("Expected error `%s` for %s, got %v", expected, input, err)
+		}
+	}
+
+	original.DataPoints[1].Unit = "oz"
+	if _, err := json.Marshal(original); err == nil {
+		t.Fatalf("Expected error for data points in mixed units")
+	}
+}
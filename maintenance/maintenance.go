@@ -0,0 +1,147 @@
+package maintenance
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fako1024/brew/action"
+	"github.com/fako1024/brew/db/influx"
+)
+
+const day = 24 * time.Hour
+
+// Task denotes a recurring maintenance task, due after a number of shots and / or a time
+// interval since it was last performed (whichever comes first)
+type Task struct {
+	Type     action.Type   `json:"type"`
+	Shots    int           `json:"shots,omitempty"`    // Number of shots after which the task is due (0: disabled)
+	Interval time.Duration `json:"interval,omitempty"` // Time after which the task is due (0: disabled)
+	Buzz     int           `json:"buzz,omitempty"`     // Number of buzzes signaled on the scale if the task is due
+}
+
+// DefaultTasks returns the default maintenance schedule
+func DefaultTasks() []Task {
+	return []Task{
+		{Type: action.BackFlush, Shots: 50, Buzz: 2},
+		{Type: action.DescaleBrewGroup, Interval: 91 * day, Buzz: 3},
+		{Type: action.DescalePressureReliefValve, Interval: 182 * day, Buzz: 3},
+		{Type: action.DescaleExpansionValve, Interval: 182 * day, Buzz: 3},
+		{Type: action.DescaleFull, Interval: 365 * day, Buzz: 3},
+	}
+}
+
+// WithRecurringActions extends a set of tasks by all registered recurring action types not
+// covered by any of the tasks yet
+func WithRecurringActions(tasks []Task) []Task {
+	covered := make(map[action.Type]struct{}, len(tasks))
+	for _, task := range tasks {
+		covered[task.Type] = struct{}{}
+	}
+
+	for _, def := range action.Definitions() {
+		if _, exists := covered[def.Type]; exists || def.Interval <= 0 {
+			continue
+		}
+		tasks = append(tasks, Task{
+			Type:     def.Type,
+			Interval: def.Interval,
+		})
+	}
+
+	return tasks
+}
+
+// Source denotes a source of recorded actions and brews
+type Source interface {
+
+	// LastAction returns when an action of the given type was last performed (zero if never)
+	LastAction(t action.Type) (time.Time, error)
+
+	// CountBrews returns the number of brews since the provided time
+	CountBrews(since time.Time) (int, error)
+}
+
+// Status denotes the status of a maintenance task
+type Status struct {
+	Task
+
+	Last      time.Time `json:"last,omitempty"`       // Time the task was last performed (zero if never)
+	Shots     int       `json:"shots_since"`          // Number of shots since the task was last performed
+	ShotsLeft int       `json:"shots_left,omitempty"` // Number of shots left until the task is due (if shot based)
+	DueAt     time.Time `json:"due_at,omitempty"`     // Time the task is due (if time based)
+	Due       bool      `json:"due"`                  // Task is due
+}
+
+// Check computes the status of all tasks at the given time
+func Check(tasks []Task, src Source, now time.Time) ([]Status, error) {
+
+	statuses := make([]Status, 0, len(tasks))
+	for _, task := range tasks {
+		last, err := src.LastAction(task.Type)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve last %s: %w", task.Type, err)
+		}
+
+		status := Status{
+			Task: task,
+			Last: last,
+		}
+		if status.Shots, err = src.CountBrews(last); err != nil {
+			return nil, fmt.Errorf("failed to count brews since last %s: %w", task.Type, err)
+		}
+
+		if task.Shots > 0 {
+			if status.ShotsLeft = task.Shots - status.Shots; status.ShotsLeft <= 0 {
+				status.ShotsLeft, status.Due = 0, true
+			}
+		}
+
+		// A time based task that was never recorded is considered due
+		if task.Interval > 0 {
+			if last.IsZero() {
+				status.Due = true
+			} else if status.DueAt = last.Add(task.Interval); !now.Before(status.DueAt) {
+				status.Due = true
+			}
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// Buzz returns the number of buzzes to signal on the scale for a set of task states (i.e.
+// the maximum of all due tasks, or zero if none is due)
+func Buzz(statuses []Status) (n int) {
+	for _, status := range statuses {
+		if status.Due && status.Buzz > n {
+			n = status.Buzz
+		}
+	}
+	return
+}
+
+// influxSource provides recorded actions and brews from an InfluxDB
+type influxSource struct {
+	db     *influx.DB
+	dbName string
+}
+
+// NewInfluxSource instantiates a new source of recorded actions and brews from an InfluxDB
+func NewInfluxSource(db *influx.DB, dbName string) Source {
+	return &influxSource{
+		db:     db,
+		dbName: dbName,
+	}
+}
+
+// LastAction returns when an action of the given type was last performed (zero if never)
+func (s *influxSource) LastAction(t action.Type) (time.Time, error) {
+	return s.db.LastTimestamp(s.dbName, action.Measurement, "action_type", t)
+}
+
+// CountBrews returns the number of brews since the provided time
+func (s *influxSource) CountBrews(since time.Time) (int, error) {
+	return s.db.Count(s.dbName, "summary", "end_weight", since)
+}
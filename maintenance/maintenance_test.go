@@ -0,0 +1,78 @@
+package maintenance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fako1024/brew/action"
+)
+
+type testSource struct {
+	lastActions map[action.Type]time.Time
+	brews       []time.Time
+}
+
+func (s *testSource) LastAction(t action.Type) (time.Time, error) {
+	return s.lastActions[t], nil
+}
+
+func (s *testSource) CountBrews(since time.Time) (n int, err error) {
+	for _, ts := range s.brews {
+		if !ts.Before(since) {
+			n++
+		}
+	}
+	return
+}
+
+func TestCheck(t *testing.T) {
+
+	now := time.Date(2020, 9, 23, 11, 0, 0, 0, time.UTC)
+	src := &testSource{
+		lastActions: map[action.Type]time.Time{
+			action.BackFlush:        now.Add(-10 * day),
+			action.DescaleBrewGroup: now.Add(-30 * day),
+			action.DescaleFull:      now.Add(-400 * day),
+		},
+	}
+	for i := 0; i < 60; i++ {
+		src.brews = append(src.brews, now.Add(-time.Duration(i)*4*time.Hour))
+	}
+
+	tasks := []Task{
+		{Type: action.BackFlush, Shots: 50, Buzz: 2},
+		{Type: action.DescaleBrewGroup, Interval: 91 * day, Buzz: 3},
+		{Type: action.DescaleFull, Interval: 365 * day, Shots: 10000, Buzz: 4},
+		{Type: action.DescaleExpansionValve, Interval: 182 * day, Buzz: 1},
+	}
+	statuses, err := Check(tasks, src, now)
+	if err != nil {
+		t.Fatalf("Failed to check maintenance status: %s", err)
+	}
+
+	for i, expected := range []struct {
+		shots     int
+		shotsLeft int
+		due       bool
+	}{
+		{shots: 60, shotsLeft: 0, due: true},
+		{shots: 60, shotsLeft: 0, due: false},
+		{shots: 60, shotsLeft: 9940, due: true},
+		{shots: 60, shotsLeft: 0, due: true},
+	} {
+		status := statuses[i]
+		if status.Shots != expected.shots || status.ShotsLeft != expected.shotsLeft || status.Due != expected.due {
+			t.Fatalf("Unexpected status for %s, want %+v, have %+v", status.Type, expected, status)
+		}
+	}
+	if dueAt := statuses[1].DueAt; !dueAt.Equal(now.Add(61 * day)) {
+		t.Fatalf("Unexpected due time for %s: %v", statuses[1].Type, dueAt)
+	}
+
+	if n := Buzz(statuses); n != 4 {
+		t.Fatalf("Unexpected number of buzzes, want %d, have %d", 4, n)
+	}
+	if n := Buzz(statuses[1:2]); n != 0 {
+		t.Fatalf("Unexpected number of buzzes for no due tasks, want %d, have %d", 0, n)
+	}
+}
@@ -0,0 +1,85 @@
+package brew
+
+import (
+	"fmt"
+	"time"
+)
+
+// RoastDateLayout denotes the layout used to represent the roast date of beans
+const RoastDateLayout = "2006-01-02"
+
+// metadataFields denotes the names of all database fields representing metadata
+var metadataFields = map[string]struct{}{
+	"setup": {}, "beans": {}, "roaster": {}, "roast_date": {}, "grinder": {},
+	"grinder_setting": {}, "basket": {}, "water_temperature": {}, "recipe": {},
+}
+
+// IsMetadataField returns if a database field represents metadata
+func IsMetadataField(name string) bool {
+	_, exists := metadataFields[name]
+	return exists
+}
+
+// Fields returns the (non-empty) metadata as a set of database fields
+func (m Metadata) Fields() map[string]interface{} {
+
+	fields := make(map[string]interface{})
+	for k, v := range map[string]string{
+		"setup":           m.Setup,
+		"beans":           m.Beans,
+		"roaster":         m.Roaster,
+		"grinder":         m.Grinder,
+		"grinder_setting": m.GrinderSetting,
+		"basket":          m.Basket,
+		"recipe":          m.Recipe,
+	} {
+		if v != "" {
+			fields[k] = v
+		}
+	}
+	if !m.RoastDate.IsZero() {
+		fields["roast_date"] = m.RoastDate.Format(RoastDateLayout)
+	}
+	if m.WaterTemperature > 0. {
+		fields["water_temperature"] = m.WaterTemperature
+	}
+
+	return fields
+}
+
+// MetadataFromFields parses metadata from a set of database fields (ignoring unrelated fields)
+func MetadataFromFields(fields map[string]interface{}) (m Metadata, err error) {
+
+	for k, dest := range map[string]*string{
+		"setup":           &m.Setup,
+		"beans":           &m.Beans,
+		"roaster":         &m.Roaster,
+		"grinder":         &m.Grinder,
+		"grinder_setting": &m.GrinderSetting,
+		"basket":          &m.Basket,
+		"recipe":          &m.Recipe,
+	} {
+		if v, exists := fields[k]; exists && v != nil {
+			*dest = fmt.Sprint(v)
+		}
+	}
+	if v, exists := fields["roast_date"]; exists && v != nil {
+		if m.RoastDate, err = time.Parse(RoastDateLayout, fmt.Sprint(v)); err != nil {
+			return m, fmt.Errorf("failed to parse roast date: %w", err)
+		}
+	}
+	if v, exists := fields["water_temperature"]; exists && v != nil {
+		switch t := v.(type) {
+		case float64:
+			m.WaterTemperature = t
+		case fmt.Stringer:
+			if _, err = fmt.Sscan(t.String(), &m.WaterTemperature); err != nil {
+				return m, fmt.Errorf("failed to parse water temperature: %w", err)
+			}
+		default:
+			return m, fmt.Errorf("unexpected type %T for water temperature", v)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,139 @@
+package scanner
+
+import (
+	"math"
+	"time"
+
+	"github.com/fako1024/brew"
+	"github.com/fako1024/brew/buffer"
+	"github.com/fako1024/btscale/pkg/scale"
+)
+
+// event denotes a detected manipulation of the scale
+type event struct {
+	brew.Annotation
+
+	brewIndex int // Number of brew data points right before the event started
+}
+
+// detectEvent tracks step changes of weight and classifies them once the weight has
+// settled. Returns the event and true if an event was detected.
+func (s *Scanner) detectEvent(data buffer.DataPoints) (event, bool) {
+
+	// Validate data buffer length is sufficient
+	if len(data) < 2 || data[len(data)-2] == nil || data[len(data)-1] == nil {
+		return event{}, false
+	}
+
+	prev, current := data[len(data)-2].(scale.DataPoint), data[len(data)-1].(scale.DataPoint)
+
+	// If no step is ongoing, check if one has started
+	if s.currentStep == nil {
+		if math.Abs(current.Weight-prev.Weight) < minStepChange && !isTare(prev.Weight, current.Weight) {
+			return event{}, false
+		}
+
+		s.currentStep = &step{
+			start:        current.TimeStamp,
+			startWeight:  prev.Weight,
+			firstWeight:  current.Weight,
+			stableBefore: lastNStable(data[:len(data)-1], len(data)-2, maxSettledChange),
+		}
+		if s.currentlyTrackingBrew {
+			s.currentStep.brewIndex = len(s.currentBrew.DataPoints)
+		}
+	}
+	s.currentStep.nDataPoints++
+
+	// Wait for the weight to settle (or give up waiting after a while)
+	if !lastNStable(data, len(data)-1, maxSettledChange) && s.currentStep.nDataPoints < maxStepDataPoints {
+		return event{}, false
+	}
+
+	st := s.currentStep
+	s.currentStep = nil
+
+	detected := event{
+		Annotation: brew.Annotation{
+			TimeStamp: st.start,
+			Change:    current.Weight - st.startWeight,
+		},
+		brewIndex: st.brewIndex,
+	}
+
+	switch {
+
+	// Lifting an untared cup off the scale drops the weight below its recorded baseline,
+	// which takes precedence over a tare (both possibly resetting the weight to zero at once)
+	case s.isUntaredCupRemoval(st, current.Weight):
+		detected.Event = brew.CupRemovedEvent
+
+	// A tare resets the weight to zero instantly (within a single data point, from a stable
+	// weight, potentially followed by ongoing flow), whereas manually placing / removing a
+	// cup causes a gradual change over several data points
+	case st.stableBefore && math.Abs(st.firstWeight) <= maxTareWeight:
+		detected.Event = brew.TareEvent
+		detected.Change = st.firstWeight - st.startWeight
+	case math.Abs(detected.Change) < minStepChange:
+		return event{}, false
+	case detected.Change > 0:
+		detected.Event = brew.CupPlacedEvent
+	default:
+		detected.Event = brew.CupRemovedEvent
+	}
+
+	s.logger.Debugf("detected %s event at %v (change: %.2f)", detected.Event, detected.TimeStamp, detected.Change)
+
+	return detected, true
+}
+
+// isUntaredCupRemoval determines if a step was caused by removing a cup placed on the scale
+// without taring it, i.e. if the weight prior to the step included the baseline of the current
+// (or most recent) brew and dropped below it
+func (s *Scanner) isUntaredCupRemoval(st *step, weight float64) bool {
+
+	b := s.lastBrew
+	if s.currentlyTrackingBrew {
+		b = s.currentBrew
+	} else if b != nil && st.start.Sub(b.End) >= maxAnnotationAge {
+		return false
+	}
+	if b == nil || b.Baseline < minStepChange {
+		return false
+	}
+
+	return st.startWeight >= b.Baseline-maxSettledChange && weight <= b.Baseline-minStepChange
+}
+
+// handleIdleEvent processes an event detected while no brew is being tracked
+func (s *Scanner) handleIdleEvent(e event) {
+
+	// Removing the cup shortly after a brew has finished is associated with that brew
+	if e.Event == brew.CupRemovedEvent && s.lastBrew != nil && e.TimeStamp.Sub(s.lastBrew.End) < maxAnnotationAge {
+		s.lastBrew.Annotations = append(s.lastBrew.Annotations, e.Annotation)
+		s.emitAnnotations(s.lastBrew, e.Annotation)
+		s.lastBrew = nil
+		return
+	}
+
+	s.pendingAnnotations = append(s.pendingAnnotations, e.Annotation)
+}
+
+// popPendingAnnotations returns all events detected not longer than maxAnnotationAge before
+// the provided time and clears the list of pending events
+func (s *Scanner) popPendingAnnotations(t time.Time) (annotations []brew.Annotation) {
+	for _, annotation := range s.pendingAnnotations {
+		if t.Sub(annotation.TimeStamp) <= maxAnnotationAge {
+			annotations = append(annotations, annotation)
+		}
+	}
+	s.pendingAnnotations = nil
+
+	return
+}
+
+// isTare determines if a change of weight between two consecutive data points was caused
+// by a tare (which may happen at low weights, e.g. right at the start of a brew)
+func isTare(prev, current float64) bool {
+	return math.Abs(current) <= maxTareWeight && math.Abs(prev) >= minTareChange
+}
@@ -1,6 +1,13 @@
 package scanner
 
-import "github.com/fako1024/btscale/pkg/scale"
+import (
+	"time"
+
+	"github.com/fako1024/brew"
+	"github.com/fako1024/brew/curve"
+	"github.com/fako1024/brew/inventory"
+	"github.com/fako1024/btscale/pkg/scale"
+)
 
 // WithExpectedSingleBrewShotWeight sets a custom expected single shot weight
 func WithExpectedSingleBrewShotWeight(weight float64) func(*Scanner) {
@@ -20,7 +27,7 @@ func WithExpectedDoubleBrewShotWeight(weight float64) func(*Scanner) {
 // used for a single shot
 func WithSingleShotBeansWeight(weight float64) func(*Scanner) {
 	return func(s *Scanner) {
-		s.singleShotBeansWeight = weight
+		s.setup.BeansWeightSingle = weight
 	}
 }
 
@@ -28,7 +35,7 @@ func WithSingleShotBeansWeight(weight float64) func(*Scanner) {
 // used for a double shot
 func WithDoubleShotBeansWeight(weight float64) func(*Scanner) {
 	return func(s *Scanner) {
-		s.doubleShotBeansWeight = weight
+		s.setup.BeansWeightDouble = weight
 	}
 }
 
@@ -37,7 +44,78 @@ func WithDoubleShotBeansWeight(weight float64) func(*Scanner) {
 // 1.0: coarsest
 func WithGrindSetting(setting float64) func(*Scanner) {
 	return func(s *Scanner) {
-		s.grindSetting = setting
+		s.setup.GrindSetting = setting
+	}
+}
+
+// WithSetup sets the initial setup used for brewing (overriding any beans weights /
+// grind setting set before)
+func WithSetup(setup Setup) func(*Scanner) {
+	return func(s *Scanner) {
+		s.setup = setup
+	}
+}
+
+// WithInventory sets a bean inventory, deducting the dose of each brew from the active pack
+func WithInventory(inv *inventory.Inventory) func(*Scanner) {
+	return func(s *Scanner) {
+		s.inventory = inv
+	}
+}
+
+// WithStartupBuzz sets a number of buzzes to signal on the scale once it is connected
+func WithStartupBuzz(n int) func(*Scanner) {
+	return func(s *Scanner) {
+		s.startupBuzz = n
+	}
+}
+
+// WithTags sets additional tags (e.g. station / group head) to attach to all data
+// points emitted by the scanner
+func WithTags(tags map[string]string) func(*Scanner) {
+	return func(s *Scanner) {
+		s.tags = tags
+	}
+}
+
+// WithReferences sets the reference curves per recipe, against which each brew brewed with
+// a setup of that recipe is scored
+func WithReferences(references map[string]brew.Reference) func(*Scanner) {
+	return func(s *Scanner) {
+		s.references = references
+	}
+}
+
+// WithCompression sets the compression applied to the data points of each brew prior to
+// storage (e.g. to reduce the size of the database)
+func WithCompression(compression curve.Compression) func(*Scanner) {
+	return func(s *Scanner) {
+		s.compression = compression
+	}
+}
+
+// WithPumpOffset sets the offset between the start of the pump and the first drop, used to
+// estimate the start of the pump of brews without signaled start (0: no estimate)
+func WithPumpOffset(offset time.Duration) func(*Scanner) {
+	return func(s *Scanner) {
+		s.pumpOffset = offset
+	}
+}
+
+// WithPumpOffsetLearning enables learning the offset between the start of the pump and the
+// first drop from brews with signaled start of the pump (e.g. via the control API). The
+// offset cannot be learned from the data points alone, which do not change prior to the
+// first drop
+func WithPumpOffsetLearning() func(*Scanner) {
+	return func(s *Scanner) {
+		s.learnPumpOffset = true
+	}
+}
+
+// WithFinishHandler sets a handler to be called for each successfully tracked brew
+func WithFinishHandler(handler func(*brew.Brew)) func(*Scanner) {
+	return func(s *Scanner) {
+		s.finishHandler = handler
 	}
 }
 
@@ -0,0 +1,78 @@
+package scanner
+
+import (
+	"time"
+
+	"github.com/fako1024/brew"
+)
+
+// ButtonScale denotes a scale reporting presses of its button (e.g. starting its timer), which
+// are used to signal the start of the pump
+type ButtonScale interface {
+	SetButtonChannel(chan time.Time)
+}
+
+// pumpStart denotes a signaled start of the pump
+type pumpStart struct {
+	ts     time.Time
+	source brew.PumpStartSource
+}
+
+// PumpStarted signals the start of the pump at the given time, to be associated with the
+// next brew whose first drop follows within MaxPumpLead
+func (s *Scanner) PumpStarted(ts time.Time, source brew.PumpStartSource) {
+	s.pumpMu.Lock()
+	defer s.pumpMu.Unlock()
+
+	s.pumpStarts = append(s.pumpStarts, pumpStart{ts: ts, source: source})
+	s.logger.Debugf("pump started at %v (source: %s)", ts, source)
+}
+
+// PumpOffset returns the current (learned) offset between the start of the pump and the
+// first drop (zero if unknown)
+func (s *Scanner) PumpOffset() time.Duration {
+	s.pumpMu.Lock()
+	defer s.pumpMu.Unlock()
+
+	return s.pumpOffset
+}
+
+// assignPumpStart determines the start of the pump of the current brew, preferring the most
+// recent start signaled prior to its first drop over an estimate from the (learned) offset
+func (s *Scanner) assignPumpStart() {
+	s.pumpMu.Lock()
+	defer s.pumpMu.Unlock()
+
+	b := s.currentBrew
+	var (
+		signaled *pumpStart
+		pending  []pumpStart
+	)
+	for i, start := range s.pumpStarts {
+		switch {
+		case start.ts.After(b.End):
+			pending = append(pending, start)
+		case !start.ts.After(b.Start) && b.Start.Sub(start.ts) <= MaxPumpLead:
+			signaled = &s.pumpStarts[i]
+		}
+	}
+	s.pumpStarts = pending
+
+	if signaled == nil {
+		if s.pumpOffset > 0 {
+			b.PumpStart, b.PumpStartSource = b.Start.Add(-s.pumpOffset), brew.PumpStartOffset
+		}
+		return
+	}
+	b.PumpStart, b.PumpStartSource = signaled.ts, signaled.source
+
+	if !s.learnPumpOffset {
+		return
+	}
+	offset := b.Start.Sub(signaled.ts)
+	if s.pumpOffset > 0 {
+		offset = time.Duration(pumpOffsetLearningRate*float64(offset) + (1-pumpOffsetLearningRate)*float64(s.pumpOffset))
+	}
+	s.pumpOffset = offset.Round(time.Millisecond)
+	s.logger.Infof("learned offset between start of pump and first drop: %v", s.pumpOffset)
+}
@@ -0,0 +1,52 @@
+package scanner
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fako1024/brew"
+	"github.com/fako1024/btscale/pkg/scale"
+)
+
+// Number of static data points appended to a replayed brew to allow its end to be detected
+const nTrailingDataPoints = 5
+
+// Redetect replays the raw data points of a stored brew through a new scanner (configured
+// via the provided options, without scale / database), returning all brews detected in them
+func Redetect(b *brew.Brew, options ...func(*Scanner)) ([]*brew.Brew, error) {
+
+	if len(b.DataPoints) < 2 {
+		return nil, fmt.Errorf("brew %s has insufficient data points to replay", b.ID)
+	}
+
+	var detected []*brew.Brew
+	scan := New(nil, nil, append(options, WithFinishHandler(func(b *brew.Brew) {
+		detected = append(detected, b)
+	}))...)
+	for _, dataPoint := range b.DataPoints {
+		scan.Process(dataPoint)
+	}
+
+	// If the end of the brew was not detected within its data points (e.g. because the cup was
+	// removed), hold the last weight until it is
+	last := b.DataPoints[len(b.DataPoints)-1]
+	interval := last.TimeStamp.Sub(b.DataPoints[0].TimeStamp) / time.Duration(len(b.DataPoints)-1)
+	for i := 1; i <= nTrailingDataPoints && scan.currentlyTrackingBrew; i++ {
+		scan.Process(scale.DataPoint{
+			TimeStamp: last.TimeStamp.Add(time.Duration(i) * interval),
+			Weight:    last.Weight,
+			Unit:      last.Unit,
+		})
+	}
+
+	// Discard any data points beyond the stored ones
+	for _, d := range detected {
+		if d.End.After(last.TimeStamp) {
+			if err := d.Trim(time.Time{}, last.TimeStamp); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return detected, nil
+}
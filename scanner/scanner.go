@@ -2,12 +2,17 @@ package scanner
 
 import (
 	"math"
+	"sync"
 	"time"
 
 	"github.com/fako1024/brew"
 	"github.com/fako1024/brew/buffer"
+	"github.com/fako1024/brew/curve"
 	"github.com/fako1024/brew/db"
 	"github.com/fako1024/brew/db/influx"
+	"github.com/fako1024/brew/grinder"
+	"github.com/fako1024/brew/inventory"
+	"github.com/fako1024/brew/store"
 	"github.com/fako1024/btscale/pkg/scale"
 	"github.com/google/uuid"
 )
@@ -18,8 +23,39 @@ const (
 	minBrewTime = 10 * time.Second
 	maxBrewTime = 60 * time.Second
 
-	defaultExpectedSingleShotWeight = 30.
-	defaultExpectedDoubleShotWeight = 65.
+	// DefaultExpectedSingleShotWeight denotes the default expected yield of a single shot
+	DefaultExpectedSingleShotWeight = 30.
+
+	// DefaultExpectedDoubleShotWeight denotes the default expected yield of a double shot
+	DefaultExpectedDoubleShotWeight = 65.
+
+	// Minimum change of weight between two consecutive data points to be considered
+	// a step (i.e. a manipulation of the scale instead of flow)
+	minStepChange = 5.0
+
+	// Maximum change of weight between consecutive data points for the weight to be
+	// considered settled after a step
+	maxSettledChange = 0.5
+
+	// Maximum number of data points to wait for the weight to settle after a step
+	maxStepDataPoints = 20
+
+	// Maximum absolute weight considered to be zero after a tare
+	maxTareWeight = 0.2
+
+	// Minimum absolute weight prior to a reset to zero to be considered a tare
+	minTareChange = 1.0
+
+	// Maximum age of an event prior to the start of a brew to still be associated with it
+	maxAnnotationAge = 60 * time.Second
+
+	// MaxPumpLead denotes the maximum time between the start of the pump and the first drop
+	// of a brew
+	MaxPumpLead = 30 * time.Second
+
+	// Weight of the most recent brew when learning the offset between the start of the
+	// pump and the first drop
+	pumpOffsetLearningRate = 0.25
 
 	// DefaultSingleShotBeansWeight denotes the default weight of beans
 	// / grounds used for a single shot
@@ -28,13 +64,30 @@ const (
 	// DefaultDoubleShotBeansWeight denotes the default weight of beans
 	// / grounds used for a double shot
 	DefaultDoubleShotBeansWeight = 16.0
+)
+
+var (
 
-	// DefaultGrindSetting denotes the relative grinder setting
+	// DefaultGrinder denotes the grinder the default grind setting refers to
+	DefaultGrinder = grinder.MahlkoenigVario
+
+	// DefaultGrindSetting denotes the relative grinder setting (3B on the default grinder)
 	// 0.0: Fine
 	// 1.0: Coarse
-	DefaultGrindSetting = 0.208695652 // Mahlkönig Vario V2: (23*2 + 2) / 230 (3B setting)
+	DefaultGrindSetting = DefaultGrinder.MustNormalize("3B")
 )
 
+// step denotes an ongoing (not yet settled) step change of weight on the scale
+type step struct {
+	start       time.Time // Time of the first data point of the step
+	startWeight float64   // Weight right before the step
+	firstWeight float64   // Weight of the first data point of the step
+	brewIndex   int       // Number of brew data points right before the step (if tracking)
+	nDataPoints int       // Number of data points since the start of the step
+
+	stableBefore bool // The weight was stable prior to the step
+}
+
 // Scanner denotes a brew scanner that constantly analyzes weight data from a scale
 // and automatically creates / tracks brews
 type Scanner struct {
@@ -44,30 +97,53 @@ type Scanner struct {
 	dataChan    chan scale.DataPoint // The data channel to receive measurements on
 	dataBuf     *buffer.DataBuffer   // The ring buffer to keep the last n measurements
 	currentBrew *brew.Brew           // The currently ongoing brew process
+	lastBrew    *brew.Brew           // The most recently finished brew process
+
+	currentlyTrackingBrew bool              // Indicates if a brew is currently being tracked
+	currentStep           *step             // The currently ongoing step change of weight (if any)
+	pendingAnnotations    []brew.Annotation // Events detected while not tracking a brew
+	unit                  brew.Unit         // Unit reported by the scale for the most recent (valid) data point
+	rawUnit               string            // Raw unit reported by the scale for the most recent data point
 
 	expectedSingleShotWeight float64
 	expectedDoubleShotWeight float64
-	singleShotBeansWeight    float64
-	doubleShotBeansWeight    float64
-	grindSetting             float64
+
+	setup     Setup        // The setup currently used for brewing
+	setupMu   sync.RWMutex // Mutex protecting the setup (which can be switched at runtime)
+	brewSetup Setup        // The setup used for the currently ongoing brew process
+
+	inventory *inventory.Inventory // The bean inventory to deduct the dose of each brew from (optional)
+
+	startupBuzz int // Number of buzzes to signal on the scale once connected (e.g. due maintenance)
+
+	references map[string]brew.Reference // Reference curves per recipe to score brews against
+
+	compression curve.Compression // Compression of the data points of each brew prior to storage
+
+	pumpStarts      []pumpStart   // Signaled starts of the pump not yet associated with a brew
+	pumpOffset      time.Duration // (Learned) offset between the start of the pump and the first drop (0: unknown)
+	learnPumpOffset bool          // Learn the offset from brews with signaled start of the pump
+	pumpMu          sync.Mutex    // Mutex protecting the starts of the pump / offset (signaled at runtime)
+
+	tags          map[string]string // Additional tags to attach to all emitted data points
+	finishHandler func(*brew.Brew)  // Handler called for each successfully tracked brew
 
 	logger scale.Logger
 }
 
-// New initializes a new brew scanner instance
+// New initializes a new brew scanner instance (without scale, data can only be replayed
+// via Process)
 func New(s scale.Scale, influxDB *influx.DB, options ...func(*Scanner)) *Scanner {
 	scanner := &Scanner{
 		scale:    s,
 		dataBuf:  buffer.NewDataBuffer(1024),
 		dataChan: make(chan scale.DataPoint, defaultDataChanDepth),
 
-		expectedSingleShotWeight: defaultExpectedSingleShotWeight,
-		expectedDoubleShotWeight: defaultExpectedDoubleShotWeight,
+		expectedSingleShotWeight: DefaultExpectedSingleShotWeight,
+		expectedDoubleShotWeight: DefaultExpectedDoubleShotWeight,
 
-		singleShotBeansWeight: DefaultSingleShotBeansWeight,
-		doubleShotBeansWeight: DefaultDoubleShotBeansWeight,
-		grindSetting:          DefaultGrindSetting,
-		logger:                &scale.NullLogger{},
+		setup:  DefaultSetup(),
+		logger: &scale.NullLogger{},
 	}
 
 	if influxDB != nil {
@@ -88,114 +164,247 @@ func (s *Scanner) Run() error {
 	// Set the data channel
 	s.scale.SetDataChannel(s.dataChan)
 
-	var currentlyTrackingBrew bool
+	// Use presses of the button of the scale as start of the pump (if reported by the scale)
+	if bs, ok := s.scale.(ButtonScale); ok {
+		buttonChan := make(chan time.Time, 8)
+		bs.SetButtonChannel(buttonChan)
+		go func() {
+			for ts := range buttonChan {
+				s.PumpStarted(ts, brew.PumpStartButton)
+			}
+		}()
+	}
 
 	// Loop over channel and process each arriving data point
 	for dataPoint := range s.dataChan {
 
 		s.logger.Debugf("tracking data point %#v (Scale Battery Level: %.2f (raw %d)", dataPoint, s.scale.BatteryLevel(), s.scale.BatteryLevelRaw())
 
-		s.dataBuf.Append(dataPoint)
-		last5 := s.dataBuf.LastN(5)
-
-		if !currentlyTrackingBrew {
-			if lastNIncreasing(last5, 4) {
-				s.currentBrew = &brew.Brew{
-					ID:         uuid.New().String(),
-					Start:      last5[0].(scale.DataPoint).TimeStamp,
-					DataPoints: scale.DataPoints{last5[0].(scale.DataPoint), last5[1].(scale.DataPoint), last5[2].(scale.DataPoint), last5[3].(scale.DataPoint), last5[4].(scale.DataPoint)},
-				}
-				s.logger.Infof("starting tracking brew: %v", last5[0])
-				currentlyTrackingBrew = true
-			}
-		} else {
-			s.currentBrew.DataPoints = append(s.currentBrew.DataPoints, last5[4].(scale.DataPoint))
-			if lastNStatic(last5, 4, 0.05) {
-				s.currentBrew.End = last5[4].(scale.DataPoint).TimeStamp
-
-				if elapsed := s.currentBrew.End.Sub(s.currentBrew.Start); elapsed < minBrewTime {
-					s.logger.Warnf("brew time too short (%v), ignoring data points", elapsed)
-					currentlyTrackingBrew = false
-					continue
-				} else if elapsed > maxBrewTime {
-					s.logger.Warnf("brew time too long (%v), ignoring data points", elapsed)
-					currentlyTrackingBrew = false
-					continue
-				}
-
-				if math.Abs(s.expectedSingleShotWeight-last5[4].Value()) < math.Abs(s.expectedDoubleShotWeight-last5[4].Value()) {
-					s.currentBrew.ShotType = brew.SingleShot
-					s.scale.Buzz(1)
-				} else {
-					s.currentBrew.ShotType = brew.DoubleShot
-					s.scale.Buzz(2)
-				}
-
-				// If brew was successfully tracked, store data into InfluxDB
-				s.logger.Infof("finished tracking brew: %#v", s.currentBrew)
-				if s.influxDB != nil {
-
-					// Generate tags
-					tags := map[string]string{
-						"id":        s.currentBrew.ID,
-						"shot_type": s.currentBrew.ShotType.String(),
-					}
-
-					// Generate data points from brew data
-					var dataPoints db.DataPoints
-					for _, v := range s.currentBrew.DataPoints {
-						dataPoints = append(dataPoints, db.DataPoint{
-							TimeStamp: v.TimeStamp,
-							Tags:      tags,
-							Data: map[string]interface{}{
-								"unit":   v.Unit,
-								"weight": v.Weight,
-							},
-						})
-					}
-
-					// Define the weight of the beans / grounds used for the
-					// single  or double shot, respectively
-					beansWeight := s.doubleShotBeansWeight
-					if s.currentBrew.ShotType == brew.SingleShot {
-						beansWeight = s.singleShotBeansWeight
-					}
-
-					// Emit the summary to the influxDB
-					if s.influxDB != nil {
-						if err := s.influxDB.EmitDataPoints("brews", "summary", db.DataPoints{
-							{
-								TimeStamp: s.currentBrew.Start,
-								Tags:      tags,
-								Data: map[string]interface{}{
-									"start":         s.currentBrew.Start.Unix() * 1000,
-									"end":           s.currentBrew.End.Unix() * 1000,
-									"end_weight":    s.currentBrew.DataPoints[len(s.currentBrew.DataPoints)-1].Weight,
-									"unit":          s.currentBrew.DataPoints[len(s.currentBrew.DataPoints)-1].Unit,
-									"battery_level": s.scale.BatteryLevel(),
-									"beans_weight":  beansWeight,
-									"grind_setting": s.grindSetting,
-								},
-							},
-						}); err != nil {
-							s.logger.Errorf("failed to emit brew summary to influxDB: %s", err)
-						}
-
-						// Emit the data points to the influxDB
-						if err := s.influxDB.EmitDataPoints("brews", "brew", dataPoints); err != nil {
-							s.logger.Errorf("failed to emit brew data points to influxDB: %s", err)
-						}
-					}
-				}
-
-				currentlyTrackingBrew = false
+		// Signal on the scale once it is connected (i.e. the first data point arrives), if requested
+		if s.startupBuzz > 0 {
+			if err := s.scale.Buzz(s.startupBuzz); err != nil {
+				s.logger.Warnf("failed to signal on scale: %s", err)
 			}
+			s.startupBuzz = 0
 		}
+
+		s.Process(dataPoint)
 	}
 
 	return nil
 }
 
+// Process analyzes a single data point in the context of the preceding ones (called for each
+// data point received from the scale, can be used directly to replay recorded data)
+func (s *Scanner) Process(dataPoint scale.DataPoint) {
+
+	// Normalize the weight to the canonical unit prior to any detection / classification,
+	// flagging brews during which the unit reported by the scale changed
+	unit, err := brew.UnitFromString(dataPoint.Unit)
+	if err != nil {
+		if dataPoint.Unit != s.rawUnit {
+			s.logger.Warnf("ignoring data points: %s", err)
+		}
+		s.rawUnit = dataPoint.Unit
+		return
+	}
+	s.rawUnit = dataPoint.Unit
+	if s.unit != "" && unit != s.unit {
+		s.logger.Warnf("unit reported by scale changed from %s to %s", s.unit, unit)
+		if s.currentlyTrackingBrew {
+			s.currentBrew.UnitChanged = true
+		}
+	}
+	s.unit = unit
+	dataPoint.Weight, dataPoint.Unit = unit.ToCanonical(dataPoint.Weight), brew.CanonicalUnit.String()
+
+	s.dataBuf.Append(dataPoint)
+	last5 := s.dataBuf.LastN(5)
+
+	// Detect any manipulation of the scale (tare, cup placement / removal)
+	e, detected := s.detectEvent(last5)
+
+	if !s.currentlyTrackingBrew {
+		if detected {
+			s.handleIdleEvent(e)
+		}
+
+		// A brew can only start once the weight has settled and the increase
+		// is steady (i.e. not caused by a cup being placed on the scale)
+		if s.currentStep == nil && lastNIncreasing(last5, 4) && !lastNChangedBy(last5, 4, minStepChange) {
+			s.currentBrew = &brew.Brew{
+				ID:          uuid.New().String(),
+				Start:       last5[0].(scale.DataPoint).TimeStamp,
+				Baseline:    last5[0].Value(),
+				DataPoints:  scale.DataPoints{last5[0].(scale.DataPoint), last5[1].(scale.DataPoint), last5[2].(scale.DataPoint), last5[3].(scale.DataPoint), last5[4].(scale.DataPoint)},
+				Annotations: s.popPendingAnnotations(last5[0].(scale.DataPoint).TimeStamp),
+			}
+			s.brewSetup = s.Setup()
+			s.currentBrew.Metadata = s.brewSetup.Metadata
+			s.logger.Infof("starting tracking brew: %v", last5[0])
+			s.currentlyTrackingBrew = true
+		}
+
+		return
+	}
+
+	s.currentBrew.DataPoints = append(s.currentBrew.DataPoints, last5[4].(scale.DataPoint))
+
+	if detected {
+		s.currentBrew.Annotations = append(s.currentBrew.Annotations, e.Annotation)
+
+		switch e.Event {
+		case brew.CupRemovedEvent:
+
+			// Removing the cup is a strong signal for the end of the brew, hence all
+			// data points from the start of the removal onwards are discarded
+			s.logger.Infof("cup removed from scale, finishing brew")
+			s.currentBrew.DataPoints = s.currentBrew.DataPoints[:e.brewIndex]
+			s.finishBrew()
+			return
+		case brew.CupPlacedEvent:
+
+			// Placing a cup shortly after an assumed brew start means that the increase in
+			// weight was caused by the placement, not by actual flow
+			if elapsed := e.TimeStamp.Sub(s.currentBrew.Start); elapsed < minBrewTime {
+				s.logger.Infof("cup placed on scale shortly after start of brew (%v), ignoring data points", elapsed)
+				s.pendingAnnotations = append(s.pendingAnnotations, s.currentBrew.Annotations...)
+				s.currentlyTrackingBrew = false
+				return
+			}
+		case brew.TareEvent:
+			s.logger.Infof("scale tared during brew")
+		}
+	}
+
+	// Do not attempt to detect the end of the brew while the scale is being manipulated
+	if s.currentStep != nil {
+		return
+	}
+
+	if lastNStatic(last5, 4, 0.05) {
+		s.finishBrew()
+	}
+}
+
+// finishBrew concludes the currently tracked brew, classifies it and emits it to the
+// database (if configured)
+func (s *Scanner) finishBrew() {
+
+	s.currentlyTrackingBrew = false
+
+	if len(s.currentBrew.DataPoints) == 0 {
+		s.logger.Warnf("brew without data points, ignoring")
+		return
+	}
+
+	lastDataPoint := s.currentBrew.DataPoints[len(s.currentBrew.DataPoints)-1]
+	s.currentBrew.End = lastDataPoint.TimeStamp
+
+	if elapsed := s.currentBrew.End.Sub(s.currentBrew.Start); elapsed < minBrewTime {
+		s.logger.Warnf("brew time too short (%v), ignoring data points", elapsed)
+		return
+	} else if elapsed > maxBrewTime {
+		s.logger.Warnf("brew time too long (%v), ignoring data points", elapsed)
+		return
+	}
+
+	// Classify the brew based on its net yield (i.e. independent of whether a cup
+	// was placed on the scale without taring it)
+	yield := s.currentBrew.Yield()
+	s.currentBrew.ShotType = brew.Classify(yield, s.expectedSingleShotWeight, s.expectedDoubleShotWeight)
+	if s.scale != nil {
+		if s.currentBrew.ShotType == brew.SingleShot {
+			s.scale.Buzz(1)
+		} else {
+			s.scale.Buzz(2)
+		}
+	}
+	s.currentBrew.BeansWeight = s.brewSetup.BeansWeight(s.currentBrew.ShotType)
+	s.currentBrew.GrindSetting = s.brewSetup.GrindSetting
+	s.assignPumpStart()
+	s.scoreBrew()
+	s.lastBrew = s.currentBrew
+
+	// Deduct the dose from the active pack of beans (if an inventory is used)
+	if s.inventory != nil {
+		s.consumeBeans()
+	}
+
+	// If brew was successfully tracked, store data into InfluxDB
+	s.logger.Infof("finished tracking brew: %#v", s.currentBrew)
+	if s.influxDB != nil {
+		if err := store.New(s.influxDB, "brews", store.WithCompression(s.compression)).Save(s.entry(s.currentBrew)); err != nil {
+			s.logger.Errorf("failed to emit brew to influxDB: %s", err)
+		}
+	}
+
+	if s.finishHandler != nil {
+		s.finishHandler(s.currentBrew)
+	}
+}
+
+// emitAnnotations stores events associated with a brew in the database
+func (s *Scanner) emitAnnotations(b *brew.Brew, annotations ...brew.Annotation) {
+	if s.influxDB == nil || len(annotations) == 0 {
+		return
+	}
+
+	if err := store.New(s.influxDB, "brews").AddAnnotations(s.entry(b), annotations...); err != nil {
+		s.logger.Errorf("failed to emit brew annotations to influxDB: %s", err)
+	}
+}
+
+// entry generates the database entry of a brew, including any additional tags configured
+// for the scanner
+func (s *Scanner) entry(b *brew.Brew) store.Entry {
+	e := store.Entry{
+		Brew:   b,
+		Tags:   s.tags,
+		Fields: make(map[string]interface{}),
+	}
+	if s.scale != nil {
+		e.Fields["battery_level"] = s.scale.BatteryLevel()
+	}
+
+	return e
+}
+
+// scoreBrew compares the current brew to the reference curve of its recipe (if any)
+func (s *Scanner) scoreBrew() {
+
+	ref, exists := s.references[s.brewSetup.Recipe]
+	if !exists || s.brewSetup.Recipe == "" {
+		return
+	}
+
+	score, err := ref.Score(s.currentBrew)
+	if err != nil {
+		s.logger.Warnf("failed to score brew against reference %s: %s", ref.Name, err)
+		return
+	}
+	s.currentBrew.Score = &score
+	s.logger.Infof("scored brew against reference %s: %.1f (curve deviation: %.2f, yield error: %+.2f, time error: %+v)",
+		ref.Name, score.Score, score.CurveDeviation, score.YieldError, score.TimeError.Round(100*time.Millisecond))
+}
+
+// consumeBeans deducts the dose of the current brew from the active pack of beans and tags
+// the brew with it
+func (s *Scanner) consumeBeans() {
+
+	pack, err := s.inventory.Consume(s.brewSetup.BeansWeight(s.currentBrew.ShotType))
+	if err != nil {
+		s.logger.Warnf("failed to deduct beans from inventory: %s", err)
+		return
+	}
+	s.currentBrew.Pack = pack.ID
+	pack.Apply(&s.currentBrew.Metadata)
+
+	for _, warning := range s.inventory.Warnings(s.currentBrew.End) {
+		s.logger.Warnf("%s", warning)
+	}
+}
+
 func lastNIncreasing(data buffer.DataPoints, n int) bool {
 	return lastNIncreasingBy(data, n, 0.0)
 }
@@ -245,3 +454,49 @@ func lastNStatic(data buffer.DataPoints, n int, maxChange float64) bool {
 
 	return true
 }
+
+func lastNStable(data buffer.DataPoints, n int, maxChange float64) bool {
+
+	// Validate data buffer length is sufficient
+	if len(data) < n {
+		return false
+	}
+
+	for i := 0; i < n; i++ {
+
+		// Check if data point is valid
+		if data[i] == nil || data[i+1] == nil {
+			return false
+		}
+
+		// Check if data has changed (in any direction) from step i to i+1 by maxChange
+		if math.Abs(data[i+1].Value()-data[i].Value()) >= maxChange {
+			return false
+		}
+	}
+
+	return true
+}
+
+func lastNChangedBy(data buffer.DataPoints, n int, change float64) bool {
+
+	// Validate data buffer length is sufficient
+	if len(data) < n {
+		return false
+	}
+
+	for i := 0; i < n; i++ {
+
+		// Check if data point is valid
+		if data[i] == nil || data[i+1] == nil {
+			continue
+		}
+
+		// Check if data has changed (in any direction) from step i to i+1 by change
+		if math.Abs(data[i+1].Value()-data[i].Value()) >= change {
+			return true
+		}
+	}
+
+	return false
+}
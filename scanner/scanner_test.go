@@ -1,16 +1,43 @@
 package scanner
 
 import (
+	"math"
 	"testing"
 	"time"
 
 	"github.com/fako1024/brew"
 	"github.com/fako1024/brew/buffer"
+	"github.com/fako1024/brew/inventory"
 	"github.com/fako1024/btscale/pkg/mock"
 	"github.com/fako1024/btscale/pkg/scale"
 	jsoniter "github.com/json-iterator/go"
 )
 
+// feeder feeds synthetic data points (spaced evenly) to a scanner
+type feeder struct {
+	scanner *Scanner
+	ts      time.Time
+	weight  float64 // Current weight (in grams)
+}
+
+func newFeeder(scanner *Scanner) *feeder {
+	return &feeder{
+		scanner: scanner,
+		ts:      time.Date(2020, 9, 23, 11, 0, 0, 0, time.UTC),
+	}
+}
+
+// feed processes n data points, changing the weight by change (in grams) for each data point
+// and reporting it in the provided unit
+func (f *feeder) feed(n int, change float64, unit string) {
+	u, _ := brew.UnitFromString(unit)
+	for i := 0; i < n; i++ {
+		f.weight += change
+		f.ts = f.ts.Add(100 * time.Millisecond)
+		f.scanner.Process(scale.DataPoint{TimeStamp: f.ts, Unit: unit, Weight: u.FromCanonical(f.weight)})
+	}
+}
+
 func TestParseDataPoints(t *testing.T) {
 
 	var dataPoints scale.DataPoints
@@ -129,6 +156,385 @@ func TestScanDataPointsTable(t *testing.T) {
 	}
 }
 
+func TestScanAnnotationsTable(t *testing.T) {
+
+	testTable := []struct {
+		name                string
+		data                string
+		expectedAnnotations []brew.EventType
+	}{
+		{"standardBrewSingle1", standardBrewSingle1JSON, []brew.EventType{brew.CupPlacedEvent, brew.TareEvent}},
+		{"standardBrewSingle2", standardBrewSingle2JSON, []brew.EventType{brew.CupPlacedEvent, brew.TareEvent}},
+		{"standardBrewDouble1", standardBrewDouble1JSON, []brew.EventType{brew.CupPlacedEvent, brew.TareEvent}},
+		{"standardBrewDouble2", standardBrewDouble2JSON, []brew.EventType{brew.CupPlacedEvent, brew.TareEvent}},
+	}
+
+	for _, test := range testTable {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := mock.New()
+			if err != nil {
+				t.Fatalf("Failed to initialize mock scale: %s", err)
+			}
+
+			scanner := New(s, nil, WithExpectedSingleBrewShotWeight(45.), WithExpectedDoubleBrewShotWeight(90.))
+
+			var dataPoints scale.DataPoints
+			if err := jsoniter.Unmarshal([]byte(test.data), &dataPoints); err != nil {
+				t.Fatalf("Failed to parse JSON: %s", err)
+			}
+			for _, dataPoint := range dataPoints {
+				scanner.Process(dataPoint)
+			}
+
+			if scanner.currentBrew == nil {
+				t.Fatalf("No brew was detected")
+			}
+			if len(scanner.currentBrew.Annotations) != len(test.expectedAnnotations) {
+				t.Fatalf("Unexpected number of annotations, want %d, have %d", len(test.expectedAnnotations), len(scanner.currentBrew.Annotations))
+			}
+			for i, annotation := range scanner.currentBrew.Annotations {
+				if annotation.Event != test.expectedAnnotations[i] {
+					t.Fatalf("Unexpected annotation at position %d, want %s, have %s", i, test.expectedAnnotations[i], annotation.Event)
+				}
+			}
+		})
+	}
+}
+
+func TestScanCupRemovalAndTare(t *testing.T) {
+
+	s, err := mock.New()
+	if err != nil {
+		t.Fatalf("Failed to initialize mock scale: %s", err)
+	}
+	scanner := New(s, nil)
+
+	f := newFeeder(scanner)
+
+	// Idle, then place a cup (gradually) and tare the scale
+	f.feed(10, 0, "g")
+	f.feed(4, 50, "g")
+	f.feed(10, 0, "g")
+	f.feed(1, -f.weight, "g")
+	f.feed(10, 0, "g")
+	if scanner.currentlyTrackingBrew {
+		t.Fatalf("Unexpected brew tracking after placing cup on scale")
+	}
+
+	// Brew for 15 seconds, tare the scale early on and in between, then remove the cup (without waiting
+	// for the weight to become static)
+	f.feed(10, 0.3, "g")
+	f.feed(1, -f.weight, "g")
+	f.feed(90, 0.3, "g")
+	f.feed(1, -f.weight, "g")
+	f.feed(50, 0.3, "g")
+	if !scanner.currentlyTrackingBrew {
+		t.Fatalf("Unexpected end of brew tracking after tare")
+	}
+	f.feed(4, -100, "g")
+	f.feed(10, 0, "g")
+
+	if scanner.currentlyTrackingBrew {
+		t.Fatalf("Unexpected ongoing brew tracking after removal of cup")
+	}
+	if scanner.lastBrew == nil || scanner.lastBrew != scanner.currentBrew {
+		t.Fatalf("Brew was not finished successfully")
+	}
+	for _, dataPoint := range scanner.lastBrew.DataPoints {
+		if dataPoint.Weight < 0 {
+			t.Fatalf("Unexpected data point after removal of cup: %v", dataPoint)
+		}
+	}
+
+	if yield := scanner.lastBrew.Yield(); math.Abs(yield-45.) > 0.01 {
+		t.Fatalf("Unexpected yield after tare during brew, want %.2f, have %.2f", 45., yield)
+	}
+
+	expectedAnnotations := []brew.EventType{brew.CupPlacedEvent, brew.TareEvent, brew.TareEvent, brew.TareEvent, brew.CupRemovedEvent}
+	if len(scanner.lastBrew.Annotations) != len(expectedAnnotations) {
+		t.Fatalf("Unexpected annotations: %v", scanner.lastBrew.Annotations)
+	}
+	for i, annotation := range scanner.lastBrew.Annotations {
+		if annotation.Event != expectedAnnotations[i] {
+			t.Fatalf("Unexpected annotation at position %d, want %s, have %s", i, expectedAnnotations[i], annotation.Event)
+		}
+	}
+}
+
+func TestScanUntaredCup(t *testing.T) {
+
+	s, err := mock.New()
+	if err != nil {
+		t.Fatalf("Failed to initialize mock scale: %s", err)
+	}
+	scanner := New(s, nil)
+
+	f := newFeeder(scanner)
+
+	// Place a cup without taring the scale, then brew a single shot
+	f.feed(10, 0, "g")
+	f.feed(4, 50, "g")
+	f.feed(10, 0, "g")
+	f.feed(100, 0.3, "g")
+	f.feed(10, 0, "g")
+
+	if scanner.currentlyTrackingBrew || scanner.lastBrew == nil {
+		t.Fatalf("Brew was not finished successfully")
+	}
+	if scanner.lastBrew.Baseline != 200. {
+		t.Fatalf("Unexpected baseline weight, want %.2f, have %.2f", 200., scanner.lastBrew.Baseline)
+	}
+	if yield := scanner.lastBrew.Yield(); math.Abs(yield-30.) > 0.01 {
+		t.Fatalf("Unexpected yield, want %.2f, have %.2f", 30., yield)
+	}
+	if scanner.lastBrew.ShotType != brew.SingleShot {
+		t.Fatalf("Unexpected shot type, want %s, have %s", brew.SingleShot, scanner.lastBrew.ShotType)
+	}
+}
+
+func TestScanUntaredCupRemoval(t *testing.T) {
+
+	s, err := mock.New()
+	if err != nil {
+		t.Fatalf("Failed to initialize mock scale: %s", err)
+	}
+	var finished []*brew.Brew
+	scanner := New(s, nil, WithFinishHandler(func(b *brew.Brew) {
+		finished = append(finished, b)
+	}))
+
+	f := newFeeder(scanner)
+
+	// Place a cup without taring the scale, brew a single shot and lift the cup off the scale
+	// at once (resetting the weight to zero within a single data point, like a tare)
+	f.feed(10, 0, "g")
+	f.feed(4, 50, "g")
+	f.feed(10, 0, "g")
+	f.feed(100, 0.3, "g")
+	f.feed(10, 0, "g")
+	f.feed(1, -f.weight, "g")
+	f.feed(10, 0, "g")
+
+	if len(finished) != 1 {
+		t.Fatalf("Brew was not finished successfully")
+	}
+	annotations := finished[0].Annotations
+	if len(annotations) == 0 || annotations[len(annotations)-1].Event != brew.CupRemovedEvent || math.Abs(annotations[len(annotations)-1].Change+230.) > 0.01 {
+		t.Fatalf("Unexpected annotations after removal of untared cup: %v", annotations)
+	}
+	if len(scanner.pendingAnnotations) != 0 {
+		t.Fatalf("Unexpected pending annotations: %v", scanner.pendingAnnotations)
+	}
+}
+
+func TestSwitchSetup(t *testing.T) {
+
+	s, err := mock.New()
+	if err != nil {
+		t.Fatalf("Failed to initialize mock scale: %s", err)
+	}
+	scanner := New(s, nil, WithSetup(Setup{
+		Metadata: brew.Metadata{Setup: "house", Beans: "House Blend"},
+	}))
+
+	f := newFeeder(scanner)
+
+	// Switching the setup during a brew does not affect the brew being tracked
+	f.feed(10, 0, "g")
+	f.feed(50, 0.3, "g")
+	scanner.SetSetup(Setup{
+		Metadata: brew.Metadata{Setup: "guest", Beans: "Guest Roast"},
+	})
+	f.feed(50, 0.3, "g")
+	f.feed(10, 0, "g")
+
+	if scanner.currentlyTrackingBrew || scanner.lastBrew == nil {
+		t.Fatalf("Brew was not finished successfully")
+	}
+	if scanner.lastBrew.Metadata.Setup != "house" || scanner.lastBrew.Metadata.Beans != "House Blend" {
+		t.Fatalf("Unexpected metadata for brew: %#v", scanner.lastBrew.Metadata)
+	}
+	if setup := scanner.Setup(); setup.Metadata.Setup != "guest" {
+		t.Fatalf("Unexpected current setup, want %s, have %s", "guest", setup.Metadata.Setup)
+	}
+}
+
+func TestInventoryConsumption(t *testing.T) {
+
+	s, err := mock.New()
+	if err != nil {
+		t.Fatalf("Failed to initialize mock scale: %s", err)
+	}
+	inv, err := inventory.New()
+	if err != nil {
+		t.Fatalf("Failed to initialize inventory: %s", err)
+	}
+	pack, err := inv.Register(inventory.Pack{Name: "House Blend", Roaster: "Local Roasters", Weight: 250.})
+	if err != nil {
+		t.Fatalf("Failed to register pack: %s", err)
+	}
+	scanner := New(s, nil, WithInventory(inv), WithSetup(DefaultSetup()))
+
+	f := newFeeder(scanner)
+	f.feed(10, 0, "g")
+	f.feed(100, 0.3, "g")
+	f.feed(10, 0, "g")
+
+	if scanner.lastBrew == nil {
+		t.Fatalf("Brew was not finished successfully")
+	}
+	if scanner.lastBrew.Pack != pack.ID || scanner.lastBrew.Metadata.Beans != pack.Name || scanner.lastBrew.Metadata.Roaster != pack.Roaster {
+		t.Fatalf("Brew not associated with active pack: %#v", scanner.lastBrew)
+	}
+	active, err := inv.Active()
+	if err != nil {
+		t.Fatalf("Failed to get active pack: %s", err)
+	}
+	if expected := pack.Weight - DefaultSingleShotBeansWeight; active.Remaining != expected || active.NBrews != 1 {
+		t.Fatalf("Unexpected remaining beans, want %.2f, have %.2f", expected, active.Remaining)
+	}
+}
+
+func TestScoreAgainstReference(t *testing.T) {
+
+	s, err := mock.New()
+	if err != nil {
+		t.Fatalf("Failed to initialize mock scale: %s", err)
+	}
+	ref, err := brew.ParametricReference("espresso", 0, 10*time.Second, 30.)
+	if err != nil {
+		t.Fatalf("Failed to generate reference: %s", err)
+	}
+	var finished *brew.Brew
+	scanner := New(s, nil, WithReferences(map[string]brew.Reference{"espresso": ref}), WithSetup(Setup{
+		Metadata: brew.Metadata{Recipe: "espresso"},
+	}), WithFinishHandler(func(b *brew.Brew) {
+		finished = b
+	}))
+
+	f := newFeeder(scanner)
+	f.feed(10, 0, "g")
+	f.feed(100, 0.3, "g")
+	f.feed(10, 0, "g")
+
+	if finished == nil || finished.Score == nil {
+		t.Fatalf("Brew was not scored: %#v", finished)
+	}
+	if finished.Score.Reference != "espresso" || finished.Score.Score < 80. || finished.Score.CurveDeviation > 2. {
+		t.Fatalf("Unexpected score of brew closely following the reference: %#v", finished.Score)
+	}
+}
+
+func TestUnitNormalization(t *testing.T) {
+
+	s, err := mock.New()
+	if err != nil {
+		t.Fatalf("Failed to initialize mock scale: %s", err)
+	}
+	var finished []*brew.Brew
+	scanner := New(s, nil, WithFinishHandler(func(b *brew.Brew) {
+		finished = append(finished, b)
+	}))
+
+	// Weights reported in ounces are classified / stored in grams
+	f := newFeeder(scanner)
+	f.feed(10, 0, "oz")
+	f.feed(100, 0.3, "oz")
+	f.feed(10, 0, "oz")
+
+	if len(finished) != 1 || finished[0].ShotType != brew.SingleShot || math.Abs(finished[0].Yield()-30.) > 0.5 || finished[0].UnitChanged {
+		t.Fatalf("Unexpected brew: %#v", finished)
+	}
+	if unit := finished[0].DataPoints[0].Unit; unit != "g" {
+		t.Fatalf("Unexpected unit of data points: %s", unit)
+	}
+
+	// Changing the unit during a brew is flagged (the weights being normalized regardless)
+	f.weight = 0.
+	f.feed(10, 0, "g")
+	f.feed(50, 0.6, "g")
+	f.feed(50, 0.6, "oz")
+	f.feed(10, 0, "oz")
+	if len(finished) != 2 || !finished[1].UnitChanged || finished[1].ShotType != brew.DoubleShot {
+		t.Fatalf("Unexpected brew after unit change: %#v", finished[len(finished)-1])
+	}
+}
+
+func TestPumpStart(t *testing.T) {
+
+	s, err := mock.New()
+	if err != nil {
+		t.Fatalf("Failed to initialize mock scale: %s", err)
+	}
+	var finished []*brew.Brew
+	scanner := New(s, nil, WithPumpOffsetLearning(), WithFinishHandler(func(b *brew.Brew) {
+		finished = append(finished, b)
+	}))
+
+	f := newFeeder(scanner)
+
+	// A start of the pump signaled prior to the first drop is associated with the brew (and
+	// its offset learned)
+	f.feed(10, 0, "g")
+	scanner.PumpStarted(f.ts, brew.PumpStartAPI)
+	pumpStart := f.ts
+	f.feed(40, 0, "g")
+	f.feed(100, 0.3, "g")
+	f.feed(10, 0, "g")
+	if len(finished) != 1 || !finished[0].PumpStart.Equal(pumpStart) || finished[0].PumpStartSource != brew.PumpStartAPI {
+		t.Fatalf("Unexpected brew: %#v", finished)
+	}
+	offset := finished[0].Start.Sub(pumpStart)
+	if offset < 4*time.Second || finished[0].PumpTime() != finished[0].FlowTime()+offset || scanner.PumpOffset() != offset {
+		t.Fatalf("Unexpected pump / flow time: %v / %v (learned offset: %v)", finished[0].PumpTime(), finished[0].FlowTime(), scanner.PumpOffset())
+	}
+
+	// Without (recent) signal, the start of the pump is estimated from the learned offset
+	f.weight = 0.
+	scanner.PumpStarted(f.ts, brew.PumpStartAPI)
+	f.feed(400, 0, "g")
+	f.feed(100, 0.3, "g")
+	f.feed(10, 0, "g")
+	if len(finished) != 2 || finished[1].PumpStartSource != brew.PumpStartOffset || finished[1].Start.Sub(finished[1].PumpStart) != offset {
+		t.Fatalf("Unexpected brew without signaled start of pump: %#v", finished[len(finished)-1])
+	}
+}
+
+func TestRedetect(t *testing.T) {
+
+	var dataPoints scale.DataPoints
+	if err := jsoniter.Unmarshal([]byte(standardBrewSingle2JSON), &dataPoints); err != nil {
+		t.Fatalf("Failed to parse JSON: %s", err)
+	}
+
+	s, err := mock.New()
+	if err != nil {
+		t.Fatalf("Failed to initialize mock scale: %s", err)
+	}
+	var stored *brew.Brew
+	scan := New(s, nil, WithExpectedSingleBrewShotWeight(45.), WithExpectedDoubleBrewShotWeight(90.), WithFinishHandler(func(b *brew.Brew) {
+		stored = b
+	}))
+	for _, dataPoint := range dataPoints {
+		scan.Process(dataPoint)
+	}
+	if stored == nil || stored.ShotType != brew.SingleShot {
+		t.Fatalf("Unexpected stored brew: %v", stored)
+	}
+
+	// Re-running the detection with a lower expected yield changes the classification only
+	detected, err := Redetect(stored, WithExpectedSingleBrewShotWeight(20.), WithExpectedDoubleBrewShotWeight(50.))
+	if err != nil {
+		t.Fatalf("Failed to re-run detection: %s", err)
+	}
+	if len(detected) != 1 {
+		t.Fatalf("Unexpected number of detected brews: %d", len(detected))
+	}
+	if detected[0].ShotType != brew.DoubleShot || !detected[0].Start.Equal(stored.Start) || !detected[0].End.Equal(stored.End) {
+		t.Fatalf("Unexpected re-detected brew: %s, %v - %v (stored: %v - %v)", detected[0].ShotType, detected[0].Start, detected[0].End, stored.Start, stored.End)
+	}
+}
+
 //////////////////////
 
 func BenchmarkLastNIncreasing(b *testing.B) {
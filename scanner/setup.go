@@ -0,0 +1,47 @@
+package scanner
+
+import "github.com/fako1024/brew"
+
+// Setup denotes the setup currently used for brewing, applied to each tracked brew
+type Setup struct {
+	brew.Metadata
+
+	BeansWeightSingle float64 // Weight of the beans / grounds used for a single shot
+	BeansWeightDouble float64 // Weight of the beans / grounds used for a double shot
+	GrindSetting      float64 // Relative grinder setting (0.0: finest, 1.0: coarsest)
+}
+
+// DefaultSetup returns the default setup
+func DefaultSetup() Setup {
+	return Setup{
+		BeansWeightSingle: DefaultSingleShotBeansWeight,
+		BeansWeightDouble: DefaultDoubleShotBeansWeight,
+		GrindSetting:      DefaultGrindSetting,
+	}
+}
+
+// BeansWeight returns the weight of the beans / grounds used for the given shot type
+func (s Setup) BeansWeight(shotType brew.ShotType) float64 {
+	if shotType == brew.SingleShot {
+		return s.BeansWeightSingle
+	}
+	return s.BeansWeightDouble
+}
+
+// Setup returns the setup currently used for brewing
+func (s *Scanner) Setup() Setup {
+	s.setupMu.RLock()
+	defer s.setupMu.RUnlock()
+
+	return s.setup
+}
+
+// SetSetup switches the setup used for brewing (at runtime). Brews that are currently
+// being tracked retain the setup that was active when they started
+func (s *Scanner) SetSetup(setup Setup) {
+	s.setupMu.Lock()
+	defer s.setupMu.Unlock()
+
+	s.logger.Infof("switching setup to `%s`", setup.Metadata.Setup)
+	s.setup = setup
+}
@@ -0,0 +1,273 @@
+package brew
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+
+	// referenceResolution denotes the interval at which curves are resampled for comparison
+	referenceResolution = 500 * time.Millisecond
+
+	// Weights of the individual (relative) errors in the overall score
+	curveErrorWeight = 0.5
+	yieldErrorWeight = 0.25
+	timeErrorWeight  = 0.25
+
+	// scorePenalty denotes the penalty factor applied to the weighted relative error, i.e. an
+	// overall relative error of 10% yields a score of 80
+	scorePenalty = 2.
+)
+
+// scoreFields denotes the names of all database fields representing the score
+var scoreFields = map[string]struct{}{
+	"score": {}, "score_reference": {}, "score_curve_deviation": {}, "score_yield_error": {}, "score_time_error": {},
+}
+
+// IsScoreField returns if a database field represents the score of a brew
+func IsScoreField(name string) bool {
+	_, exists := scoreFields[name]
+	return exists
+}
+
+// ReferencePoint denotes a single point of a reference curve
+type ReferencePoint struct {
+	Offset time.Duration // Time since the start of the brew
+	Weight float64       // Net weight at that time
+}
+
+// Reference denotes a reference ("golden") curve for a recipe, to which brews are compared
+type Reference struct {
+	Name  string           // Name of the reference (e.g. the ID of the brew it was taken from)
+	Curve []ReferencePoint // Net weight over time (in chronological order)
+}
+
+// Score denotes the quality of a brew compared to a reference curve
+type Score struct {
+	Reference      string        // Name of the reference the brew was compared to
+	Score          float64       // Overall score between 0 (no resemblance) and 100 (identical)
+	CurveDeviation float64       // Root mean square deviation of the curves after time alignment
+	YieldError     float64       // Difference in yield (positive: more than the reference)
+	TimeError      time.Duration // Difference in duration (positive: longer than the reference)
+}
+
+// ReferenceFromBrew generates a reference curve from a (stored) brew
+func ReferenceFromBrew(b *Brew) (Reference, error) {
+
+	ref := Reference{Name: b.ID}
+	for _, dataPoint := range b.NetDataPoints() {
+		if dataPoint.TimeStamp.Before(b.Start) || dataPoint.TimeStamp.After(b.End) {
+			continue
+		}
+		ref.Curve = append(ref.Curve, ReferencePoint{
+			Offset: dataPoint.TimeStamp.Sub(b.Start),
+			Weight: dataPoint.Weight,
+		})
+	}
+
+	return ref, ref.validate()
+}
+
+// ParametricReference generates a reference curve from a recipe definition: no flow during
+// pre-infusion, followed by a constant flow until the yield is reached after the duration
+func ParametricReference(name string, preInfusion, duration time.Duration, yield float64) (Reference, error) {
+
+	if duration <= 0 || yield <= 0. {
+		return Reference{}, errors.New("duration and yield must be positive")
+	}
+	if preInfusion < 0 || preInfusion >= duration {
+		return Reference{}, fmt.Errorf("pre-infusion (%v) must be shorter than the duration (%v)", preInfusion, duration)
+	}
+
+	ref := Reference{Name: name}
+	for offset := time.Duration(0); ; offset += referenceResolution {
+		if offset > duration {
+			offset = duration
+		}
+		weight := 0.
+		if offset > preInfusion {
+			weight = yield * float64(offset-preInfusion) / float64(duration-preInfusion)
+		}
+		ref.Curve = append(ref.Curve, ReferencePoint{Offset: offset, Weight: weight})
+		if offset == duration {
+			break
+		}
+	}
+
+	return ref, nil
+}
+
+// Yield returns the final weight of the reference curve
+func (r Reference) Yield() float64 {
+	if len(r.Curve) == 0 {
+		return 0.
+	}
+	return r.Curve[len(r.Curve)-1].Weight
+}
+
+// Duration returns the duration of the reference curve
+func (r Reference) Duration() time.Duration {
+	if len(r.Curve) == 0 {
+		return 0
+	}
+	return r.Curve[len(r.Curve)-1].Offset
+}
+
+// Score compares a brew to the reference curve. The curves are aligned in time via dynamic
+// time warping (DTW) before determining their deviation, hence a brew running slightly
+// faster / slower than the reference is penalized via its time error only
+func (r Reference) Score(b *Brew) (Score, error) {
+
+	if err := r.validate(); err != nil {
+		return Score{}, err
+	}
+	actual, err := ReferenceFromBrew(b)
+	if err != nil {
+		return Score{}, err
+	}
+
+	s := Score{
+		Reference:      r.Name,
+		CurveDeviation: dtw(r.resample(), actual.resample()),
+		YieldError:     b.Yield() - r.Yield(),
+		TimeError:      b.End.Sub(b.Start) - r.Duration(),
+	}
+
+	relativeError := curveErrorWeight*s.CurveDeviation/r.Yield() +
+		yieldErrorWeight*math.Abs(s.YieldError)/r.Yield() +
+		timeErrorWeight*math.Abs(s.TimeError.Seconds())/r.Duration().Seconds()
+	s.Score = math.Round(math.Max(0., 100.*(1.-scorePenalty*relativeError))*10) / 10
+
+	return s, nil
+}
+
+// Fields returns the score as a set of database fields
+func (s Score) Fields() map[string]interface{} {
+	return map[string]interface{}{
+		"score":                 s.Score,
+		"score_reference":       s.Reference,
+		"score_curve_deviation": s.CurveDeviation,
+		"score_yield_error":     s.YieldError,
+		"score_time_error":      s.TimeError.Seconds(),
+	}
+}
+
+// ScoreFromFields parses a score from a set of database fields (returning nil if the fields
+// do not contain a score)
+func ScoreFromFields(fields map[string]interface{}) *Score {
+
+	score, exists := floatField(fields, "score")
+	if !exists {
+		return nil
+	}
+	s := &Score{Score: score}
+	if reference, exists := fields["score_reference"]; exists && reference != nil {
+		s.Reference = fmt.Sprint(reference)
+	}
+	s.CurveDeviation, _ = floatField(fields, "score_curve_deviation")
+	s.YieldError, _ = floatField(fields, "score_yield_error")
+	if timeError, exists := floatField(fields, "score_time_error"); exists {
+		s.TimeError = time.Duration(timeError * float64(time.Second))
+	}
+
+	return s
+}
+
+func (r Reference) validate() error {
+	if len(r.Curve) < 2 {
+		return errors.New("reference curve requires at least two points")
+	}
+	if r.Yield() <= 0. || r.Duration() <= 0 {
+		return errors.New("reference curve requires a positive yield and duration")
+	}
+	for i := 1; i < len(r.Curve); i++ {
+		if r.Curve[i].Offset < r.Curve[i-1].Offset {
+			return errors.New("reference curve not in chronological order")
+		}
+	}
+	return nil
+}
+
+// resample returns the weights of the curve at a fixed resolution (interpolating linearly
+// between points)
+func (r Reference) resample() []float64 {
+
+	weights := make([]float64, 0, int(r.Duration()/referenceResolution)+1)
+	idx := 0
+	for offset := time.Duration(0); offset <= r.Duration(); offset += referenceResolution {
+		for idx < len(r.Curve)-1 && r.Curve[idx+1].Offset < offset {
+			idx++
+		}
+		switch {
+		case offset <= r.Curve[0].Offset:
+			weights = append(weights, r.Curve[0].Weight)
+		case idx == len(r.Curve)-1:
+			weights = append(weights, r.Curve[idx].Weight)
+		default:
+			p, q := r.Curve[idx], r.Curve[idx+1]
+			frac := 0.
+			if q.Offset > p.Offset {
+				frac = float64(offset-p.Offset) / float64(q.Offset-p.Offset)
+			}
+			weights = append(weights, p.Weight+frac*(q.Weight-p.Weight))
+		}
+	}
+
+	return weights
+}
+
+// dtw returns the root mean square deviation of two series along their optimal alignment
+// (dynamic time warping)
+func dtw(a, b []float64) float64 {
+
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return 0.
+	}
+
+	// cost[i][j] denotes the minimal cumulative squared deviation aligning a[:i+1] and b[:j+1],
+	// steps[i][j] the length of the corresponding path
+	cost := make([][]float64, n)
+	steps := make([][]int, n)
+	for i := range cost {
+		cost[i] = make([]float64, m)
+		steps[i] = make([]int, m)
+		for j := range cost[i] {
+			d := (a[i] - b[j]) * (a[i] - b[j])
+			switch {
+			case i == 0 && j == 0:
+				cost[i][j], steps[i][j] = d, 1
+			case i == 0:
+				cost[i][j], steps[i][j] = cost[i][j-1]+d, steps[i][j-1]+1
+			case j == 0:
+				cost[i][j], steps[i][j] = cost[i-1][j]+d, steps[i-1][j]+1
+			default:
+				pi, pj := i-1, j-1
+				if cost[i-1][j] < cost[pi][pj] {
+					pi, pj = i-1, j
+				}
+				if cost[i][j-1] < cost[pi][pj] {
+					pi, pj = i, j-1
+				}
+				cost[i][j], steps[i][j] = cost[pi][pj]+d, steps[pi][pj]+1
+			}
+		}
+	}
+
+	return math.Sqrt(cost[n-1][m-1] / float64(steps[n-1][m-1]))
+}
+
+func floatField(fields map[string]interface{}, name string) (float64, bool) {
+	switch t := fields[name].(type) {
+	case float64:
+		return t, true
+	case fmt.Stringer:
+		var f float64
+		_, err := fmt.Sscan(t.String(), &f)
+		return f, err == nil
+	}
+	return 0., false
+}
@@ -0,0 +1,71 @@
+package brew
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/fako1024/btscale/pkg/scale"
+)
+
+func testCurve(start time.Time, preInfusion, duration time.Duration, yield float64) *Brew {
+	b := &Brew{ID: "test", Start: start, End: start.Add(duration)}
+	for offset := time.Duration(0); offset <= duration; offset += 200 * time.Millisecond {
+		weight := 0.
+		if offset > preInfusion {
+			weight = yield * float64(offset-preInfusion) / float64(duration-preInfusion)
+		}
+		b.DataPoints = append(b.DataPoints, scale.DataPoint{TimeStamp: start.Add(offset), Weight: weight, Unit: "g"})
+	}
+	return b
+}
+
+func TestScore(t *testing.T) {
+
+	start := time.Date(2020, 9, 23, 11, 0, 0, 0, time.UTC)
+	ref, err := ParametricReference("espresso", 5*time.Second, 30*time.Second, 36.)
+	if err != nil {
+		t.Fatalf("Failed to generate reference: %s", err)
+	}
+
+	// A brew identical to the reference scores perfectly
+	perfect, err := ref.Score(testCurve(start, 5*time.Second, 30*time.Second, 36.))
+	if err != nil {
+		t.Fatalf("Failed to score brew: %s", err)
+	}
+	if perfect.Score != 100. || perfect.CurveDeviation > 1e-9 || perfect.YieldError != 0. || perfect.TimeError != 0 {
+		t.Fatalf("Unexpected score of perfect brew: %#v", perfect)
+	}
+
+	// A brew following the same curve more slowly is penalized via its time error, whereas
+	// a brew deviating from the curve is penalized via its curve deviation
+	slow, _ := ref.Score(testCurve(start, 6*time.Second, 36*time.Second, 36.))
+	if slow.TimeError != 6*time.Second || slow.CurveDeviation > 1. || slow.Score >= perfect.Score {
+		t.Fatalf("Unexpected score of slow brew: %#v", slow)
+	}
+	gusher, _ := ref.Score(testCurve(start, 0, 30*time.Second, 50.))
+	if math.Abs(gusher.YieldError-14.) > 1e-9 || gusher.CurveDeviation < 2. || gusher.Score >= slow.Score {
+		t.Fatalf("Unexpected score of gusher: %#v", gusher)
+	}
+
+	// References can be taken from stored brews and the score round-trips via database fields
+	stored, err := ReferenceFromBrew(testCurve(start, 5*time.Second, 30*time.Second, 36.))
+	if err != nil {
+		t.Fatalf("Failed to generate reference from brew: %s", err)
+	}
+	if s, _ := stored.Score(testCurve(start, 5*time.Second, 30*time.Second, 36.)); s.Score != 100. {
+		t.Fatalf("Unexpected score against stored reference: %#v", s)
+	}
+	if parsed := ScoreFromFields(slow.Fields()); parsed == nil || *parsed != slow {
+		t.Fatalf("Unexpected score parsed from fields:\nwant %#v\nhave %#v", slow, parsed)
+	}
+	if ScoreFromFields(map[string]interface{}{}) != nil {
+		t.Fatalf("Expected no score for fields without score")
+	}
+
+	for _, invalid := range [][]time.Duration{{0, 0}, {30 * time.Second, 30 * time.Second}, {-time.Second, 30 * time.Second}} {
+		if _, err := ParametricReference("invalid", invalid[0], invalid[1], 36.); err == nil {
+			t.Fatalf("Expected error for invalid reference %v", invalid)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package shotfile
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/fako1024/brew"
+)
+
+// beanconquerorQuantityGrams denotes the Beanconqueror quantity type representing grams
+const beanconquerorQuantityGrams = "GR"
+
+// beanconquerorBrew denotes a brew as exported by Beanconqueror. Beanconqueror stores the
+// flow profile in a separate file, it is embedded here to keep each shot self-contained
+type beanconquerorBrew struct {
+	Config                   beanconquerorConfig   `json:"config"`
+	GrindSize                string                `json:"grind_size"`
+	GrindWeight              float64               `json:"grind_weight"`
+	BrewTime                 float64               `json:"brew_time"`
+	BrewBeverageQuantity     float64               `json:"brew_beverage_quantity"`
+	BrewBeverageQuantityType string                `json:"brew_beverage_quantity_type"`
+	BrewTemperature          float64               `json:"brew_temperature,omitempty"`
+	Note                     string                `json:"note,omitempty"`
+	FlowProfile              *beanconquerorProfile `json:"flow_profile,omitempty"`
+}
+
+type beanconquerorConfig struct {
+	UUID          string `json:"uuid"`
+	UnixTimestamp int64  `json:"unix_timestamp"`
+}
+
+type beanconquerorProfile struct {
+	Weight       []beanconquerorWeight `json:"weight"`
+	RealtimeFlow []beanconquerorFlow   `json:"realtimeFlow"`
+}
+
+type beanconquerorWeight struct {
+	Timestamp            string  `json:"timestamp"`
+	BrewTime             string  `json:"brew_time"`
+	ActualWeight         float64 `json:"actual_weight"`
+	OldWeight            float64 `json:"old_weight"`
+	ActualSmoothedWeight float64 `json:"actual_smoothed_weight"`
+	OldSmoothedWeight    float64 `json:"old_smoothed_weight"`
+	NotMutatedWeight     float64 `json:"not_mutated_weight"`
+}
+
+type beanconquerorFlow struct {
+	Timestamp      string  `json:"timestamp"`
+	BrewTime       string  `json:"brew_time"`
+	FlowValue      float64 `json:"flow_value"`
+	SmoothedWeight float64 `json:"smoothed_weight"`
+	TimestampDelta int64   `json:"timestampdelta"`
+}
+
+func beanconquerorFromBrew(b *brew.Brew) beanconquerorBrew {
+
+	netDataPoints := b.NetDataPoints()
+	flow := flowRates(netDataPoints)
+
+	profile := &beanconquerorProfile{
+		Weight:       make([]beanconquerorWeight, 0, len(netDataPoints)),
+		RealtimeFlow: make([]beanconquerorFlow, 0, len(netDataPoints)),
+	}
+	for i, dataPoint := range netDataPoints {
+		timestamp := dataPoint.TimeStamp.Format("15:04:05.000")
+		brewTime := strconv.FormatFloat(dataPoint.TimeStamp.Sub(b.Start).Seconds(), 'f', 3, 64)
+		oldWeight, delta := 0., int64(0)
+		if i > 0 {
+			oldWeight = netDataPoints[i-1].Weight
+			delta = dataPoint.TimeStamp.Sub(netDataPoints[i-1].TimeStamp).Milliseconds()
+		}
+		profile.Weight = append(profile.Weight, beanconquerorWeight{
+			Timestamp:            timestamp,
+			BrewTime:             brewTime,
+			ActualWeight:         dataPoint.Weight,
+			OldWeight:            oldWeight,
+			ActualSmoothedWeight: dataPoint.Weight,
+			OldSmoothedWeight:    oldWeight,
+			NotMutatedWeight:     dataPoint.Weight,
+		})
+		profile.RealtimeFlow = append(profile.RealtimeFlow, beanconquerorFlow{
+			Timestamp:      timestamp,
+			BrewTime:       brewTime,
+			FlowValue:      flow[i],
+			SmoothedWeight: dataPoint.Weight,
+			TimestampDelta: delta,
+		})
+	}
+
+	return beanconquerorBrew{
+		Config: beanconquerorConfig{
+			UUID:          b.ID,
+			UnixTimestamp: b.Start.Unix(),
+		},
+		GrindSize:                b.Metadata.GrinderSetting,
+		GrindWeight:              b.BeansWeight,
+		BrewTime:                 b.End.Sub(b.Start).Seconds(),
+		BrewBeverageQuantity:     round(b.Yield()),
+		BrewBeverageQuantityType: beanconquerorQuantityGrams,
+		BrewTemperature:          b.Metadata.WaterTemperature,
+		Note:                     b.Metadata.Recipe,
+		FlowProfile:              profile,
+	}
+}
+
+func (bc beanconquerorBrew) brew() (*brew.Brew, error) {
+
+	if bc.Config.UnixTimestamp <= 0 {
+		return nil, errors.New("missing time stamp")
+	}
+	if bc.BrewBeverageQuantityType != "" && bc.BrewBeverageQuantityType != beanconquerorQuantityGrams {
+		return nil, fmt.Errorf("unsupported beverage quantity type %q", bc.BrewBeverageQuantityType)
+	}
+	if bc.FlowProfile == nil {
+		return nil, errors.New("missing flow profile")
+	}
+
+	start := time.Unix(bc.Config.UnixTimestamp, 0)
+	offsets := make([]float64, 0, len(bc.FlowProfile.Weight))
+	weights := make([]float64, 0, len(bc.FlowProfile.Weight))
+	for _, w := range bc.FlowProfile.Weight {
+		offset, err := strconv.ParseFloat(w.BrewTime, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid brew time %q", w.BrewTime)
+		}
+		offsets = append(offsets, offset)
+		weights = append(weights, w.ActualWeight)
+	}
+	dataPoints, err := dataPointsFromSeries(start, offsets, weights)
+	if err != nil {
+		return nil, err
+	}
+
+	end := start.Add(time.Duration(bc.BrewTime * float64(time.Second)))
+	if bc.BrewTime <= 0. {
+		end = dataPoints[len(dataPoints)-1].TimeStamp
+	}
+
+	return &brew.Brew{
+		ID:          bc.Config.UUID,
+		Start:       start,
+		End:         end,
+		DataPoints:  dataPoints,
+		BeansWeight: bc.GrindWeight,
+		Metadata: brew.Metadata{
+			GrinderSetting:   bc.GrindSize,
+			WaterTemperature: bc.BrewTemperature,
+			Recipe:           bc.Note,
+		},
+	}, nil
+}
@@ -0,0 +1,195 @@
+// Package shotfile converts brews to / from the shot file formats of third-party apps
+// (Beanconqueror and visualizer.coffee) and the native JSON representation of brews
+package shotfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/fako1024/brew"
+	"github.com/fako1024/brew/archive"
+	"github.com/fako1024/brew/curve"
+	"github.com/fako1024/brew/store"
+	"github.com/fako1024/btscale/pkg/scale"
+)
+
+// Format denotes a shot file format
+type Format string
+
+const (
+
+	// Beanconqueror denotes the brew format of Beanconqueror (with embedded flow profile)
+	Beanconqueror Format = "beanconqueror"
+
+	// Visualizer denotes the (Decent v2) shot format accepted by visualizer.coffee
+	Visualizer Format = "visualizer"
+
+	// Native denotes the (lossless) versioned JSON representation of brews (see brew.JSONVersion)
+	Native Format = "brew"
+)
+
+// appName denotes the name of this application as stated in exported shot files
+const appName = "brew"
+
+// Formats denotes all supported shot file formats
+var Formats = []Format{Beanconqueror, Visualizer, Native}
+
+// FormatFromString allows to generate a Format from a string
+func FormatFromString(f string) (Format, error) {
+	for _, format := range Formats {
+		if string(format) == f {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported shot file format %q (supported: %s, %s, %s)", f, Beanconqueror, Visualizer, Native)
+}
+
+// Options denotes the options for reading shot files
+type Options struct {
+
+	// Expected yields of single / double shots, used to classify brews without shot type
+	ExpectedSingleShotWeight float64
+	ExpectedDoubleShotWeight float64
+}
+
+// Marshal converts brews to a shot file (a single shot if exactly one brew is provided, a
+// list of shots otherwise)
+func (f Format) Marshal(brews ...*brew.Brew) ([]byte, error) {
+
+	shots := make([]interface{}, 0, len(brews))
+	for _, b := range brews {
+		if len(b.DataPoints) == 0 {
+			return nil, fmt.Errorf("brew %s has no data points", b.ID)
+		}
+		switch f {
+		case Beanconqueror:
+			shots = append(shots, beanconquerorFromBrew(b))
+		case Visualizer:
+			shots = append(shots, visualizerFromBrew(b))
+		case Native:
+			shots = append(shots, b)
+		default:
+			return nil, fmt.Errorf("unsupported shot file format %q", f)
+		}
+	}
+
+	if len(shots) == 1 {
+		return json.MarshalIndent(shots[0], "", "  ")
+	}
+	return json.MarshalIndent(shots, "", "  ")
+}
+
+// Unmarshal reads brews from a shot file (containing either a single shot or a list of shots)
+func (f Format) Unmarshal(data []byte, opts Options) ([]*brew.Brew, error) {
+
+	var raw []json.RawMessage
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &raw); err != nil {
+			return nil, err
+		}
+	} else {
+		raw = []json.RawMessage{data}
+	}
+
+	brews := make([]*brew.Brew, 0, len(raw))
+	for i, shot := range raw {
+		var (
+			b   *brew.Brew
+			err error
+		)
+		switch f {
+		case Beanconqueror:
+			var bc beanconquerorBrew
+			if err = json.Unmarshal(shot, &bc); err == nil {
+				b, err = bc.brew()
+			}
+		case Visualizer:
+			var v visualizerShot
+			if err = json.Unmarshal(shot, &v); err == nil {
+				b, err = v.brew()
+			}
+		case Native:
+			b = new(brew.Brew)
+			err = json.Unmarshal(shot, b)
+		default:
+			return nil, fmt.Errorf("unsupported shot file format %q", f)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("shot %d: %w", i, err)
+		}
+
+		if b.ID == "" {
+			b.ID = archive.BrewID(b.Start)
+		}
+		if b.ShotType == brew.UnknownShot {
+			b.ShotType = brew.Classify(b.Yield(), opts.ExpectedSingleShotWeight, opts.ExpectedDoubleShotWeight)
+		}
+		brews = append(brews, b)
+	}
+
+	return brews, nil
+}
+
+// Records converts brews to archive records (e.g. to import them via archive.Import)
+func Records(brews ...*brew.Brew) []archive.Record {
+	return CompressedRecords(curve.Compression{}, brews...)
+}
+
+// CompressedRecords converts brews to archive records, compressing their data points
+func CompressedRecords(compression curve.Compression, brews ...*brew.Brew) []archive.Record {
+
+	records := make([]archive.Record, 0, len(brews))
+	for _, b := range brews {
+		records = append(records, archive.RecordFromEntry(store.Entry{Brew: b, Compression: compression}))
+	}
+
+	return records
+}
+
+// flowRates returns the flow rate (in g/s) at each data point, derived from the change in
+// weight since the previous one
+func flowRates(dataPoints scale.DataPoints) []float64 {
+
+	flow := make([]float64, len(dataPoints))
+	for i := 1; i < len(dataPoints); i++ {
+		if dt := dataPoints[i].TimeStamp.Sub(dataPoints[i-1].TimeStamp).Seconds(); dt > 0 {
+			flow[i] = round((dataPoints[i].Weight - dataPoints[i-1].Weight) / dt)
+		}
+	}
+
+	return flow
+}
+
+// dataPointsFromSeries reconstructs the data points of a brew from weights at offsets (in
+// seconds) relative to its start
+func dataPointsFromSeries(start time.Time, offsets, weights []float64) (scale.DataPoints, error) {
+
+	if len(offsets) == 0 {
+		return nil, errors.New("missing weight curve")
+	}
+	if len(offsets) != len(weights) {
+		return nil, fmt.Errorf("mismatching number of time stamps (%d) and weights (%d)", len(offsets), len(weights))
+	}
+
+	dataPoints := make(scale.DataPoints, 0, len(offsets))
+	for i, offset := range offsets {
+		if i > 0 && offset < offsets[i-1] {
+			return nil, fmt.Errorf("time stamps not in chronological order at index %d", i)
+		}
+		dataPoints = append(dataPoints, scale.DataPoint{
+			TimeStamp: start.Add(time.Duration(math.Round(offset*1000)) * time.Millisecond),
+			Weight:    weights[i],
+			Unit:      brew.CanonicalUnit.String(),
+		})
+	}
+
+	return dataPoints, nil
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,121 @@
+package shotfile
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/fako1024/brew"
+	"github.com/fako1024/brew/archive"
+	"github.com/fako1024/brew/db/memory"
+	"github.com/fako1024/btscale/pkg/scale"
+)
+
+func testBrew() *brew.Brew {
+	start := time.Date(2023, 3, 1, 8, 30, 0, 0, time.Local)
+	b := &brew.Brew{
+		ID:          "test",
+		Start:       start,
+		End:         start.Add(3 * time.Second),
+		ShotType:    brew.DoubleShot,
+		BeansWeight: 18.,
+		Metadata: brew.Metadata{
+			Beans:          "House Blend",
+			Roaster:        "Local Roaster",
+			RoastDate:      time.Date(2023, 2, 20, 0, 0, 0, 0, time.Local),
+			Grinder:        "Niche",
+			GrinderSetting: "12",
+		},
+	}
+	for i, weight := range []float64{0., 0., 10., 25., 36.} {
+		b.DataPoints = append(b.DataPoints, scale.DataPoint{
+			TimeStamp: start.Add(time.Duration(i-1) * time.Second),
+			Weight:    weight,
+			Unit:      "g",
+		})
+	}
+
+	return b
+}
+
+func TestRoundTrip(t *testing.T) {
+
+	for _, format := range Formats {
+		t.Run(string(format), func(t *testing.T) {
+			original := testBrew()
+			data, err := format.Marshal(original)
+			if err != nil {
+				t.Fatalf("Failed to marshal brew: %s", err)
+			}
+			brews, err := format.Unmarshal(data, Options{})
+			if err != nil {
+				t.Fatalf("Failed to unmarshal brew: %s", err)
+			}
+			if len(brews) != 1 {
+				t.Fatalf("Unexpected number of brews: %d", len(brews))
+			}
+
+			b := brews[0]
+			if b.ID != original.ID || !b.Start.Equal(original.Start) || !b.End.Equal(original.End) || b.BeansWeight != original.BeansWeight {
+				t.Fatalf("Unexpected brew:\nwant %#v\nhave %#v", original, b)
+			}
+			if len(b.DataPoints) != len(original.DataPoints) || math.Abs(b.Yield()-original.Yield()) > 1e-9 {
+				t.Fatalf("Unexpected data points:\nwant %v\nhave %v", original.DataPoints, b.DataPoints)
+			}
+			for i, dataPoint := range b.DataPoints {
+				if !dataPoint.TimeStamp.Equal(original.DataPoints[i].TimeStamp) {
+					t.Fatalf("Unexpected time stamp of data point %d: want %v, have %v", i, original.DataPoints[i].TimeStamp, dataPoint.TimeStamp)
+				}
+			}
+			if b.Metadata.GrinderSetting != "12" {
+				t.Fatalf("Unexpected metadata: %#v", b.Metadata)
+			}
+
+			// Lists of shots are supported for bulk exports
+			data, err = format.Marshal(original, original)
+			if err != nil {
+				t.Fatalf("Failed to marshal brews: %s", err)
+			}
+			if brews, err = format.Unmarshal(data, Options{}); err != nil || len(brews) != 2 {
+				t.Fatalf("Unexpected result of bulk round trip: %d brews (error: %v)", len(brews), err)
+			}
+		})
+	}
+}
+
+func TestImportForeignShot(t *testing.T) {
+
+	// A shot logged in another app lacks ID and shot type
+	data := []byte(`{"version":2,"clock":"1677659400","elapsed":[0,1,2,3],"totals":{"weight":[0,5,12,19]},"meta":{"in":9,"out":19,"time":3}}`)
+	brews, err := Visualizer.Unmarshal(data, Options{ExpectedSingleShotWeight: 20., ExpectedDoubleShotWeight: 40.})
+	if err != nil {
+		t.Fatalf("Failed to unmarshal shot: %s", err)
+	}
+	b := brews[0]
+	if b.ID != archive.BrewID(time.Unix(1677659400, 0)) || b.ShotType != brew.SingleShot {
+		t.Fatalf("Unexpected ID / shot type: %s / %s", b.ID, b.ShotType)
+	}
+
+	d := memory.New()
+	report, err := archive.Import(d, "brews", Records(brews...), archive.SkipExisting, nil, false)
+	if err != nil || report.Created != 1 {
+		t.Fatalf("Unexpected import result: %#v (error: %v)", report, err)
+	}
+
+	// Importing the same shot again is skipped
+	brews, _ = Visualizer.Unmarshal(data, Options{})
+	if report, err = archive.Import(d, "brews", Records(brews...), archive.SkipExisting, nil, false); err != nil || report.Skipped != 1 {
+		t.Fatalf("Unexpected import result: %#v (error: %v)", report, err)
+	}
+
+	// Invalid shots are rejected
+	for _, invalid := range []string{
+		`{"elapsed":[0],"totals":{"weight":[0]}}`,
+		`{"clock":"1677659400","elapsed":[0,1],"totals":{"weight":[0]}}`,
+		`{"clock":"1677659400","elapsed":[1,0],"totals":{"weight":[0,1]}}`,
+	} {
+		if _, err := Visualizer.Unmarshal([]byte(invalid), Options{}); err == nil {
+			t.Fatalf("Expected error for invalid shot %s", invalid)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package shotfile
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/fako1024/brew"
+)
+
+// visualizerShot denotes a shot in the (Decent v2) JSON format accepted by visualizer.coffee.
+// Pressure / temperature series are not available from a scale and hence omitted
+type visualizerShot struct {
+	Version   int              `json:"version"`
+	Clock     string           `json:"clock"`
+	Timestamp string           `json:"timestamp"`
+	Date      string           `json:"date"`
+	Elapsed   []float64        `json:"elapsed"`
+	Flow      visualizerFlow   `json:"flow"`
+	Totals    visualizerTotals `json:"totals"`
+	Meta      visualizerMeta   `json:"meta"`
+	App       *visualizerApp   `json:"app,omitempty"`
+}
+
+type visualizerFlow struct {
+	ByWeight []float64 `json:"by_weight"`
+}
+
+type visualizerTotals struct {
+	Weight []float64 `json:"weight"`
+}
+
+type visualizerMeta struct {
+	Bean    visualizerBean    `json:"bean"`
+	Grinder visualizerGrinder `json:"grinder"`
+	In      float64           `json:"in"`
+	Out     float64           `json:"out"`
+	Time    float64           `json:"time"`
+}
+
+type visualizerBean struct {
+	Brand     string `json:"brand"`
+	Type      string `json:"type"`
+	RoastDate string `json:"roast_date,omitempty"`
+}
+
+type visualizerGrinder struct {
+	Model   string `json:"model"`
+	Setting string `json:"setting"`
+}
+
+// visualizerApp denotes the application having written the shot (allowing to restore the
+// ID and shot type of brews exported by this application)
+type visualizerApp struct {
+	AppName string            `json:"app_name"`
+	Data    map[string]string `json:"data,omitempty"`
+}
+
+func visualizerFromBrew(b *brew.Brew) visualizerShot {
+
+	netDataPoints := b.NetDataPoints()
+	elapsed := make([]float64, 0, len(netDataPoints))
+	weights := make([]float64, 0, len(netDataPoints))
+	for _, dataPoint := range netDataPoints {
+		elapsed = append(elapsed, dataPoint.TimeStamp.Sub(b.Start).Seconds())
+		weights = append(weights, dataPoint.Weight)
+	}
+
+	shot := visualizerShot{
+		Version:   2,
+		Clock:     strconv.FormatInt(b.Start.Unix(), 10),
+		Timestamp: strconv.FormatInt(b.Start.Unix(), 10),
+		Date:      b.Start.Format(time.RFC1123Z),
+		Elapsed:   elapsed,
+		Flow:      visualizerFlow{ByWeight: flowRates(netDataPoints)},
+		Totals:    visualizerTotals{Weight: weights},
+		Meta: visualizerMeta{
+			Bean: visualizerBean{
+				Brand: b.Metadata.Roaster,
+				Type:  b.Metadata.Beans,
+			},
+			Grinder: visualizerGrinder{
+				Model:   b.Metadata.Grinder,
+				Setting: b.Metadata.GrinderSetting,
+			},
+			In:   b.BeansWeight,
+			Out:  round(b.Yield()),
+			Time: b.End.Sub(b.Start).Seconds(),
+		},
+		App: &visualizerApp{
+			AppName: appName,
+			Data: map[string]string{
+				"id":        b.ID,
+				"shot_type": b.ShotType.String(),
+			},
+		},
+	}
+	if !b.Metadata.RoastDate.IsZero() {
+		shot.Meta.Bean.RoastDate = b.Metadata.RoastDate.Format(brew.RoastDateLayout)
+	}
+
+	return shot
+}
+
+func (v visualizerShot) brew() (*brew.Brew, error) {
+
+	clock := v.Clock
+	if clock == "" {
+		clock = v.Timestamp
+	}
+	if clock == "" {
+		return nil, errors.New("missing time stamp")
+	}
+	ts, err := strconv.ParseFloat(clock, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time stamp %q", clock)
+	}
+	start := time.UnixMilli(int64(ts * 1000))
+
+	dataPoints, err := dataPointsFromSeries(start, v.Elapsed, v.Totals.Weight)
+	if err != nil {
+		return nil, err
+	}
+
+	end := start.Add(time.Duration(v.Meta.Time * float64(time.Second)))
+	if v.Meta.Time <= 0. {
+		end = dataPoints[len(dataPoints)-1].TimeStamp
+	}
+
+	b := &brew.Brew{
+		Start:       start,
+		End:         end,
+		DataPoints:  dataPoints,
+		BeansWeight: v.Meta.In,
+		Metadata: brew.Metadata{
+			Beans:          v.Meta.Bean.Type,
+			Roaster:        v.Meta.Bean.Brand,
+			Grinder:        v.Meta.Grinder.Model,
+			GrinderSetting: v.Meta.Grinder.Setting,
+		},
+	}
+	if v.Meta.Bean.RoastDate != "" {
+		if b.Metadata.RoastDate, err = time.ParseInLocation(brew.RoastDateLayout, v.Meta.Bean.RoastDate, time.Local); err != nil {
+			return nil, fmt.Errorf("invalid roast date %q", v.Meta.Bean.RoastDate)
+		}
+	}
+
+	// Shots exported by this application retain their ID and shot type
+	if v.App != nil && v.App.AppName == appName {
+		b.ID = v.App.Data["id"]
+		b.ShotType = brew.ShotTypeFromString(v.App.Data["shot_type"])
+	}
+
+	return b, nil
+}
@@ -0,0 +1,169 @@
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fako1024/brew"
+)
+
+// Format denotes an output format of a report
+type Format string
+
+const (
+
+	// Text denotes a plain text report (aligned tables)
+	Text Format = "text"
+
+	// JSON denotes a JSON report
+	JSON Format = "json"
+
+	// Markdown denotes a Markdown report (e.g. for notes / wikis)
+	Markdown Format = "markdown"
+)
+
+// timeLayout denotes the layout used to represent time stamps in text / Markdown reports
+const timeLayout = "2006-01-02 15:04"
+
+// table denotes a titled table of a report section
+type table struct {
+	title  string
+	header []string
+	rows   [][]string
+}
+
+// Write writes the report in the given format
+func (r Report) Write(w io.Writer, format Format) error {
+
+	switch format {
+	case JSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case Text:
+		return r.writeText(w)
+	case Markdown:
+		return r.writeMarkdown(w)
+	}
+
+	return fmt.Errorf("invalid output format %q (supported: text, json, markdown)", format)
+}
+
+func (r Report) writeText(w io.Writer) error {
+
+	if len(r.Periods) == 0 {
+		_, err := fmt.Fprintln(w, "no brews found")
+		return err
+	}
+
+	for i, p := range r.Periods {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "== %s (%d brews) ==\n", p.Label, p.Count)
+		for _, t := range p.tables(r.Unit) {
+			if len(t.rows) == 0 {
+				continue
+			}
+			fmt.Fprintf(w, "\n%s:\n", t.title)
+			tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, strings.ToUpper(strings.Join(t.header, "\t"))+"\t")
+			for _, row := range t.rows {
+				fmt.Fprintln(tw, strings.Join(row, "\t")+"\t")
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r Report) writeMarkdown(w io.Writer) error {
+
+	fmt.Fprintln(w, "# Brew statistics")
+	if len(r.Periods) == 0 {
+		_, err := fmt.Fprintln(w, "\nNo brews found.")
+		return err
+	}
+
+	for _, p := range r.Periods {
+		fmt.Fprintf(w, "\n## %s (%d brews)\n", p.Label, p.Count)
+		for _, t := range p.tables(r.Unit) {
+			if len(t.rows) == 0 {
+				continue
+			}
+			fmt.Fprintf(w, "\n### %s\n\n", t.title)
+			fmt.Fprintf(w, "| %s |\n", strings.Join(t.header, " | "))
+			fmt.Fprintf(w, "|%s\n", strings.Repeat(" --- |", len(t.header)))
+			for _, row := range t.rows {
+				if _, err := fmt.Fprintf(w, "| %s |\n", strings.Join(row, " | ")); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// tables returns the sections of the period report as tables
+func (p PeriodReport) tables(unit brew.Unit) []table {
+
+	shotTypes := table{
+		title:  "Shot types",
+		header: []string{"Shot type", "Count", "Duration (s)", "Yield (" + unit.String() + ")", "Ratio", "Consistency"},
+	}
+	for _, st := range p.ShotTypes {
+		shotTypes.rows = append(shotTypes.rows, []string{
+			st.ShotType, fmt.Sprint(st.Count), formatDistribution(st.Duration), formatDistribution(st.Yield), formatDistribution(st.Ratio), fmt.Sprintf("%.0f", st.Consistency),
+		})
+	}
+
+	outliers := table{
+		title:  "Outliers",
+		header: []string{"ID", "Shot type", "Start", "Metric", "Value", "Z-score"},
+	}
+	for _, o := range p.Outliers {
+		outliers.rows = append(outliers.rows, []string{
+			o.ID, o.ShotType, o.Start.In(time.Local).Format(timeLayout), o.Metric, fmt.Sprintf("%.2f", o.Value), fmt.Sprintf("%+.2f", o.ZScore),
+		})
+	}
+
+	trends := table{
+		title:  "Duration vs. grind setting",
+		header: []string{"Shot type", "Count", "Slope (s / unit)", "Correlation"},
+	}
+	for _, t := range p.GrindTrends {
+		trends.rows = append(trends.rows, []string{
+			t.ShotType, fmt.Sprint(t.Count), fmt.Sprintf("%+.2f", t.Slope), fmt.Sprintf("%+.2f", t.Correlation),
+		})
+	}
+
+	packs := table{
+		title:  "Packs",
+		header: []string{"Pack", "Count", "Duration (s)", "Yield (" + unit.String() + ")", "Ratio"},
+	}
+	for _, ps := range p.Packs {
+		packs.rows = append(packs.rows, []string{
+			ps.Pack, fmt.Sprint(ps.Count), formatDistribution(ps.Duration), formatDistribution(ps.Yield), formatDistribution(ps.Ratio),
+		})
+	}
+
+	return []table{shotTypes, outliers, trends, packs}
+}
+
+func formatDistribution(d Distribution) string {
+	switch d.Count {
+	case 0:
+		return "-"
+	case 1:
+		return fmt.Sprintf("%.2f", d.Mean)
+	}
+	return fmt.Sprintf("%.2f ± %.2f", d.Mean, d.Stdev)
+}
@@ -0,0 +1,510 @@
+// Package stats provides per-period statistics and trend reports of stored brews
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/fako1024/brew"
+	"github.com/fako1024/brew/db"
+	"github.com/fako1024/brew/store"
+)
+
+const (
+
+	// DefaultOutlierThreshold denotes the default z-score above which a shot is considered an outlier
+	DefaultOutlierThreshold = 2.
+
+	// minShotsForOutliers denotes the minimum number of shots required to detect outliers
+	minShotsForOutliers = 4
+
+	// minShotsForTrend denotes the minimum number of shots required to determine a trend
+	minShotsForTrend = 3
+)
+
+// Period denotes the length of the periods a report is split into
+type Period string
+
+const (
+
+	// Day denotes daily periods
+	Day Period = "day"
+
+	// Week denotes weekly periods (starting on Monday)
+	Week Period = "week"
+
+	// Month denotes monthly periods
+	Month Period = "month"
+
+	// All denotes a single period spanning all shots
+	All Period = "all"
+)
+
+// PeriodFromString allows to generate a Period from a string
+func PeriodFromString(p string) (Period, error) {
+	switch Period(p) {
+	case Day, Week, Month, All:
+		return Period(p), nil
+	}
+	return "", fmt.Errorf("invalid period %q (supported: day, week, month, all)", p)
+}
+
+// Shot denotes the key figures of a single stored brew
+type Shot struct {
+	ID           string        `json:"id"`
+	ShotType     string        `json:"shot_type"`
+	Pack         string        `json:"pack,omitempty"`
+	Beans        string        `json:"beans,omitempty"`
+	Start        time.Time     `json:"start"`
+	Duration     time.Duration `json:"duration"` // Pump time (if known), flow time otherwise
+	Yield        float64       `json:"yield"`
+	BeansWeight  float64       `json:"beans_weight,omitempty"`
+	GrindSetting float64       `json:"grind_setting,omitempty"`
+}
+
+// Ratio returns the brew ratio (yield / beans weight) of the shot (zero if unknown)
+func (s Shot) Ratio() float64 {
+	if s.BeansWeight <= 0. {
+		return 0.
+	}
+	return s.Yield / s.BeansWeight
+}
+
+// Load retrieves the shots started within a time range from the brew summaries in the database
+func Load(d db.DB, dbName string, start, end time.Time) ([]Shot, error) {
+
+	summaries, err := d.FetchDataPoints(dbName, store.SummaryMeasurement, db.Filter{Start: start, End: end})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve brew summaries: %w", err)
+	}
+
+	shots := make([]Shot, 0, len(summaries))
+	for _, summary := range summaries {
+		shot, err := FromSummary(summary)
+		if err != nil {
+			return nil, err
+		}
+		shots = append(shots, shot)
+	}
+	sort.SliceStable(shots, func(i, j int) bool {
+		return shots[i].Start.Before(shots[j].Start)
+	})
+
+	return shots, nil
+}
+
+// FromSummary extracts the key figures of a shot from its summary data point
+func FromSummary(summary db.DataPoint) (Shot, error) {
+
+	shot := Shot{
+		ID:       summary.Tags["id"],
+		ShotType: summary.Tags["shot_type"],
+		Pack:     summary.Tags["pack"],
+		Start:    summary.TimeStamp,
+	}
+
+	// The pump time takes precedence over the flow time, falling back to the time between
+	// first drop and end of brews stored without either of them
+	if pumpTime, exists := toFloat(summary.Data["pump_time"]); exists {
+		shot.Duration = seconds(pumpTime)
+	} else if flowTime, exists := toFloat(summary.Data["flow_time"]); exists {
+		shot.Duration = seconds(flowTime)
+	} else {
+		start, hasStart := toFloat(summary.Data["start"])
+		end, hasEnd := toFloat(summary.Data["end"])
+		if hasStart && hasEnd {
+			shot.Duration = time.Duration(end-start) * time.Millisecond
+		}
+	}
+	var exists bool
+	if shot.Yield, exists = store.Yield(summary); !exists {
+		return shot, fmt.Errorf("brew %s: missing yield", shot.ID)
+	}
+
+	// The yield is stored in the unit reported by the scale (unless normalized)
+	if unit, exists := summary.Data["unit"]; exists && unit != nil {
+		u, err := brew.UnitFromString(fmt.Sprint(unit))
+		if err != nil {
+			return shot, fmt.Errorf("brew %s: %w", shot.ID, err)
+		}
+		shot.Yield = u.ToCanonical(shot.Yield)
+	}
+	shot.BeansWeight, _ = toFloat(summary.Data["beans_weight"])
+	shot.GrindSetting, _ = toFloat(summary.Data["grind_setting"])
+	if beans, exists := summary.Data["beans"]; exists && beans != nil {
+		shot.Beans = fmt.Sprint(beans)
+	}
+
+	return shot, nil
+}
+
+// Distribution denotes the mean and standard deviation of a metric
+type Distribution struct {
+	Count int     `json:"count"`
+	Mean  float64 `json:"mean"`
+	Stdev float64 `json:"stdev"`
+}
+
+// ShotTypeStats denotes the statistics of all shots of a shot type within a period
+type ShotTypeStats struct {
+	ShotType    string       `json:"shot_type"`
+	Count       int          `json:"count"`
+	Duration    Distribution `json:"duration"` // In seconds
+	Yield       Distribution `json:"yield"`
+	Ratio       Distribution `json:"ratio"`       // Only shots with known beans weight
+	Consistency float64      `json:"consistency"` // Score between 0 (erratic) and 100 (identical shots)
+}
+
+// Outlier denotes a shot deviating significantly from the other shots of its type
+type Outlier struct {
+	ID       string    `json:"id"`
+	ShotType string    `json:"shot_type"`
+	Start    time.Time `json:"start"`
+	Metric   string    `json:"metric"`
+	Value    float64   `json:"value"`
+	ZScore   float64   `json:"z_score"`
+}
+
+// GrindTrend denotes the dependency of the shot duration on the grind setting
+type GrindTrend struct {
+	ShotType    string  `json:"shot_type"`
+	Count       int     `json:"count"`
+	Slope       float64 `json:"slope"`       // Change in duration (seconds) per unit of grind setting
+	Correlation float64 `json:"correlation"` // Pearson correlation between grind setting and duration
+}
+
+// PackStats denotes the statistics of all shots brewed from a pack of beans within a period
+type PackStats struct {
+	Pack     string       `json:"pack"`
+	Count    int          `json:"count"`
+	Duration Distribution `json:"duration"`
+	Yield    Distribution `json:"yield"`
+	Ratio    Distribution `json:"ratio"`
+}
+
+// PeriodReport denotes the statistics of all shots within a period
+type PeriodReport struct {
+	Label       string          `json:"label"`
+	Start       time.Time       `json:"start"`
+	End         time.Time       `json:"end"`
+	Count       int             `json:"count"`
+	ShotTypes   []ShotTypeStats `json:"shot_types"`
+	Outliers    []Outlier       `json:"outliers"`
+	GrindTrends []GrindTrend    `json:"grind_trends"`
+	Packs       []PackStats     `json:"packs"`
+}
+
+// Report denotes the statistics of shots, split into periods
+type Report struct {
+	Period  Period         `json:"period"`
+	Unit    brew.Unit      `json:"unit"` // Unit of all weights
+	Periods []PeriodReport `json:"periods"`
+}
+
+// Settings denotes the settings for computing a report
+type Settings struct {
+	Period           Period
+	OutlierThreshold float64
+	Location         *time.Location
+	Unit             brew.Unit
+}
+
+// WithPeriod sets the length of the periods the report is split into
+func WithPeriod(period Period) func(*Settings) {
+	return func(s *Settings) {
+		s.Period = period
+	}
+}
+
+// WithOutlierThreshold sets the z-score above which a shot is considered an outlier
+func WithOutlierThreshold(threshold float64) func(*Settings) {
+	return func(s *Settings) {
+		s.OutlierThreshold = threshold
+	}
+}
+
+// WithLocation sets the time zone used to determine the boundaries of periods
+func WithLocation(loc *time.Location) func(*Settings) {
+	return func(s *Settings) {
+		s.Location = loc
+	}
+}
+
+// WithUnit sets the unit of all weights in the report
+func WithUnit(unit brew.Unit) func(*Settings) {
+	return func(s *Settings) {
+		s.Unit = unit
+	}
+}
+
+// Compute generates a report from a set of shots
+func Compute(shots []Shot, options ...func(*Settings)) Report {
+
+	s := Settings{
+		Period:           Month,
+		OutlierThreshold: DefaultOutlierThreshold,
+		Location:         time.Local,
+		Unit:             brew.CanonicalUnit,
+	}
+	for _, option := range options {
+		option(&s)
+	}
+	if s.Unit != brew.CanonicalUnit {
+		converted := make([]Shot, len(shots))
+		for i, shot := range shots {
+			shot.Yield, shot.BeansWeight = s.Unit.FromCanonical(shot.Yield), s.Unit.FromCanonical(shot.BeansWeight)
+			converted[i] = shot
+		}
+		shots = converted
+	}
+
+	// Split the shots into periods (in chronological order)
+	var (
+		periods []PeriodReport
+		groups  [][]Shot
+		index   = make(map[time.Time]int)
+	)
+	sorted := append([]Shot{}, shots...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Start.Before(sorted[j].Start)
+	})
+	for _, shot := range sorted {
+		start, end, label := s.bounds(shot.Start)
+		i, exists := index[start]
+		if !exists {
+			i = len(periods)
+			index[start] = i
+			periods = append(periods, PeriodReport{Label: label, Start: start, End: end})
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], shot)
+	}
+
+	// The single period spans exactly the shots
+	if s.Period == All && len(periods) == 1 {
+		periods[0].Start, periods[0].End = sorted[0].Start, sorted[len(sorted)-1].Start
+	}
+
+	for i := range periods {
+		periods[i].compute(groups[i], s.OutlierThreshold)
+	}
+
+	return Report{
+		Period:  s.Period,
+		Unit:    s.Unit,
+		Periods: periods,
+	}
+}
+
+func (p *PeriodReport) compute(shots []Shot, outlierThreshold float64) {
+
+	p.Count = len(shots)
+	p.ShotTypes, p.Outliers, p.GrindTrends, p.Packs = []ShotTypeStats{}, []Outlier{}, []GrindTrend{}, []PackStats{}
+
+	byShotType, shotTypes := groupBy(shots, func(s Shot) string { return s.ShotType })
+	for _, shotType := range shotTypes {
+		group := byShotType[shotType]
+		durations, yields, ratios := metrics(group)
+		st := ShotTypeStats{
+			ShotType: shotType,
+			Count:    len(group),
+			Duration: distribution(durations),
+			Yield:    distribution(yields),
+			Ratio:    distribution(ratios),
+		}
+		st.Consistency = consistency(st.Duration, st.Yield)
+		p.ShotTypes = append(p.ShotTypes, st)
+
+		// Outliers are determined per shot type (as single / double shots differ by design)
+		if len(group) >= minShotsForOutliers {
+			for _, m := range []struct {
+				name   string
+				values []float64
+				dist   Distribution
+			}{
+				{"duration", durations, st.Duration},
+				{"yield", yields, st.Yield},
+			} {
+				if m.dist.Stdev == 0. {
+					continue
+				}
+				for j, v := range m.values {
+					if z := (v - m.dist.Mean) / m.dist.Stdev; math.Abs(z) > outlierThreshold {
+						p.Outliers = append(p.Outliers, Outlier{
+							ID:       group[j].ID,
+							ShotType: shotType,
+							Start:    group[j].Start,
+							Metric:   m.name,
+							Value:    v,
+							ZScore:   z,
+						})
+					}
+				}
+			}
+		}
+
+		if trend, ok := FitGrindTrend(group); ok {
+			p.GrindTrends = append(p.GrindTrends, trend)
+		}
+	}
+	sort.SliceStable(p.Outliers, func(i, j int) bool {
+		return p.Outliers[i].Start.Before(p.Outliers[j].Start)
+	})
+
+	byPack, packs := groupBy(shots, func(s Shot) string { return s.Pack })
+	for _, pack := range packs {
+		if pack == "" {
+			continue
+		}
+		durations, yields, ratios := metrics(byPack[pack])
+		p.Packs = append(p.Packs, PackStats{
+			Pack:     pack,
+			Count:    len(byPack[pack]),
+			Duration: distribution(durations),
+			Yield:    distribution(yields),
+			Ratio:    distribution(ratios),
+		})
+	}
+}
+
+// bounds returns the boundaries and label of the period containing a time stamp
+func (s Settings) bounds(ts time.Time) (time.Time, time.Time, string) {
+
+	ts = ts.In(s.Location)
+	day := time.Date(ts.Year(), ts.Month(), ts.Day(), 0, 0, 0, 0, s.Location)
+	switch s.Period {
+	case Day:
+		return day, day.AddDate(0, 0, 1), day.Format("2006-01-02")
+	case Week:
+		start := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		year, week := start.ISOWeek()
+		return start, start.AddDate(0, 0, 7), fmt.Sprintf("%d-W%02d", year, week)
+	case Month:
+		start := time.Date(ts.Year(), ts.Month(), 1, 0, 0, 0, 0, s.Location)
+		return start, start.AddDate(0, 1, 0), start.Format("2006-01")
+	}
+
+	return time.Time{}, time.Time{}, "all"
+}
+
+// FitGrindTrend determines the linear dependency of the duration on the grind setting (returning
+// false if there are too few shots with known grind setting or the setting never changed)
+func FitGrindTrend(shots []Shot) (GrindTrend, bool) {
+
+	var xs, ys []float64
+	for _, shot := range shots {
+		if shot.GrindSetting > 0. && shot.Duration > 0 {
+			xs = append(xs, shot.GrindSetting)
+			ys = append(ys, shot.Duration.Seconds())
+		}
+	}
+	if len(xs) < minShotsForTrend {
+		return GrindTrend{}, false
+	}
+
+	x, y := distribution(xs), distribution(ys)
+	if x.Stdev == 0. {
+		return GrindTrend{}, false
+	}
+	var cov float64
+	for i := range xs {
+		cov += (xs[i] - x.Mean) * (ys[i] - y.Mean)
+	}
+	cov /= float64(len(xs) - 1)
+
+	trend := GrindTrend{
+		ShotType: shots[0].ShotType,
+		Count:    len(xs),
+		Slope:    cov / (x.Stdev * x.Stdev),
+	}
+	if y.Stdev > 0. {
+		trend.Correlation = cov / (x.Stdev * y.Stdev)
+	}
+
+	return trend, true
+}
+
+// consistency returns a score between 0 and 100 based on the relative spread (coefficient
+// of variation) of duration and yield
+func consistency(duration, yield Distribution) float64 {
+	if duration.Count < 2 || duration.Mean <= 0. || yield.Mean <= 0. {
+		return 0.
+	}
+	cv := (duration.Stdev/duration.Mean + yield.Stdev/yield.Mean) / 2.
+	return math.Max(0., 100.*(1.-cv))
+}
+
+func metrics(shots []Shot) (durations, yields, ratios []float64) {
+	for _, shot := range shots {
+		durations = append(durations, shot.Duration.Seconds())
+		yields = append(yields, shot.Yield)
+		if ratio := shot.Ratio(); ratio > 0. {
+			ratios = append(ratios, ratio)
+		}
+	}
+	return
+}
+
+// distribution computes the mean and (sample) standard deviation of a set of values
+func distribution(values []float64) Distribution {
+
+	d := Distribution{Count: len(values)}
+	if d.Count == 0 {
+		return d
+	}
+	for _, v := range values {
+		d.Mean += v
+	}
+	d.Mean /= float64(d.Count)
+	if d.Count < 2 {
+		return d
+	}
+	for _, v := range values {
+		d.Stdev += (v - d.Mean) * (v - d.Mean)
+	}
+	d.Stdev = math.Sqrt(d.Stdev / float64(d.Count-1))
+
+	return d
+}
+
+func groupBy(shots []Shot, key func(Shot) string) (map[string][]Shot, []string) {
+	groups := make(map[string][]Shot)
+	var keys []string
+	for _, shot := range shots {
+		k := key(shot)
+		if _, exists := groups[k]; !exists {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], shot)
+	}
+	sort.Strings(keys)
+	return groups, keys
+}
+
+// seconds converts a duration in (fractional) seconds, as stored in summaries, at millisecond
+// precision
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Round(s*1000)) * time.Millisecond
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case int64:
+		return float64(t), true
+	case int:
+		return float64(t), true
+	case json.Number:
+		f, err := t.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(t, 64)
+		return f, err == nil
+	}
+	return 0., false
+}
@@ -0,0 +1,175 @@
+package stats
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fako1024/brew"
+	"github.com/fako1024/brew/db"
+	"github.com/fako1024/brew/db/memory"
+	"github.com/fako1024/brew/store"
+	"github.com/fako1024/btscale/pkg/scale"
+)
+
+func testShots() []Shot {
+	start := time.Date(2023, 3, 1, 8, 0, 0, 0, time.UTC)
+
+	var shots []Shot
+	for i, duration := range []float64{25, 26, 27, 28, 29, 26, 27, 45} {
+		shots = append(shots, Shot{
+			ID:           string(rune('a' + i)),
+			ShotType:     "double",
+			Pack:         []string{"p1", "p2"}[i/4],
+			Start:        start.Add(time.Duration(i) * 24 * time.Hour),
+			Duration:     time.Duration(duration * float64(time.Second)),
+			Yield:        36.,
+			BeansWeight:  18.,
+			GrindSetting: 0.2 + 0.01*float64(i%5),
+		})
+	}
+	shots = append(shots, Shot{ID: "s", ShotType: "single", Start: start.Add(40 * 24 * time.Hour), Duration: 20 * time.Second, Yield: 18.})
+
+	return shots
+}
+
+func TestCompute(t *testing.T) {
+
+	report := Compute(testShots(), WithLocation(time.UTC))
+	if report.Period != Month || len(report.Periods) != 2 {
+		t.Fatalf("Unexpected periods: %#v", report.Periods)
+	}
+
+	march := report.Periods[0]
+	if march.Label != "2023-03" || march.Count != 8 || len(march.ShotTypes) != 1 {
+		t.Fatalf("Unexpected period: %#v", march)
+	}
+	st := march.ShotTypes[0]
+	if st.Count != 8 || math.Abs(st.Duration.Mean-29.125) > 1e-9 || st.Yield.Stdev != 0. || st.Ratio.Mean != 2. {
+		t.Fatalf("Unexpected shot type stats: %#v", st)
+	}
+	if st.Consistency <= 0. || st.Consistency >= 100. {
+		t.Fatalf("Unexpected consistency: %.2f", st.Consistency)
+	}
+
+	// The slow last shot is an outlier (the yield being constant cannot be)
+	if len(march.Outliers) != 1 || march.Outliers[0].ID != "h" || march.Outliers[0].Metric != "duration" || march.Outliers[0].ZScore <= 2. {
+		t.Fatalf("Unexpected outliers: %#v", march.Outliers)
+	}
+	if len(march.GrindTrends) != 1 || march.GrindTrends[0].Count != 8 {
+		t.Fatalf("Unexpected grind trends: %#v", march.GrindTrends)
+	}
+	if len(march.Packs) != 2 || march.Packs[0].Pack != "p1" || math.Abs(march.Packs[0].Duration.Mean-26.5) > 1e-9 {
+		t.Fatalf("Unexpected pack stats: %#v", march.Packs)
+	}
+
+	// Without outlier, the duration depends linearly on the grind setting (one second per 0.01)
+	trend, ok := FitGrindTrend(testShots()[:5])
+	if !ok || math.Abs(trend.Slope-100.) > 1e-9 || math.Abs(trend.Correlation-1.) > 1e-9 {
+		t.Fatalf("Unexpected grind trend: %#v", trend)
+	}
+
+	if weekly := Compute(testShots(), WithPeriod(Week), WithLocation(time.UTC)); len(weekly.Periods) != 3 || weekly.Periods[0].Label != "2023-W09" {
+		t.Fatalf("Unexpected weekly periods: %#v", weekly.Periods)
+	}
+	if all := Compute(testShots(), WithPeriod(All)); len(all.Periods) != 1 || all.Periods[0].Count != 9 {
+		t.Fatalf("Unexpected single period: %#v", all.Periods)
+	}
+
+	// Weights are converted to the requested unit (the ratio being unaffected)
+	oz := Compute(testShots(), WithUnit(brew.Ounce), WithLocation(time.UTC))
+	if st := oz.Periods[0].ShotTypes[0]; oz.Unit != brew.Ounce || math.Abs(st.Yield.Mean-brew.Gram.Convert(36., brew.Ounce)) > 1e-9 || st.Ratio.Mean != 2. {
+		t.Fatalf("Unexpected converted report: %#v", oz.Periods[0].ShotTypes)
+	}
+}
+
+func TestLoad(t *testing.T) {
+
+	d := memory.New()
+	start := time.Date(2023, 3, 1, 8, 0, 0, 0, time.UTC)
+	if err := store.New(d, "brews").Save(store.Entry{Brew: &brew.Brew{
+		ID:          "test",
+		Start:       start,
+		End:         start.Add(28 * time.Second),
+		ShotType:    brew.DoubleShot,
+		Pack:        "p1",
+		BeansWeight: 18.,
+		DataPoints:  scale.DataPoints{{TimeStamp: start, Weight: 0.}, {TimeStamp: start.Add(28 * time.Second), Weight: 36.}},
+	}}); err != nil {
+		t.Fatalf("Failed to save brew: %s", err)
+	}
+
+	shots, err := Load(d, "brews", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to load shots: %s", err)
+	}
+	if len(shots) != 1 || shots[0].Duration != 28*time.Second || shots[0].Yield != 36. || shots[0].Ratio() != 2. || shots[0].Pack != "p1" {
+		t.Fatalf("Unexpected shots: %#v", shots)
+	}
+
+	// The pump time takes precedence over the flow time (both at millisecond precision)
+	if err := store.New(d, "brews").Save(store.Entry{Brew: &brew.Brew{
+		ID:              "pump",
+		Start:           start.Add(time.Hour + 250*time.Millisecond),
+		End:             start.Add(time.Hour + 27*time.Second + 900*time.Millisecond),
+		PumpStart:       start.Add(time.Hour - 4*time.Second),
+		PumpStartSource: brew.PumpStartButton,
+		ShotType:        brew.DoubleShot,
+		DataPoints:      scale.DataPoints{{TimeStamp: start.Add(time.Hour + 250*time.Millisecond), Weight: 0.}, {TimeStamp: start.Add(time.Hour + 27*time.Second + 900*time.Millisecond), Weight: 36.}},
+	}}); err != nil {
+		t.Fatalf("Failed to save brew: %s", err)
+	}
+	if shots, err = Load(d, "brews", start.Add(time.Minute), time.Time{}); err != nil || len(shots) != 1 || shots[0].Duration != 31*time.Second+900*time.Millisecond {
+		t.Fatalf("Unexpected shots with pump time: %#v (error: %v)", shots, err)
+	}
+	for _, c := range []struct {
+		data     map[string]interface{}
+		expected time.Duration
+	}{
+		{map[string]interface{}{"end_weight": 36., "start": int64(1000), "end": int64(28500), "flow_time": 27.5}, 27500 * time.Millisecond},
+		{map[string]interface{}{"end_weight": 36., "start": int64(1000), "end": int64(28000)}, 27 * time.Second},
+	} {
+		if shot, err := FromSummary(db.DataPoint{TimeStamp: start, Data: c.data}); err != nil || shot.Duration != c.expected {
+			t.Fatalf("Unexpected duration of shot from summary %v: %v (error: %v)", c.data, shot.Duration, err)
+		}
+	}
+
+	// Legacy summaries state the raw end weight (including the baseline weight)
+	shot, err := FromSummary(db.DataPoint{TimeStamp: start, Data: map[string]interface{}{"end_weight": 236., "baseline_weight": 200., "beans_weight": 18.}})
+	if err != nil || shot.Yield != 36. {
+		t.Fatalf("Unexpected shot from legacy summary: %#v (error: %v)", shot, err)
+	}
+}
+
+func TestWrite(t *testing.T) {
+
+	report := Compute(testShots(), WithLocation(time.UTC))
+	for format, expected := range map[Format]string{
+		Text:     "== 2023-03 (8 brews) ==",
+		Markdown: "| Shot type | Count | Duration (s) |",
+	} {
+		buf := new(bytes.Buffer)
+		if err := report.Write(buf, format); err != nil {
+			t.Fatalf("Failed to write %s report: %s", format, err)
+		}
+		if !strings.Contains(buf.String(), expected) || !strings.Contains(buf.String(), "29.12 ± 6.53") {
+			t.Fatalf("Unexpected %s report:\n%s", format, buf.String())
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := report.Write(buf, JSON); err != nil {
+		t.Fatalf("Failed to write JSON report: %s", err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || len(decoded.Periods) != 2 || decoded.Periods[0].ShotTypes[0].Count != 8 {
+		t.Fatalf("Unexpected JSON report: %s (error: %v)", buf.String(), err)
+	}
+
+	if err := report.Write(buf, "xml"); err == nil {
+		t.Fatalf("Expected error for invalid format")
+	}
+}
@@ -0,0 +1,606 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fako1024/brew"
+	"github.com/fako1024/brew/curve"
+	"github.com/fako1024/brew/db"
+	"github.com/fako1024/brew/db/backup"
+	"github.com/fako1024/btscale/pkg/scale"
+)
+
+const (
+
+	// SummaryMeasurement denotes the measurement holding the summary of each brew
+	SummaryMeasurement = "summary"
+
+	// CurveMeasurement denotes the measurement holding the data points of each brew
+	CurveMeasurement = "brew"
+
+	// AnnotationsMeasurement denotes the measurement holding the annotations of each brew
+	AnnotationsMeasurement = "annotations"
+)
+
+// SummaryVersion denotes the version of the schema of brew summaries (stored as field
+// schema_version), to be increased on any change of the meaning of existing fields
+//
+// Version 1 (no schema_version field): end_weight (summary) and weight (data points) denote
+// the raw weights measured by the scale (e.g. including an untared cup)
+//
+// Version 2: end_weight and weight denote the net weights (compensating for the baseline
+// weight and tares), the raw weights being stored as raw_end_weight / raw_weight
+const SummaryVersion = 2
+
+// ErrNotFound denotes that a requested brew does not exist
+var ErrNotFound = errors.New("brew not found")
+
+// derivedFields denotes summary fields derived from the data points of a brew
+var derivedFields = map[string]struct{}{
+	"start": {}, "end": {}, "end_weight": {}, "raw_end_weight": {}, "unit": {},
+	"flow_time": {}, "pump_time": {}, "schema_version": {},
+}
+
+// Entry denotes a brew as stored in the database
+type Entry struct {
+	*brew.Brew
+
+	Tags   map[string]string      // Additional tags (e.g. station / group head)
+	Fields map[string]interface{} // Additional summary fields (e.g. battery level)
+
+	Compression curve.Compression // Compression of the stored data points (if any)
+}
+
+// Summary generates the summary data point of the brew
+func (e Entry) Summary() db.DataPoint {
+
+	summary := e.Metadata.Fields()
+	for k, v := range e.Fields {
+		summary[k] = v
+	}
+	if e.Score != nil {
+		for k, v := range e.Score.Fields() {
+			summary[k] = v
+		}
+	}
+	summary["schema_version"] = int64(SummaryVersion)
+	summary["start"] = e.Start.UnixMilli()
+	summary["end"] = e.End.UnixMilli()
+	summary["end_weight"] = e.Yield()
+	summary["baseline_weight"] = e.Baseline
+	summary["beans_weight"] = e.BeansWeight
+	summary["grind_setting"] = e.GrindSetting
+	if e.UnitChanged {
+		summary["unit_changed"] = true
+	}
+	summary["flow_time"] = e.FlowTime().Seconds()
+	if !e.PumpStart.IsZero() {
+		summary["pump_start"] = e.PumpStart.UnixMilli()
+		summary["pump_start_source"] = e.PumpStartSource.String()
+		summary["pump_time"] = e.PumpTime().Seconds()
+	}
+	if len(e.DataPoints) > 0 {
+		last := e.DataPoints[len(e.DataPoints)-1]
+		summary["raw_end_weight"] = last.Weight
+		summary["unit"] = last.Unit
+	}
+	if e.Compression.Enabled() {
+		summary["curve_compression"] = e.Compression.Mode.String()
+		if e.Compression.Mode == curve.Simplify {
+			summary["curve_tolerance"] = e.Compression.Tolerance
+		}
+	}
+
+	return db.DataPoint{
+		TimeStamp: e.Start,
+		Tags:      e.tags(),
+		Data:      summary,
+	}
+}
+
+// Curve generates the data points of the brew (compressed, if enabled, each data point stating
+// the number of data points dropped after it)
+func (e Entry) Curve() db.DataPoints {
+
+	tags := e.tags()
+	indices := e.Compression.Select(e.DataPoints)
+	dropped := curve.Dropped(indices)
+	netDataPoints := e.NetDataPoints()
+	dataPoints := make(db.DataPoints, 0, len(indices))
+	for j, i := range indices {
+		data := map[string]interface{}{
+			"unit":       netDataPoints[i].Unit,
+			"weight":     netDataPoints[i].Weight,
+			"raw_weight": e.DataPoints[i].Weight,
+		}
+		if dropped[j] > 0 {
+			data["dropped"] = int64(dropped[j])
+		}
+		dataPoints = append(dataPoints, db.DataPoint{
+			TimeStamp: netDataPoints[i].TimeStamp,
+			Tags:      tags,
+			Data:      data,
+		})
+	}
+
+	return dataPoints
+}
+
+// AnnotationDataPoints generates the data points for annotations of the brew
+func (e Entry) AnnotationDataPoints(annotations ...brew.Annotation) db.DataPoints {
+
+	dataPoints := make(db.DataPoints, 0, len(annotations))
+	for _, annotation := range annotations {
+		tags := make(map[string]string, len(e.Tags)+2)
+		for k, v := range e.Tags {
+			tags[k] = v
+		}
+		tags["id"], tags["event"] = e.ID, annotation.Event.String()
+		dataPoints = append(dataPoints, db.DataPoint{
+			TimeStamp: annotation.TimeStamp,
+			Tags:      tags,
+			Data: map[string]interface{}{
+				"change": annotation.Change,
+			},
+		})
+	}
+
+	return dataPoints
+}
+
+// SetField sets a single summary field from its string representation (an empty value
+// removing the field, if possible)
+func (e *Entry) SetField(name, value string) error {
+
+	if _, isDerived := derivedFields[name]; isDerived {
+		return fmt.Errorf("field %s is derived from the data points of the brew and cannot be set", name)
+	}
+	if brew.IsScoreField(name) {
+		return fmt.Errorf("field %s is computed from the reference curve of the recipe and cannot be set", name)
+	}
+	if name == "pump_start" || name == "pump_start_source" {
+		return fmt.Errorf("field %s is recorded by the scanner and cannot be set", name)
+	}
+	if name == "curve_compression" || name == "curve_tolerance" {
+		return fmt.Errorf("field %s denotes the storage of the data points of the brew and cannot be set", name)
+	}
+
+	switch {
+	case name == "shot_type":
+		if e.ShotType = brew.ShotTypeFromString(value); e.ShotType == brew.UnknownShot {
+			return fmt.Errorf("invalid shot type: %s", value)
+		}
+	case name == "pack":
+		e.Pack = value
+	case name == "baseline_weight":
+		return parseFloat(value, &e.Baseline)
+	case name == "beans_weight":
+		return parseFloat(value, &e.BeansWeight)
+	case name == "grind_setting":
+		return parseFloat(value, &e.GrindSetting)
+	case name == "unit_changed":
+		if value == "" {
+			e.UnitChanged = false
+			return nil
+		}
+		changed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid value for %s: %s", name, value)
+		}
+		e.UnitChanged = changed
+	case brew.IsMetadataField(name):
+		fields := e.Metadata.Fields()
+		delete(fields, name)
+		if value != "" {
+			if name == "water_temperature" {
+				var temperature float64
+				if err := parseFloat(value, &temperature); err != nil {
+					return err
+				}
+				fields[name] = temperature
+			} else {
+				fields[name] = value
+			}
+		}
+		metadata, err := brew.MetadataFromFields(fields)
+		if err != nil {
+			return err
+		}
+		e.Metadata = metadata
+	default:
+		if e.Fields == nil {
+			e.Fields = make(map[string]interface{})
+		}
+		if value == "" {
+			delete(e.Fields, name)
+			return nil
+		}
+
+		// Retain the type of existing fields (the database does not allow to change it)
+		switch e.Fields[name].(type) {
+		case string:
+			e.Fields[name] = value
+		case int64:
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid integer value for field %s: %s", name, value)
+			}
+			e.Fields[name] = n
+		default:
+			if f, err := strconv.ParseFloat(value, 64); err == nil {
+				e.Fields[name] = f
+			} else if _, exists := e.Fields[name]; exists {
+				return fmt.Errorf("invalid numeric value for field %s: %s", name, value)
+			} else {
+				e.Fields[name] = value
+			}
+		}
+	}
+
+	return nil
+}
+
+// Flatten returns a flat representation of all summary fields and tags of the brew (e.g.
+// to display / compare them)
+func (e Entry) Flatten() map[string]string {
+	summary := e.Summary()
+
+	flat := make(map[string]string, len(summary.Data)+len(summary.Tags))
+	for k, v := range summary.Tags {
+		flat[k] = v
+	}
+	for k, v := range summary.Data {
+		if f, isFloat := v.(float64); isFloat {
+			flat[k] = strconv.FormatFloat(f, 'f', -1, 64)
+			continue
+		}
+		flat[k] = fmt.Sprint(v)
+	}
+	flat["data_points"] = strconv.Itoa(len(e.DataPoints))
+	flat["annotations"] = strconv.Itoa(len(e.Annotations))
+
+	return flat
+}
+
+// tags generates the tags of all data points of the brew
+func (e Entry) tags() map[string]string {
+	tags := make(map[string]string, len(e.Tags)+3)
+	for k, v := range e.Tags {
+		tags[k] = v
+	}
+	tags["id"], tags["shot_type"] = e.ID, e.ShotType.String()
+	if e.Pack != "" {
+		tags["pack"] = e.Pack
+	}
+
+	return tags
+}
+
+// Store provides access to brews stored in a database
+type Store struct {
+	db          db.DB
+	dbName      string
+	journal     *backup.Journal
+	compression curve.Compression
+}
+
+// New instantiates a new brew store backed by the provided database
+func New(db db.DB, dbName string, options ...func(*Store)) *Store {
+	s := &Store{
+		db:     db,
+		dbName: dbName,
+	}
+
+	for _, opt := range options {
+		opt(s)
+	}
+
+	return s
+}
+
+// WithJournal sets a journal to back up all brews replaced by corrections to
+func WithJournal(journal *backup.Journal) func(*Store) {
+	return func(s *Store) {
+		s.journal = journal
+	}
+}
+
+// WithCompression sets the compression applied to the data points of all brews stored (brews
+// loaded from a store retain the compression they were stored with otherwise)
+func WithCompression(compression curve.Compression) func(*Store) {
+	return func(s *Store) {
+		s.compression = compression
+	}
+}
+
+// Save stores a brew (summary, data points and annotations)
+func (s *Store) Save(e Entry) error {
+
+	e = s.compress(e)
+	var errs []error
+	if err := s.db.EmitDataPoints(s.dbName, SummaryMeasurement, db.DataPoints{e.Summary()}); err != nil {
+		errs = append(errs, fmt.Errorf("failed to store brew summary: %w", err))
+	}
+	if err := s.db.EmitDataPoints(s.dbName, CurveMeasurement, e.Curve()); err != nil {
+		errs = append(errs, fmt.Errorf("failed to store brew data points: %w", err))
+	}
+	if err := s.AddAnnotations(e, e.Annotations...); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// AddAnnotations stores (additional) annotations of a brew
+func (s *Store) AddAnnotations(e Entry, annotations ...brew.Annotation) error {
+	if len(annotations) == 0 {
+		return nil
+	}
+	if err := s.db.EmitDataPoints(s.dbName, AnnotationsMeasurement, e.AnnotationDataPoints(annotations...)); err != nil {
+		return fmt.Errorf("failed to store brew annotations: %w", err)
+	}
+
+	return nil
+}
+
+// Load retrieves a brew (summary, data points and annotations)
+func (s *Store) Load(id string) (Entry, error) {
+
+	filter := db.Filter{Tags: map[string]string{"id": id}}
+	summaries, err := s.db.FetchDataPoints(s.dbName, SummaryMeasurement, filter)
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to retrieve brew summary: %w", err)
+	}
+	if len(summaries) == 0 {
+		return Entry{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if len(summaries) > 1 {
+		return Entry{}, fmt.Errorf("unexpected number of summaries for brew %s: %d", id, len(summaries))
+	}
+
+	e, err := entryFromSummary(summaries[0])
+	if err != nil {
+		return e, fmt.Errorf("failed to parse summary of brew %s: %w", id, err)
+	}
+
+	stored, err := s.db.FetchDataPoints(s.dbName, CurveMeasurement, filter)
+	if err != nil {
+		return e, fmt.Errorf("failed to retrieve brew data points: %w", err)
+	}
+	sort.SliceStable(stored, func(i, j int) bool {
+		return stored[i].TimeStamp.Before(stored[j].TimeStamp)
+	})
+	dropped := make([]int, 0, len(stored))
+	for _, dataPoint := range stored {
+		weight, ok := toFloat(dataPoint.Data["raw_weight"])
+		if !ok {
+			weight, _ = toFloat(dataPoint.Data["weight"])
+		}
+		e.DataPoints = append(e.DataPoints, scale.DataPoint{
+			TimeStamp: dataPoint.TimeStamp,
+			Unit:      fmt.Sprint(dataPoint.Data["unit"]),
+			Weight:    weight,
+		})
+		n, _ := toFloat(dataPoint.Data["dropped"])
+		dropped = append(dropped, int(n))
+	}
+	if e.Compression.Enabled() {
+		e.DataPoints = curve.Reconstruct(e.DataPoints, dropped)
+	}
+	if len(e.DataPoints) > 0 {
+		e.End = e.DataPoints[len(e.DataPoints)-1].TimeStamp
+	}
+
+	annotations, err := s.db.FetchDataPoints(s.dbName, AnnotationsMeasurement, filter)
+	if err != nil {
+		return e, fmt.Errorf("failed to retrieve brew annotations: %w", err)
+	}
+	for _, dataPoint := range annotations {
+		change, _ := toFloat(dataPoint.Data["change"])
+		e.Annotations = append(e.Annotations, brew.Annotation{
+			TimeStamp: dataPoint.TimeStamp,
+			Event:     brew.EventTypeFromString(dataPoint.Tags["event"]),
+			Change:    change,
+		})
+	}
+
+	return e, nil
+}
+
+// IDs retrieves the IDs of all brews started within the provided time range (a zero time
+// denoting no limit), ordered by their start
+func (s *Store) IDs(start, end time.Time) ([]string, error) {
+
+	summaries, err := s.db.FetchDataPoints(s.dbName, SummaryMeasurement, db.Filter{Start: start, End: end})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve brew summaries: %w", err)
+	}
+	sort.SliceStable(summaries, func(i, j int) bool {
+		return summaries[i].TimeStamp.Before(summaries[j].TimeStamp)
+	})
+
+	ids := make([]string, 0, len(summaries))
+	for _, summary := range summaries {
+		ids = append(ids, summary.Tags["id"])
+	}
+
+	return ids, nil
+}
+
+// Delete removes a brew (summary, data points and annotations)
+func (s *Store) Delete(id string) error {
+
+	filter := db.Filter{Tags: map[string]string{"id": id}}
+	for _, measurement := range []string{SummaryMeasurement, CurveMeasurement, AnnotationsMeasurement} {
+		if err := s.db.DeleteDataPoints(s.dbName, measurement, filter); err != nil {
+			return fmt.Errorf("failed to delete brew %s from measurement %s: %w", id, measurement, err)
+		}
+	}
+
+	return nil
+}
+
+// Replace replaces a set of stored brews by a set of new / corrected ones in a single
+// modification (backed up if a journal is set and restored on failure). The backup holds
+// the data points of the originals exactly as stored (e.g. of legacy brews)
+func (s *Store) Replace(originals []Entry, replacements []Entry) error {
+
+	changes := []backup.Change{
+		{Measurement: SummaryMeasurement},
+		{Measurement: CurveMeasurement},
+		{Measurement: AnnotationsMeasurement},
+	}
+	var before, after []string
+	for _, e := range originals {
+		filter := db.Filter{Tags: map[string]string{"id": e.ID}}
+		for i := range changes {
+			dataPoints, err := s.db.FetchDataPoints(s.dbName, changes[i].Measurement, filter)
+			if err != nil {
+				return fmt.Errorf("failed to retrieve brew %s from measurement %s: %w", e.ID, changes[i].Measurement, err)
+			}
+			changes[i].Before = append(changes[i].Before, dataPoints...)
+		}
+		before = append(before, e.ID)
+	}
+	for _, e := range replacements {
+		e = s.compress(e)
+		changes[0].After = append(changes[0].After, e.Summary())
+		changes[1].After = append(changes[1].After, e.Curve()...)
+		changes[2].After = append(changes[2].After, e.AnnotationDataPoints(e.Annotations...)...)
+		after = append(after, e.ID)
+	}
+
+	description := fmt.Sprintf("replace brew(s) %s", strings.Join(before, ", "))
+	if len(after) > 0 {
+		description += fmt.Sprintf(" with %s", strings.Join(after, ", "))
+	}
+
+	return s.journal.Apply(s.db, backup.Modification{
+		Description: description,
+		DB:          s.dbName,
+		Changes:     changes,
+	})
+}
+
+// SummaryVersionOf returns the schema version of a stored brew summary (see SummaryVersion)
+func SummaryVersionOf(summary db.DataPoint) int {
+	if version, ok := toFloat(summary.Data["schema_version"]); ok {
+		return int(version)
+	}
+	return 1
+}
+
+// Yield returns the net yield stated by a stored brew summary (legacy summaries stating the
+// raw end weight, compensated by the baseline weight if recorded). It matches the yield of
+// the brew as loaded from the store, legacy brews without baseline weight being taken as
+// tared (a baseline of zero) until corrected, e.g. via re-running the detection
+func Yield(summary db.DataPoint) (float64, bool) {
+	endWeight, ok := toFloat(summary.Data["end_weight"])
+	if !ok || SummaryVersionOf(summary) >= 2 {
+		return endWeight, ok
+	}
+	baseline, _ := toFloat(summary.Data["baseline_weight"])
+
+	return endWeight - baseline, true
+}
+
+// compress applies the compression of the store (if any) to a brew
+func (s *Store) compress(e Entry) Entry {
+	if s.compression.Enabled() {
+		e.Compression = s.compression
+	}
+	return e
+}
+
+// entryFromSummary parses a brew from its summary data point
+func entryFromSummary(summary db.DataPoint) (Entry, error) {
+
+	e := Entry{
+		Brew: &brew.Brew{
+			ID:       summary.Tags["id"],
+			Start:    summary.TimeStamp,
+			ShotType: brew.ShotTypeFromString(summary.Tags["shot_type"]),
+			Pack:     summary.Tags["pack"],
+		},
+		Tags:   make(map[string]string),
+		Fields: make(map[string]interface{}),
+	}
+	for k, v := range summary.Tags {
+		switch k {
+		case "id", "shot_type", "pack":
+		default:
+			e.Tags[k] = v
+		}
+	}
+
+	var err error
+	if e.Metadata, err = brew.MetadataFromFields(summary.Data); err != nil {
+		return e, err
+	}
+	e.Score = brew.ScoreFromFields(summary.Data)
+	for k, v := range summary.Data {
+		switch {
+		case k == "end":
+			if end, ok := toFloat(v); ok {
+				e.End = time.UnixMilli(int64(end))
+			}
+		case k == "baseline_weight":
+			e.Baseline, _ = toFloat(v)
+		case k == "beans_weight":
+			e.BeansWeight, _ = toFloat(v)
+		case k == "grind_setting":
+			e.GrindSetting, _ = toFloat(v)
+		case k == "unit_changed":
+			e.UnitChanged, _ = v.(bool)
+		case k == "pump_start":
+			if pumpStart, ok := toFloat(v); ok {
+				e.PumpStart = time.UnixMilli(int64(pumpStart))
+			}
+		case k == "pump_start_source":
+			e.PumpStartSource, _ = brew.PumpStartSourceFromString(fmt.Sprint(v))
+		case k == "curve_compression":
+			if e.Compression.Mode, err = curve.ModeFromString(fmt.Sprint(v)); err != nil {
+				return e, err
+			}
+		case k == "curve_tolerance":
+			e.Compression.Tolerance, _ = toFloat(v)
+		case brew.IsMetadataField(k), brew.IsScoreField(k):
+		default:
+			if _, isDerived := derivedFields[k]; !isDerived {
+				e.Fields[k] = v
+			}
+		}
+	}
+
+	return e, nil
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case int64:
+		return float64(t), true
+	case int:
+		return float64(t), true
+	case json.Number:
+		f, err := t.Float64()
+		return f, err == nil
+	}
+	return 0., false
+}
+
+func parseFloat(value string, dest *float64) error {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("invalid numeric value: %s", value)
+	}
+	*dest = f
+	return nil
+}
@@ -0,0 +1,273 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fako1024/brew"
+	"github.com/fako1024/brew/curve"
+	"github.com/fako1024/brew/db"
+	"github.com/fako1024/brew/db/backup"
+	"github.com/fako1024/brew/db/memory"
+	"github.com/fako1024/btscale/pkg/scale"
+)
+
+func TestStore(t *testing.T) {
+
+	start := time.Date(2020, 9, 23, 11, 0, 0, 0, time.Local)
+	b := &brew.Brew{
+		ID:              "test",
+		Start:           start,
+		End:             start.Add(2 * time.Second),
+		ShotType:        brew.SingleShot,
+		Baseline:        100.,
+		BeansWeight:     9.,
+		GrindSetting:    0.4,
+		Metadata:        brew.Metadata{Beans: "House Blend", WaterTemperature: 93.},
+		Score:           &brew.Score{Reference: "espresso", Score: 87.5, YieldError: -1.5, TimeError: 2 * time.Second},
+		UnitChanged:     true,
+		PumpStart:       start.Add(-3 * time.Second),
+		PumpStartSource: brew.PumpStartButton,
+		DataPoints: scale.DataPoints{
+			{TimeStamp: start, Weight: 100., Unit: "g"},
+			{TimeStamp: start.Add(time.Second), Weight: 110., Unit: "g"},
+			{TimeStamp: start.Add(2 * time.Second), Weight: 130., Unit: "g"},
+		},
+		Annotations: []brew.Annotation{
+			{TimeStamp: start.Add(time.Second), Event: brew.CupPlacedEvent, Change: 5.},
+		},
+	}
+
+	s := New(memory.New(), "brews")
+	if err := s.Save(Entry{Brew: b, Tags: map[string]string{"station": "home"}, Fields: map[string]interface{}{"battery_level": 0.8}}); err != nil {
+		t.Fatalf("Failed to save brew: %s", err)
+	}
+
+	e, err := s.Load("test")
+	if err != nil {
+		t.Fatalf("Failed to load brew: %s", err)
+	}
+	if e.Yield() != 30. || e.ShotType != brew.SingleShot || e.BeansWeight != 9. || e.Metadata.Beans != "House Blend" ||
+		len(e.DataPoints) != 3 || len(e.Annotations) != 1 || !e.End.Equal(b.End) ||
+		e.Tags["station"] != "home" || e.Fields["battery_level"] != 0.8 || e.Score == nil || *e.Score != *b.Score || !e.UnitChanged {
+		t.Fatalf("Unexpected loaded brew: %#v", e)
+	}
+	if summary := e.Summary(); !e.PumpStart.Equal(b.PumpStart) || e.PumpStartSource != brew.PumpStartButton || summary.Data["flow_time"] != 2. || summary.Data["pump_time"] != 5. {
+		t.Fatalf("Unexpected pump start / times of loaded brew: %v / %s (summary: %v)", e.PumpStart, e.PumpStartSource, summary.Data)
+	}
+
+	// Correct the brew and replace it
+	original, err := s.Load("test")
+	if err != nil {
+		t.Fatalf("Failed to load brew: %s", err)
+	}
+	for k, v := range map[string]string{"shot_type": "double", "water_temperature": "94", "battery_level": "0.9", "unit_changed": "false"} {
+		if err := e.SetField(k, v); err != nil {
+			t.Fatalf("Failed to set field %s: %s", k, err)
+		}
+	}
+	if err := e.SetField("end_weight", "42"); err == nil {
+		t.Fatalf("Expected error when setting derived field")
+	}
+	if err := e.SetField("pump_start", "0"); err == nil {
+		t.Fatalf("Expected error when setting start of the pump")
+	}
+	if err := e.SetField("score", "100"); err == nil {
+		t.Fatalf("Expected error when setting score")
+	}
+	if err := e.SetField("shot_type", "triple"); err == nil {
+		t.Fatalf("Expected error when setting invalid shot type")
+	}
+	e.ShotType = brew.DoubleShot
+	if err := s.Replace([]Entry{original}, []Entry{e}); err != nil {
+		t.Fatalf("Failed to replace brew: %s", err)
+	}
+	if e, err = s.Load("test"); err != nil || e.ShotType != brew.DoubleShot || e.Metadata.WaterTemperature != 94. || e.Fields["battery_level"] != 0.9 || e.UnitChanged {
+		t.Fatalf("Unexpected corrected brew: %#v (error: %v)", e, err)
+	}
+
+	if err := s.Delete("test"); err != nil {
+		t.Fatalf("Failed to delete brew: %s", err)
+	}
+	if _, err := s.Load("test"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Unexpected error for deleted brew: %v", err)
+	}
+}
+
+func TestCompression(t *testing.T) {
+
+	start := time.Date(2020, 9, 23, 11, 0, 0, 0, time.Local)
+	b := &brew.Brew{
+		ID:       "test",
+		Start:    start,
+		ShotType: brew.DoubleShot,
+		Baseline: 100.,
+	}
+	for i := 0; i <= 100; i++ {
+		weight := 100.
+		if i > 20 && i < 80 {
+			weight += float64(i-20) * 0.5
+		} else if i >= 80 {
+			weight += 30.
+		}
+		b.DataPoints = append(b.DataPoints, scale.DataPoint{TimeStamp: start.Add(time.Duration(i) * 200 * time.Millisecond), Weight: weight, Unit: "g"})
+	}
+	b.End = b.DataPoints[len(b.DataPoints)-1].TimeStamp
+
+	d := memory.New()
+	s := New(d, "brews", WithCompression(curve.Compression{Mode: curve.Lossless}))
+	if err := s.Save(Entry{Brew: b}); err != nil {
+		t.Fatalf("Failed to save brew: %s", err)
+	}
+	if stored, _ := d.FetchDataPoints("brews", CurveMeasurement, db.Filter{}); len(stored) != 4 {
+		t.Fatalf("Unexpected number of stored data points: %d", len(stored))
+	}
+
+	e, err := s.Load("test")
+	if err != nil {
+		t.Fatalf("Failed to load brew: %s", err)
+	}
+	if e.Compression.Mode != curve.Lossless || len(e.DataPoints) != len(b.DataPoints) || e.Yield() != 30. || !e.End.Equal(b.End) {
+		t.Fatalf("Unexpected loaded brew: %#v", e)
+	}
+	for i, dataPoint := range e.DataPoints {
+		if !dataPoint.TimeStamp.Equal(b.DataPoints[i].TimeStamp) || math.Abs(dataPoint.Weight-b.DataPoints[i].Weight) > 1e-9 {
+			t.Fatalf("Unexpected reconstructed data point %d: %v (want %v)", i, dataPoint, b.DataPoints[i])
+		}
+	}
+	if err := e.SetField("curve_compression", "none"); err == nil {
+		t.Fatalf("Expected error when setting compression")
+	}
+
+	// Brews loaded from a store without compression retain the one they were stored with
+	corrected := e
+	corrected.Brew = &brew.Brew{}
+	*corrected.Brew = *e.Brew
+	corrected.ShotType = brew.SingleShot
+	if err := New(d, "brews").Replace([]Entry{e}, []Entry{corrected}); err != nil {
+		t.Fatalf("Failed to replace brew: %s", err)
+	}
+	if stored, _ := d.FetchDataPoints("brews", CurveMeasurement, db.Filter{}); len(stored) != 4 || stored[0].Tags["shot_type"] != "single" {
+		t.Fatalf("Unexpected stored data points after replacement: %v", stored)
+	}
+}
+
+func TestLegacySummary(t *testing.T) {
+
+	// Legacy brews (summary version 1) state raw weights, including the untared cup
+	start := time.Date(2020, 9, 23, 11, 0, 0, 0, time.Local)
+	tags := map[string]string{"id": "legacy"}
+	d := memory.New()
+	if err := d.EmitDataPoints("brews", SummaryMeasurement, db.DataPoints{{
+		TimeStamp: start,
+		Tags:      tags,
+		Data:      map[string]interface{}{"start": start.UnixMilli(), "end": start.Add(time.Second).UnixMilli(), "end_weight": 130., "shot_type": "single"},
+	}}); err != nil {
+		t.Fatalf("Failed to emit legacy summary: %s", err)
+	}
+	if err := d.EmitDataPoints("brews", CurveMeasurement, db.DataPoints{
+		{TimeStamp: start, Tags: tags, Data: map[string]interface{}{"weight": 100., "unit": "g"}},
+		{TimeStamp: start.Add(time.Second), Tags: tags, Data: map[string]interface{}{"weight": 130., "unit": "g"}},
+	}); err != nil {
+		t.Fatalf("Failed to emit legacy curve: %s", err)
+	}
+
+	e, err := New(d, "brews").Load("legacy")
+	if err != nil {
+		t.Fatalf("Failed to load legacy brew: %s", err)
+	}
+	if e.Baseline != 0. || e.Yield() != 130. {
+		t.Fatalf("Unexpected baseline / yield of legacy brew: %v / %v", e.Baseline, e.Yield())
+	}
+
+	summaries, err := d.FetchDataPoints("brews", SummaryMeasurement, db.Filter{Tags: tags})
+	if err != nil || len(summaries) != 1 {
+		t.Fatalf("Failed to fetch legacy summary: %v (%d summaries)", err, len(summaries))
+	}
+	if version := SummaryVersionOf(summaries[0]); version != 1 {
+		t.Fatalf("Unexpected version of legacy summary: %d", version)
+	}
+	if yield, ok := Yield(summaries[0]); !ok || yield != e.Yield() {
+		t.Fatalf("Unexpected yield of legacy summary without baseline: %v (loaded: %v)", yield, e.Yield())
+	}
+
+	// With baseline weight, the yields of the summary and of the loaded brew are net yields
+	summaries[0].Data["baseline_weight"] = 100.
+	if err := d.EmitDataPoints("brews", SummaryMeasurement, summaries); err != nil {
+		t.Fatalf("Failed to emit legacy summary: %s", err)
+	}
+	if e, err = New(d, "brews").Load("legacy"); err != nil {
+		t.Fatalf("Failed to load legacy brew: %s", err)
+	}
+	if yield, ok := Yield(summaries[0]); !ok || yield != 30. || e.Yield() != 30. {
+		t.Fatalf("Unexpected yield of legacy summary: %v (loaded: %v)", yield, e.Yield())
+	}
+	if summary := e.Summary(); SummaryVersionOf(summary) != SummaryVersion || summary.Data["end_weight"] != 30. {
+		t.Fatalf("Unexpected summary of migrated brew: %v", summary.Data)
+	}
+}
+
+func TestReplaceUndoLegacy(t *testing.T) {
+
+	// Hand-written legacy data points (which the store would not generate as is)
+	start := time.Date(2020, 9, 23, 11, 0, 0, 0, time.UTC)
+	tags := map[string]string{"id": "legacy", "shot_type": "single"}
+	legacy := map[string]db.DataPoints{
+		SummaryMeasurement: {
+			{TimeStamp: start, Tags: tags, Data: map[string]interface{}{"start": start.Unix() * 1000, "end": start.Add(2*time.Second).Unix() * 1000, "end_weight": 130., "beans": "Old Blend"}},
+		},
+		CurveMeasurement: {
+			{TimeStamp: start, Tags: tags, Data: map[string]interface{}{"weight": 100., "unit": "g"}},
+			{TimeStamp: start.Add(time.Second), Tags: tags, Data: map[string]interface{}{"weight": 110.5, "unit": "g"}},
+			{TimeStamp: start.Add(2 * time.Second), Tags: tags, Data: map[string]interface{}{"weight": 130., "unit": "g"}},
+		},
+		AnnotationsMeasurement: {
+			{TimeStamp: start.Add(time.Second), Tags: map[string]string{"id": "legacy", "event": "cup_placed"}, Data: map[string]interface{}{"change": 5.}},
+		},
+	}
+
+	d := memory.New()
+	for measurement, dataPoints := range legacy {
+		if err := d.EmitDataPoints("brews", measurement, dataPoints); err != nil {
+			t.Fatalf("Failed to emit legacy data points: %s", err)
+		}
+	}
+
+	journal := backup.New(t.TempDir())
+	s := New(d, "brews", WithJournal(journal))
+	original, err := s.Load("legacy")
+	if err != nil {
+		t.Fatalf("Failed to load legacy brew: %s", err)
+	}
+	corrected, err := s.Load("legacy")
+	if err != nil {
+		t.Fatalf("Failed to load legacy brew: %s", err)
+	}
+	if err := corrected.SetField("shot_type", "double"); err != nil {
+		t.Fatalf("Failed to set shot type: %s", err)
+	}
+	if err := s.Replace([]Entry{original}, []Entry{corrected}); err != nil {
+		t.Fatalf("Failed to replace legacy brew: %s", err)
+	}
+	if _, err := journal.Undo(d, 1); err != nil {
+		t.Fatalf("Failed to undo replacement: %s", err)
+	}
+
+	for measurement, expected := range legacy {
+		restored, err := d.FetchDataPoints("brews", measurement, db.Filter{Tags: map[string]string{"id": "legacy"}})
+		if err != nil {
+			t.Fatalf("Failed to fetch restored data points: %s", err)
+		}
+		if len(restored) != len(expected) {
+			t.Fatalf("Unexpected number of restored data points in measurement %s: %d (want %d)", measurement, len(restored), len(expected))
+		}
+		for i := range expected {
+			if !restored[i].TimeStamp.Equal(expected[i].TimeStamp) || !reflect.DeepEqual(restored[i].Tags, expected[i].Tags) || !reflect.DeepEqual(restored[i].Data, expected[i].Data) {
+				t.Fatalf("Unexpected restored data point in measurement %s: %v (want %v)", measurement, restored[i], expected[i])
+			}
+		}
+	}
+}
@@ -52,4 +52,118 @@ type Brew struct {
 	End        time.Time        // End of the brewing process
 	DataPoints scale.DataPoints // Data points collected as part of the brewing process
 	ShotType   ShotType         // Type of brew (single / double / unknown)
+
+	Baseline    float64      // Weight on the scale before the start of the flow (e.g. an untared cup)
+	Annotations []Annotation // Events (tare, cup placement / removal) associated with the brew
+	Metadata    Metadata     // Information about the setup used for the brew (beans, grinder, recipe, ...)
+	Pack        string       // ID of the pack of beans used for the brew (if tracked)
+
+	BeansWeight  float64 // Weight of the beans / grounds used for the brew
+	GrindSetting float64 // Relative grinder setting used for the brew (0.0: finest, 1.0: coarsest)
+
+	Score *Score // Quality of the brew compared to the reference curve of its recipe (if any)
+
+	UnitChanged bool // The unit reported by the scale changed during the brew (weights being normalized regardless)
+
+	PumpStart       time.Time       // Start of the pump, i.e. the start of the shot timer of a barista (zero if unknown)
+	PumpStartSource PumpStartSource // Source the start of the pump was determined from
+}
+
+// PumpStartSource denotes how the start of the pump of a brew was determined
+type PumpStartSource string
+
+const (
+
+	// PumpStartAPI denotes the start of the pump being signaled manually via the control API
+	PumpStartAPI PumpStartSource = "api"
+
+	// PumpStartButton denotes the start of the pump being signaled by pressing the button of
+	// the scale (if reported by the scale)
+	PumpStartButton PumpStartSource = "button"
+
+	// PumpStartOffset denotes the start of the pump being estimated from the (learned) offset
+	// between the start of the pump and the first drop
+	PumpStartOffset PumpStartSource = "offset"
+)
+
+// PumpStartSourceFromString allows to generate a PumpStartSource from a string (returning
+// false for unknown sources)
+func PumpStartSourceFromString(source string) (PumpStartSource, bool) {
+	switch s := PumpStartSource(source); s {
+	case PumpStartAPI, PumpStartButton, PumpStartOffset:
+		return s, true
+	}
+	return "", false
+}
+
+// String returns a string representation of the pump start source
+func (s PumpStartSource) String() string {
+	return string(s)
+}
+
+// Metadata denotes information about the setup used for a brew
+type Metadata struct {
+	Setup            string    // Name of the setup the metadata was sourced from
+	Beans            string    // Name of the beans / blend
+	Roaster          string    // Roaster of the beans
+	RoastDate        time.Time // Roast date of the beans
+	Grinder          string    // Grinder model
+	GrinderSetting   string    // Absolute grinder setting in the notation of the grinder (e.g. "3B")
+	Basket           string    // Basket used for the brew
+	WaterTemperature float64   // Brew water temperature (in °C)
+	Recipe           string    // Name of the recipe
+}
+
+// EventType denotes the type of an event detected on the scale (e.g. a tare)
+type EventType int
+
+const (
+
+	// UnknownEvent denotes an invalid / unknown event type
+	UnknownEvent EventType = iota
+
+	// TareEvent denotes the scale being tared (weight abruptly reset to zero)
+	TareEvent
+
+	// CupPlacedEvent denotes a cup being placed on the scale (positive step
+	// without flow)
+	CupPlacedEvent
+
+	// CupRemovedEvent denotes a cup being removed from the scale (negative step)
+	CupRemovedEvent
+)
+
+// EventTypeFromString allows to generate an EventType from a string
+func EventTypeFromString(t string) EventType {
+	switch t {
+	case "tare":
+		return TareEvent
+	case "cup_placed":
+		return CupPlacedEvent
+	case "cup_removed":
+		return CupRemovedEvent
+	default:
+		return UnknownEvent
+	}
+}
+
+// String returns a string representation of the event type
+func (t EventType) String() string {
+	switch t {
+	case TareEvent:
+		return "tare"
+	case CupPlacedEvent:
+		return "cup_placed"
+	case CupRemovedEvent:
+		return "cup_removed"
+	default:
+		return "unknown"
+	}
+}
+
+// Annotation denotes an event detected before, during or after a brew
+type Annotation struct {
+	TimeStamp time.Time // Time of the event
+	Event     EventType // Type of event
+	Change    float64   // Change of weight caused by the event
 }
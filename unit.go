@@ -0,0 +1,63 @@
+package brew
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Unit denotes the unit of a weight
+type Unit string
+
+const (
+
+	// Gram denotes weights in grams
+	Gram Unit = "g"
+
+	// Ounce denotes weights in (avoirdupois) ounces
+	Ounce Unit = "oz"
+
+	// CanonicalUnit denotes the unit all weights are normalized to prior to detection /
+	// classification and stored in
+	CanonicalUnit = Gram
+)
+
+// grams denotes the weight of one unit in grams
+var grams = map[Unit]float64{
+	Gram:  1.,
+	Ounce: 28.349523125,
+}
+
+// UnitFromString parses a unit (accepting common spellings, an empty string denoting the
+// canonical unit)
+func UnitFromString(unit string) (Unit, error) {
+	switch strings.ToLower(strings.TrimSpace(unit)) {
+	case "", "g", "gr", "gram", "grams":
+		return Gram, nil
+	case "oz", "ounce", "ounces":
+		return Ounce, nil
+	}
+	return "", fmt.Errorf("unsupported weight unit %q (supported: g, oz)", unit)
+}
+
+// String returns a string representation of the unit
+func (u Unit) String() string {
+	return string(u)
+}
+
+// Convert converts a weight in this unit to another unit
+func (u Unit) Convert(weight float64, to Unit) float64 {
+	if u == to {
+		return weight
+	}
+	return weight * grams[u] / grams[to]
+}
+
+// ToCanonical converts a weight in this unit to the canonical unit
+func (u Unit) ToCanonical(weight float64) float64 {
+	return u.Convert(weight, CanonicalUnit)
+}
+
+// FromCanonical converts a weight in the canonical unit to this unit
+func (u Unit) FromCanonical(weight float64) float64 {
+	return CanonicalUnit.Convert(weight, u)
+}
@@ -0,0 +1,28 @@
+package brew
+
+import (
+	"math"
+	"testing"
+)
+
+func TestUnit(t *testing.T) {
+
+	for input, expected := range map[string]Unit{"": Gram, "g": Gram, "Grams": Gram, "oz": Ounce, " ounces ": Ounce} {
+		if unit, err := UnitFromString(input); err != nil || unit != expected {
+			t.Fatalf("Unexpected unit for %q: %s (error: %v)", input, unit, err)
+		}
+	}
+	if _, err := UnitFromString("ml"); err == nil {
+		t.Fatalf("Expected error for unsupported unit")
+	}
+
+	if w := Ounce.ToCanonical(1.); math.Abs(w-28.349523125) > 1e-9 {
+		t.Fatalf("Unexpected weight of one ounce: %v", w)
+	}
+	if w := Ounce.FromCanonical(Ounce.ToCanonical(1.25)); math.Abs(w-1.25) > 1e-9 {
+		t.Fatalf("Unexpected weight after round trip: %v", w)
+	}
+	if w := Gram.Convert(36., Gram); w != 36. {
+		t.Fatalf("Unexpected weight after identity conversion: %v", w)
+	}
+}